@@ -13,7 +13,7 @@ import (
 
 func main() {
 	// Set up logging to file for debugging
-	logFile, err := os.OpenFile("concord-client.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	logFile, err := os.OpenFile("concord-client.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
 	if err == nil {
 		log.SetOutput(logFile)
 		defer logFile.Close()
@@ -23,6 +23,7 @@ func main() {
 	}
 
 	// Parse command line flags
+	noSavePassword := flag.Bool("no-save-password", false, "Don't store the identity password; reconnect with saved tokens only")
 	flag.Parse()
 
 	// Print banner
@@ -33,6 +34,13 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to create config manager: %v", err)
 	}
+	configMgr.SetSavePassword(!*noSavePassword)
+
+	// Saved passwords and tokens can only be read once the vault is unlocked
+	if err := unlockCredentials(configMgr); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not unlock saved credentials: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Load servers configuration
 	serversConfig, err := configMgr.LoadServers()
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/concord-chat/concord/internal/client"
+)
+
+// Shortest passphrase accepted when setting one up
+const minPassphraseLength = 8
+
+// Wrong passphrases allowed before giving up
+const maxUnlockAttempts = 3
+
+// passphraseEnv supplies the passphrase without a prompt, for launches where
+// stdin isn't a terminal
+const passphraseEnv = "CONCORD_PASSPHRASE"
+
+// unlockCredentials asks for the passphrase that protects saved passwords and
+// tokens, or has the user choose one on first run. A passphrase in
+// CONCORD_PASSPHRASE is used instead of prompting.
+func unlockCredentials(configMgr *client.ConfigManager) error {
+	if passphrase, ok := os.LookupEnv(passphraseEnv); ok {
+		// Keep it out of the environment of anything started later
+		os.Unsetenv(passphraseEnv)
+		return unlockWith(configMgr, passphrase)
+	}
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		return fmt.Errorf("a terminal is needed to enter the passphrase; set %s to run without one", passphraseEnv)
+	}
+
+	if !configMgr.HasVault() {
+		fmt.Println("Saved passwords and tokens are encrypted with a passphrase.")
+		for {
+			passphrase, err := readPassphrase("Choose a passphrase: ")
+			if err != nil {
+				return err
+			}
+			if len(passphrase) < minPassphraseLength {
+				fmt.Printf("Use at least %d characters.\n", minPassphraseLength)
+				continue
+			}
+			confirm, err := readPassphrase("Confirm passphrase: ")
+			if err != nil {
+				return err
+			}
+			if confirm != passphrase {
+				fmt.Println("Passphrases do not match.")
+				continue
+			}
+			return configMgr.CreateVault(passphrase)
+		}
+	}
+
+	for attempt := 1; attempt <= maxUnlockAttempts; attempt++ {
+		passphrase, err := readPassphrase("Passphrase: ")
+		if err != nil {
+			return err
+		}
+		err = configMgr.Unlock(passphrase)
+		if !errors.Is(err, client.ErrWrongPassphrase) {
+			return err
+		}
+		fmt.Println("Wrong passphrase.")
+	}
+	return errors.New("too many wrong passphrases (to start over, delete the \"vault\" entry " +
+		"from ~/.concord/config.json; saved passwords and tokens will be lost)")
+}
+
+// unlockWith unlocks the vault with passphrase, or sets the vault up with it
+// on first run, without prompting
+func unlockWith(configMgr *client.ConfigManager, passphrase string) error {
+	if !configMgr.HasVault() {
+		if len(passphrase) < minPassphraseLength {
+			return fmt.Errorf("%s must be at least %d characters", passphraseEnv, minPassphraseLength)
+		}
+		return configMgr.CreateVault(passphrase)
+	}
+	if err := configMgr.Unlock(passphrase); err != nil {
+		return fmt.Errorf("%s: %w", passphraseEnv, err)
+	}
+	return nil
+}
+
+// readPassphrase prompts on stdout and reads a line from the terminal without echo
+func readPassphrase(prompt string) (string, error) {
+	fmt.Print(prompt)
+	passphrase, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return string(passphrase), nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/concord-chat/concord/internal/client"
+)
+
+func TestUnlockFromEnv(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	configMgr, err := client.NewConfigManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// First run: the passphrase sets up the vault, if it's long enough
+	t.Setenv(passphraseEnv, "short")
+	if err := unlockCredentials(configMgr); err == nil || configMgr.HasVault() {
+		t.Fatalf("short passphrase set up a vault: %v", err)
+	}
+	t.Setenv(passphraseEnv, "correct horse")
+	if err := unlockCredentials(configMgr); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	if !configMgr.HasVault() {
+		t.Fatal("no vault after setup")
+	}
+
+	tests := []struct {
+		name       string
+		passphrase string
+		want       error
+	}{
+		{"right passphrase", "correct horse", nil},
+		{"wrong passphrase", "wrong horse", client.ErrWrongPassphrase},
+	}
+	for _, tt := range tests {
+		t.Setenv(passphraseEnv, tt.passphrase)
+		if err := unlockCredentials(configMgr); !errors.Is(err, tt.want) {
+			t.Errorf("%s: unlock = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
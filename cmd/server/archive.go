@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/concord-chat/concord/internal/database"
+	"github.com/concord-chat/concord/internal/server"
+)
+
+const (
+	exportUsage = "usage: concord-server export [--out file] [--server id|name | --user email]"
+	importUsage = "usage: concord-server import <archive-file>"
+)
+
+// runExport implements the export subcommand. By default it archives every
+// server and DM conversation; --server limits it to one server and --user
+// writes a single user's data for a compliance request.
+func runExport(config *server.Config, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	out := fs.String("out", "", "File to write the archive to (- for stdout)")
+	serverRef := fs.String("server", "", "Export only this server (ID or name)")
+	email := fs.String("user", "", "Export one user's data (by email)")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return errors.New(exportUsage)
+	}
+	if *serverRef != "" && *email != "" {
+		return errors.New("--server and --user can't be combined")
+	}
+
+	db, err := database.Open(config.DatabaseSource())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var archive *database.Archive
+	switch {
+	case *email != "":
+		user, _, err := db.GetUserByEmail(*email)
+		if err != nil {
+			return fmt.Errorf("no user with email %s", *email)
+		}
+		archive, err = db.ExportUser(user.ID)
+		if err != nil {
+			return err
+		}
+	case *serverRef != "":
+		serverID, err := db.LookupServer(*serverRef)
+		if err != nil {
+			return err
+		}
+		if archive, err = db.Export(serverID); err != nil {
+			return err
+		}
+	default:
+		if archive, err = db.Export(uuid.Nil); err != nil {
+			return err
+		}
+	}
+
+	if *out == "" {
+		*out = "concord-export-" + time.Now().Format("20060102-150405") + ".json"
+	}
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		// Archives hold password hashes and private messages
+		f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(archive); err != nil {
+		return err
+	}
+	if *out != "-" {
+		fmt.Fprintf(os.Stderr, "Exported %d users and %d servers to %s\n", len(archive.Users), len(archive.Servers), *out)
+	}
+	return nil
+}
+
+// runImport implements the import subcommand. The target database must be
+// empty; it is created and migrated if it doesn't exist yet.
+func runImport(config *server.Config, args []string) error {
+	if len(args) != 1 {
+		return errors.New(importUsage)
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var archive database.Archive
+	if err := json.NewDecoder(f).Decode(&archive); err != nil {
+		return fmt.Errorf("%s: not a valid archive: %w", args[0], err)
+	}
+
+	db, err := database.New(config.DatabaseSource())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Import(&archive)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d users, %d servers, %d channels and %d messages\n",
+		result.Users, result.Servers, result.Channels, result.Messages)
+	return nil
+}
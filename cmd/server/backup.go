@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/concord-chat/concord/internal/database"
+	"github.com/concord-chat/concord/internal/server"
+)
+
+const (
+	backupUsage  = "usage: concord-server backup [--out file]"
+	restoreUsage = "usage: concord-server restore <backup-file>"
+)
+
+// runBackup implements the backup subcommand. It is safe to run while the
+// server is up. Without --out the backup goes to the configured backup
+// directory and the retention limit is applied.
+func runBackup(config *server.Config, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	out := fs.String("out", "", "File to write the backup to")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return errors.New(backupUsage)
+	}
+
+	db, err := database.Open(config.DatabaseSource())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if *out != "" {
+		if err := db.Backup(*out); err != nil {
+			return err
+		}
+		fmt.Printf("Backup written to %s\n", *out)
+		return nil
+	}
+
+	path, size, err := server.NewBackups(db, config.Backup).Run()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backup written to %s (%d bytes)\n", path, size)
+	return nil
+}
+
+// runRestore implements the restore subcommand. The server must be stopped.
+func runRestore(config *server.Config, args []string) error {
+	if len(args) != 1 {
+		return errors.New(restoreUsage)
+	}
+	if config.DatabaseURL != "" {
+		return errors.New("restore is only supported for SQLite; use pg_restore for PostgreSQL")
+	}
+
+	version, err := database.CheckBackup(args[0])
+	if err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	kept, err := database.Restore(args[0], config.DatabasePath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Restored %s to %s (schema version %d)\n", args[0], config.DatabasePath, version)
+	if kept != "" {
+		fmt.Printf("Previous database kept at %s\n", kept)
+	}
+	if version < database.LatestVersion() {
+		fmt.Printf("Pending migrations to version %d will be applied when the server starts\n", database.LatestVersion())
+	}
+	return nil
+}
@@ -16,10 +16,36 @@ func main() {
 	configPath := flag.String("config", "", "Path to configuration file")
 	host := flag.String("host", "", "Host to bind to (overrides config)")
 	port := flag.Int("port", 0, "Port to bind to (overrides config)")
-	dbPath := flag.String("db", "", "Path to database file (overrides config)")
+	dbPath := flag.String("db", "", "SQLite database file or postgres:// URL (overrides config)")
 	adminEmail := flag.String("admin-email", "", "Grant admin role to this email on startup")
 	flag.Parse()
 
+	// Maintenance subcommands run against the database without starting the server
+	switch cmd := flag.Arg(0); cmd {
+	case "migrate", "backup", "restore", "export", "import":
+		config := readConfig(*configPath)
+		if *dbPath != "" {
+			config.DatabasePath, config.DatabaseURL = *dbPath, ""
+		}
+		var err error
+		switch cmd {
+		case "migrate":
+			err = runMigrate(config.DatabaseSource(), flag.Args()[1:])
+		case "backup":
+			err = runBackup(config, flag.Args()[1:])
+		case "restore":
+			err = runRestore(config, flag.Args()[1:])
+		case "export":
+			err = runExport(config, flag.Args()[1:])
+		case "import":
+			err = runImport(config, flag.Args()[1:])
+		}
+		if err != nil {
+			log.Fatalf("%s: %v", cmd, err)
+		}
+		return
+	}
+
 	// Detect first-run: no config file specified and default config file absent
 	isFirstRun := *configPath == ""
 	if isFirstRun {
@@ -33,16 +59,7 @@ func main() {
 	if isFirstRun {
 		config = runFirstRunSetup()
 	} else {
-		config = server.DefaultConfig()
-		if *configPath != "" {
-			if err := loadConfig(*configPath, config); err != nil {
-				log.Fatalf("Failed to load config: %v", err)
-			}
-		} else if _, err := os.Stat(configFilename); err == nil {
-			if err := loadConfig(configFilename, config); err != nil {
-				log.Fatalf("Failed to load config: %v", err)
-			}
-		}
+		config = readConfig(*configPath)
 	}
 
 	// Apply command line overrides
@@ -53,7 +70,7 @@ func main() {
 		config.Port = *port
 	}
 	if *dbPath != "" {
-		config.DatabasePath = *dbPath
+		config.DatabasePath, config.DatabaseURL = *dbPath, ""
 	}
 
 	// Print banner
@@ -61,7 +78,7 @@ func main() {
 
 	// Handle --admin-email: open DB, grant role, close, then start normally
 	if *adminEmail != "" {
-		db, err := database.New(config.DatabasePath)
+		db, err := database.New(config.DatabaseSource())
 		if err != nil {
 			log.Fatalf("Failed to open database for admin-email: %v", err)
 		}
@@ -83,6 +100,21 @@ func main() {
 	}
 }
 
+// readConfig loads configPath, or the default config file if present, over the defaults
+func readConfig(configPath string) *server.Config {
+	config := server.DefaultConfig()
+	if configPath != "" {
+		if err := loadConfig(configPath, config); err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+	} else if _, err := os.Stat(configFilename); err == nil {
+		if err := loadConfig(configFilename, config); err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+	}
+	return config
+}
+
 func loadConfig(path string, config *server.Config) error {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/concord-chat/concord/internal/database"
+)
+
+const migrateUsage = "usage: concord-server migrate status | up [version] | down [version]"
+
+// runMigrate implements the migrate subcommand against the database at source,
+// an SQLite file path or a postgres:// URL
+func runMigrate(source string, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New(migrateUsage)
+	}
+	target := -1
+	if len(args) == 2 {
+		v, err := strconv.Atoi(args[1])
+		if err != nil || v < 0 {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		target = v
+	}
+
+	db, err := database.Open(source)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "status":
+		if target >= 0 {
+			return errors.New(migrateUsage)
+		}
+		return printMigrationStatus(db, source)
+
+	case "up":
+		if target < 0 {
+			target = 0 // latest
+		}
+		applied, err := db.MigrateUp(target)
+		for _, m := range applied {
+			fmt.Printf("Applied   %3d %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("Schema is up to date")
+		}
+
+	case "down":
+		// Without a version, revert only the most recent migration
+		if target < 0 {
+			current, err := db.SchemaVersion()
+			if err != nil {
+				return err
+			}
+			if current == 0 {
+				fmt.Println("No migrations to revert")
+				return nil
+			}
+			target = previousVersion(db, current)
+		}
+		reverted, err := db.MigrateDown(target)
+		for _, m := range reverted {
+			fmt.Printf("Reverted  %3d %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Schema version is now %d\n", version)
+	return nil
+}
+
+// previousVersion returns the applied migration just below current, or 0
+func previousVersion(db *database.DB, current int) int {
+	status, err := db.MigrationStatus()
+	if err != nil {
+		return current - 1
+	}
+	prev := 0
+	for _, s := range status {
+		if s.AppliedAt != nil && s.Version < current && s.Version > prev {
+			prev = s.Version
+		}
+	}
+	return prev
+}
+
+// printMigrationStatus lists applied and pending migrations
+func printMigrationStatus(db *database.DB, source string) error {
+	status, err := db.MigrationStatus()
+	if err != nil {
+		return err
+	}
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	// Never echo a database password
+	if u, err := url.Parse(source); err == nil && strings.HasPrefix(u.Scheme, "postgres") {
+		source = u.Redacted()
+	}
+	fmt.Printf("Database:       %s\n", source)
+	fmt.Printf("Schema version: %d (this binary supports %d)\n\n", version, database.LatestVersion())
+	for _, s := range status {
+		state := "pending"
+		if s.AppliedAt != nil {
+			state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("  %3d  %-20s %s\n", s.Version, s.Name, state)
+	}
+	if version > database.LatestVersion() {
+		fmt.Printf("\nThe database is newer than this binary; upgrade concord-server before starting it.\n")
+	}
+	return nil
+}
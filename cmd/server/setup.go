@@ -26,9 +26,18 @@ const (
 	fieldHost
 	fieldPort
 	fieldDB
+	fieldTLSCert
+	fieldTLSKey
+	fieldSelfSigned
 	numFields
 )
 
+// Where a self-signed certificate is written when no paths are given
+const (
+	defaultCertFile = "concord-cert.pem"
+	defaultKeyFile  = "concord-key.pem"
+)
+
 func newSetupModel() setupModel {
 	hostname, _ := os.Hostname()
 
@@ -55,6 +64,19 @@ func newSetupModel() setupModel {
 	inputs[fieldDB].SetValue("concord.db")
 	inputs[fieldDB].CharLimit = 128
 
+	inputs[fieldTLSCert] = textinput.New()
+	inputs[fieldTLSCert].Placeholder = "blank for plain ws://"
+	inputs[fieldTLSCert].CharLimit = 256
+
+	inputs[fieldTLSKey] = textinput.New()
+	inputs[fieldTLSKey].Placeholder = "blank for plain ws://"
+	inputs[fieldTLSKey].CharLimit = 256
+
+	inputs[fieldSelfSigned] = textinput.New()
+	inputs[fieldSelfSigned].Placeholder = "y/n"
+	inputs[fieldSelfSigned].SetValue("n")
+	inputs[fieldSelfSigned].CharLimit = 3
+
 	return setupModel{inputs: inputs}
 }
 
@@ -78,6 +100,16 @@ func (m setupModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.err = "Port must be a number."
 					return m, nil
 				}
+				cert := strings.TrimSpace(m.inputs[fieldTLSCert].Value())
+				key := strings.TrimSpace(m.inputs[fieldTLSKey].Value())
+				if (cert == "") != (key == "") {
+					m.err = "Set both the TLS certificate and key, or neither."
+					return m, nil
+				}
+				if _, ok := parseYesNo(m.inputs[fieldSelfSigned].Value()); !ok {
+					m.err = "Self-signed must be y or n."
+					return m, nil
+				}
 				m.done = true
 				return m, tea.Quit
 			}
@@ -116,7 +148,8 @@ func (m setupModel) View() string {
 	b.WriteString(hintStyle.Render("Tab/↑↓ to navigate · Enter on last field to confirm · Esc to cancel"))
 	b.WriteString("\n\n")
 
-	labels := []string{"Server Name", "Bind Host", "Port", "Database Path"}
+	labels := []string{"Server Name", "Bind Host", "Port", "Database Path",
+		"TLS Certificate (PEM)", "TLS Key (PEM)", "Generate Self-Signed Certificate (y/n)"}
 	for i, label := range labels {
 		b.WriteString(labelStyle.Render(label))
 		b.WriteString("\n")
@@ -156,12 +189,31 @@ func runFirstRunSetup() *server.Config {
 		port = 8080
 	}
 
-	cfg := &server.Config{
-		Host:           strings.TrimSpace(final.inputs[fieldHost].Value()),
-		Port:           port,
-		DatabasePath:   strings.TrimSpace(final.inputs[fieldDB].Value()),
-		MaxConnections: 1000,
-		Debug:          false,
+	// Start from the defaults so the written file carries every setting
+	cfg := server.DefaultConfig()
+	cfg.Host = strings.TrimSpace(final.inputs[fieldHost].Value())
+	cfg.Port = port
+	cfg.DatabasePath = strings.TrimSpace(final.inputs[fieldDB].Value())
+	cfg.TLSCert = strings.TrimSpace(final.inputs[fieldTLSCert].Value())
+	cfg.TLSKey = strings.TrimSpace(final.inputs[fieldTLSKey].Value())
+
+	// Generate a self-signed certificate unless one already exists at the given paths
+	if selfSigned, _ := parseYesNo(final.inputs[fieldSelfSigned].Value()); selfSigned {
+		if cfg.TLSCert == "" {
+			cfg.TLSCert, cfg.TLSKey = defaultCertFile, defaultKeyFile
+		}
+		if _, err := os.Stat(cfg.TLSCert); err == nil {
+			fmt.Printf("\nUsing existing certificate %s\n", cfg.TLSCert)
+		} else {
+			fingerprint, err := server.GenerateSelfSignedCert(cfg.TLSCert, cfg.TLSKey, certHosts(cfg.Host))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to generate certificate: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("\nSelf-signed certificate written to %s and %s\n", cfg.TLSCert, cfg.TLSKey)
+			fmt.Printf("Fingerprint (SHA-256): %s\n", fingerprint)
+			fmt.Println("Clients pin this on first connect; share it so users can check it.")
+		}
 	}
 
 	// Write config file
@@ -174,3 +226,27 @@ func runFirstRunSetup() *server.Config {
 	fmt.Printf("Share this address: %s:%d\n\n", cfg.Host, cfg.Port)
 	return cfg
 }
+
+// parseYesNo reads a y/n answer; blank means no
+func parseYesNo(s string) (yes, ok bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "y", "yes":
+		return true, true
+	case "", "n", "no":
+		return false, true
+	}
+	return false, false
+}
+
+// certHosts lists the names a self-signed certificate should cover: the
+// bind host when it is specific, this machine's hostname, and loopback
+func certHosts(bindHost string) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		hosts = append(hosts, hostname)
+	}
+	if bindHost != "" && bindHost != "0.0.0.0" && bindHost != "::" && bindHost != "localhost" {
+		hosts = append(hosts, bindHost)
+	}
+	return hosts
+}
@@ -30,6 +30,11 @@ func (a *App) initAddServerForm() {
 	a.addServerPort.Width = 50
 	a.addServerPort.SetValue("8080") // Default port
 
+	a.addServerInvite = textinput.New()
+	a.addServerInvite.Placeholder = "optional, used when creating an account"
+	a.addServerInvite.CharLimit = 32
+	a.addServerInvite.Width = 50
+
 	a.addServerUseTLS = false
 	a.addServerFocus = 0
 	a.addServerError = ""
@@ -39,7 +44,7 @@ func (a *App) initAddServerForm() {
 func (a *App) renderAddServerView() string {
 	// Calculate dialog dimensions
 	dialogWidth := 60
-	dialogHeight := 18
+	dialogHeight := 21
 
 	// Center the dialog
 	leftPadding := (a.width - dialogWidth) / 2
@@ -107,6 +112,12 @@ func (a *App) renderAddServerView() string {
 	content.WriteString(fieldContainerStyle.Render(a.addServerPort.View()))
 	content.WriteString("\n\n")
 
+	// Invite Code
+	content.WriteString(labelStyle.Render("Invite Code:"))
+	content.WriteString("\n")
+	content.WriteString(fieldContainerStyle.Render(a.addServerInvite.View()))
+	content.WriteString("\n\n")
+
 	// Use TLS toggle
 	content.WriteString(labelStyle.Render("Use TLS (WSS):"))
 	content.WriteString("\n")
@@ -118,7 +129,7 @@ func (a *App) renderAddServerView() string {
 
 	tlsStyle := lipgloss.NewStyle().
 		Foreground(lipgloss.Color(a.theme.Colors.Foreground))
-	if a.addServerFocus == 3 {
+	if a.addServerFocus == 4 {
 		tlsStyle = tlsStyle.Foreground(lipgloss.Color(a.theme.Colors.Purple)).Bold(true)
 	}
 
@@ -160,6 +171,7 @@ func (a *App) handleAddServerSubmit() tea.Cmd {
 	name := strings.TrimSpace(a.addServerName.Value())
 	address := strings.TrimSpace(a.addServerAddress.Value())
 	portStr := strings.TrimSpace(a.addServerPort.Value())
+	inviteCode := strings.TrimSpace(a.addServerInvite.Value())
 
 	if name == "" {
 		a.addServerError = "Server name is required"
@@ -186,10 +198,14 @@ func (a *App) handleAddServerSubmit() tea.Cmd {
 		idx := a.editingServerIndex
 		if idx >= 0 && idx < len(a.clientServers) {
 			cs := a.clientServers[idx]
+			if cs.Address != address || cs.Port != port {
+				cs.TLSFingerprint = "" // A different host gets pinned afresh
+			}
 			cs.Name = name
 			cs.Address = address
 			cs.Port = port
 			cs.UseTLS = a.addServerUseTLS
+			cs.InviteCode = inviteCode
 			if name != "" {
 				cs.IconLetter = string([]rune(strings.ToUpper(name))[0])
 			}
@@ -221,6 +237,7 @@ func (a *App) handleAddServerSubmit() tea.Cmd {
 
 	// Create new server info
 	newServer := NewClientServerInfo(name, address, port, a.addServerUseTLS)
+	newServer.InviteCode = inviteCode
 
 	// Add to client servers list
 	a.clientServers = append(a.clientServers, newServer)
@@ -269,6 +286,8 @@ func (a *App) updateAddServerForm(msg tea.Msg) tea.Cmd {
 		a.addServerAddress, cmd = a.addServerAddress.Update(msg)
 	case 2:
 		a.addServerPort, cmd = a.addServerPort.Update(msg)
+	case 3:
+		a.addServerInvite, cmd = a.addServerInvite.Update(msg)
 	}
 
 	return cmd
@@ -276,12 +295,13 @@ func (a *App) updateAddServerForm(msg tea.Msg) tea.Cmd {
 
 // cycleAddServerFocus cycles through the Add Server form fields
 func (a *App) cycleAddServerFocus() {
-	a.addServerFocus = (a.addServerFocus + 1) % 4
+	a.addServerFocus = (a.addServerFocus + 1) % 5
 
 	// Update field focus states
 	a.addServerName.Blur()
 	a.addServerAddress.Blur()
 	a.addServerPort.Blur()
+	a.addServerInvite.Blur()
 
 	switch a.addServerFocus {
 	case 0:
@@ -291,6 +311,8 @@ func (a *App) cycleAddServerFocus() {
 	case 2:
 		a.addServerPort.Focus()
 	case 3:
+		a.addServerInvite.Focus()
+	case 4:
 		// TLS toggle - no textinput to focus
 	}
 }
@@ -299,13 +321,14 @@ func (a *App) cycleAddServerFocus() {
 func (a *App) cycleAddServerFocusReverse() {
 	a.addServerFocus--
 	if a.addServerFocus < 0 {
-		a.addServerFocus = 3
+		a.addServerFocus = 4
 	}
 
 	// Update field focus states
 	a.addServerName.Blur()
 	a.addServerAddress.Blur()
 	a.addServerPort.Blur()
+	a.addServerInvite.Blur()
 
 	switch a.addServerFocus {
 	case 0:
@@ -315,6 +338,8 @@ func (a *App) cycleAddServerFocusReverse() {
 	case 2:
 		a.addServerPort.Focus()
 	case 3:
+		a.addServerInvite.Focus()
+	case 4:
 		// TLS toggle - no textinput to focus
 	}
 }
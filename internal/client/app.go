@@ -2,6 +2,7 @@ package client
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os/exec"
@@ -49,6 +50,7 @@ const (
 	FocusInput
 	FocusUserList
 	FocusMessageNav                   // Message navigation mode
+	FocusThread                       // Thread pane beside the chat
 )
 
 // App represents the main application state
@@ -69,7 +71,8 @@ type App struct {
 	banner Banner // Static banner chosen at startup
 
 	// Local identity (single identity across all servers)
-	localIdentity *LocalIdentity
+	localIdentity      *LocalIdentity
+	passwordUnverified bool // Password was typed this run (not saved) and no server has accepted it yet
 
 	// Multi-server connection management
 	connMgr    *ConnectionManager      // Manages all server connections
@@ -92,6 +95,9 @@ type App struct {
 	channelIndex        int
 	channelTree         *ChannelTree          // Hierarchical channel tree
 	collapsedCategories map[uuid.UUID]bool    // Per-server collapsed category state
+	pendingDMRecipient  uuid.UUID             // Set by /dm; the DM opens when the server confirms it
+	pendingServerName   string                // Set by /server create; the server opens when it arrives
+	auditQuery          *protocol.AuditLogRequest // Last /audit query, paged on by "/audit more"; nil when exhausted
 
 	// Default user preferences
 	defaultPreferences *DefaultPreferences
@@ -126,6 +132,7 @@ type App struct {
 	addServerName    textinput.Model
 	addServerAddress textinput.Model
 	addServerPort    textinput.Model
+	addServerInvite  textinput.Model
 	addServerUseTLS  bool
 	addServerFocus   int
 	addServerError   string
@@ -149,6 +156,9 @@ type App struct {
 	typingFrame     int                     // current animation frame index
 	lastTypingSent  time.Time               // when we last sent OpTypingStart
 
+	// Slowmode countdowns
+	slowmodeUntil map[uuid.UUID]time.Time // channelID → when we may post again
+
 	// Theme browser state
 	themeBrowserState *ThemeBrowserState
 
@@ -175,8 +185,23 @@ type App struct {
 	messageSelectionStart *Position // Selection start (nil if no selection)
 	messageSelectionEnd   *Position // Selection end
 
+	// Message edit/delete state
+	editingMessageID uuid.UUID // Message being edited in the input box (Nil when composing)
+	editingChannelID uuid.UUID
+	pendingDeleteID  uuid.UUID // Message armed for deletion by a first "d" press
+	revealedSpoilers map[uuid.UUID]bool // Messages whose ||spoilers|| were revealed with "s"
+	replyingTo       *MessageDisplay // Message the next send replies to (nil when not replying)
+
 	// Link browser state
 	linkBrowserState *LinkBrowserState
+
+	// Search results overlay (nil when closed)
+	searchState *SearchState
+
+	// Thread pane (nil when closed)
+	thread              *ThreadState
+	threadAnchor        uuid.UUID // Message picked with "t" for the next /thread create
+	pendingThreadAnchor uuid.UUID // Set by /thread create; the thread opens when the server confirms it
 }
 
 // Position represents a cursor position in a message (for Level 2 navigation)
@@ -193,6 +218,15 @@ type LinkBrowserState struct {
 	PreviousMode  string           // "message_nav" or "main"
 }
 
+// SearchState holds the results shown by the /search overlay
+type SearchState struct {
+	ServerID      uuid.UUID
+	Query         string
+	Results       []*protocol.MessageDisplay
+	HasMore       bool
+	SelectedIndex int
+}
+
 // MessageDisplay wraps a message with display information
 type MessageDisplay struct {
 	*models.Message
@@ -344,6 +378,10 @@ func NewApp(clientServers []*ClientServerInfo, defaultPrefs *DefaultPreferences,
 	addServerPort.Placeholder = "8080"
 	addServerPort.CharLimit = 5
 
+	addServerInvite := textinput.New()
+	addServerInvite.Placeholder = "Invite Code"
+	addServerInvite.CharLimit = 32
+
 	// Load default theme
 	theme := themes.GetDefaultTheme()
 	styles := theme.BuildStyles()
@@ -388,6 +426,9 @@ func NewApp(clientServers []*ClientServerInfo, defaultPrefs *DefaultPreferences,
 		servers := configMgr.GetClientServers()
 		if len(servers) == 0 {
 			startView = ViewAddServer
+		} else if identity.Password == "" {
+			// Password isn't saved; the unlock passphrase already guarded startup
+			startView = ViewMain
 		} else {
 			startView = ViewLogin
 		}
@@ -444,6 +485,7 @@ func NewApp(clientServers []*ClientServerInfo, defaultPrefs *DefaultPreferences,
 		addServerName:           addServerName,
 		addServerAddress:        addServerAddress,
 		addServerPort:           addServerPort,
+		addServerInvite:         addServerInvite,
 		addServerUseTLS:         false,
 	}
 
@@ -598,6 +640,21 @@ func (a *App) autoConnectServer(serverID uuid.UUID) tea.Cmd {
 			return AutoConnectMsg{ServerID: serverID, Err: fmt.Errorf("no local identity configured")}
 		}
 
+		// Without a saved password, reconnect with the saved token
+		if id.Password == "" {
+			for _, cs := range a.configMgr.GetClientServers() {
+				if cs.ID == serverID && cs.SavedCredentials != nil && cs.SavedCredentials.Token != "" {
+					return AutoConnectMsg{
+						ServerID: serverID,
+						UserID:   cs.UserID,
+						Email:    cs.SavedCredentials.Email,
+						Token:    cs.SavedCredentials.Token,
+					}
+				}
+			}
+			return AutoConnectMsg{ServerID: serverID, Err: errPasswordRequired}
+		}
+
 		// HTTP login/register only — WebSocket connection follows via connectServerAsync
 		result := a.connMgr.AutoConnectHTTP(serverID, id.Email, id.Alias, id.Password)
 		return AutoConnectMsg{
@@ -630,6 +687,20 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		// Re-schedule the AFK check
 		cmds = append(cmds, tea.Tick(30*time.Second, func(t time.Time) tea.Msg { return afkCheckMsg{t} }))
 
+	case beginEditMsg:
+		a.replyingTo = nil
+		a.editingMessageID = msg.msg.ID
+		a.editingChannelID = msg.msg.ChannelID
+		a.messageNavMode = false
+		a.inMessageEditMode = false
+		a.focus = FocusInput
+		a.input.SetValue(msg.msg.Content)
+		a.input.Focus()
+		a.statusMessage = "Editing message (Enter to save, Esc to cancel)"
+		a.statusError = false
+		a.updateChatContent()
+		cmds = append(cmds, tea.ShowCursor)
+
 	case typingTickMsg:
 		// Advance animation frame and prune expired typing entries
 		a.typingFrame++
@@ -646,6 +717,7 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				a.rebuildTypingUsers()
 			}
 		}
+		a.pruneThreadTyping(now)
 		cmds = append(cmds, tea.Tick(400*time.Millisecond, func(t time.Time) tea.Msg { return typingTickMsg(t) }))
 
 	case tea.KeyMsg:
@@ -680,7 +752,7 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			time.Since(a.lastTypingSent) > 4*time.Second {
 			a.lastTypingSent = time.Now()
 			serverID := a.currentClientServer.ID
-			channelID := a.currentChannel.ID
+			channelID := a.composeChannel().ID
 			cmds = append(cmds, func() tea.Msg {
 				_ = a.connMgr.SendTyping(serverID, channelID)
 				return nil
@@ -739,7 +811,20 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			log.Printf("Auto-connect failed for server %s: %v", msg.ServerID, msg.Err)
 			a.statusMessage = fmt.Sprintf("Could not connect to server: %v", msg.Err)
 			a.statusError = true
+			if errors.Is(msg.Err, errPasswordRequired) && a.view == ViewMain {
+				a.view = ViewLogin
+				a.initLoginView()
+				a.loginError = "Enter your password to sign in to servers without a saved session"
+			} else if a.passwordUnverified {
+				// The typed password may be wrong; ask again rather than keep it
+				a.localIdentity.Password = ""
+				a.passwordUnverified = false
+				a.view = ViewLogin
+				a.initLoginView()
+				a.loginError = fmt.Sprintf("Sign-in failed: %v", msg.Err)
+			}
 		} else if msg.Token != "" {
+			a.passwordUnverified = false
 			// Save token to disk for future sessions
 			go func() {
 				if err := a.configMgr.SaveServerToken(msg.ServerID, msg.Email, msg.Token, msg.UserID); err != nil {
@@ -859,6 +944,9 @@ func (a *App) View() string {
 	if a.linkBrowserState != nil {
 		return a.renderLinkBrowserOverlay(baseView)
 	}
+	if a.searchState != nil {
+		return a.renderSearchOverlay(baseView)
+	}
 
 	return baseView
 }
@@ -875,6 +963,9 @@ func (a *App) handleKeyPress(msg tea.KeyMsg) tea.Cmd {
 	if a.view == ViewThemeBrowser {
 		return a.handleThemeBrowserKey(msg)
 	}
+	if a.searchState != nil {
+		return a.handleSearchKey(msg)
+	}
 
 	switch msg.String() {
 	case "ctrl+q":
@@ -972,6 +1063,13 @@ func (a *App) handleKeyPress(msg tea.KeyMsg) tea.Cmd {
 		if a.view == ViewMain {
 			// If focused on server icons
 			if a.focus == FocusServerIcons {
+				// A DM in the server column opens that conversation
+				if dm := a.selectedSidebarDM(); dm != nil {
+					a.selectDMChannel(dm)
+					a.focus = FocusInput
+					a.input.Focus()
+					return nil
+				}
 				// Check if "Manage Servers" button is selected
 				if a.serverIndex >= len(a.clientServers) {
 					a.view = ViewManageServers
@@ -1016,6 +1114,7 @@ func (a *App) handleKeyPress(msg tea.KeyMsg) tea.Cmd {
 				// Esc from Level 1: exit navigation mode entirely
 				a.messageNavMode = false
 				a.messageNavIndex = 0
+				a.pendingDeleteID = uuid.Nil
 				// Restore previous focus (input or chat)
 				if a.focus == FocusMessageNav {
 					a.focus = FocusInput
@@ -1034,6 +1133,17 @@ func (a *App) handleKeyPress(msg tea.KeyMsg) tea.Cmd {
 			a.mentionSuggestions = nil
 			return nil
 		}
+		// Cancel an in-progress message edit
+		if a.editingMessageID != uuid.Nil {
+			a.cancelMessageEdit()
+			return nil
+		}
+		// Cancel a reply
+		if a.replyingTo != nil && a.focus == FocusInput {
+			a.replyingTo = nil
+			a.statusMessage = ""
+			return nil
+		}
 		if a.view == ViewRegister {
 			// Go back to login view
 			a.view = ViewLogin
@@ -1050,6 +1160,8 @@ func (a *App) handleKeyPress(msg tea.KeyMsg) tea.Cmd {
 			} else {
 				a.view = ViewMain
 			}
+		} else if a.view == ViewMain && a.focus == FocusThread {
+			a.closeThread()
 		} else if a.view == ViewMain {
 			a.focus = FocusServerIcons
 			a.input.Blur()
@@ -1057,7 +1169,7 @@ func (a *App) handleKeyPress(msg tea.KeyMsg) tea.Cmd {
 
 	case " ", "space":
 		// Toggle TLS in Add Server view when on TLS field
-		if a.view == ViewAddServer && a.addServerFocus == 3 {
+		if a.view == ViewAddServer && a.addServerFocus == 4 {
 			a.addServerUseTLS = !a.addServerUseTLS
 		}
 
@@ -1073,6 +1185,7 @@ func (a *App) handleKeyPress(msg tea.KeyMsg) tea.Cmd {
 				a.messageNavIndex = len(messages) - 1 // Start at newest message
 				a.messageSelectionStart = nil         // Clear any previous selection
 				a.messageSelectionEnd = nil
+				a.pendingDeleteID = uuid.Nil
 				a.input.Blur()
 				// Refresh viewport to show highlighting
 				a.updateChatContent()
@@ -1101,6 +1214,63 @@ func (a *App) handleKeyPress(msg tea.KeyMsg) tea.Cmd {
 			return a.copyMessageToClipboard()
 		}
 
+	case "e":
+		// Level 1: edit the selected message in the input box
+		if a.messageNavMode && !a.inMessageEditMode {
+			if md := a.selectedMessage(); md != nil && !md.IsSystem && !md.IsWhisper {
+				return func() tea.Msg { return beginEditMsg{msg: md} }
+			}
+			return nil
+		}
+
+	case "d", "delete":
+		// Level 1: delete the selected message (press twice to confirm)
+		if a.messageNavMode && !a.inMessageEditMode {
+			md := a.selectedMessage()
+			if md == nil || md.IsSystem || md.IsWhisper {
+				return nil
+			}
+			if a.pendingDeleteID != md.ID {
+				a.pendingDeleteID = md.ID
+				a.statusMessage = "Press d again to delete this message"
+				a.statusError = false
+				return nil
+			}
+			a.pendingDeleteID = uuid.Nil
+			return a.sendMessageDelete(md)
+		}
+
+	case "t":
+		// Level 1: open the selected message's thread, or start one from it
+		if a.messageNavMode && !a.inMessageEditMode {
+			return a.threadFromSelectedMessage()
+		}
+
+	case "r":
+		// Level 1: reply to the selected message
+		if a.messageNavMode && !a.inMessageEditMode {
+			return a.startReply()
+		}
+
+	case "p":
+		// Level 1: jump to the message the selected reply answers
+		if a.messageNavMode && !a.inMessageEditMode {
+			return a.jumpToReplyParent()
+		}
+
+	case "s":
+		// Level 1: reveal or hide the selected message's spoilers
+		if a.messageNavMode && !a.inMessageEditMode {
+			a.toggleSpoilers()
+			return nil
+		}
+		// Thread pane: reveal or hide spoilers in the open thread
+		if a.focus == FocusThread && a.thread != nil {
+			a.thread.ShowSpoilers = !a.thread.ShowSpoilers
+			a.updateThreadContent()
+			return nil
+		}
+
 	case "C":
 		// Uppercase C also copies in message navigation mode
 		if a.messageNavMode {
@@ -1161,6 +1331,8 @@ func (a *App) handleKeyPress(msg tea.KeyMsg) tea.Cmd {
 			a.navigateChannelList(-1)
 		} else if a.focus == FocusChat {
 			a.chatViewport.LineUp(1)
+		} else if a.focus == FocusThread {
+			a.scrollThread(-1)
 		}
 
 	case "down":
@@ -1188,6 +1360,8 @@ func (a *App) handleKeyPress(msg tea.KeyMsg) tea.Cmd {
 			a.navigateChannelList(1)
 		} else if a.focus == FocusChat {
 			a.chatViewport.LineDown(1)
+		} else if a.focus == FocusThread {
+			a.scrollThread(1)
 		}
 
 	case "shift+up":
@@ -1246,11 +1420,15 @@ func (a *App) handleKeyPress(msg tea.KeyMsg) tea.Cmd {
 	case "pgup":
 		if a.focus == FocusChat {
 			a.chatViewport.HalfViewUp()
+		} else if a.focus == FocusThread {
+			a.scrollThread(-a.thread.Viewport.Height / 2)
 		}
 
 	case "pgdown":
 		if a.focus == FocusChat {
 			a.chatViewport.HalfViewDown()
+		} else if a.focus == FocusThread {
+			a.scrollThread(a.thread.Viewport.Height / 2)
 		}
 
 	case "ctrl+s":
@@ -1283,6 +1461,7 @@ func (a *App) handleKeyPress(msg tea.KeyMsg) tea.Cmd {
 
 // cycleFocus moves focus to the next area
 func (a *App) cycleFocus() {
+	a.pendingDeleteID = uuid.Nil
 	if a.view == ViewLogin {
 		if a.localIdentity != nil {
 			// Local identity mode: email is locked, only cycle to password
@@ -1361,6 +1540,13 @@ func (a *App) cycleFocus() {
 	case FocusChannelList:
 		a.focus = FocusChat
 	case FocusChat:
+		if a.thread != nil {
+			a.focus = FocusThread
+			return
+		}
+		a.focus = FocusInput
+		a.input.Focus()
+	case FocusThread:
 		a.focus = FocusInput
 		a.input.Focus()
 	case FocusInput:
@@ -1373,6 +1559,7 @@ func (a *App) cycleFocus() {
 
 // cycleFocusReverse moves focus to the previous area
 func (a *App) cycleFocusReverse() {
+	a.pendingDeleteID = uuid.Nil
 	switch a.focus {
 	case FocusServerIcons:
 		a.focus = FocusUserList
@@ -1380,8 +1567,13 @@ func (a *App) cycleFocusReverse() {
 		a.focus = FocusServerIcons
 	case FocusChat:
 		a.focus = FocusChannelList
+	case FocusThread:
+		a.focus = FocusChat
 	case FocusInput:
 		a.focus = FocusChat
+		if a.thread != nil {
+			a.focus = FocusThread
+		}
 		a.input.Blur()
 	case FocusUserList:
 		a.focus = FocusInput
@@ -1399,8 +1591,8 @@ func (a *App) getCurrentChannels() []*models.Channel {
 
 // navigateServerList navigates the client server list
 func (a *App) navigateServerList(delta int) {
-	// Total items = servers + add button (+)
-	totalItems := len(a.clientServers) + 1
+	// Total items = servers + DMs + add button (+)
+	totalItems := len(a.clientServers) + len(a.sidebarDMChannels()) + 1
 
 	a.serverIndex += delta
 	if a.serverIndex < 0 {
@@ -1415,6 +1607,25 @@ func (a *App) navigateServerList(delta int) {
 	}
 }
 
+// sidebarDMChannels returns the DM channels listed under the servers in the
+// server column (those of the active connection)
+func (a *App) sidebarDMChannels() []*models.Channel {
+	if a.activeConn == nil {
+		return nil
+	}
+	return a.activeConn.GetDMChannels()
+}
+
+// selectedSidebarDM returns the DM highlighted in the server column, if any
+func (a *App) selectedSidebarDM() *models.Channel {
+	dms := a.sidebarDMChannels()
+	i := a.serverIndex - len(a.clientServers)
+	if i < 0 || i >= len(dms) {
+		return nil
+	}
+	return dms[i]
+}
+
 // navigateChannelList navigates the channel list for the current server
 func (a *App) navigateChannelList(delta int) {
 	if a.channelTree == nil || len(a.channelTree.FlatList) == 0 {
@@ -1556,6 +1767,9 @@ func (a *App) navigateMessage(delta int) tea.Cmd {
 		return nil
 	}
 
+	// Moving the selection disarms a pending delete
+	a.pendingDeleteID = uuid.Nil
+
 	// Update index with wrapping
 	a.messageNavIndex += delta
 	if a.messageNavIndex < 0 {
@@ -1570,6 +1784,76 @@ func (a *App) navigateMessage(delta int) tea.Cmd {
 	return nil
 }
 
+// selectedMessage returns the message highlighted in message navigation mode
+func (a *App) selectedMessage() *MessageDisplay {
+	if a.activeConn == nil || a.currentChannel == nil {
+		return nil
+	}
+	messages := a.activeConn.GetMessages(a.currentChannel.ID)
+	if a.messageNavIndex < 0 || a.messageNavIndex >= len(messages) {
+		return nil
+	}
+	return messages[a.messageNavIndex]
+}
+
+// sendMessageEdit sends the edited content for a.editingMessageID
+func (a *App) sendMessageEdit(content string) tea.Cmd {
+	req := &protocol.MessageEditRequest{
+		ChannelID: a.editingChannelID,
+		MessageID: a.editingMessageID,
+		Content:   content,
+	}
+	a.editingMessageID = uuid.Nil
+	a.editingChannelID = uuid.Nil
+	a.statusMessage = ""
+
+	sc := a.activeConn
+	if sc == nil || sc.Connection == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		msg, err := protocol.NewMessage(protocol.OpMessageEdit, req)
+		if err == nil {
+			err = sc.Connection.Send(msg)
+		}
+		if err != nil {
+			return ErrorMsg{Error: fmt.Sprintf("Failed to edit message: %v", err)}
+		}
+		return nil
+	}
+}
+
+// cancelMessageEdit abandons an in-progress edit and clears the input
+func (a *App) cancelMessageEdit() {
+	a.editingMessageID = uuid.Nil
+	a.editingChannelID = uuid.Nil
+	a.input.Reset()
+	a.statusMessage = "Edit cancelled"
+	a.statusError = false
+}
+
+// sendMessageDelete asks the server to delete a message
+func (a *App) sendMessageDelete(md *MessageDisplay) tea.Cmd {
+	sc := a.activeConn
+	if sc == nil || sc.Connection == nil {
+		return nil
+	}
+	req := &protocol.MessageDeleteRequest{
+		ChannelID: md.ChannelID,
+		MessageID: md.ID,
+	}
+	return func() tea.Msg {
+		msg, err := protocol.NewMessage(protocol.OpMessageDelete, req)
+		if err == nil {
+			err = sc.Connection.Send(msg)
+		}
+		if err != nil {
+			return ErrorMsg{Error: fmt.Sprintf("Failed to delete message: %v", err)}
+		}
+		return nil
+	}
+}
+
 // copyMessageToClipboard copies the selected message or selection to the system clipboard
 func (a *App) copyMessageToClipboard() tea.Cmd {
 	if !a.messageNavMode || a.activeConn == nil || a.currentChannel == nil {
@@ -1606,14 +1890,14 @@ func (a *App) copyMessageToClipboard() tea.Cmd {
 }
 
 // insertCursorIntoMessage inserts a visible cursor character and selection markers
-// Uses plain text markers that will be styled later by renderMessageContent
+// into the message source, wrapped the way cursor movement sees it
 func (a *App) insertCursorIntoMessage(content string) string {
 	if !a.inMessageEditMode {
 		return content
 	}
 
-	// Split content into lines
-	lines := strings.Split(content, "\n")
+	// Split content into the same wrapped lines moveCursorInMessage uses
+	lines := a.splitMessageIntoLines(content, a.chatViewport.Width-10)
 	if a.messageCursorLine < 0 || a.messageCursorLine >= len(lines) {
 		return content
 	}
@@ -1731,6 +2015,85 @@ func (a *App) closeLinkBrowser() {
 	}
 }
 
+// openSearchResults shows a SEARCH_RESULTS payload in the search overlay
+func (a *App) openSearchResults(payload protocol.SearchResultsPayload) {
+	if len(payload.Results) == 0 {
+		a.displayLocalSystemMessage(fmt.Sprintf("No messages match %q", payload.Query))
+		return
+	}
+	a.searchState = &SearchState{
+		ServerID: payload.ServerID,
+		Query:    payload.Query,
+		Results:  payload.Results,
+		HasMore:  payload.HasMore,
+	}
+}
+
+// handleSearchKey handles keyboard input while the search overlay is open
+func (a *App) handleSearchKey(msg tea.KeyMsg) tea.Cmd {
+	state := a.searchState
+	switch msg.String() {
+	case "ctrl+q":
+		return tea.Quit
+	case "esc", "q":
+		a.searchState = nil
+	case "up", "k":
+		state.SelectedIndex--
+		if state.SelectedIndex < 0 {
+			state.SelectedIndex = len(state.Results) - 1
+		}
+	case "down", "j":
+		state.SelectedIndex++
+		if state.SelectedIndex >= len(state.Results) {
+			state.SelectedIndex = 0
+		}
+	case "enter":
+		result := state.Results[state.SelectedIndex]
+		a.searchState = nil
+		a.jumpToMessage(result.ChannelID, result.ID)
+	}
+	return nil
+}
+
+// jumpToMessage switches to channelID and loads its history around messageID
+func (a *App) jumpToMessage(channelID, messageID uuid.UUID) {
+	for i, ch := range a.getCurrentChannels() {
+		if ch.ID == channelID {
+			a.channelIndex = i
+			a.currentChannel = ch
+			a.enterCurrentChannelAround(&messageID)
+			return
+		}
+	}
+	a.statusMessage = "That channel is no longer available"
+	a.statusError = true
+}
+
+// focusMessage selects messageID in message navigation mode, e.g. after
+// jumping to a search result
+func (a *App) focusMessage(messageID uuid.UUID) tea.Cmd {
+	if a.activeConn == nil || a.currentChannel == nil {
+		return nil
+	}
+	for i, m := range a.activeConn.GetMessages(a.currentChannel.ID) {
+		if m.ID == messageID {
+			a.messageNavMode = true
+			a.inMessageEditMode = false
+			a.messageNavIndex = i
+			a.pendingDeleteID = uuid.Nil
+			a.messageSelectionStart = nil
+			a.messageSelectionEnd = nil
+			a.focus = FocusMessageNav
+			a.input.Blur()
+			a.updateChatContent()
+			return tea.HideCursor
+		}
+	}
+	a.updateChatContent()
+	a.scrollToBottom()
+	return nil
+}
+
 // openURL opens a URL in the default browser
 func (a *App) openURL(url string) tea.Cmd {
 	return func() tea.Msg {
@@ -2069,6 +2432,7 @@ func (a *App) switchToClientServer(index int) {
 	// If not connected, clear stale state and show prompt
 	if a.activeConn == nil || a.activeConn.GetState() != StateReady {
 		a.statusMessage = "Unable to connect to server. Server may be offline."
+		a.closeThread()
 		a.currentServer = nil
 		a.currentChannel = nil
 		a.channelTree = nil
@@ -2086,6 +2450,24 @@ func (a *App) switchToClientServer(index int) {
 	a.loadChannelsForServer()
 }
 
+// switchToProtocolServer shows another server (guild) of the active connection
+func (a *App) switchToProtocolServer(index int) {
+	if a.activeConn == nil {
+		return
+	}
+	a.activeConn.mu.RLock()
+	if index < 0 || index >= len(a.activeConn.Servers) {
+		a.activeConn.mu.RUnlock()
+		return
+	}
+	a.currentServer = a.activeConn.Servers[index]
+	a.activeConn.mu.RUnlock()
+
+	a.protocolServerIndex = index
+	a.currentChannel = nil
+	a.loadChannelsForServer()
+}
+
 // loadChannelsForServer loads channels for the current protocol server
 func (a *App) loadChannelsForServer() {
 	if a.activeConn == nil || a.currentServer == nil {
@@ -2183,9 +2565,40 @@ func (a *App) selectChannel(index int) {
 	}
 	a.channelIndex = index
 	a.currentChannel = channels[index]
+	a.enterCurrentChannel()
+}
 
+// selectDMChannel opens a direct message channel in the chat pane
+func (a *App) selectDMChannel(channel *models.Channel) {
+	a.currentChannel = channel
+	a.enterCurrentChannel()
+}
+
+// enterCurrentChannel resets per-channel UI state and requests history for a.currentChannel
+func (a *App) enterCurrentChannel() {
+	a.enterCurrentChannelAround(nil)
+}
+
+// enterCurrentChannelAround is enterCurrentChannel, but when around is set the
+// history is centred on that message and it is selected once loaded
+func (a *App) enterCurrentChannelAround(around *uuid.UUID) {
 	// Clear typing indicators from the previous channel
 	a.clearTypingState()
+	a.pendingDeleteID = uuid.Nil
+
+	// A reply in progress belongs to the channel it was started in
+	if a.replyingTo != nil && (a.currentChannel == nil || a.replyingTo.ChannelID != a.currentChannel.ID) {
+		a.replyingTo = nil
+	}
+
+	// The thread pane stays open only beside its parent channel
+	if a.thread != nil {
+		if a.currentChannel != nil && a.currentChannel.ID == a.thread.Thread.ParentID {
+			a.reloadThread()
+		} else {
+			a.closeThread()
+		}
+	}
 
 	// Clear unread counts for this channel
 	if a.currentClientServer != nil && a.currentChannel != nil {
@@ -2208,6 +2621,7 @@ func (a *App) selectChannel(index int) {
 		req := &protocol.MessageHistoryRequest{
 			ChannelID: a.currentChannel.ID,
 			Limit:     200,
+			Around:    around,
 		}
 
 		log.Printf("selectChannel: requesting history for channel=%s", a.currentChannel.ID)
@@ -2284,6 +2698,19 @@ func (a *App) updateChatContent() {
 	// Get viewport width for full-width backgrounds
 	viewportWidth := a.chatViewport.Width
 
+	// Line span of the selected message, used to keep it in view
+	selectedTop, selectedBottom := -1, -1
+
+	// Threads started from messages in this channel, by anchor message
+	threads := a.activeConn.ThreadsByAnchor(a.currentChannel.ID)
+
+	// Loaded messages by ID, for the quoted parent above replies
+	loaded := make(map[uuid.UUID]*MessageDisplay, len(messages))
+	for _, msg := range messages {
+		loaded[msg.ID] = msg
+	}
+	var unknownParents []uuid.UUID
+
 	for i, msg := range messages {
 		// Check if this message is selected in navigation mode
 		// Level 1: Highlight entire message with selection background
@@ -2305,19 +2732,40 @@ func (a *App) updateChatContent() {
 		// Level 2: No background - just show cursor inline
 		// The cursor and selection will be rendered within the message content
 
+		if isSelected || isInLevel2 {
+			selectedTop = strings.Count(content.String(), "\n")
+		}
+
 		// In Level 2, prepare to insert cursor and selection into message content
 		messageContentWithCursor := msg.Content
 		if isInLevel2 && !isSystemMsg {
 			messageContentWithCursor = a.insertCursorIntoMessage(msg.Content)
 		}
 
-		if msg.ShowHeader && !isSystemMsg {
+		// One-line preview of the message being replied to
+		if msg.ReplyToID != nil && !isSystemMsg {
+			parent, known := a.replyParent(*msg.ReplyToID, loaded)
+			if !known {
+				unknownParents = append(unknownParents, *msg.ReplyToID)
+			}
+			quoteLine := lipgloss.NewStyle().Width(viewportWidth).Render(a.renderReplyQuote(parent, known, viewportWidth))
+			if isSelected || isInLevel2 {
+				quoteLine = highlightStyle.Render(quoteLine)
+			}
+			content.WriteString(quoteLine)
+			content.WriteString("\n")
+		}
+
+		if (msg.ShowHeader || msg.ReplyToID != nil) && !isSystemMsg {
 			// Render author line with full width background (non-system messages)
 			authorStyle := a.styles.UsernameOther
 			if msg.IsOwn {
 				authorStyle = a.styles.UsernameSelf
 			}
 			timestamp := msg.CreatedAt.Format("15:04")
+			if msg.EditedAt != nil {
+				timestamp += " (edited)"
+			}
 
 			// Render author name with its style
 			authorText := authorStyle.Render(msg.AuthorName)
@@ -2370,9 +2818,12 @@ func (a *App) updateChatContent() {
 				Italic(true).
 				Width(viewportWidth)
 			contentLine = whisperStyle.Render(messageContentWithCursor)
+		} else if isInLevel2 {
+			// The cursor moves through the source, so show it as typed
+			contentLine = a.renderMessageSource(messageContentWithCursor, viewportWidth)
 		} else {
-			// Regular messages — highlight @mentions of the current user
-			contentLine = a.renderMessageContent(messageContentWithCursor, viewportWidth)
+			// Regular messages — markdown, with @mentions of the current user highlighted
+			contentLine = a.renderMessageContent(msg.Content, viewportWidth, a.revealedSpoilers[msg.ID])
 		}
 
 		// Wrap content in highlight if selected (Level 1 or Level 2)
@@ -2381,12 +2832,69 @@ func (a *App) updateChatContent() {
 		}
 		content.WriteString(contentLine)
 		content.WriteString("\n")
+
+		// Compact reaction row: "👍 3  🎉 1", own reactions highlighted
+		if len(msg.Reactions) > 0 && !isSystemMsg {
+			reactionLine := lipgloss.NewStyle().Width(viewportWidth).Render(a.renderReactions(msg.Reactions))
+			if isSelected || isInLevel2 {
+				reactionLine = highlightStyle.Render(reactionLine)
+			}
+			content.WriteString(reactionLine)
+			content.WriteString("\n")
+		}
+
+		// Thread summary under the anchor: "🧵 name · 3 replies · 1 new"
+		if thread := threads[msg.ID]; thread != nil && !isSystemMsg {
+			threadLine := lipgloss.NewStyle().Width(viewportWidth).Render(a.renderThreadSummary(thread))
+			if isSelected || isInLevel2 {
+				threadLine = highlightStyle.Render(threadLine)
+			}
+			content.WriteString(threadLine)
+			content.WriteString("\n")
+		}
+
+		if isSelected || isInLevel2 {
+			selectedBottom = strings.Count(content.String(), "\n")
+		}
 	}
 
 	a.chatViewport.SetContent(content.String())
+	a.fetchReplyParents(a.currentChannel.ID, unknownParents)
+
+	// Scroll the selected message into view
+	if selectedTop >= 0 {
+		if selectedTop < a.chatViewport.YOffset {
+			a.chatViewport.SetYOffset(selectedTop)
+		} else if selectedBottom > a.chatViewport.YOffset+a.chatViewport.Height {
+			a.chatViewport.SetYOffset(selectedBottom - a.chatViewport.Height)
+		}
+	}
+}
+
+// renderReactions renders a message's reactions as a single row of emoji and counts
+func (a *App) renderReactions(reactions []models.Reaction) string {
+	var selfID uuid.UUID
+	if a.activeConn != nil && a.activeConn.User != nil {
+		selfID = a.activeConn.User.ID
+	}
+
+	otherStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(a.theme.Colors.Comment))
+	ownStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(a.theme.Colors.Purple)).Bold(true)
+
+	parts := make([]string, 0, len(reactions))
+	for _, r := range reactions {
+		style := otherStyle
+		for _, id := range r.UserIDs {
+			if id == selfID {
+				style = ownStyle
+				break
+			}
+		}
+		parts = append(parts, style.Render(fmt.Sprintf("%s %d", r.Emoji, r.Count)))
+	}
+	return "  " + strings.Join(parts, "  ")
 }
 
-// renderMessageContent renders message text, highlighting @mentions of the current user.
 // urlRegex matches http and https URLs.
 var urlRegex = regexp.MustCompile(`https?://[^\s<>"{}|\\^` + "`" + `\[\]]+`)
 
@@ -2398,80 +2906,6 @@ func osc8Link(url, styledText string) string {
 	return "\033]8;;" + url + st + styledText + "\033]8;;" + st
 }
 
-func (a *App) renderMessageContent(text string, width int) string {
-	// Determine current user's alias
-	var alias string
-	if a.activeConn != nil && a.activeConn.User != nil {
-		alias = a.activeConn.User.Username
-	}
-
-	msgStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color(a.theme.Semantic.ChatFg))
-	mentionStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color(a.theme.Semantic.ChatMention)).
-		Bold(true)
-	linkStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color(a.theme.Colors.Cyan)).
-		Underline(true)
-
-	// renderLine processes a single line (no \n) applying URL and @mention styling.
-	renderLine := func(line string) string {
-		var out strings.Builder
-		seg := line
-		for len(seg) > 0 {
-			urlLoc := urlRegex.FindStringIndex(seg)
-			mentionLoc := []int{-1, -1}
-			if alias != "" {
-				token := "@" + alias
-				if idx := strings.Index(strings.ToLower(seg), strings.ToLower(token)); idx != -1 {
-					mentionLoc = []int{idx, idx + len(token)}
-				}
-			}
-
-			useURL := urlLoc != nil
-			useMention := mentionLoc[0] != -1
-			if useURL && useMention {
-				if mentionLoc[0] < urlLoc[0] {
-					useURL = false
-				} else {
-					useMention = false
-				}
-			}
-
-			switch {
-			case useMention:
-				if mentionLoc[0] > 0 {
-					out.WriteString(msgStyle.Render(seg[:mentionLoc[0]]))
-				}
-				out.WriteString(mentionStyle.Render(seg[mentionLoc[0]:mentionLoc[1]]))
-				seg = seg[mentionLoc[1]:]
-			case useURL:
-				if urlLoc[0] > 0 {
-					out.WriteString(msgStyle.Render(seg[:urlLoc[0]]))
-				}
-				rawURL := seg[urlLoc[0]:urlLoc[1]]
-				out.WriteString(osc8Link(rawURL, linkStyle.Render(rawURL)))
-				seg = seg[urlLoc[1]:]
-			default:
-				out.WriteString(msgStyle.Render(seg))
-				seg = ""
-			}
-		}
-		return out.String()
-	}
-
-	// Process each newline-separated line independently and apply Width() per line.
-	// Applying Width() to the whole multi-line string causes lipgloss to
-	// miscount visible characters when OSC 8 sequences are on a continuation
-	// line, which shifts the link far to the right with blank space before it.
-	lines := strings.Split(text, "\n")
-	renderedLines := make([]string, len(lines))
-	for i, line := range lines {
-		renderedLines[i] = lipgloss.NewStyle().Width(width).Render(renderLine(line))
-	}
-	return strings.Join(renderedLines, "\n")
-}
-
 // scrollToBottom scrolls the chat to the bottom
 func (a *App) scrollToBottom() {
 	a.chatViewport.GotoBottom()
@@ -2494,9 +2928,7 @@ func (a *App) currentUserRoleLevel() roleLevel {
 	}
 	userID := a.activeConn.User.ID
 
-	a.activeConn.mu.RLock()
-	members := a.activeConn.Members
-	a.activeConn.mu.RUnlock()
+	members := a.activeConn.GetMembers(a.getActiveServerID())
 
 	for _, m := range members {
 		if m.User == nil || m.User.ID != userID {
@@ -2526,23 +2958,27 @@ func (a *App) updateTypingIndicator(users []string) {
 // rebuildTypingUsers refreshes a.typingUsers from the current typingExpiry map,
 // resolving user IDs to display names via the active connection's member list.
 func (a *App) rebuildTypingUsers() {
-	if len(a.typingExpiry) == 0 {
-		a.typingUsers = nil
-		return
+	a.typingUsers = a.typingNames(a.typingExpiry)
+}
+
+// typingNames resolves the users in a typing expiry map to sorted display names
+func (a *App) typingNames(expiry map[uuid.UUID]time.Time) []string {
+	if len(expiry) == 0 {
+		return nil
 	}
 	// Build a userID → username map from the members list
 	nameMap := make(map[uuid.UUID]string)
 	if a.activeConn != nil {
 		a.activeConn.mu.RLock()
-		for _, m := range a.activeConn.Members {
+		for _, m := range a.activeConn.Members[a.getActiveServerID()] {
 			if m.User != nil {
 				nameMap[m.User.ID] = m.User.Username
 			}
 		}
 		a.activeConn.mu.RUnlock()
 	}
-	users := make([]string, 0, len(a.typingExpiry))
-	for uid := range a.typingExpiry {
+	users := make([]string, 0, len(expiry))
+	for uid := range expiry {
 		if name, ok := nameMap[uid]; ok {
 			users = append(users, name)
 		} else {
@@ -2550,7 +2986,7 @@ func (a *App) rebuildTypingUsers() {
 		}
 	}
 	sort.Strings(users)
-	a.typingUsers = users
+	return users
 }
 
 // clearTypingState resets all typing indicators for the current channel.
@@ -2575,12 +3011,18 @@ func (a *App) updateViewportSize() {
 		chatWidth = availableWidth - serverIconsWidth - channelsWidth - membersWidth
 	}
 
+	chatWidth, threadWidth := a.splitThreadPane(chatWidth)
+
 	// Interior of the chat panel (panel has a 1-char border on each side)
 	interiorWidth := chatWidth - 2
 
-	// Set textarea width — matches renderChatPanel line 919
+	// Set textarea width — matches renderChatPanel line 919, or the thread
+	// pane when the input box moves there
 	a.input.SetWidth(interiorWidth - 2)
 	a.input.SetHeight(4)
+	if a.thread != nil {
+		a.resizeThreadPane(threadWidth)
+	}
 
 	// Set viewport dimensions — matches renderChatPanel lines 922-924
 	// panelHeight = a.height - 2 (status bar + top padding)
@@ -2606,18 +3048,43 @@ func (a *App) handleSendMessage() tea.Cmd {
 
 	a.input.Reset()
 
+	// Finish an in-progress edit instead of sending a new message
+	if a.editingMessageID != uuid.Nil {
+		return a.sendMessageEdit(content)
+	}
+
 	// Check if this is a slash command
 	if strings.HasPrefix(content, "/") {
 		return a.handleSlashCommand(content)
 	}
 
+	// Replies go to the open thread, which has no slowmode of its own
+	channel := a.composeChannel()
+
+	// Hold the message until the channel's slowmode runs out
+	if wait := a.slowmodeRemaining(); wait > 0 && channel == a.currentChannel {
+		a.input.SetValue(content)
+		a.statusMessage = fmt.Sprintf("Slowmode: you can post again in %s", formatCountdown(wait))
+		a.statusError = true
+		return nil
+	}
+
 	// Create and send message via connection manager
-	if a.activeConn != nil && a.currentChannel != nil && a.currentClientServer != nil {
+	if a.activeConn != nil && channel != nil && a.currentClientServer != nil {
 		serverID := a.currentClientServer.ID
-		channelID := a.currentChannel.ID
+		channelID := channel.ID
+		if rate := channel.RateLimitPerUser; rate > 0 && !a.bypassesSlowmode() {
+			a.startSlowmode(channelID, time.Duration(rate)*time.Second)
+		}
+		var replyTo *uuid.UUID
+		if a.replyingTo != nil && a.replyingTo.ChannelID == channelID {
+			id := a.replyingTo.ID
+			replyTo = &id
+		}
+		a.replyingTo = nil
 
 		return func() tea.Msg {
-			if err := a.connMgr.SendMessage(serverID, channelID, content); err != nil {
+			if err := a.connMgr.SendMessage(serverID, channelID, content, replyTo); err != nil {
 				return ErrorMsg{Error: fmt.Sprintf("Failed to send message: %v", err)}
 			}
 			return nil
@@ -2627,6 +3094,62 @@ func (a *App) handleSendMessage() tea.Cmd {
 	return nil
 }
 
+// slowmodeRemaining returns how long until slowmode lets us post in the current channel
+func (a *App) slowmodeRemaining() time.Duration {
+	if a.currentChannel == nil {
+		return 0
+	}
+	if wait := time.Until(a.slowmodeUntil[a.currentChannel.ID]); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// startSlowmode starts the countdown until we may post in channelID again
+func (a *App) startSlowmode(channelID uuid.UUID, wait time.Duration) {
+	if a.slowmodeUntil == nil {
+		a.slowmodeUntil = make(map[uuid.UUID]time.Time)
+	}
+	a.slowmodeUntil[channelID] = time.Now().Add(wait)
+}
+
+// bypassesSlowmode reports whether the logged-in user is exempt from slowmode
+// on the active server (owner, or Manage Messages). The
+// server has the final say; this only decides whether to show a countdown.
+func (a *App) bypassesSlowmode() bool {
+	if a.activeConn == nil || a.activeConn.User == nil {
+		return false
+	}
+	userID := a.activeConn.User.ID
+	if a.currentServer != nil && a.currentServer.OwnerID == userID {
+		return true
+	}
+
+	a.activeConn.mu.RLock()
+	defer a.activeConn.mu.RUnlock()
+	for _, m := range a.activeConn.Members[a.getActiveServerID()] {
+		if m.User == nil || m.User.ID != userID || m.HighestRole == nil {
+			continue
+		}
+		return m.HighestRole.HasPermission(models.PermissionAdministrator) ||
+			m.HighestRole.HasPermission(models.PermissionManageMessages)
+	}
+	return false
+}
+
+// formatCountdown renders a wait as e.g. "45s", "2m05s" or "1h30m"
+func formatCountdown(d time.Duration) string {
+	secs := int((d + time.Second - 1) / time.Second)
+	switch {
+	case secs < 60:
+		return fmt.Sprintf("%ds", secs)
+	case secs < 3600:
+		return fmt.Sprintf("%dm%02ds", secs/60, secs%60)
+	default:
+		return fmt.Sprintf("%dh%02dm", secs/3600, secs%3600/60)
+	}
+}
+
 // handleSlashCommand processes slash commands
 func (a *App) handleSlashCommand(input string) tea.Cmd {
 	cmd, err := ParseCommand(input)
@@ -2655,6 +3178,19 @@ func (a *App) handleSlashCommand(input string) tea.Cmd {
 	return nil
 }
 
+// formatServerError turns an error payload into a system message, calling out
+// role-hierarchy rejections so they aren't mistaken for missing permissions,
+// and deleted channels
+func formatServerError(payload protocol.ErrorPayload) string {
+	switch payload.Code {
+	case protocol.ErrorCodeRoleHierarchy:
+		return "Not allowed by role hierarchy: " + payload.Message
+	case protocol.ErrorCodeUnknownChannel:
+		return "That channel no longer exists"
+	}
+	return "Error: " + payload.Message
+}
+
 // displayLocalSystemMessage displays a system message in the chat viewport (local only, not broadcast)
 func (a *App) displayLocalSystemMessage(content string) {
 	if a.activeConn == nil || a.currentChannel == nil {
@@ -2683,6 +3219,78 @@ func (a *App) displayLocalSystemMessage(content string) {
 	a.scrollToBottom()
 }
 
+// displayAuditLog shows a page of audit log entries as a system message and
+// remembers where the next "/audit more" page starts
+func (a *App) displayAuditLog(payload protocol.AuditLogPayload) {
+	if len(payload.Entries) == 0 {
+		a.auditQuery = nil
+		a.displayLocalSystemMessage("No matching audit log entries.")
+		return
+	}
+
+	names := make(map[uuid.UUID]string, len(payload.Users))
+	for _, u := range payload.Users {
+		names[u.ID] = u.Username
+	}
+
+	lines := []string{"Audit log (newest first):"}
+	for _, e := range payload.Entries {
+		actor := names[e.ActorID]
+		if actor == "" {
+			actor = "unknown"
+		}
+		line := fmt.Sprintf("  %s  %s  %s  %s", e.CreatedAt.Local().Format("Jan 2 15:04"), actor, e.Action, e.TargetName)
+		if e.Reason != "" {
+			line += " — " + e.Reason
+		}
+		lines = append(lines, line)
+	}
+
+	if payload.HasMore && a.auditQuery != nil {
+		last := payload.Entries[len(payload.Entries)-1].ID
+		a.auditQuery.Before = &last
+		lines = append(lines, "Type /audit more for older entries.")
+	} else {
+		a.auditQuery = nil
+	}
+	a.displayLocalSystemMessage(strings.Join(lines, "\n"))
+}
+
+// formatInvite renders an invite as "CODE (uses, expiry)" for system messages
+func formatInvite(inv *models.Invite) string {
+	uses := fmt.Sprintf("%d uses", inv.Uses)
+	if inv.MaxUses > 0 {
+		uses = fmt.Sprintf("%d/%d uses", inv.Uses, inv.MaxUses)
+	}
+	expiry := "never expires"
+	if inv.ExpiresAt != nil {
+		expiry = "expires " + inv.ExpiresAt.Local().Format("Jan 2 15:04")
+	}
+	return fmt.Sprintf("%s (%s, %s)", inv.Code, uses, expiry)
+}
+
+// formatSession renders a login session for the /sessions listing
+func formatSession(session *models.Session) string {
+	device := session.UserAgent
+	if device == "" {
+		device = "Unknown device"
+	}
+	lastActive := session.CreatedAt
+	if session.LastUsedAt != nil {
+		lastActive = *session.LastUsedAt
+	}
+	details := []string{"active " + lastActive.Local().Format("Jan 2 15:04")}
+	if session.IPAddress != "" {
+		details = append([]string{session.IPAddress}, details...)
+	}
+	details = append(details, "expires "+session.ExpiresAt.Local().Format("Jan 2"))
+	line := fmt.Sprintf("%s (%s)", device, strings.Join(details, ", "))
+	if session.Current {
+		line += " [this device]"
+	}
+	return line
+}
+
 // updateMentionPopup checks the current input for a trailing @query and updates the popup.
 // Call this whenever the input value changes.
 func (a *App) updateMentionPopup() {
@@ -2717,7 +3325,7 @@ func (a *App) updateMentionPopup() {
 	var suggestions []string
 	if a.activeConn != nil {
 		a.activeConn.mu.RLock()
-		for _, m := range a.activeConn.Members {
+		for _, m := range a.activeConn.Members[a.getActiveServerID()] {
 			if m.User != nil && strings.HasPrefix(strings.ToLower(m.User.Username), query) {
 				suggestions = append(suggestions, m.User.Username)
 				if len(suggestions) >= 5 {
@@ -2773,6 +3381,7 @@ func (a *App) handleTabCompletion() {
 		"delete-category",
 		"rename-channel",
 		"move-channel",
+		"slowmode",
 		"theme",
 		"mute",
 		"unmute",
@@ -2780,6 +3389,18 @@ func (a *App) handleTabCompletion() {
 		"kick",
 		"ban",
 		"whisper",
+		"dm",
+		"react",
+		"unreact",
+		"invite",
+		"overwrite",
+		"audit",
+		"search",
+		"backup",
+		"sessions",
+		"logout",
+		"server",
+		"thread",
 		"help",
 	}
 
@@ -2813,6 +3434,10 @@ type AutoConnectMsg struct {
 	Err      error
 }
 
+// errPasswordRequired means a server has no saved token and the identity
+// password isn't saved either (--no-save-password)
+var errPasswordRequired = errors.New("enter your password to sign in")
+
 // ConnectedMsg indicates successful connection
 type ConnectedMsg struct{}
 
@@ -2843,6 +3468,10 @@ type afkCheckMsg struct{ t time.Time }
 // typingTickMsg drives the typing indicator animation and expiry pruning
 type typingTickMsg time.Time
 
+// beginEditMsg moves a message into the input box for editing. It is delivered
+// after the triggering key press so the key isn't typed into the input.
+type beginEditMsg struct{ msg *MessageDisplay }
+
 // ConnectionFailedMsg indicates connection failed
 type ConnectionFailedMsg struct {
 	ServerID uuid.UUID
@@ -2938,6 +3567,41 @@ func (a *App) handleServerScopedMessage(scopedMsg ServerScopedMsg) tea.Cmd {
 			a.statusMessage = fmt.Sprintf("Error: %s", msg.Error)
 			a.statusError = true
 		}
+
+	case SessionRevokedMsg:
+		// The token is dead on the server; forget it so it isn't offered again
+		sc.SetState(StateDisconnected)
+		sc.mu.Lock()
+		sc.Token = ""
+		sc.Sessions = nil
+		sc.mu.Unlock()
+		if creds := sc.ServerInfo.SavedCredentials; creds != nil {
+			creds.Token = ""
+			creds.EncryptedToken = ""
+		}
+		a.statusMessage = fmt.Sprintf("Signed out of %s: %s", sc.ServerInfo.Name, msg.Reason)
+		a.statusError = true
+		if a.localIdentity == nil && a.currentClientServer != nil && a.currentClientServer.ID == serverID {
+			a.view = ViewLogin
+			a.initLoginView()
+			a.loginError = "Signed out: " + msg.Reason
+		}
+		return func() tea.Msg {
+			if err := a.configMgr.ClearServerToken(serverID); err != nil {
+				return ErrorMsg{Error: fmt.Sprintf("Failed to clear saved token: %v", err)}
+			}
+			return nil
+		}
+
+	case CertificatePinnedMsg:
+		a.statusMessage = fmt.Sprintf("Trusted %s's certificate on first use (SHA-256 %s)", sc.ServerInfo.Name, msg.Fingerprint)
+		a.statusError = false
+		return func() tea.Msg {
+			if err := a.configMgr.UpdateServerFingerprint(serverID, msg.Fingerprint); err != nil {
+				return ErrorMsg{Error: fmt.Sprintf("Failed to save certificate pin: %v", err)}
+			}
+			return nil
+		}
 	}
 
 	return nil
@@ -2970,17 +3634,23 @@ func (a *App) handleProtocolMessage(serverID uuid.UUID, msg *protocol.Message) t
 	case protocol.OpInvalidSession:
 		// Token was rejected by server
 		sc.SetState(StateError)
-		if a.localIdentity != nil {
+		if a.localIdentity != nil && a.localIdentity.Password != "" {
 			// We have a local identity — retry with HTTP login (which is synchronous and reliable)
 			return a.autoConnectServer(serverID)
 		}
-		// No local identity — fall back to login screen
+		// No password to log in with — fall back to login screen
 		if a.currentClientServer != nil && a.currentClientServer.ID == serverID {
 			a.view = ViewLogin
 			a.initLoginView()
 			a.loginError = "Session invalid, please log in again"
 		}
-		return nil
+		// The saved token is dead; don't offer it again
+		return func() tea.Msg {
+			if err := a.configMgr.ClearServerToken(serverID); err != nil {
+				log.Printf("Failed to clear saved token: %v", err)
+			}
+			return nil
+		}
 	}
 
 	return nil
@@ -2997,8 +3667,24 @@ func (a *App) handleReady(serverID uuid.UUID, payload *protocol.ReadyPayload) te
 	sc.mu.Lock()
 	sc.User = payload.User
 	sc.Servers = payload.Servers
+	sc.DMChannels = nil
 	sc.mu.Unlock()
 
+	for _, ch := range payload.PrivateChannels {
+		sc.AddDMChannel(ch, payload.PrivateChannelUsers)
+	}
+
+	// DMs that arrived while offline show up as unread; history loads on open
+	for _, m := range payload.UndeliveredMessages {
+		if a.mutedChannels[m.ChannelID] {
+			continue
+		}
+		if a.unreadCounts[serverID] == nil {
+			a.unreadCounts[serverID] = make(map[uuid.UUID]int)
+		}
+		a.unreadCounts[serverID][m.ChannelID]++
+	}
+
 	// Mark as ready
 	sc.SetState(StateReady)
 
@@ -3015,6 +3701,9 @@ func (a *App) handleReady(serverID uuid.UUID, payload *protocol.ReadyPayload) te
 		}
 
 		a.statusMessage = "Ready"
+		if n := len(payload.UndeliveredMessages); n > 0 {
+			a.statusMessage = fmt.Sprintf("Ready - %d new direct message(s)", n)
+		}
 		a.statusError = false
 	}
 
@@ -3053,6 +3742,36 @@ func (a *App) handleDispatch(serverID uuid.UUID, msg *protocol.Message) tea.Cmd
 
 		// SERVER_CREATE events will follow with channels for each server
 
+	case protocol.EventDMChannelOpen:
+		var payload protocol.DMChannelPayload
+		if err := json.Unmarshal(msg.Data, &payload); err != nil {
+			log.Printf("Failed to parse DM_CHANNEL_OPEN payload: %v", err)
+			return nil
+		}
+		sc.AddDMChannel(payload.Channel, payload.Recipients)
+
+		// Open the conversation if it was requested with /dm from this client
+		if a.activeConn == sc && a.pendingDMRecipient != uuid.Nil {
+			for _, id := range payload.Channel.RecipientIDs {
+				if id == a.pendingDMRecipient {
+					a.pendingDMRecipient = uuid.Nil
+					a.selectDMChannel(payload.Channel)
+					a.focus = FocusInput
+					a.input.Focus()
+					break
+				}
+			}
+		}
+
+	case protocol.EventResumed:
+		// Missed dispatches were replayed ahead of RESUMED
+		sc.SetState(StateReady)
+		log.Printf("Session resumed on server %s", serverID)
+		if a.activeConn == sc {
+			a.statusMessage = "Reconnected"
+			a.statusError = false
+		}
+
 	case protocol.EventServerCreate:
 		// Parse server create payload
 		var payload protocol.ServerCreatePayload
@@ -3084,9 +3803,10 @@ func (a *App) handleDispatch(serverID uuid.UUID, msg *protocol.Message) tea.Cmd
 			displays = append(displays, buildMemberDisplay(m, user, roleMap))
 		}
 
+		sc.UpsertServer(payload.Server)
 		sc.mu.Lock()
 		sc.Roles[payload.Server.ID] = payload.Roles
-		sc.Members = displays
+		sc.Members[payload.Server.ID] = displays
 		sc.mu.Unlock()
 
 		log.Printf("Received SERVER_CREATE for %s: %d channels, %d members, %d roles",
@@ -3108,6 +3828,93 @@ func (a *App) handleDispatch(serverID uuid.UUID, msg *protocol.Message) tea.Cmd
 			}
 		}
 
+		// A server made with /server create opens as soon as it arrives
+		if a.activeConn == sc && a.pendingServerName != "" &&
+			payload.Server.Name == a.pendingServerName && sc.User != nil && payload.Server.OwnerID == sc.User.ID {
+			a.pendingServerName = ""
+			sc.mu.RLock()
+			index := len(sc.Servers) - 1
+			for i, s := range sc.Servers {
+				if s.ID == payload.Server.ID {
+					index = i
+					break
+				}
+			}
+			sc.mu.RUnlock()
+			a.switchToProtocolServer(index)
+			a.statusMessage = fmt.Sprintf("Created server %s", payload.Server.Name)
+			a.statusError = false
+		}
+
+	case protocol.EventServerUpdate:
+		var payload protocol.ServerUpdatePayload
+		if err := json.Unmarshal(msg.Data, &payload); err != nil || payload.Server == nil {
+			log.Printf("Failed to parse SERVER_UPDATE payload: %v", err)
+			return nil
+		}
+		sc.mu.RLock()
+		var previous *models.Server
+		for _, s := range sc.Servers {
+			if s.ID == payload.Server.ID {
+				previous = s
+				break
+			}
+		}
+		sc.mu.RUnlock()
+		sc.UpsertServer(payload.Server)
+		if a.currentServer != nil && a.currentServer.ID == payload.Server.ID {
+			a.currentServer = payload.Server
+		}
+		if a.activeConn == sc && previous != nil && previous.OwnerID != payload.Server.OwnerID {
+			owner := "another member"
+			for _, m := range sc.GetMembers(payload.Server.ID) {
+				if m.User != nil && m.User.ID == payload.Server.OwnerID {
+					owner = m.User.Username
+					break
+				}
+			}
+			a.displayLocalSystemMessage(fmt.Sprintf("%s is now owned by %s.", payload.Server.Name, owner))
+		}
+
+	case protocol.EventServerDelete:
+		var payload protocol.ServerDeletePayload
+		if err := json.Unmarshal(msg.Data, &payload); err != nil {
+			log.Printf("Failed to parse SERVER_DELETE payload: %v", err)
+			return nil
+		}
+		name := "a server"
+		sc.mu.RLock()
+		for _, s := range sc.Servers {
+			if s.ID == payload.ServerID {
+				name = s.Name
+				break
+			}
+		}
+		sc.mu.RUnlock()
+		sc.RemoveServer(payload.ServerID)
+		log.Printf("Removed from server %s (ID=%s)", name, payload.ServerID)
+
+		if a.activeConn == sc {
+			if a.currentServer != nil && a.currentServer.ID == payload.ServerID {
+				a.currentServer = nil
+				a.currentChannel = nil
+				a.channelTree = nil
+				a.switchToProtocolServer(0)
+			} else {
+				// Servers listed after the removed one moved up
+				sc.mu.RLock()
+				for i, s := range sc.Servers {
+					if a.currentServer != nil && s.ID == a.currentServer.ID {
+						a.protocolServerIndex = i
+						break
+					}
+				}
+				sc.mu.RUnlock()
+			}
+			a.statusMessage = fmt.Sprintf("You are no longer in %s", name)
+			a.statusError = false
+		}
+
 	case protocol.EventMessageCreate:
 		// Parse message payload
 		var payload protocol.MessageCreatePayload
@@ -3128,9 +3935,18 @@ func (a *App) handleDispatch(serverID uuid.UUID, msg *protocol.Message) tea.Cmd
 		// Add message to connection's message history
 		sc.AddMessage(payload.Message.ChannelID, display)
 
-		// Unread tracking: increment if this channel is not currently viewed
+		// A reply in a thread bumps the count shown under its anchor
+		thread := sc.GetThread(payload.Message.ChannelID)
+		if thread != nil {
+			sc.CountThreadReply(thread.ID, 1, payload.Message.CreatedAt)
+		}
+
+		// Unread tracking: increment if this channel is not currently viewed.
+		// Threads count on their own, and are muted along with their parent.
 		isCurrentChannel := a.currentChannel != nil && a.currentChannel.ID == payload.Message.ChannelID
-		if !isCurrentChannel && !a.mutedChannels[payload.Message.ChannelID] {
+		isOpenThread := a.thread != nil && a.thread.Thread.ID == payload.Message.ChannelID
+		muted := a.mutedChannels[payload.Message.ChannelID] || (thread != nil && a.mutedChannels[thread.ParentID])
+		if !isCurrentChannel && !isOpenThread && !muted {
 			if a.unreadCounts[serverID] == nil {
 				a.unreadCounts[serverID] = make(map[uuid.UUID]int)
 			}
@@ -3160,7 +3976,73 @@ func (a *App) handleDispatch(serverID uuid.UUID, msg *protocol.Message) tea.Cmd
 				log.Printf("Message not for current channel: msg=%s, current=%s",
 					payload.Message.ChannelID, a.currentChannel.ID)
 			}
+			if isOpenThread {
+				a.updateThreadContent()
+				a.thread.Viewport.GotoBottom()
+			}
+			if thread != nil {
+				a.refreshThreadAnchor(sc, thread.ID)
+			}
+		}
+
+	case protocol.EventMessageUpdate:
+		var payload protocol.MessageUpdatePayload
+		if err := json.Unmarshal(msg.Data, &payload); err != nil {
+			log.Printf("Failed to parse MESSAGE_UPDATE payload: %v", err)
+			return nil
+		}
+		if !sc.UpdateMessage(payload.ChannelID, payload.ID, payload.Content, payload.EditedAt) {
+			return nil
+		}
+		if a.activeConn == sc && a.currentChannel != nil && a.currentChannel.ID == payload.ChannelID {
+			a.updateChatContent()
+		}
+		a.refreshOpenThread(sc, payload.ChannelID)
+
+	case protocol.EventMessageDelete:
+		var payload protocol.MessageDeletePayload
+		if err := json.Unmarshal(msg.Data, &payload); err != nil {
+			log.Printf("Failed to parse MESSAGE_DELETE payload: %v", err)
+			return nil
+		}
+		// A deleted reply lowers its thread's count even when it isn't cached
+		if sc.CountThreadReply(payload.ChannelID, -1, time.Time{}) {
+			a.refreshThreadAnchor(sc, payload.ChannelID)
+		}
+		if !sc.RemoveMessage(payload.ChannelID, payload.ID) {
+			return nil
+		}
+		if a.editingMessageID == payload.ID {
+			a.cancelMessageEdit()
+		}
+		if a.activeConn == sc && a.currentChannel != nil && a.currentChannel.ID == payload.ChannelID {
+			// Keep the navigation cursor on a valid message
+			if n := len(sc.GetMessages(payload.ChannelID)); n == 0 {
+				a.messageNavMode = false
+				a.inMessageEditMode = false
+				a.messageNavIndex = 0
+				a.pendingDeleteID = uuid.Nil
+			} else if a.messageNavIndex >= n {
+				a.messageNavIndex = n - 1
+			}
+			a.updateChatContent()
+		}
+		a.refreshOpenThread(sc, payload.ChannelID)
+
+	case protocol.EventMessageReactionAdd, protocol.EventMessageReactionRemove:
+		var payload protocol.ReactionPayload
+		if err := json.Unmarshal(msg.Data, &payload); err != nil {
+			log.Printf("Failed to parse %s payload: %v", msg.Type, err)
+			return nil
 		}
+		add := msg.Type == protocol.EventMessageReactionAdd
+		if !sc.ApplyReaction(payload.ChannelID, payload.MessageID, payload.Emoji, payload.UserID, add) {
+			return nil
+		}
+		if a.activeConn == sc && a.currentChannel != nil && a.currentChannel.ID == payload.ChannelID {
+			a.updateChatContent()
+		}
+		a.refreshOpenThread(sc, payload.ChannelID)
 
 	case protocol.EventMessagesHistory:
 		// Parse message history payload
@@ -3173,15 +4055,20 @@ func (a *App) handleDispatch(serverID uuid.UUID, msg *protocol.Message) tea.Cmd
 		// Store messages in the server-scoped connection (not a.activeConn which may
 		// point to a different server if the user switched servers between request/response)
 		sc.mu.Lock()
-		// Clear existing messages first
-		sc.Messages[payload.ChannelID] = nil
-
 		// Determine current user ID for IsOwn flag
 		var currentUserID uuid.UUID
 		if sc.User != nil {
 			currentUserID = sc.User.ID
 		}
 
+		// A page requested with Before goes ahead of the cached messages;
+		// anything else replaces them
+		var newer []*MessageDisplay
+		if payload.Before != nil {
+			newer = sc.Messages[payload.ChannelID]
+		}
+		sc.Messages[payload.ChannelID] = nil
+
 		// Add historical messages
 		for _, msgDisplay := range payload.Messages {
 			isSystem := msgDisplay.Type == models.MessageTypeSystem
@@ -3198,6 +4085,7 @@ func (a *App) handleDispatch(serverID uuid.UUID, msg *protocol.Message) tea.Cmd
 				display,
 			)
 		}
+		sc.Messages[payload.ChannelID] = append(sc.Messages[payload.ChannelID], newer...)
 
 		// Populate pinned messages for this channel
 		if payload.PinnedMessages != nil {
@@ -3205,13 +4093,44 @@ func (a *App) handleDispatch(serverID uuid.UUID, msg *protocol.Message) tea.Cmd
 		}
 		sc.mu.Unlock()
 
+		if a.activeConn == sc && a.thread != nil && a.thread.Thread.ID == payload.ChannelID {
+			a.showThreadHistory(payload.HasMore, payload.Before != nil)
+			return nil
+		}
+
 		// Refresh chat if we're currently viewing this channel on this server
 		if a.activeConn != nil && a.activeConn.ServerID == serverID &&
 			a.currentChannel != nil && a.currentChannel.ID == payload.ChannelID {
+			if payload.Around != nil {
+				return a.focusMessage(*payload.Around)
+			}
 			a.updateChatContent()
 			a.scrollToBottom()
 		}
 
+	case protocol.EventMessagesFetched:
+		var payload protocol.MessagesFetchedPayload
+		if err := json.Unmarshal(msg.Data, &payload); err != nil {
+			log.Printf("Failed to parse MESSAGES_FETCHED payload: %v", err)
+			return nil
+		}
+		parents := make([]*MessageDisplay, 0, len(payload.Messages))
+		for _, m := range payload.Messages {
+			parents = append(parents, &MessageDisplay{
+				Message:     m.Message,
+				AuthorName:  m.Author.Username,
+				AuthorColor: a.theme.Colors.Purple,
+				IsOwn:       m.Author.ID == sc.User.ID,
+				ShowHeader:  true,
+			})
+		}
+		sc.StoreReplyParents(parents, payload.Missing)
+
+		// Swap the "loading…" quotes for the fetched previews
+		if a.activeConn == sc && a.currentChannel != nil && a.currentChannel.ID == payload.ChannelID {
+			a.updateChatContent()
+		}
+
 	case protocol.EventPresenceUpdate:
 		var payload protocol.PresenceUpdateEventPayload
 		if err := json.Unmarshal(msg.Data, &payload); err != nil {
@@ -3219,10 +4138,12 @@ func (a *App) handleDispatch(serverID uuid.UUID, msg *protocol.Message) tea.Cmd
 			return nil
 		}
 		sc.mu.Lock()
-		for _, m := range sc.Members {
-			if m.User.ID == payload.User.ID {
-				m.User.Status = payload.Status
-				break
+		for _, members := range sc.Members {
+			for _, m := range members {
+				if m.User.ID == payload.User.ID {
+					m.User.Status = payload.Status
+					break
+				}
 			}
 		}
 		sc.mu.Unlock()
@@ -3244,16 +4165,17 @@ func (a *App) handleDispatch(serverID uuid.UUID, msg *protocol.Message) tea.Cmd
 		sc.mu.Lock()
 		// Upsert: update the existing entry if the user is already in the list
 		// (e.g. they were shown as offline and have just reconnected), otherwise append.
+		members := sc.Members[payload.ServerID]
 		found := false
-		for i, m := range sc.Members {
+		for i, m := range members {
 			if m.User != nil && m.User.ID == payload.User.ID {
-				sc.Members[i] = display
+				members[i] = display
 				found = true
 				break
 			}
 		}
 		if !found {
-			sc.Members = append(sc.Members, display)
+			sc.Members[payload.ServerID] = append(members, display)
 		}
 		sc.mu.Unlock()
 
@@ -3264,9 +4186,10 @@ func (a *App) handleDispatch(serverID uuid.UUID, msg *protocol.Message) tea.Cmd
 			return nil
 		}
 		sc.mu.Lock()
-		for i, m := range sc.Members {
+		members := sc.Members[payload.ServerID]
+		for i, m := range members {
 			if m.User.ID == payload.User.ID {
-				sc.Members = append(sc.Members[:i], sc.Members[i+1:]...)
+				sc.Members[payload.ServerID] = append(members[:i], members[i+1:]...)
 				break
 			}
 		}
@@ -3288,7 +4211,7 @@ func (a *App) handleDispatch(serverID uuid.UUID, msg *protocol.Message) tea.Cmd
 		if sc.User != nil && payload.User.ID == sc.User.ID {
 			sc.mu.RLock()
 			var prevMuted bool
-			for _, m := range sc.Members {
+			for _, m := range sc.Members[payload.ServerID] {
 				if m.User != nil && m.User.ID == sc.User.ID {
 					prevMuted = m.Member != nil && m.Member.IsMuted
 					break
@@ -3303,14 +4226,46 @@ func (a *App) handleDispatch(serverID uuid.UUID, msg *protocol.Message) tea.Cmd
 		}
 
 		sc.mu.Lock()
-		for i, m := range sc.Members {
+		members := sc.Members[payload.ServerID]
+		for i, m := range members {
 			if m.User != nil && m.User.ID == payload.User.ID {
-				sc.Members[i] = buildMemberDisplay(payload.Member, payload.User, roleMap)
+				members[i] = buildMemberDisplay(payload.Member, payload.User, roleMap)
 				break
 			}
 		}
 		sc.mu.Unlock()
 
+	case "":
+		// Errors are dispatched without an event type
+		var payload protocol.ErrorPayload
+		if err := json.Unmarshal(msg.Data, &payload); err != nil || payload.Message == "" {
+			return nil
+		}
+		log.Printf("Server error %d: %s", payload.Code, payload.Message)
+		if a.activeConn == sc {
+			// Slowmode rejections say how long to wait; count that down
+			if payload.Code == protocol.ErrorCodeRateLimited && payload.RetryAfter > 0 && a.currentChannel != nil {
+				a.startSlowmode(a.currentChannel.ID, time.Duration(payload.RetryAfter)*time.Second)
+			}
+			a.displayLocalSystemMessage(formatServerError(payload))
+		}
+
+	case protocol.EventRoleCreate, protocol.EventRoleUpdate:
+		var payload protocol.RolePayload
+		if err := json.Unmarshal(msg.Data, &payload); err != nil {
+			log.Printf("Failed to parse %s payload: %v", msg.Type, err)
+			return nil
+		}
+		sc.UpsertRole(payload.ServerID, payload.Role)
+
+	case protocol.EventRoleDelete:
+		var payload protocol.RoleDeletePayload
+		if err := json.Unmarshal(msg.Data, &payload); err != nil {
+			log.Printf("Failed to parse ROLE_DELETE payload: %v", err)
+			return nil
+		}
+		sc.RemoveRole(payload.ServerID, payload.RoleID)
+
 	case protocol.EventWhisperCreate:
 		var whisperPayload protocol.WhisperCreatePayload
 		if err := json.Unmarshal(msg.Data, &whisperPayload); err != nil {
@@ -3341,6 +4296,89 @@ func (a *App) handleDispatch(serverID uuid.UUID, msg *protocol.Message) tea.Cmd
 			a.scrollToBottom()
 		}
 
+	case protocol.EventInviteCreate, protocol.EventInviteDelete:
+		var payload protocol.InvitePayload
+		if err := json.Unmarshal(msg.Data, &payload); err != nil || payload.Invite == nil {
+			log.Printf("Failed to parse %s payload: %v", msg.Type, err)
+			return nil
+		}
+		if a.activeConn != nil && a.activeConn.ServerID == serverID {
+			if msg.Type == protocol.EventInviteDelete {
+				a.displayLocalSystemMessage(fmt.Sprintf("Invite %s revoked.", payload.Invite.Code))
+			} else {
+				a.displayLocalSystemMessage("Invite created: " + formatInvite(payload.Invite))
+			}
+		}
+
+	case protocol.EventInvitesList:
+		var payload protocol.InvitesListPayload
+		if err := json.Unmarshal(msg.Data, &payload); err != nil {
+			log.Printf("Failed to parse INVITES_LIST payload: %v", err)
+			return nil
+		}
+		if a.activeConn != nil && a.activeConn.ServerID == serverID {
+			if len(payload.Invites) == 0 {
+				a.displayLocalSystemMessage("No active invites.")
+				return nil
+			}
+			lines := []string{"Active invites:"}
+			for _, inv := range payload.Invites {
+				lines = append(lines, "  "+formatInvite(inv))
+			}
+			a.displayLocalSystemMessage(strings.Join(lines, "\n"))
+		}
+
+	case protocol.EventSessionsList:
+		var payload protocol.SessionsListPayload
+		if err := json.Unmarshal(msg.Data, &payload); err != nil {
+			log.Printf("Failed to parse SESSIONS_LIST payload: %v", err)
+			return nil
+		}
+		sc.mu.Lock()
+		sc.Sessions = payload.Sessions
+		sc.mu.Unlock()
+		if a.activeConn != nil && a.activeConn.ServerID == serverID {
+			var lines []string
+			if payload.Revoked > 0 {
+				lines = append(lines, fmt.Sprintf("Signed out %d session(s).", payload.Revoked))
+			}
+			lines = append(lines, "Signed-in devices:")
+			for i, session := range payload.Sessions {
+				lines = append(lines, fmt.Sprintf("  %d. %s", i+1, formatSession(session)))
+			}
+			a.displayLocalSystemMessage(strings.Join(lines, "\n"))
+		}
+
+	case protocol.EventAuditLog:
+		var payload protocol.AuditLogPayload
+		if err := json.Unmarshal(msg.Data, &payload); err != nil {
+			log.Printf("Failed to parse AUDIT_LOG payload: %v", err)
+			return nil
+		}
+		if a.activeConn != nil && a.activeConn.ServerID == serverID {
+			a.displayAuditLog(payload)
+		}
+
+	case protocol.EventSearchResults:
+		var payload protocol.SearchResultsPayload
+		if err := json.Unmarshal(msg.Data, &payload); err != nil {
+			log.Printf("Failed to parse SEARCH_RESULTS payload: %v", err)
+			return nil
+		}
+		if a.activeConn != nil && a.activeConn.ServerID == serverID {
+			a.openSearchResults(payload)
+		}
+
+	case protocol.EventBackupComplete:
+		var payload protocol.BackupCompletePayload
+		if err := json.Unmarshal(msg.Data, &payload); err != nil {
+			log.Printf("Failed to parse BACKUP_COMPLETE payload: %v", err)
+			return nil
+		}
+		if a.activeConn != nil && a.activeConn.ServerID == serverID {
+			a.displayLocalSystemMessage(fmt.Sprintf("Backup written to %s on the host (%d KB)", payload.File, (payload.Bytes+1023)/1024))
+		}
+
 	case protocol.EventMessagePin:
 		var payload protocol.MessagePinPayload
 		if err := json.Unmarshal(msg.Data, &payload); err != nil {
@@ -3425,20 +4463,49 @@ func (a *App) handleDispatch(serverID uuid.UUID, msg *protocol.Message) tea.Cmd
 		if err := json.Unmarshal(msg.Data, &typingPayload); err != nil {
 			return nil
 		}
-		// Only show for the channel the user is currently viewing on this server
-		if a.currentChannel == nil || typingPayload.ChannelID != a.currentChannel.ID {
-			return nil
-		}
 		// Never show our own typing indicator
 		if sc.User != nil && typingPayload.UserID == sc.User.ID {
 			return nil
 		}
+		// Typing in the open thread shows under the thread pane
+		if a.activeConn == sc && a.thread != nil && typingPayload.ChannelID == a.thread.Thread.ID {
+			a.noteThreadTyping(typingPayload.UserID)
+			return nil
+		}
+		// Only show for the channel the user is currently viewing on this server
+		if a.currentChannel == nil || typingPayload.ChannelID != a.currentChannel.ID {
+			return nil
+		}
 		if a.typingExpiry == nil {
 			a.typingExpiry = make(map[uuid.UUID]time.Time)
 		}
 		a.typingExpiry[typingPayload.UserID] = time.Now().Add(10 * time.Second)
 		a.rebuildTypingUsers()
 
+	case protocol.EventThreadCreate:
+		var payload protocol.ThreadCreatePayload
+		if err := json.Unmarshal(msg.Data, &payload); err != nil {
+			log.Printf("Failed to parse THREAD_CREATE payload: %v", err)
+			return nil
+		}
+		sc.UpsertThread(payload.Channel)
+		// Open the thread we just started with /thread create
+		if a.activeConn == sc && a.pendingThreadAnchor != uuid.Nil &&
+			payload.Channel.ParentMessageID == a.pendingThreadAnchor {
+			a.pendingThreadAnchor = uuid.Nil
+			a.openThread(payload.Channel)
+			return nil
+		}
+		a.refreshThreadAnchor(sc, payload.Channel.ID)
+
+	case protocol.EventThreadUpdate:
+		var payload protocol.ThreadUpdatePayload
+		if err := json.Unmarshal(msg.Data, &payload); err != nil {
+			log.Printf("Failed to parse THREAD_UPDATE payload: %v", err)
+			return nil
+		}
+		a.applyThreadUpdate(sc, payload.Channel)
+
 	case protocol.EventChannelCreate:
 		// Parse channel payload
 		var payload protocol.ChannelCreatePayload
@@ -3473,16 +4540,26 @@ func (a *App) handleDispatch(serverID uuid.UUID, msg *protocol.Message) tea.Cmd
 			log.Printf("Failed to parse CHANNEL_UPDATE payload: %v", err)
 			return nil
 		}
+		if payload.Channel.IsThread() {
+			a.applyThreadUpdate(sc, payload.Channel)
+			return nil
+		}
 
-		// Update in server connection's channels
+		// Update in server connection's channels, adding it if it just became
+		// visible through a permission overwrite change
 		sc.mu.Lock()
 		protocolServerID := payload.Channel.ServerID
+		known := false
 		for i, ch := range sc.Channels[protocolServerID] {
 			if ch.ID == payload.Channel.ID {
 				sc.Channels[protocolServerID][i] = payload.Channel
+				known = true
 				break
 			}
 		}
+		if !known {
+			sc.Channels[protocolServerID] = append(sc.Channels[protocolServerID], payload.Channel)
+		}
 		sc.mu.Unlock()
 
 		// Update tree if this is the active connection AND the channel is for current protocol server
@@ -3493,6 +4570,18 @@ func (a *App) handleDispatch(serverID uuid.UUID, msg *protocol.Message) tea.Cmd
 					a.channelTree.RebuildFlatList(a.collapsedCategories)
 				}
 			}
+			if a.currentChannel != nil && a.currentChannel.ID == payload.Channel.ID {
+				oldRate := a.currentChannel.RateLimitPerUser
+				a.currentChannel = payload.Channel
+				if rate := payload.Channel.RateLimitPerUser; rate != oldRate {
+					delete(a.slowmodeUntil, payload.Channel.ID)
+					if rate == 0 {
+						a.displayLocalSystemMessage("Slowmode is off")
+					} else {
+						a.displayLocalSystemMessage(fmt.Sprintf("Slowmode is on: one message every %s", formatCountdown(time.Duration(rate)*time.Second)))
+					}
+				}
+			}
 		}
 
 	case protocol.EventChannelDelete:
@@ -3502,6 +4591,14 @@ func (a *App) handleDispatch(serverID uuid.UUID, msg *protocol.Message) tea.Cmd
 			log.Printf("Failed to parse CHANNEL_DELETE payload: %v", err)
 			return nil
 		}
+		if payload.Type == models.ChannelTypeThread {
+			a.removeThread(sc, payload.ChannelID)
+			return nil
+		}
+		// The channel's threads go with it
+		for _, thread := range sc.ChannelThreads(payload.ChannelID) {
+			a.removeThread(sc, thread.ID)
+		}
 
 		// Remove from server connection's channels
 		sc.mu.Lock()
@@ -4,8 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/concord-chat/concord/internal/models"
 	"github.com/concord-chat/concord/internal/protocol"
@@ -62,6 +65,8 @@ func (ch *CommandHandler) Execute(cmd *Command) (string, error) {
 		return ch.handleRenameChannel(cmd.Args)
 	case "move-channel":
 		return ch.handleMoveChannel(cmd.Args)
+	case "slowmode":
+		return ch.handleSlowmode(cmd.Args)
 	case "help":
 		return ch.handleHelp(cmd.Args)
 	case "theme":
@@ -93,8 +98,32 @@ func (ch *CommandHandler) Execute(cmd *Command) (string, error) {
 		return ch.handleUnpin(cmd.Args)
 	case "whisper", "w":
 		return ch.handleWhisper(cmd.Args)
+	case "dm":
+		return ch.handleDM(cmd.Args)
+	case "react":
+		return ch.handleReact(cmd.Args, true)
+	case "unreact":
+		return ch.handleReact(cmd.Args, false)
 	case "links":
 		return ch.handleLinks(cmd.Args)
+	case "invite":
+		return ch.handleInvite(cmd.Args)
+	case "overwrite":
+		return ch.handleOverwrite(cmd.Args)
+	case "audit":
+		return ch.handleAudit(cmd.Args)
+	case "search":
+		return ch.handleSearch(cmd.Args)
+	case "backup":
+		return ch.handleBackup()
+	case "sessions":
+		return ch.handleSessions(cmd.Args)
+	case "logout":
+		return ch.handleLogout()
+	case "server":
+		return ch.handleServer(cmd.Args)
+	case "thread":
+		return ch.handleThread(cmd.Args)
 	default:
 		return "", fmt.Errorf("unknown command: %s", cmd.Name)
 	}
@@ -286,6 +315,50 @@ func (ch *CommandHandler) handleRenameChannel(args []string) (string, error) {
 	return fmt.Sprintf("Renaming channel to #%s...", newName), nil
 }
 
+// handleSlowmode handles /slowmode <seconds|duration|off> for the current channel
+func (ch *CommandHandler) handleSlowmode(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", errors.New("usage: /slowmode <seconds|off>  (e.g. 30, 5m, off)")
+	}
+	if ch.app.activeConn == nil || ch.app.currentServer == nil {
+		return "", errors.New("not connected to a server")
+	}
+	if ch.app.currentChannel == nil {
+		return "", errors.New("no channel selected")
+	}
+
+	var seconds int
+	switch arg := strings.ToLower(args[0]); {
+	case arg == "off":
+		seconds = 0
+	case strings.IndexFunc(arg, unicode.IsLetter) >= 0:
+		d, err := time.ParseDuration(arg)
+		if err != nil || d < 0 {
+			return "", fmt.Errorf("invalid duration %q", args[0])
+		}
+		seconds = int(d / time.Second)
+	default:
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("invalid number of seconds %q", args[0])
+		}
+		seconds = n
+	}
+
+	req := &protocol.ChannelUpdateRequest{
+		ServerID:         ch.app.currentServer.ID,
+		ChannelID:        ch.app.currentChannel.ID,
+		RateLimitPerUser: &seconds,
+	}
+	if err := ch.sendModMsg(protocol.OpChannelUpdate, req); err != nil {
+		return "", err
+	}
+	if seconds == 0 {
+		return fmt.Sprintf("Turning off slowmode in #%s...", ch.app.currentChannel.Name), nil
+	}
+	return fmt.Sprintf("Setting slowmode in #%s to %s...", ch.app.currentChannel.Name, formatCountdown(time.Duration(seconds)*time.Second)), nil
+}
+
 func (ch *CommandHandler) handleMoveChannel(args []string) (string, error) {
 	if len(args) < 1 {
 		return "", errors.New("usage: /move-channel <category-name>")
@@ -345,10 +418,29 @@ func (ch *CommandHandler) handleHelp(args []string) (string, error) {
 	lines := []string{
 		"Available Commands:",
 		"/whisper @user <msg>       - Send an ephemeral DM (alias: /w)",
+		"/dm @user                  - Open a direct message conversation",
+		"/react <emoji> [N]         - React to the Nth most recent message (default: 1)",
+		"/unreact <emoji> [N]       - Remove your reaction from the Nth most recent message",
 		"/links [N]                 - Show links from recent N messages (default: 20)",
+		"/search <query>            - Search messages; filters: from:@user in:#channel",
+		"                             before:/after:YYYY-MM-DD has:link",
 		"/theme [name]              - Open theme browser, or apply theme directly",
 		"/mute                      - Mute current channel (suppress unread badges)",
 		"/unmute                    - Unmute current channel",
+		"/sessions                  - List devices signed in to your account",
+		"/sessions revoke <N>|others - Sign out the Nth device, or every other device",
+		"/logout                    - Sign out of this server on this device",
+		"/server [list]             - List your servers on this host",
+		"/server switch <name|N>    - Show another server",
+		"/server create <name>      - Create a server that you own",
+		"/server leave              - Leave the current server",
+		"/server delete <name>      - Delete the current server (owner)",
+		"/server transfer @user     - Make another member the owner (owner)",
+		"/thread create <name>      - Start a thread (on the message picked with t, or the latest)",
+		"/thread [list]             - List this channel's threads",
+		"/thread open <N|name>      - Open a thread beside the chat",
+		"/thread close              - Close the thread pane",
+		"/thread archive|unarchive  - Archive or reopen the open thread (owner or moderators)",
 	}
 
 	if level >= roleLevelMod {
@@ -359,6 +451,7 @@ func (ch *CommandHandler) handleHelp(args []string) (string, error) {
 			"/delete-category <name>    - Delete an empty category",
 			"/rename-channel <name>     - Rename the current channel",
 			"/move-channel <category>   - Move current channel to a category",
+			"/slowmode <seconds|off>    - Limit how often each member can post here",
 			"/mute @user [minutes]      - Server-mute a member",
 			"/unmute @user              - Server-unmute a member",
 			"/kick @user [reason]       - Kick a member from the server",
@@ -371,8 +464,20 @@ func (ch *CommandHandler) handleHelp(args []string) (string, error) {
 	if level >= roleLevelAdmin {
 		lines = append(lines,
 			"/role assign|remove @user <role> - Manage member roles",
+			"/role create <name> [#color]     - Create a role above everyone",
+			"/role edit <role> name|color|hoist|perms <value> - Edit a role",
+			"/role delete <role>              - Delete a role",
+			"/role move <role> <position>     - Reorder a role (1 = lowest)",
 			"/ban @user [reason]        - Permanently ban a member",
 			"/unban @user               - Lift a ban from a member",
+			"/invite [hours] [uses]     - Create an invite (0 = never expires / unlimited)",
+			"/invite list               - List active invites",
+			"/invite revoke <code>      - Revoke an invite",
+			"/overwrite <@user|role> allow|deny|neutral <perm,...> - Set channel permissions",
+			"/overwrite <@user|role> clear - Remove a channel overwrite",
+			"/audit [@user] [#channel] [action] - Show the audit log",
+			"/audit more                - Show older audit log entries",
+			"/backup                    - Back up the host's database",
 		)
 	}
 
@@ -389,7 +494,7 @@ func (ch *CommandHandler) resolveMember(mention string) *MemberDisplay {
 	}
 	sc.mu.RLock()
 	defer sc.mu.RUnlock()
-	for _, m := range sc.Members {
+	for _, m := range sc.Members[a.getActiveServerID()] {
 		if m.User != nil && strings.ToLower(m.User.Username) == name {
 			return m
 		}
@@ -437,10 +542,104 @@ func (ch *CommandHandler) handleWhisper(args []string) (string, error) {
 	return "", a.activeConn.Connection.Send(msg)
 }
 
+// handleDM handles /dm @user: asks the server for the DM channel, which is
+// opened when DM_CHANNEL_OPEN arrives
+func (ch *CommandHandler) handleDM(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("usage: /dm @user")
+	}
+	md := ch.resolveMember(args[0])
+	if md == nil {
+		return "", fmt.Errorf("user %s not found", args[0])
+	}
+	a := ch.app
+	if a.activeConn != nil && a.activeConn.User != nil && md.User.ID == a.activeConn.User.ID {
+		return "", fmt.Errorf("you cannot DM yourself")
+	}
+
+	// Reuse a DM we already know about without a round trip
+	if a.activeConn != nil {
+		for _, dm := range a.activeConn.GetDMChannels() {
+			for _, id := range dm.RecipientIDs {
+				if id == md.User.ID {
+					a.selectDMChannel(dm)
+					return "", nil
+				}
+			}
+		}
+	}
+
+	a.pendingDMRecipient = md.User.ID
+	if err := ch.sendModMsg(protocol.OpDMOpen, &protocol.DMOpenRequest{RecipientID: md.User.ID}); err != nil {
+		a.pendingDMRecipient = uuid.Nil
+		return "", err
+	}
+	return fmt.Sprintf("Opening DM with %s...", md.User.Username), nil
+}
+
+// handleReact handles /react <emoji> [N] and /unreact <emoji> [N]
+func (ch *CommandHandler) handleReact(args []string, add bool) (string, error) {
+	a := ch.app
+	if a.activeConn == nil || a.currentChannel == nil {
+		return "", fmt.Errorf("no channel selected")
+	}
+	if len(args) < 1 {
+		if add {
+			return "", fmt.Errorf("usage: /react <emoji> [N]")
+		}
+		return "", fmt.Errorf("usage: /unreact <emoji> [N]")
+	}
+	n := 1
+	if len(args) >= 2 {
+		parsed, err := strconv.Atoi(args[1])
+		if err != nil || parsed <= 0 {
+			return "", fmt.Errorf("invalid index %q — must be a positive integer", args[1])
+		}
+		n = parsed
+	}
+
+	// Only messages that exist on the server can carry reactions
+	var msgs []*MessageDisplay
+	for _, md := range a.activeConn.GetMessages(a.currentChannel.ID) {
+		if !md.IsSystem && !md.IsWhisper && md.AuthorName != "System" {
+			msgs = append(msgs, md)
+		}
+	}
+	if len(msgs) == 0 {
+		return "", fmt.Errorf("no messages in this channel")
+	}
+	if n > len(msgs) {
+		return "", fmt.Errorf("only %d messages available", len(msgs))
+	}
+	target := msgs[len(msgs)-n]
+
+	op := protocol.OpReactionAdd
+	if !add {
+		op = protocol.OpReactionRemove
+	}
+	return "", ch.sendModMsg(op, &protocol.ReactionRequest{
+		ChannelID: a.currentChannel.ID,
+		MessageID: target.Message.ID,
+		Emoji:     args[0],
+	})
+}
+
 // handleRole handles /role assign @user rolename  or  /role remove @user rolename
 func (ch *CommandHandler) handleRole(args []string) (string, error) {
+	if len(args) >= 1 {
+		switch strings.ToLower(args[0]) {
+		case "create":
+			return ch.handleRoleCreate(args[1:])
+		case "edit":
+			return ch.handleRoleEdit(args[1:])
+		case "delete":
+			return ch.handleRoleDelete(args[1:])
+		case "move":
+			return ch.handleRoleMove(args[1:])
+		}
+	}
 	if len(args) < 3 {
-		return "", fmt.Errorf("usage: /role assign|remove @user <rolename>")
+		return "", fmt.Errorf("usage: /role assign|remove @user <rolename> | create|edit|delete|move ...")
 	}
 	subCmd := strings.ToLower(args[0])
 	md := ch.resolveMember(args[1])
@@ -470,8 +669,701 @@ func (ch *CommandHandler) handleRole(args []string) (string, error) {
 		}
 		return fmt.Sprintf("Removing role %q from %s...", roleName, md.User.Username), nil
 	default:
-		return "", fmt.Errorf("unknown subcommand %q — use assign or remove", subCmd)
+		return "", fmt.Errorf("unknown subcommand %q — use assign, remove, create, edit, delete or move", subCmd)
+	}
+}
+
+// handleRoleCreate handles /role create <name> [#color]
+func (ch *CommandHandler) handleRoleCreate(args []string) (string, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return "", fmt.Errorf("usage: /role create <name> [#color]")
+	}
+	serverID := ch.app.getActiveServerID()
+	if serverID == uuid.Nil {
+		return "", fmt.Errorf("not connected to a server")
+	}
+	req := &protocol.RoleCreateRequest{ServerID: serverID, Name: args[0]}
+	if len(args) == 2 {
+		color, err := parseRoleColor(args[1])
+		if err != nil {
+			return "", err
+		}
+		// A colored role is meant to stand out, so show it as its own group
+		req.Color = color
+		req.IsHoisted = true
+	}
+	if err := ch.sendModMsg(protocol.OpRoleCreate, req); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Creating role %q...", args[0]), nil
+}
+
+// handleRoleEdit handles /role edit <role> name <new>|color <#hex>|hoist on|off|perms <+perm,-perm>
+func (ch *CommandHandler) handleRoleEdit(args []string) (string, error) {
+	const usage = "usage: /role edit <role> name <new>|color <#hex>|hoist on|off|perms <+perm,-perm,...>"
+	if len(args) < 3 {
+		return "", errors.New(usage)
+	}
+	role := ch.resolveRole(args[0])
+	if role == nil {
+		return "", fmt.Errorf("role %q not found", args[0])
+	}
+	req := &protocol.RoleUpdateRequest{ServerID: role.ServerID, RoleID: role.ID}
+	value := args[2]
+
+	switch strings.ToLower(args[1]) {
+	case "name":
+		req.Name = &value
+	case "color":
+		color, err := parseRoleColor(value)
+		if err != nil {
+			return "", err
+		}
+		req.Color = &color
+	case "hoist":
+		hoisted := strings.EqualFold(value, "on")
+		if !hoisted && !strings.EqualFold(value, "off") {
+			return "", errors.New(usage)
+		}
+		req.IsHoisted = &hoisted
+	case "perms":
+		perms := role.Permissions
+		for _, item := range strings.Split(strings.ToLower(value), ",") {
+			item = strings.TrimSpace(item)
+			if len(item) < 2 || (item[0] != '+' && item[0] != '-') {
+				return "", fmt.Errorf("permission %q must start with + or -", item)
+			}
+			p, ok := rolePermissions[item[1:]]
+			if !ok {
+				return "", fmt.Errorf("unknown permission %q — use %s", item[1:], permissionNameList(rolePermissions))
+			}
+			if item[0] == '+' {
+				perms |= p
+			} else {
+				perms &^= p
+			}
+		}
+		req.Permissions = &perms
+	default:
+		return "", errors.New(usage)
+	}
+
+	if err := ch.sendModMsg(protocol.OpRoleUpdate, req); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Updating role %q...", role.Name), nil
+}
+
+// handleRoleDelete handles /role delete <role>
+func (ch *CommandHandler) handleRoleDelete(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("usage: /role delete <role>")
+	}
+	role := ch.resolveRole(args[0])
+	if role == nil {
+		return "", fmt.Errorf("role %q not found", args[0])
+	}
+	if err := ch.sendModMsg(protocol.OpRoleDelete, &protocol.RoleDeleteRequest{
+		ServerID: role.ServerID, RoleID: role.ID,
+	}); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Deleting role %q...", role.Name), nil
+}
+
+// handleRoleMove handles /role move <role> <position>; position 1 is the
+// lowest custom role, just above everyone
+func (ch *CommandHandler) handleRoleMove(args []string) (string, error) {
+	if len(args) != 2 {
+		return "", fmt.Errorf("usage: /role move <role> <position>")
+	}
+	role := ch.resolveRole(args[0])
+	if role == nil {
+		return "", fmt.Errorf("role %q not found", args[0])
+	}
+	position, err := strconv.Atoi(args[1])
+	if err != nil || position <= 0 {
+		return "", fmt.Errorf("invalid position %q — must be a positive integer (1 = lowest)", args[1])
+	}
+	if err := ch.sendModMsg(protocol.OpRoleUpdate, &protocol.RoleUpdateRequest{
+		ServerID: role.ServerID, RoleID: role.ID, Position: &position,
+	}); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Moving role %q to position %d...", role.Name, position), nil
+}
+
+// parseRoleColor parses a #RRGGBB (or RRGGBB) hex color
+func parseRoleColor(s string) (int, error) {
+	hex := strings.TrimPrefix(s, "#")
+	n, err := strconv.ParseInt(hex, 16, 32)
+	if err != nil || len(hex) != 6 {
+		return 0, fmt.Errorf("invalid color %q — use #RRGGBB", s)
+	}
+	return int(n), nil
+}
+
+// overwritePermissions maps /overwrite permission names to permission bits
+var overwritePermissions = map[string]models.Permission{
+	"view":             models.PermissionViewChannels,
+	"send":             models.PermissionSendMessages,
+	"history":          models.PermissionReadMessageHistory,
+	"react":            models.PermissionAddReactions,
+	"pin":              models.PermissionPinMessages,
+	"manage-messages":  models.PermissionManageMessages,
+	"embed":            models.PermissionEmbedLinks,
+	"attach":           models.PermissionAttachFiles,
+	"mention-everyone": models.PermissionMentionEveryone,
+	"create-threads":   models.PermissionCreateThreads,
+	"send-threads":     models.PermissionSendMessagesThreads,
+}
+
+// rolePermissions maps /role edit permission names to permission bits; it
+// adds server-wide permissions to the channel-level overwrite names
+var rolePermissions = func() map[string]models.Permission {
+	m := map[string]models.Permission{
+		"manage-channels": models.PermissionManageChannels,
+		"manage-roles":    models.PermissionManageRoles,
+		"manage-server":   models.PermissionManageServer,
+		"invite":          models.PermissionCreateInvite,
+		"kick":            models.PermissionKickMembers,
+		"ban":             models.PermissionBanMembers,
+		"mute":            models.PermissionMuteMembers,
+		"admin":           models.PermissionAdministrator,
+	}
+	for name, p := range overwritePermissions {
+		m[name] = p
+	}
+	return m
+}()
+
+// permissionNameList returns the sorted, comma-separated names in m
+func permissionNameList(m map[string]models.Permission) string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// handleOverwrite handles /overwrite <@user|role> allow|deny|neutral <perm[,perm]>
+// and /overwrite <@user|role> clear for the current channel
+func (ch *CommandHandler) handleOverwrite(args []string) (string, error) {
+	const usage = "usage: /overwrite <@user|role> allow|deny|neutral <perm[,perm]> | <@user|role> clear"
+	a := ch.app
+	if len(args) < 2 {
+		return "", errors.New(usage)
+	}
+	if a.activeConn == nil || a.currentServer == nil || a.currentChannel == nil || a.currentChannel.IsDM() {
+		return "", fmt.Errorf("no server channel selected")
+	}
+	channel := a.currentChannel
+
+	// Resolve the target: @username is a member, anything else a role name
+	var targetID uuid.UUID
+	var targetType, targetName string
+	if strings.HasPrefix(args[0], "@") {
+		md := ch.resolveMember(args[0])
+		if md == nil {
+			return "", fmt.Errorf("user %s not found", args[0])
+		}
+		targetID, targetType, targetName = md.User.ID, "member", md.User.Username
+	} else {
+		role := ch.resolveRole(args[0])
+		if role == nil {
+			return "", fmt.Errorf("role %q not found", args[0])
+		}
+		targetID, targetType, targetName = role.ID, "role", role.Name
+	}
+
+	action := strings.ToLower(args[1])
+	if action == "clear" {
+		if err := ch.sendModMsg(protocol.OpOverwriteDelete, &protocol.OverwriteDeleteRequest{
+			ChannelID: channel.ID, TargetID: targetID,
+		}); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Clearing overwrite for %s in #%s...", targetName, channel.Name), nil
+	}
+	if len(args) < 3 {
+		return "", errors.New(usage)
+	}
+
+	var perms models.Permission
+	for _, name := range strings.Split(strings.ToLower(args[2]), ",") {
+		p, ok := overwritePermissions[strings.TrimSpace(name)]
+		if !ok {
+			return "", fmt.Errorf("unknown permission %q — use %s", name, permissionNameList(overwritePermissions))
+		}
+		perms |= p
+	}
+
+	// Merge into the existing overwrite so other bits are kept
+	var allow, deny models.Permission
+	for _, ow := range channel.PermissionOverwrites {
+		if ow.ID == targetID {
+			allow, deny = models.Permission(ow.Allow), models.Permission(ow.Deny)
+			break
+		}
+	}
+	switch action {
+	case "allow":
+		allow |= perms
+		deny &^= perms
+	case "deny":
+		deny |= perms
+		allow &^= perms
+	case "neutral":
+		allow &^= perms
+		deny &^= perms
+	default:
+		return "", fmt.Errorf("unknown action %q — use allow, deny, neutral or clear", action)
+	}
+
+	if err := ch.sendModMsg(protocol.OpOverwriteSet, &protocol.OverwriteSetRequest{
+		ChannelID:  channel.ID,
+		TargetID:   targetID,
+		TargetType: targetType,
+		Allow:      int64(allow),
+		Deny:       int64(deny),
+	}); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Updating %s overwrite for %s in #%s...", action, targetName, channel.Name), nil
+}
+
+// resolveRole finds a role on the current server by name; "everyone" matches
+// the default role.
+func (ch *CommandHandler) resolveRole(name string) *models.Role {
+	a := ch.app
+	sc := a.activeConn
+	if sc == nil || a.currentServer == nil {
+		return nil
+	}
+	name = strings.TrimPrefix(strings.ToLower(name), "@")
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	for _, role := range sc.Roles[a.currentServer.ID] {
+		if strings.ToLower(role.Name) == name || (name == "everyone" && role.IsDefault) {
+			return role
+		}
+	}
+	return nil
+}
+
+// handleSearch handles /search <query>; filters are parsed by the server
+func (ch *CommandHandler) handleSearch(args []string) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("usage: /search <text> [from:@user] [in:#channel] [before:YYYY-MM-DD] [after:YYYY-MM-DD] [has:link]")
+	}
+	serverID := ch.app.getActiveServerID()
+	if serverID == uuid.Nil {
+		return "", fmt.Errorf("not connected to a server")
+	}
+	req := &protocol.SearchRequest{ServerID: serverID, Query: strings.Join(args, " ")}
+	if err := ch.sendModMsg(protocol.OpSearch, req); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Searching for %q...", req.Query), nil
+}
+
+// handleBackup handles /backup; the server checks the Administrator permission
+func (ch *CommandHandler) handleBackup() (string, error) {
+	serverID := ch.app.getActiveServerID()
+	if serverID == uuid.Nil {
+		return "", fmt.Errorf("not connected to a server")
+	}
+	if err := ch.sendModMsg(protocol.OpBackup, &protocol.BackupRequest{ServerID: serverID}); err != nil {
+		return "", err
+	}
+	return "Starting database backup...", nil
+}
+
+// handleSessions handles /sessions, /sessions revoke <N> and /sessions revoke others
+func (ch *CommandHandler) handleSessions(args []string) (string, error) {
+	if len(args) == 0 || strings.EqualFold(args[0], "list") {
+		if err := ch.sendModMsg(protocol.OpSessionList, nil); err != nil {
+			return "", err
+		}
+		return "Fetching sessions...", nil
+	}
+	if !strings.EqualFold(args[0], "revoke") || len(args) < 2 {
+		return "", fmt.Errorf("usage: /sessions [revoke <N>|others]")
+	}
+
+	if strings.EqualFold(args[1], "others") {
+		if err := ch.sendModMsg(protocol.OpSessionRevoke, &protocol.SessionRevokeRequest{Others: true}); err != nil {
+			return "", err
+		}
+		return "Signing out other devices...", nil
+	}
+
+	sc := ch.app.activeConn
+	if sc == nil {
+		return "", fmt.Errorf("not connected")
+	}
+	n, err := strconv.Atoi(args[1])
+	sc.mu.RLock()
+	sessions := sc.Sessions
+	sc.mu.RUnlock()
+	if err != nil || n < 1 || n > len(sessions) {
+		return "", fmt.Errorf("no session %s — run /sessions to list them", args[1])
+	}
+	session := sessions[n-1]
+	if session.Current {
+		return "", fmt.Errorf("session %d is this device — use /logout instead", n)
+	}
+	if err := ch.sendModMsg(protocol.OpSessionRevoke, &protocol.SessionRevokeRequest{SessionID: &session.ID}); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Revoking session %d...", n), nil
+}
+
+// handleLogout handles /logout. The server closes the connection once the
+// session is gone, and the client then forgets the saved token.
+func (ch *CommandHandler) handleLogout() (string, error) {
+	if err := ch.sendModMsg(protocol.OpSessionRevoke, &protocol.SessionRevokeRequest{Current: true}); err != nil {
+		return "", err
+	}
+	return "Logging out...", nil
+}
+
+// handleServer handles /server [list], /server switch <name|N>,
+// /server create <name>, /server leave, /server delete <name> and
+// /server transfer @user. All but create act on the server being viewed.
+func (ch *CommandHandler) handleServer(args []string) (string, error) {
+	a := ch.app
+	sc := a.activeConn
+	if sc == nil {
+		return "", fmt.Errorf("not connected")
+	}
+	sc.mu.RLock()
+	servers := append([]*models.Server(nil), sc.Servers...)
+	sc.mu.RUnlock()
+
+	if len(args) == 0 || strings.EqualFold(args[0], "list") {
+		if len(servers) == 0 {
+			return "You are not in any server on this host — /server create <name> to make one", nil
+		}
+		lines := []string{"Servers on this host:"}
+		for i, server := range servers {
+			line := fmt.Sprintf("  %d. %s", i+1, server.Name)
+			if sc.User != nil && server.OwnerID == sc.User.ID {
+				line += " (owner)"
+			}
+			if server.ID == a.getActiveServerID() {
+				line += " *"
+			}
+			lines = append(lines, line)
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+
+	name := strings.Join(args[1:], " ")
+	switch strings.ToLower(args[0]) {
+	case "switch":
+		if name == "" {
+			return "", fmt.Errorf("usage: /server switch <name|N>")
+		}
+		index := -1
+		if n, err := strconv.Atoi(name); err == nil && n >= 1 && n <= len(servers) {
+			index = n - 1
+		} else {
+			for i, server := range servers {
+				if strings.EqualFold(server.Name, name) {
+					index = i
+					break
+				}
+			}
+		}
+		if index < 0 {
+			return "", fmt.Errorf("no server %q — run /server list", name)
+		}
+		a.switchToProtocolServer(index)
+		return fmt.Sprintf("Switched to %s.", servers[index].Name), nil
+
+	case "create":
+		if name == "" {
+			return "", fmt.Errorf("usage: /server create <name>")
+		}
+		if err := ch.sendModMsg(protocol.OpServerCreate, &protocol.ServerCreateRequest{Name: name}); err != nil {
+			return "", err
+		}
+		a.pendingServerName = name
+		return fmt.Sprintf("Creating server %s...", name), nil
+	}
+
+	current := a.currentServer
+	if current == nil {
+		return "", fmt.Errorf("no server selected")
+	}
+	isOwner := sc.User != nil && current.OwnerID == sc.User.ID
+
+	switch strings.ToLower(args[0]) {
+	case "leave":
+		if isOwner {
+			return "", fmt.Errorf("you own %s — /server transfer @user or /server delete %s first", current.Name, current.Name)
+		}
+		if err := ch.sendModMsg(protocol.OpServerLeave, &protocol.ServerLeaveRequest{ServerID: current.ID}); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Leaving %s...", current.Name), nil
+
+	case "delete":
+		if !isOwner {
+			return "", fmt.Errorf("only the owner can delete %s", current.Name)
+		}
+		// Typing the name guards against deleting the wrong server
+		if !strings.EqualFold(name, current.Name) {
+			return "", fmt.Errorf("to delete this server and all its messages, type /server delete %s", current.Name)
+		}
+		if err := ch.sendModMsg(protocol.OpServerDelete, &protocol.ServerDeleteRequest{ServerID: current.ID}); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Deleting %s...", current.Name), nil
+
+	case "transfer":
+		if len(args) < 2 {
+			return "", fmt.Errorf("usage: /server transfer @user")
+		}
+		if !isOwner {
+			return "", fmt.Errorf("only the owner can transfer %s", current.Name)
+		}
+		md := ch.resolveMember(args[1])
+		if md == nil {
+			return "", fmt.Errorf("user %s not found", args[1])
+		}
+		if err := ch.sendModMsg(protocol.OpServerTransfer, &protocol.ServerTransferRequest{
+			ServerID: current.ID, UserID: md.User.ID,
+		}); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Transferring %s to %s...", current.Name, md.User.Username), nil
+	}
+
+	return "", fmt.Errorf("usage: /server [list|switch <name|N>|create <name>|leave|delete <name>|transfer @user]")
+}
+
+// handleThread handles /thread [list], /thread create <name>, /thread open
+// <N|name>, /thread close and /thread archive|unarchive
+func (ch *CommandHandler) handleThread(args []string) (string, error) {
+	a := ch.app
+	sc := a.activeConn
+	if sc == nil || a.currentChannel == nil {
+		return "", fmt.Errorf("no channel selected")
+	}
+	threads := sc.ChannelThreads(a.currentChannel.ID)
+
+	if len(args) == 0 || strings.EqualFold(args[0], "list") {
+		if len(threads) == 0 {
+			return "No threads in this channel — pick a message with t, or /thread create <name>", nil
+		}
+		lines := []string{fmt.Sprintf("Threads in #%s:", a.currentChannel.Name)}
+		for i, thread := range threads {
+			line := fmt.Sprintf("  %d. %s", i+1, thread.Name)
+			if thread.Thread != nil {
+				line += fmt.Sprintf(" — %d replies", thread.Thread.MessageCount)
+				if thread.Thread.Archived {
+					line += ", archived"
+				}
+			}
+			if n := a.unreadCounts[sc.ServerID][thread.ID]; n > 0 {
+				line += fmt.Sprintf(", %d new", n)
+			}
+			lines = append(lines, line)
+		}
+		a.displayLocalSystemMessage(strings.Join(lines, "\n"))
+		return "", nil
+	}
+
+	name := strings.Join(args[1:], " ")
+	switch strings.ToLower(args[0]) {
+	case "create":
+		if name == "" {
+			return "", fmt.Errorf("usage: /thread create <name>")
+		}
+		// Anchor on the message picked with t, or else the latest one
+		anchor := a.threadAnchor
+		a.threadAnchor = uuid.Nil
+		if anchor == uuid.Nil {
+			messages := sc.GetMessages(a.currentChannel.ID)
+			for i := len(messages) - 1; i >= 0; i-- {
+				if !messages[i].IsSystem && !messages[i].IsWhisper {
+					anchor = messages[i].ID
+					break
+				}
+			}
+		}
+		if anchor == uuid.Nil {
+			return "", fmt.Errorf("no message to start a thread from")
+		}
+		if existing := sc.ThreadsByAnchor(a.currentChannel.ID)[anchor]; existing != nil {
+			a.openThread(existing)
+			return fmt.Sprintf("That message already has thread %s — opened it.", existing.Name), nil
+		}
+		if err := ch.sendModMsg(protocol.OpThreadCreate, &protocol.ThreadCreateRequest{
+			ChannelID: a.currentChannel.ID,
+			MessageID: anchor,
+			Name:      name,
+		}); err != nil {
+			return "", err
+		}
+		a.pendingThreadAnchor = anchor
+		return fmt.Sprintf("Starting thread %s...", name), nil
+
+	case "open":
+		if name == "" {
+			return "", fmt.Errorf("usage: /thread open <N|name>")
+		}
+		var target *models.Channel
+		if n, err := strconv.Atoi(name); err == nil && n >= 1 && n <= len(threads) {
+			target = threads[n-1]
+		} else {
+			for _, thread := range threads {
+				if strings.EqualFold(thread.Name, name) {
+					target = thread
+					break
+				}
+			}
+		}
+		if target == nil {
+			return "", fmt.Errorf("no thread %q — run /thread list", name)
+		}
+		a.openThread(target)
+		return a.statusMessage, nil
+
+	case "close":
+		if a.thread == nil {
+			return "", fmt.Errorf("no thread is open")
+		}
+		a.closeThread()
+		return "Closed the thread.", nil
+
+	case "archive", "unarchive":
+		if a.thread == nil {
+			return "", fmt.Errorf("open a thread first — /thread open <N|name>")
+		}
+		archived := strings.EqualFold(args[0], "archive")
+		if err := ch.sendModMsg(protocol.OpThreadArchive, &protocol.ThreadArchiveRequest{
+			ThreadID: a.thread.Thread.ID,
+			Archived: archived,
+		}); err != nil {
+			return "", err
+		}
+		if archived {
+			return fmt.Sprintf("Archiving %s...", a.thread.Thread.Name), nil
+		}
+		return fmt.Sprintf("Reopening %s...", a.thread.Thread.Name), nil
+	}
+
+	return "", fmt.Errorf("usage: /thread [list|create <name>|open <N|name>|close|archive|unarchive]")
+}
+
+// auditActionPrefixes are the action families /audit treats as an action filter
+var auditActionPrefixes = []string{"channel", "overwrite", "role", "member", "message", "thread", "invite", "server"}
+
+// handleAudit handles /audit [@user] [#channel|target] [action] and /audit more
+func (ch *CommandHandler) handleAudit(args []string) (string, error) {
+	a := ch.app
+	serverID := a.getActiveServerID()
+	if serverID == uuid.Nil {
+		return "", fmt.Errorf("not connected to a server")
+	}
+
+	if len(args) == 1 && strings.EqualFold(args[0], "more") {
+		if a.auditQuery == nil || a.auditQuery.ServerID != serverID {
+			return "", fmt.Errorf("no more audit log entries — run /audit first")
+		}
+		if err := ch.sendModMsg(protocol.OpAuditLog, a.auditQuery); err != nil {
+			return "", err
+		}
+		return "Fetching older audit log entries...", nil
+	}
+
+	req := &protocol.AuditLogRequest{ServerID: serverID}
+	for _, arg := range args {
+		lower := strings.ToLower(arg)
+		switch {
+		case strings.HasPrefix(arg, "@"):
+			md := ch.resolveMember(arg)
+			if md == nil {
+				return "", fmt.Errorf("user %s not found", arg)
+			}
+			req.ActorID = &md.User.ID
+		case isAuditAction(lower):
+			req.Action = lower
+		default:
+			// Channels are recorded as "#name"; roles, members and invites by name
+			req.Target = arg
+		}
+	}
+
+	a.auditQuery = req
+	if err := ch.sendModMsg(protocol.OpAuditLog, req); err != nil {
+		return "", err
+	}
+	return "Fetching audit log...", nil
+}
+
+// isAuditAction reports whether s names an audit action or action family,
+// e.g. "channel" or "member_ban"
+func isAuditAction(s string) bool {
+	for _, prefix := range auditActionPrefixes {
+		if s == prefix || strings.HasPrefix(s, prefix+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+// handleInvite handles /invite [hours] [uses], /invite list and /invite revoke <code>
+func (ch *CommandHandler) handleInvite(args []string) (string, error) {
+	serverID := ch.app.getActiveServerID()
+	if serverID == uuid.Nil {
+		return "", fmt.Errorf("not connected to a server")
+	}
+	if len(args) >= 1 {
+		switch strings.ToLower(args[0]) {
+		case "list":
+			if err := ch.sendModMsg(protocol.OpInviteList, &protocol.InviteListRequest{ServerID: serverID}); err != nil {
+				return "", err
+			}
+			return "Fetching invites...", nil
+		case "revoke":
+			if len(args) < 2 {
+				return "", fmt.Errorf("usage: /invite revoke <code>")
+			}
+			if err := ch.sendModMsg(protocol.OpInviteRevoke, &protocol.InviteRevokeRequest{
+				ServerID: serverID, Code: args[1],
+			}); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Revoking invite %s...", args[1]), nil
+		}
+	}
+
+	// Optional limits; omitted values use the server defaults
+	req := &protocol.InviteCreateRequest{ServerID: serverID}
+	if len(args) >= 1 {
+		hours, err := strconv.Atoi(args[0])
+		if err != nil || hours < 0 {
+			return "", fmt.Errorf("usage: /invite [hours] [uses] | list | revoke <code>")
+		}
+		maxAge := hours * 3600
+		req.MaxAge = &maxAge
+	}
+	if len(args) >= 2 {
+		uses, err := strconv.Atoi(args[1])
+		if err != nil || uses < 0 {
+			return "", fmt.Errorf("invalid use count %q — must be 0 or more", args[1])
+		}
+		req.MaxUses = &uses
+	}
+	if err := ch.sendModMsg(protocol.OpInviteCreate, req); err != nil {
+		return "", err
 	}
+	return "Creating invite...", nil
 }
 
 // handleKickBan handles /kick @user [reason] and /ban @user [reason]
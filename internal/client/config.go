@@ -27,9 +27,10 @@ type DefaultPreferences struct {
 
 // LocalIdentity stores the user's single identity used across all servers
 type LocalIdentity struct {
-	Alias    string `json:"alias"`
-	Email    string `json:"email"`
-	Password string `json:"password"` // plaintext in v0.1; will be encrypted in a future version
+	Alias             string `json:"alias"`
+	Email             string `json:"email"`
+	Password          string `json:"password,omitempty"`           // In memory only; read from disk only to migrate old plaintext configs
+	EncryptedPassword string `json:"encrypted_password,omitempty"` // Password sealed with the vault key
 }
 
 // AppConfig represents UI preferences stored in ~/.concord/config.json
@@ -37,6 +38,7 @@ type AppConfig struct {
 	Version  int            `json:"version"`
 	UI       UIConfig       `json:"ui"`
 	Identity *LocalIdentity `json:"identity,omitempty"`
+	Vault    *VaultConfig   `json:"vault,omitempty"`
 }
 
 // UIConfig holds UI-related preferences
@@ -52,6 +54,12 @@ type ConfigManager struct {
 	serversFilePath string
 	configFilePath  string
 	mu              sync.RWMutex
+
+	// Vault key that seals passwords and tokens on disk; nil until Unlock
+	key []byte
+
+	// Whether the identity password is written to config.json
+	savePassword bool
 }
 
 // NewConfigManager creates a new configuration manager
@@ -64,14 +72,20 @@ func NewConfigManager() (*ConfigManager, error) {
 	concordDir := filepath.Join(homeDir, ".concord")
 
 	// Create ~/.concord directory if it doesn't exist
-	if err := os.MkdirAll(concordDir, 0755); err != nil {
+	if err := os.MkdirAll(concordDir, 0700); err != nil {
 		return nil, fmt.Errorf("failed to create .concord directory: %w", err)
 	}
 
-	return &ConfigManager{
+	cm := &ConfigManager{
 		serversFilePath: filepath.Join(concordDir, "servers.json"),
 		configFilePath:  filepath.Join(concordDir, "config.json"),
-	}, nil
+		savePassword:    true,
+	}
+
+	// Older versions created these readable by everyone
+	hardenPermissions(concordDir, cm.serversFilePath, cm.configFilePath)
+
+	return cm, nil
 }
 
 // LoadServers loads the server list from ~/.concord/servers.json
@@ -104,6 +118,9 @@ func (cm *ConfigManager) LoadServers() (*ServersConfig, error) {
 	if err := json.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse servers config: %w", err)
 	}
+	for _, server := range config.Servers {
+		cm.openCredentials(server.SavedCredentials)
+	}
 
 	return &config, nil
 }
@@ -113,15 +130,19 @@ func (cm *ConfigManager) SaveServers(config *ServersConfig) error {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
-	// Marshal to JSON with indentation
-	data, err := json.MarshalIndent(config, "", "  ")
+	// Marshal to JSON with indentation; secrets are sealed, never written in plaintext
+	sealed, err := cm.sealServers(config)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(sealed, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal servers config: %w", err)
 	}
 
 	// Write to temp file first (atomic write)
 	tempFile := cm.serversFilePath + ".tmp"
-	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+	if err := os.WriteFile(tempFile, data, 0600); err != nil {
 		return fmt.Errorf("failed to write servers config: %w", err)
 	}
 
@@ -195,6 +216,23 @@ func (cm *ConfigManager) UpdateServerLastConnected(serverID uuid.UUID) error {
 	return fmt.Errorf("server %s not found", serverID)
 }
 
+// UpdateServerFingerprint pins (or, with "", forgets) a server's TLS certificate
+func (cm *ConfigManager) UpdateServerFingerprint(serverID uuid.UUID, fingerprint string) error {
+	config, err := cm.LoadServers()
+	if err != nil {
+		return fmt.Errorf("failed to load servers: %w", err)
+	}
+
+	for _, server := range config.Servers {
+		if server.ID == serverID {
+			server.TLSFingerprint = fingerprint
+			return cm.SaveServers(config)
+		}
+	}
+
+	return fmt.Errorf("server %s not found", serverID)
+}
+
 // UpdateServer updates an existing server's connection details
 func (cm *ConfigManager) UpdateServer(info *ClientServerInfo) error {
 	config, err := cm.LoadServers()
@@ -264,6 +302,7 @@ func (cm *ConfigManager) LoadAppConfig() (*AppConfig, error) {
 	if config.UI.CollapsedCategories == nil {
 		config.UI.CollapsedCategories = make(map[string]map[string]bool)
 	}
+	cm.openIdentity(config.Identity)
 
 	return &config, nil
 }
@@ -273,15 +312,21 @@ func (cm *ConfigManager) SaveAppConfig(config *AppConfig) error {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
-	// Marshal to JSON with indentation
-	data, err := json.MarshalIndent(config, "", "  ")
+	// Marshal to JSON with indentation; the password is sealed or left out
+	sealed := *config
+	identity, err := cm.sealIdentity(config.Identity)
+	if err != nil {
+		return err
+	}
+	sealed.Identity = identity
+	data, err := json.MarshalIndent(&sealed, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal app config: %w", err)
 	}
 
 	// Write to temp file first (atomic write)
 	tempFile := cm.configFilePath + ".tmp"
-	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+	if err := os.WriteFile(tempFile, data, 0600); err != nil {
 		return fmt.Errorf("failed to write app config: %w", err)
 	}
 
@@ -354,3 +399,23 @@ func (cm *ConfigManager) SaveServerToken(serverID uuid.UUID, email, token string
 	}
 	return fmt.Errorf("server %s not found", serverID)
 }
+
+// ClearServerToken forgets a server's saved token, keeping the saved email
+// for the login form
+func (cm *ConfigManager) ClearServerToken(serverID uuid.UUID) error {
+	config, err := cm.LoadServers()
+	if err != nil {
+		return fmt.Errorf("failed to load servers: %w", err)
+	}
+	for _, server := range config.Servers {
+		if server.ID == serverID {
+			if server.SavedCredentials == nil {
+				return nil
+			}
+			server.SavedCredentials.Token = ""
+			server.SavedCredentials.EncryptedToken = ""
+			return cm.SaveServers(config)
+		}
+	}
+	return fmt.Errorf("server %s not found", serverID)
+}
@@ -2,12 +2,15 @@ package client
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"os"
+	"runtime"
 	"sync"
 	"time"
 
@@ -24,6 +27,7 @@ type Connection struct {
 	
 	// Server address
 	serverAddr string
+	tlsConfig  *tls.Config // Certificate pinning for wss/https; nil uses the defaults
 	
 	// Message handlers
 	onMessage     func(*protocol.Message)
@@ -36,6 +40,9 @@ type Connection struct {
 	authenticated bool
 	sessionID    string
 	lastSeq      int64
+	token        string // Kept for RESUME and re-IDENTIFY after a drop
+	resuming     bool   // A RESUME is in flight
+	closedByUser bool   // Disconnect was requested; don't auto-reconnect
 	
 	// Channels
 	send chan *protocol.Message
@@ -93,6 +100,7 @@ func (c *Connection) Connect() error {
 	dialer := &websocket.Dialer{
 		HandshakeTimeout: 10 * time.Second,
 		Proxy:            http.ProxyFromEnvironment,
+		TLSClientConfig:  c.tlsConfig,
 	}
 
 	// Connect with timeout
@@ -116,8 +124,17 @@ func (c *Connection) Connect() error {
 	return nil
 }
 
-// Disconnect closes the connection
+// Disconnect closes the connection and disables auto-reconnect
 func (c *Connection) Disconnect() {
+	c.mu.Lock()
+	c.closedByUser = true
+	c.mu.Unlock()
+
+	c.disconnect()
+}
+
+// disconnect tears down the socket without changing auto-reconnect state
+func (c *Connection) disconnect() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	
@@ -177,7 +194,30 @@ func (c *Connection) Identify(token string) error {
 	if err != nil {
 		return err
 	}
-	
+
+	c.mu.Lock()
+	c.token = token
+	c.mu.Unlock()
+
+	return c.Send(msg)
+}
+
+// Resume sends a RESUME for the previous session so missed dispatches are replayed
+func (c *Connection) Resume() error {
+	c.mu.Lock()
+	payload := &protocol.ResumePayload{
+		Token:     c.token,
+		SessionID: c.sessionID,
+		Seq:       c.lastSeq,
+	}
+	c.resuming = true
+	c.mu.Unlock()
+
+	msg, err := protocol.NewMessage(protocol.OpResume, payload)
+	if err != nil {
+		return err
+	}
+
 	return c.Send(msg)
 }
 
@@ -259,10 +299,33 @@ func (c *Connection) Send(msg *protocol.Message) error {
 	}
 }
 
+// SessionRevokedError is reported when the server closes the connection
+// because its login session was revoked or logged out
+type SessionRevokedError struct {
+	Reason string
+}
+
+func (e *SessionRevokedError) Error() string {
+	return "signed out: " + e.Reason
+}
+
 // readPump reads messages from the WebSocket
 func (c *Connection) readPump() {
+	var revoked *SessionRevokedError
 	defer func() {
-		c.Disconnect()
+		c.disconnect()
+
+		// Reported after the disconnect so the sign-out is the last word
+		if revoked != nil && c.onError != nil {
+			c.onError(revoked)
+		}
+
+		c.mu.RLock()
+		shouldReconnect := !c.closedByUser && c.token != ""
+		c.mu.RUnlock()
+		if shouldReconnect {
+			go c.reconnect()
+		}
 	}()
 	
 	c.conn.SetReadLimit(512 * 1024) // 512KB
@@ -275,6 +338,15 @@ func (c *Connection) readPump() {
 	for {
 		_, data, err := c.conn.ReadMessage()
 		if err != nil {
+			if ce, ok := err.(*websocket.CloseError); ok && ce.Code == int(protocol.CloseSessionRevoked) {
+				// The token is dead; reconnecting with it would only fail
+				c.mu.Lock()
+				c.closedByUser = true
+				c.token = ""
+				c.mu.Unlock()
+				revoked = &SessionRevokedError{Reason: ce.Text}
+				return
+			}
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
 				if c.onError != nil {
@@ -357,14 +429,16 @@ func (c *Connection) handleMessage(msg *protocol.Message) {
 		c.handleInvalidSession(msg)
 		
 	case protocol.OpReconnect:
-		// Server requested reconnection
-		go func() {
-			c.Disconnect()
-			time.Sleep(time.Second)
-			c.Connect()
-		}()
+		// Server requested reconnection; readPump's exit path resumes the session
+		c.conn.Close()
 		
 	case protocol.OpDispatch:
+		if msg.Type == protocol.EventResumed {
+			c.mu.Lock()
+			c.authenticated = true
+			c.resuming = false
+			c.mu.Unlock()
+		}
 		// Forward to message handler
 		if c.onMessage != nil {
 			c.onMessage(msg)
@@ -372,6 +446,43 @@ func (c *Connection) handleMessage(msg *protocol.Message) {
 	}
 }
 
+// reconnect re-dials after an unexpected disconnect with exponential backoff,
+// resuming the previous session if there is one and identifying otherwise.
+func (c *Connection) reconnect() {
+	strategy := DefaultReconnectStrategy()
+	for attempt := 0; strategy.ShouldRetry(attempt); attempt++ {
+		time.Sleep(strategy.NextDelay(attempt))
+
+		c.mu.RLock()
+		stop := c.closedByUser
+		c.mu.RUnlock()
+		if stop {
+			return
+		}
+
+		if err := c.Connect(); err != nil {
+			log.Printf("Reconnect attempt %d failed: %v", attempt+1, err)
+			continue
+		}
+
+		c.mu.RLock()
+		sessionID := c.sessionID
+		token := c.token
+		c.mu.RUnlock()
+
+		if sessionID != "" {
+			c.Resume()
+		} else {
+			c.Identify(token)
+		}
+		return
+	}
+
+	if c.onError != nil {
+		c.onError(fmt.Errorf("reconnect failed after %d attempts", strategy.MaxRetries))
+	}
+}
+
 // handleHello processes the HELLO message
 func (c *Connection) handleHello(msg *protocol.Message) {
 	var payload protocol.HelloPayload
@@ -406,11 +517,26 @@ func (c *Connection) handleReady(msg *protocol.Message) {
 	}
 }
 
-// handleInvalidSession processes authentication failure
+// handleInvalidSession processes authentication failure. A rejected RESUME
+// falls back to a fresh IDENTIFY on the same socket.
 func (c *Connection) handleInvalidSession(msg *protocol.Message) {
+	var payload protocol.InvalidSessionPayload
+	json.Unmarshal(msg.Data, &payload)
+
 	c.mu.Lock()
 	c.authenticated = false
+	wasResuming := c.resuming
+	token := c.token
+	c.resuming = false
+	c.sessionID = ""
+	c.lastSeq = 0
 	c.mu.Unlock()
+
+	if wasResuming && !payload.Resumable && token != "" {
+		log.Printf("Session could not be resumed (%s), identifying", payload.Reason)
+		c.Identify(token)
+		return
+	}
 	
 	if c.onError != nil {
 		c.onError(fmt.Errorf("invalid session"))
@@ -468,6 +594,39 @@ type LoginResponse struct {
 	Token string       `json:"token"`
 }
 
+// httpClient returns a client for the server's HTTP API, sharing the
+// connection's TLS settings
+func (c *Connection) httpClient() *http.Client {
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: c.tlsConfig,
+		},
+	}
+}
+
+// postJSON posts a JSON body to the server's HTTP API. The User-Agent names
+// this device in the server's session list.
+func (c *Connection) postJSON(endpoint string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent())
+	return c.httpClient().Do(req)
+}
+
+// userAgent describes this client and machine, e.g. "Concord client on laptop (linux/amd64)"
+func userAgent() string {
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+	if host, err := os.Hostname(); err == nil && host != "" {
+		return fmt.Sprintf("Concord client on %s (%s)", host, platform)
+	}
+	return fmt.Sprintf("Concord client (%s)", platform)
+}
+
 // Login authenticates with the server using email and password
 func (c *Connection) Login(email, password string) (*models.User, string, error) {
 	// Parse server address to get HTTP URL
@@ -495,10 +654,7 @@ func (c *Connection) Login(email, password string) (*models.User, string, error)
 	}
 
 	// Make HTTP request with timeout
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-	resp, err := client.Post(u.String(), "application/json", bytes.NewBuffer(jsonData))
+	resp, err := c.postJSON(u.String(), jsonData)
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to connect to server: %w", err)
 	}
@@ -525,7 +681,7 @@ func (c *Connection) Login(email, password string) (*models.User, string, error)
 }
 
 // Register creates a new account on the server
-func (c *Connection) Register(username, email, password string) (*models.User, string, error) {
+func (c *Connection) Register(username, email, password, inviteCode string) (*models.User, string, error) {
 	// Parse server address to get HTTP URL
 	u, err := url.Parse(c.serverAddr)
 	if err != nil {
@@ -546,16 +702,16 @@ func (c *Connection) Register(username, email, password string) (*models.User, s
 		"email":    email,
 		"password": password,
 	}
+	if inviteCode != "" {
+		reqBody["invite_code"] = inviteCode
+	}
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	// Make HTTP request with timeout
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-	resp, err := client.Post(u.String(), "application/json", bytes.NewBuffer(jsonData))
+	resp, err := c.postJSON(u.String(), jsonData)
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to connect to server: %w", err)
 	}
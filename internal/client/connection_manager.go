@@ -1,7 +1,11 @@
 package client
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -59,9 +63,17 @@ type ServerConnection struct {
 	Token   string                  // Auth token
 	Servers []*models.Server        // Servers from READY message
 	Channels map[uuid.UUID][]*models.Channel // Channels per protocol server
+	Threads  map[uuid.UUID]*models.Channel   // Threads by channel ID, kept out of Channels
 	Messages map[uuid.UUID][]*MessageDisplay // Messages per channel
-	Members  []*MemberDisplay        // Members in current server
+	ReplyParents map[uuid.UUID]*MessageDisplay // Fetched parents of replies, by ID; nil once known deleted
+	Members  map[uuid.UUID][]*MemberDisplay  // Members per protocol server
 	Roles    map[uuid.UUID][]*models.Role    // Roles per protocol server
+	PinnedMessages map[uuid.UUID][]*models.Message // Pinned messages per channel
+	DMChannels     []*models.Channel               // Direct message channels
+	DMUsers        map[uuid.UUID]*models.User      // DM recipients by user ID
+	Sessions       []*models.Session               // Login sessions from the last /sessions listing
+
+	pendingParents map[uuid.UUID]bool // Reply parents requested but not yet answered
 
 	// Retry tracking
 	RetryCount     int
@@ -78,9 +90,14 @@ func NewServerConnection(serverID uuid.UUID, serverInfo *ClientServerInfo) *Serv
 		ServerInfo: serverInfo,
 		State:      StateDisconnected,
 		Channels:   make(map[uuid.UUID][]*models.Channel),
+		Threads:    make(map[uuid.UUID]*models.Channel),
 		Messages:   make(map[uuid.UUID][]*MessageDisplay),
-		Members:    make([]*MemberDisplay, 0),
+		ReplyParents:   make(map[uuid.UUID]*MessageDisplay),
+		pendingParents: make(map[uuid.UUID]bool),
+		Members:    make(map[uuid.UUID][]*MemberDisplay),
 		Roles:      make(map[uuid.UUID][]*models.Role),
+		PinnedMessages: make(map[uuid.UUID][]*models.Message),
+		DMUsers:        make(map[uuid.UUID]*models.User),
 	}
 }
 
@@ -105,11 +122,116 @@ func (sc *ServerConnection) GetChannels(protocolServerID uuid.UUID) []*models.Ch
 	return sc.Channels[protocolServerID]
 }
 
-// SetChannels sets channels for a protocol server (thread-safe)
+// SetChannels sets channels for a protocol server. Threads in the list are
+// stored apart so they don't show in the channel tree (thread-safe)
 func (sc *ServerConnection) SetChannels(protocolServerID uuid.UUID, channels []*models.Channel) {
 	sc.mu.Lock()
 	defer sc.mu.Unlock()
-	sc.Channels[protocolServerID] = channels
+	for id, t := range sc.Threads {
+		if t.ServerID == protocolServerID {
+			delete(sc.Threads, id)
+		}
+	}
+	list := make([]*models.Channel, 0, len(channels))
+	for _, ch := range channels {
+		if ch.IsThread() {
+			sc.Threads[ch.ID] = ch
+			continue
+		}
+		list = append(list, ch)
+	}
+	sc.Channels[protocolServerID] = list
+}
+
+// GetMembers returns the members of a protocol server (thread-safe)
+func (sc *ServerConnection) GetMembers(protocolServerID uuid.UUID) []*MemberDisplay {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.Members[protocolServerID]
+}
+
+// UpsertServer adds a protocol server, or replaces the cached copy (thread-safe)
+func (sc *ServerConnection) UpsertServer(server *models.Server) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for i, s := range sc.Servers {
+		if s.ID == server.ID {
+			sc.Servers[i] = server
+			return
+		}
+	}
+	sc.Servers = append(sc.Servers, server)
+}
+
+// RemoveServer drops a protocol server the user is no longer in, along with
+// its channels, messages, members and roles (thread-safe)
+func (sc *ServerConnection) RemoveServer(protocolServerID uuid.UUID) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for i, s := range sc.Servers {
+		if s.ID == protocolServerID {
+			sc.Servers = append(sc.Servers[:i:i], sc.Servers[i+1:]...)
+			break
+		}
+	}
+	for _, ch := range sc.Channels[protocolServerID] {
+		delete(sc.Messages, ch.ID)
+		delete(sc.PinnedMessages, ch.ID)
+	}
+	for id, t := range sc.Threads {
+		if t.ServerID == protocolServerID {
+			delete(sc.Threads, id)
+			delete(sc.Messages, id)
+		}
+	}
+	delete(sc.Channels, protocolServerID)
+	delete(sc.Members, protocolServerID)
+	delete(sc.Roles, protocolServerID)
+}
+
+// GetDMChannels returns the direct message channels (thread-safe)
+func (sc *ServerConnection) GetDMChannels() []*models.Channel {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.DMChannels
+}
+
+// AddDMChannel stores a DM channel and its recipients, replacing any channel
+// with the same ID (thread-safe)
+func (sc *ServerConnection) AddDMChannel(channel *models.Channel, users []*models.User) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	for _, u := range users {
+		sc.DMUsers[u.ID] = u
+	}
+	for i, ch := range sc.DMChannels {
+		if ch.ID == channel.ID {
+			sc.DMChannels[i] = channel
+			return
+		}
+	}
+	sc.DMChannels = append(sc.DMChannels, channel)
+}
+
+// DMName returns the display name of a DM channel: the other recipient's username
+func (sc *ServerConnection) DMName(channel *models.Channel) string {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+
+	var names []string
+	for _, id := range channel.RecipientIDs {
+		if sc.User != nil && id == sc.User.ID {
+			continue
+		}
+		if u, ok := sc.DMUsers[id]; ok {
+			names = append(names, u.Username)
+		}
+	}
+	if len(names) == 0 {
+		return "unknown"
+	}
+	return strings.Join(names, ", ")
 }
 
 // GetMessages returns messages for a channel (thread-safe)
@@ -139,6 +261,140 @@ func (sc *ServerConnection) AddMessage(channelID uuid.UUID, msg *MessageDisplay)
 	sc.Messages[channelID] = messages
 }
 
+// UpdateMessage applies an edit to a cached message. It returns false if the
+// message isn't cached (thread-safe)
+func (sc *ServerConnection) UpdateMessage(channelID, messageID uuid.UUID, content string, editedAt *time.Time) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	for _, pinned := range sc.PinnedMessages[channelID] {
+		if pinned.ID == messageID {
+			pinned.Content = content
+			pinned.EditedAt = editedAt
+		}
+	}
+	if parent := sc.ReplyParents[messageID]; parent != nil {
+		parent.Content = content
+		parent.EditedAt = editedAt
+	}
+	for _, md := range sc.Messages[channelID] {
+		if md.ID == messageID {
+			md.Content = content
+			md.EditedAt = editedAt
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyReaction adds or removes a user's reaction on a cached message. It
+// returns false if the message isn't cached (thread-safe)
+func (sc *ServerConnection) ApplyReaction(channelID, messageID uuid.UUID, emoji string, userID uuid.UUID, add bool) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	for _, md := range sc.Messages[channelID] {
+		if md.ID == messageID {
+			if add {
+				md.AddReaction(emoji, userID)
+			} else {
+				md.RemoveReaction(emoji, userID)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// UpsertRole adds or replaces a role and recomputes member grouping and
+// colors, which depend on role position, color and hoisting (thread-safe)
+func (sc *ServerConnection) UpsertRole(serverID uuid.UUID, role *models.Role) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	roles := sc.Roles[serverID]
+	found := false
+	for i, r := range roles {
+		if r.ID == role.ID {
+			roles[i] = role
+			found = true
+			break
+		}
+	}
+	if !found {
+		roles = append(roles, role)
+	}
+	sort.SliceStable(roles, func(i, j int) bool { return roles[i].Position > roles[j].Position })
+	sc.Roles[serverID] = roles
+	sc.rebuildMembersLocked(serverID)
+}
+
+// RemoveRole drops a deleted role from the cache and from every member (thread-safe)
+func (sc *ServerConnection) RemoveRole(serverID, roleID uuid.UUID) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	roles := sc.Roles[serverID]
+	for i, r := range roles {
+		if r.ID == roleID {
+			sc.Roles[serverID] = append(roles[:i:i], roles[i+1:]...)
+			break
+		}
+	}
+	for _, m := range sc.Members[serverID] {
+		if m.Member != nil {
+			m.Member.RemoveRole(roleID)
+		}
+	}
+	sc.rebuildMembersLocked(serverID)
+}
+
+// rebuildMembersLocked recomputes member displays from the cached roles.
+// Caller must hold sc.mu.
+func (sc *ServerConnection) rebuildMembersLocked(serverID uuid.UUID) {
+	roleMap := make(map[uuid.UUID]*models.Role, len(sc.Roles[serverID]))
+	for _, r := range sc.Roles[serverID] {
+		roleMap[r.ID] = r
+	}
+	members := sc.Members[serverID]
+	for i, m := range members {
+		if m.Member != nil && m.User != nil {
+			members[i] = buildMemberDisplay(m.Member, m.User, roleMap)
+		}
+	}
+}
+
+// RemoveMessage drops a deleted message from the cache. It returns false if
+// the message isn't cached (thread-safe)
+func (sc *ServerConnection) RemoveMessage(channelID, messageID uuid.UUID) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	pinned := sc.PinnedMessages[channelID]
+	for i, m := range pinned {
+		if m.ID == messageID {
+			sc.PinnedMessages[channelID] = append(pinned[:i:i], pinned[i+1:]...)
+			break
+		}
+	}
+
+	// The server unlinks replies from a deleted message, so the cache does too
+	delete(sc.ReplyParents, messageID)
+	removed := false
+	messages := sc.Messages[channelID]
+	for i, md := range messages {
+		if md.ReplyToID != nil && *md.ReplyToID == messageID {
+			md.ReplyToID = nil
+		}
+		if md.ID == messageID && !removed {
+			messages = append(messages[:i:i], messages[i+1:]...)
+			removed = true
+		}
+	}
+	sc.Messages[channelID] = messages
+	return removed
+}
+
 // ClearMessages clears all messages for a channel (thread-safe)
 func (sc *ServerConnection) ClearMessages(channelID uuid.UUID) {
 	sc.mu.Lock()
@@ -146,6 +402,125 @@ func (sc *ServerConnection) ClearMessages(channelID uuid.UUID) {
 	sc.Messages[channelID] = make([]*MessageDisplay, 0)
 }
 
+// ReplyParent returns a fetched reply parent and whether it has been
+// fetched at all; a fetched parent that is nil was deleted (thread-safe)
+func (sc *ServerConnection) ReplyParent(messageID uuid.UUID) (*MessageDisplay, bool) {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	parent, ok := sc.ReplyParents[messageID]
+	return parent, ok
+}
+
+// ClaimReplyParents returns the IDs not yet fetched or requested, marking
+// them as requested (thread-safe)
+func (sc *ServerConnection) ClaimReplyParents(ids []uuid.UUID) []uuid.UUID {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	var claimed []uuid.UUID
+	for _, id := range ids {
+		if _, ok := sc.ReplyParents[id]; ok || sc.pendingParents[id] {
+			continue
+		}
+		sc.pendingParents[id] = true
+		claimed = append(claimed, id)
+	}
+	return claimed
+}
+
+// StoreReplyParents records fetched reply parents and the ones that no
+// longer exist (thread-safe)
+func (sc *ServerConnection) StoreReplyParents(parents []*MessageDisplay, missing []uuid.UUID) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for _, md := range parents {
+		sc.ReplyParents[md.ID] = md
+		delete(sc.pendingParents, md.ID)
+	}
+	for _, id := range missing {
+		sc.ReplyParents[id] = nil
+		delete(sc.pendingParents, id)
+	}
+}
+
+// GetThread returns a cached thread, or nil (thread-safe)
+func (sc *ServerConnection) GetThread(threadID uuid.UUID) *models.Channel {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.Threads[threadID]
+}
+
+// UpsertThread adds a thread or replaces the cached copy (thread-safe)
+func (sc *ServerConnection) UpsertThread(thread *models.Channel) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.Threads[thread.ID] = thread
+}
+
+// RemoveThread drops a thread and its messages (thread-safe)
+func (sc *ServerConnection) RemoveThread(threadID uuid.UUID) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	delete(sc.Threads, threadID)
+	delete(sc.Messages, threadID)
+}
+
+// RemoveChannelThreads drops every thread of a deleted channel (thread-safe)
+func (sc *ServerConnection) RemoveChannelThreads(parentID uuid.UUID) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for id, t := range sc.Threads {
+		if t.ParentID == parentID {
+			delete(sc.Threads, id)
+			delete(sc.Messages, id)
+		}
+	}
+}
+
+// ChannelThreads returns a channel's threads, oldest first (thread-safe)
+func (sc *ServerConnection) ChannelThreads(parentID uuid.UUID) []*models.Channel {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	var threads []*models.Channel
+	for _, t := range sc.Threads {
+		if t.ParentID == parentID {
+			threads = append(threads, t)
+		}
+	}
+	sort.Slice(threads, func(i, j int) bool { return threads[i].CreatedAt.Before(threads[j].CreatedAt) })
+	return threads
+}
+
+// ThreadsByAnchor maps the messages of a channel that have a thread to it (thread-safe)
+func (sc *ServerConnection) ThreadsByAnchor(parentID uuid.UUID) map[uuid.UUID]*models.Channel {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	anchors := make(map[uuid.UUID]*models.Channel)
+	for _, t := range sc.Threads {
+		if t.ParentID == parentID {
+			anchors[t.ParentMessageID] = t
+		}
+	}
+	return anchors
+}
+
+// CountThreadReply adjusts a thread's reply count after a message is posted
+// (delta 1, at its timestamp) or deleted (delta -1) in it. It returns false
+// if channelID isn't a cached thread (thread-safe)
+func (sc *ServerConnection) CountThreadReply(channelID uuid.UUID, delta int, at time.Time) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	t := sc.Threads[channelID]
+	if t == nil || t.Thread == nil {
+		return false
+	}
+	t.Thread.MessageCount = max(t.Thread.MessageCount+delta, 0)
+	if !at.IsZero() {
+		t.Thread.LastMessageAt = at
+		t.Thread.Archived = false
+	}
+	return true
+}
+
 // ConnectionManager manages multiple server connections
 type ConnectionManager struct {
 	connections map[uuid.UUID]*ServerConnection
@@ -197,6 +572,7 @@ func (cm *ConnectionManager) ConnectServer(serverID uuid.UUID) error {
 
 	// Create new connection
 	conn := NewConnection(sc.ServerInfo.GetWebSocketURL())
+	conn.tlsConfig = cm.tlsConfig(sc)
 
 	// Set up callbacks to route events through ConnectionManager
 	conn.onMessage = func(msg *protocol.Message) {
@@ -230,6 +606,36 @@ func (cm *ConnectionManager) ConnectServer(serverID uuid.UUID) error {
 	return nil
 }
 
+// tlsConfig returns the TLS settings for a server's connections. A
+// certificate not signed by a trusted CA is pinned the first time it is
+// seen, and CertificatePinnedMsg asks the app to save the pin.
+func (cm *ConnectionManager) tlsConfig(sc *ServerConnection) *tls.Config {
+	sc.mu.RLock()
+	useTLS := sc.ServerInfo.UseTLS
+	host := sc.ServerInfo.Address
+	sc.mu.RUnlock()
+	if !useTLS {
+		return nil
+	}
+
+	pinned := func() string {
+		sc.mu.RLock()
+		defer sc.mu.RUnlock()
+		return sc.ServerInfo.TLSFingerprint
+	}
+	onPin := func(fingerprint string) {
+		sc.mu.Lock()
+		sc.ServerInfo.TLSFingerprint = fingerprint
+		sc.mu.Unlock()
+
+		cm.eventChan <- ServerScopedMsg{
+			ServerID: sc.ServerID,
+			Msg:      CertificatePinnedMsg{Fingerprint: fingerprint},
+		}
+	}
+	return pinnedTLSConfig(host, pinned, onPin)
+}
+
 // DisconnectServer disconnects from a server
 func (cm *ConnectionManager) DisconnectServer(serverID uuid.UUID) error {
 	sc := cm.GetConnection(serverID)
@@ -297,8 +703,9 @@ func (cm *ConnectionManager) GetConnectedServers() []*ServerConnection {
 	return connected
 }
 
-// SendMessage sends a message to a channel on a specific server
-func (cm *ConnectionManager) SendMessage(serverID, channelID uuid.UUID, content string) error {
+// SendMessage sends a message to a channel on a specific server, as a reply
+// when replyTo is set
+func (cm *ConnectionManager) SendMessage(serverID, channelID uuid.UUID, content string, replyTo *uuid.UUID) error {
 	sc := cm.GetConnection(serverID)
 	if sc == nil {
 		return fmt.Errorf("server %s not found", serverID)
@@ -316,7 +723,7 @@ func (cm *ConnectionManager) SendMessage(serverID, channelID uuid.UUID, content
 		return fmt.Errorf("no connection for server %s", serverID)
 	}
 
-	return conn.SendMessage(channelID, content, nil)
+	return conn.SendMessage(channelID, content, replyTo)
 }
 
 // SendTyping sends a typing indicator to a channel on a specific server
@@ -357,6 +764,7 @@ func (cm *ConnectionManager) Login(serverID uuid.UUID, email, password string) (
 		// Create temporary connection for login
 		conn = NewConnection(sc.ServerInfo.GetWebSocketURL())
 		conn.serverAddr = httpURL
+		conn.tlsConfig = cm.tlsConfig(sc)
 	}
 
 	user, token, err := conn.Login(email, password)
@@ -382,13 +790,15 @@ func (cm *ConnectionManager) Register(serverID uuid.UUID, username, email, passw
 
 	sc.mu.RLock()
 	httpURL := sc.ServerInfo.GetHTTPURL()
+	inviteCode := sc.ServerInfo.InviteCode
 	sc.mu.RUnlock()
 
 	// Create temporary connection for registration
 	conn := NewConnection(sc.ServerInfo.GetWebSocketURL())
 	conn.serverAddr = httpURL
+	conn.tlsConfig = cm.tlsConfig(sc)
 
-	user, token, err := conn.Register(username, email, password)
+	user, token, err := conn.Register(username, email, password, inviteCode)
 	if err != nil {
 		return nil, "", err
 	}
@@ -558,6 +968,15 @@ func (cm *ConnectionManager) handleServerDisconnected(serverID uuid.UUID) {
 
 // handleServerError handles error event
 func (cm *ConnectionManager) handleServerError(serverID uuid.UUID, err error) {
+	var revoked *SessionRevokedError
+	if errors.As(err, &revoked) {
+		cm.eventChan <- ServerScopedMsg{
+			ServerID: serverID,
+			Msg:      SessionRevokedMsg{Reason: revoked.Reason},
+		}
+		return
+	}
+
 	sc := cm.GetConnection(serverID)
 	if sc != nil {
 		sc.SetState(StateError)
@@ -571,6 +990,18 @@ func (cm *ConnectionManager) handleServerError(serverID uuid.UUID, err error) {
 	cm.eventChan <- wrapped
 }
 
+// CertificatePinnedMsg reports that a server's certificate was trusted on
+// first use and should be saved to servers.json
+type CertificatePinnedMsg struct {
+	Fingerprint string
+}
+
+// SessionRevokedMsg reports that the server signed this client out, so the
+// saved token must be discarded
+type SessionRevokedMsg struct {
+	Reason string
+}
+
 // ServerScopedMsg wraps a tea.Msg with server context
 type ServerScopedMsg struct {
 	ServerID uuid.UUID
@@ -45,7 +45,8 @@ func (a *App) renderManageServersView() string {
 	// Instructions
 	instructions := lipgloss.NewStyle().
 		Foreground(lipgloss.Color(a.theme.Colors.Comment)).
-		Render("↑/↓: Navigate  •  Shift+↑/↓: Reorder  •  P: Ping  •  E: Edit  •  D: Delete  •  Enter: Select  •  Esc: Close")
+		Render("↑/↓: Navigate  •  Shift+↑/↓: Reorder  •  P: Ping  •  E: Edit  •  D: Delete\n" +
+			"F: Forget pinned certificate  •  Enter: Select  •  Esc: Close")
 
 	content.WriteString(instructions + "\n\n")
 
@@ -130,6 +131,9 @@ func (a *App) renderServerRow(server *ClientServerInfo, selected bool) string {
 		protocol = "https"
 	}
 	serverAddr := fmt.Sprintf("%s://%s:%d", protocol, server.Address, server.Port)
+	if server.UseTLS && server.TLSFingerprint != "" {
+		serverAddr += " [pinned]"
+	}
 
 	// Build row
 	nameStyle := lipgloss.NewStyle().Bold(true)
@@ -251,12 +255,38 @@ func (a *App) handleManageServersKey(msg tea.KeyMsg) tea.Cmd {
 			a.addServerName.SetValue(server.Name)
 			a.addServerAddress.SetValue(server.Address)
 			a.addServerPort.SetValue(fmt.Sprintf("%d", server.Port))
+			a.addServerInvite.SetValue(server.InviteCode)
 			a.addServerUseTLS = server.UseTLS
 			a.addServerName.Focus()
 			a.view = ViewAddServer
 		}
 		return nil
 
+	case "f", "F":
+		// Forget the pinned certificate so the next connection pins afresh
+		if a.manageServersFocus < len(servers) {
+			server := servers[a.manageServersFocus]
+			if server.TLSFingerprint == "" {
+				a.statusMessage = fmt.Sprintf("No certificate pinned for %s", server.Name)
+				a.statusError = false
+				return nil
+			}
+			for _, cs := range a.clientServers {
+				if cs.ID == server.ID {
+					cs.TLSFingerprint = ""
+				}
+			}
+			a.statusMessage = fmt.Sprintf("Forgot the pinned certificate for %s", server.Name)
+			a.statusError = false
+			return func() tea.Msg {
+				if err := a.configMgr.UpdateServerFingerprint(server.ID, ""); err != nil {
+					return ErrorMsg{Error: fmt.Sprintf("Failed to save server: %v", err)}
+				}
+				return nil
+			}
+		}
+		return nil
+
 	case "d", "D":
 		// Delete selected server
 		if a.manageServersFocus < len(servers) {
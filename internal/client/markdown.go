@@ -0,0 +1,527 @@
+package client
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/google/uuid"
+)
+
+// Messages support a markdown subset: **bold**, *italic* or _italic_,
+// ~~strikethrough~~, `code`, ||spoilers||, "> " quotes and ``` fenced
+// code blocks. A newline is always a line break.
+
+// mdFlags are the inline styles in effect for a span of text
+type mdFlags uint8
+
+const (
+	mdBold mdFlags = 1 << iota
+	mdItalic
+	mdStrike
+	mdCode
+	mdSpoiler
+	mdMention
+	mdLink
+)
+
+// mdSpan is a run of message text with one set of inline styles
+type mdSpan struct {
+	text  string
+	flags mdFlags
+}
+
+// mdDelims maps emphasis delimiters to their style, longest first so "**"
+// is tried before "*"
+var mdDelims = []struct {
+	delim string
+	flag  mdFlags
+}{
+	{"||", mdSpoiler},
+	{"**", mdBold},
+	{"~~", mdStrike},
+	{"*", mdItalic},
+	{"_", mdItalic},
+}
+
+// mdEscapable are the characters a backslash makes literal
+const mdEscapable = "\\`*_~|>"
+
+// inlineParser splits a line into spans. With source set, only links and
+// mentions are picked out and the markdown is left as typed.
+type inlineParser struct {
+	alias  string // Current user's name, for @mention highlighting
+	source bool
+	spans  []mdSpan
+}
+
+// parseInline splits one line of markdown into styled spans
+func parseInline(line, alias string) []mdSpan {
+	p := &inlineParser{alias: alias}
+	p.parse(line, 0)
+	return p.spans
+}
+
+func (p *inlineParser) emit(text string, flags mdFlags) {
+	if text == "" {
+		return
+	}
+	if n := len(p.spans); n > 0 && p.spans[n-1].flags == flags && flags&mdLink == 0 {
+		p.spans[n-1].text += text
+		return
+	}
+	p.spans = append(p.spans, mdSpan{text: text, flags: flags})
+}
+
+func (p *inlineParser) parse(s string, flags mdFlags) {
+	plain := 0 // Start of the text not yet emitted
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		// Links and mentions are taken whole so "_" in a URL stays put
+		if c == 'h' && strings.HasPrefix(s[i:], "http") {
+			if loc := urlRegex.FindStringIndex(s[i:]); loc != nil && loc[0] == 0 {
+				p.emit(s[plain:i], flags)
+				p.emit(s[i:i+loc[1]], flags|mdLink)
+				i += loc[1]
+				plain = i
+				continue
+			}
+		}
+		if c == '@' && p.alias != "" && len(s)-i > len(p.alias) &&
+			strings.EqualFold(s[i+1:i+1+len(p.alias)], p.alias) {
+			p.emit(s[plain:i], flags)
+			p.emit(s[i:i+1+len(p.alias)], flags|mdMention)
+			i += 1 + len(p.alias)
+			plain = i
+			continue
+		}
+		if p.source {
+			i++
+			continue
+		}
+
+		if c == '\\' && i+1 < len(s) && strings.IndexByte(mdEscapable, s[i+1]) >= 0 {
+			p.emit(s[plain:i], flags)
+			p.emit(s[i+1:i+2], flags)
+			i += 2
+			plain = i
+			continue
+		}
+
+		// `code` or ``code with ` inside``: no formatting within
+		if c == '`' {
+			n := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+			if end := strings.Index(s[i+n:], s[i:i+n]); end > 0 {
+				p.emit(s[plain:i], flags)
+				p.emit(s[i+n:i+n+end], flags|mdCode)
+				i += n + end + n
+				plain = i
+				continue
+			}
+			i += n
+			continue
+		}
+
+		if delim, flag, closeAt, ok := matchDelim(s, i); ok {
+			p.emit(s[plain:i], flags)
+			p.parse(s[i+len(delim):closeAt], flags|flag)
+			i = closeAt + len(delim)
+			plain = i
+			continue
+		}
+		i++
+	}
+	p.emit(s[plain:], flags)
+}
+
+// matchDelim finds an emphasis delimiter opening at s[i] and where it closes.
+// Delimiters must hug their text ("* x *" stays literal), and "_" only
+// counts at word boundaries so snake_case is left alone.
+func matchDelim(s string, i int) (delim string, flag mdFlags, closeAt int, ok bool) {
+	for _, d := range mdDelims {
+		if !strings.HasPrefix(s[i:], d.delim) {
+			continue
+		}
+		start := i + len(d.delim)
+		if start >= len(s) || s[start] == ' ' {
+			continue
+		}
+		if d.delim == "_" && i > 0 && isWordByte(s[i-1]) {
+			continue
+		}
+		for j := start + 1; j+len(d.delim) <= len(s); j++ {
+			if s[j:j+len(d.delim)] != d.delim || s[j-1] == ' ' {
+				continue
+			}
+			// A lone "*" doesn't close on half of a "**"
+			if d.delim == "*" && (s[j-1] == '*' || (j+1 < len(s) && s[j+1] == '*')) {
+				continue
+			}
+			if d.delim == "_" && j+1 < len(s) && isWordByte(s[j+1]) {
+				continue
+			}
+			return d.delim, d.flag, j, true
+		}
+	}
+	return "", 0, 0, false
+}
+
+func isWordByte(b byte) bool {
+	return b >= 0x80 || b == '_' || ('0' <= b && b <= '9') || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z')
+}
+
+// mdBlockKind is the kind of a group of message lines
+type mdBlockKind int
+
+const (
+	mdText mdBlockKind = iota
+	mdQuote
+	mdFence
+)
+
+// mdBlock is a run of lines rendered the same way
+type mdBlock struct {
+	kind  mdBlockKind
+	lang  string // Language named after the opening ``` of a fence
+	lines []string
+}
+
+// parseBlocks groups message lines into text, "> " quotes and fenced code.
+// A fence that is never closed runs to the end of the message.
+func parseBlocks(text string) []mdBlock {
+	var blocks []mdBlock
+	add := func(kind mdBlockKind, line string) {
+		if n := len(blocks); n > 0 && blocks[n-1].kind == kind && kind != mdFence {
+			blocks[n-1].lines = append(blocks[n-1].lines, line)
+			return
+		}
+		blocks = append(blocks, mdBlock{kind: kind, lines: []string{line}})
+	}
+
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```") && len(trimmed) > 6 && strings.HasSuffix(trimmed, "```"):
+			// ```one-liner```
+			blocks = append(blocks, mdBlock{kind: mdFence, lines: []string{trimmed[3 : len(trimmed)-3]}})
+		case strings.HasPrefix(trimmed, "```"):
+			block := mdBlock{kind: mdFence, lang: strings.ToLower(strings.TrimSpace(trimmed[3:]))}
+			for i++; i < len(lines) && strings.TrimSpace(lines[i]) != "```"; i++ {
+				block.lines = append(block.lines, lines[i])
+			}
+			if len(block.lines) == 0 {
+				block.lines = []string{""}
+			}
+			blocks = append(blocks, block)
+		case line == ">" || strings.HasPrefix(line, "> "):
+			add(mdQuote, strings.TrimPrefix(strings.TrimPrefix(line, ">"), " "))
+		default:
+			add(mdText, line)
+		}
+	}
+	return blocks
+}
+
+// plainMarkdown strips the markup from content for one-line previews.
+// Spoilers are masked so previews never give them away.
+func plainMarkdown(content string) string {
+	var out []string
+	for _, block := range parseBlocks(content) {
+		if block.kind == mdFence {
+			out = append(out, block.lines...)
+			continue
+		}
+		for _, line := range block.lines {
+			var b strings.Builder
+			masked := false
+			for _, span := range parseInline(line, "") {
+				if span.flags&mdSpoiler != 0 {
+					if !masked {
+						b.WriteString("▒▒▒")
+					}
+					masked = true
+					continue
+				}
+				b.WriteString(span.text)
+				masked = false
+			}
+			out = append(out, b.String())
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// hasSpoiler reports whether content has any ||spoiler|| text
+func hasSpoiler(content string) bool {
+	for _, block := range parseBlocks(content) {
+		if block.kind == mdFence {
+			continue
+		}
+		for _, line := range block.lines {
+			for _, span := range parseInline(line, "") {
+				if span.flags&mdSpoiler != 0 {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// mdRun is a piece of text ready to draw: its style and, for links, the URL
+type mdRun struct {
+	text  string
+	style lipgloss.Style
+	link  string
+}
+
+// wrapRuns breaks runs into rows of at most width columns. Words move to the
+// next row whole unless they are wider than a row. With hard set it breaks
+// anywhere and keeps every space, for code.
+func wrapRuns(runs []mdRun, width int, hard bool) [][]mdRun {
+	width = max(width, 1)
+	var rows [][]mdRun
+	var row []mdRun
+	col, last := 0, -1
+	newRow := func() {
+		rows = append(rows, row)
+		row, col, last = nil, 0, -1
+	}
+	put := func(src int, text string) {
+		if n := len(row); n > 0 && last == src {
+			row[n-1].text += text
+		} else {
+			run := runs[src]
+			run.text = text
+			row = append(row, run)
+		}
+		last = src
+		col += lipgloss.Width(text)
+	}
+	putRunes := func(src int, text string) {
+		for _, r := range text {
+			if w := lipgloss.Width(string(r)); col+w > width && col > 0 {
+				newRow()
+			}
+			put(src, string(r))
+		}
+	}
+
+	if hard {
+		for i, run := range runs {
+			putRunes(i, run.text)
+		}
+		return append(rows, row)
+	}
+
+	// Split runs into words and spaces; a word may span several runs
+	type piece struct {
+		src  int
+		text string
+	}
+	var word []piece
+	wrapped := false // The current row was started by wrapping
+	flushWord := func() {
+		if len(word) == 0 {
+			return
+		}
+		w := 0
+		for _, pc := range word {
+			w += lipgloss.Width(pc.text)
+		}
+		if col+w > width && col > 0 {
+			newRow()
+			wrapped = true
+		}
+		for _, pc := range word {
+			if w > width {
+				putRunes(pc.src, pc.text)
+			} else {
+				put(pc.src, pc.text)
+			}
+		}
+		word = word[:0]
+	}
+	for i, run := range runs {
+		text := run.text
+		for text != "" {
+			end := strings.IndexByte(text, ' ')
+			if end != 0 {
+				if end < 0 {
+					end = len(text)
+				}
+				word = append(word, piece{i, text[:end]})
+				text = text[end:]
+				continue
+			}
+			flushWord()
+			end = len(text) - len(strings.TrimLeft(text, " "))
+			spaces := text[:end]
+			text = text[end:]
+			switch {
+			case col == 0 && wrapped:
+				// Leading spaces of a wrapped row are dropped
+			case col+len(spaces) > width:
+				newRow()
+				wrapped = true
+			default:
+				put(i, spaces)
+			}
+		}
+	}
+	flushWord()
+	return append(rows, row)
+}
+
+// renderRow draws a row of runs, turning links into OSC 8 hyperlinks
+func renderRow(row []mdRun) string {
+	var b strings.Builder
+	for _, run := range row {
+		styled := run.style.Render(run.text)
+		if run.link != "" {
+			styled = osc8Link(run.link, styled)
+		}
+		b.WriteString(styled)
+	}
+	return b.String()
+}
+
+// renderMessageContent renders message markdown wrapped to width: inline
+// styles, @mentions of the current user, links, quotes and highlighted code
+// blocks. Spoilers stay masked unless revealSpoilers is set.
+func (a *App) renderMessageContent(text string, width int, revealSpoilers bool) string {
+	alias := a.currentAlias()
+	lineStyle := lipgloss.NewStyle().Width(width)
+	codeBg := lipgloss.Color(a.theme.Colors.CurrentLine)
+
+	var rendered []string
+	for _, block := range parseBlocks(text) {
+		switch block.kind {
+		case mdFence:
+			rowStyle := lipgloss.NewStyle().Background(codeBg).Width(width).PaddingLeft(1)
+			for _, runs := range a.highlightCode(block.lines, block.lang) {
+				for _, row := range wrapRuns(runs, width-2, true) {
+					rendered = append(rendered, rowStyle.Render(renderRow(row)))
+				}
+			}
+		case mdQuote:
+			bar := lipgloss.NewStyle().Foreground(lipgloss.Color(a.theme.Colors.Comment)).Render("▎ ")
+			for _, line := range block.lines {
+				runs := a.inlineRuns(parseInline(line, alias), revealSpoilers)
+				for _, row := range wrapRuns(runs, width-2, false) {
+					rendered = append(rendered, lineStyle.Render(bar+renderRow(row)))
+				}
+			}
+		default:
+			for _, line := range block.lines {
+				runs := a.inlineRuns(parseInline(line, alias), revealSpoilers)
+				for _, row := range wrapRuns(runs, width, false) {
+					rendered = append(rendered, lineStyle.Render(renderRow(row)))
+				}
+			}
+		}
+	}
+	return strings.Join(rendered, "\n")
+}
+
+// renderMessageSource renders message text as typed, only picking out links
+// and mentions. Level 2 navigation shows this so the cursor and selection sit
+// on the columns splitMessageIntoLines gives the movement and copy logic.
+func (a *App) renderMessageSource(text string, width int) string {
+	p := &inlineParser{alias: a.currentAlias(), source: true}
+	lineStyle := lipgloss.NewStyle().Width(width)
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		p.spans = nil
+		p.parse(line, 0)
+		lines[i] = lineStyle.Render(renderRow(a.inlineRuns(p.spans, true)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// currentAlias is the logged-in user's name on the active server
+func (a *App) currentAlias() string {
+	if a.activeConn != nil && a.activeConn.User != nil {
+		return a.activeConn.User.Username
+	}
+	return ""
+}
+
+// inlineRuns styles parsed spans with the active theme
+func (a *App) inlineRuns(spans []mdSpan, revealSpoilers bool) []mdRun {
+	colors := a.theme.Colors
+	runs := make([]mdRun, 0, len(spans))
+	for _, span := range spans {
+		style := lipgloss.NewStyle().Foreground(lipgloss.Color(a.theme.Semantic.ChatFg))
+		switch {
+		case span.flags&mdMention != 0:
+			style = style.Foreground(lipgloss.Color(a.theme.Semantic.ChatMention)).Bold(true)
+		case span.flags&mdLink != 0:
+			style = style.Foreground(lipgloss.Color(colors.Cyan)).Underline(true)
+		case span.flags&mdCode != 0:
+			style = style.Foreground(lipgloss.Color(colors.Green)).Background(lipgloss.Color(colors.CurrentLine))
+		}
+		if span.flags&mdBold != 0 {
+			style = style.Bold(true)
+		}
+		if span.flags&mdItalic != 0 {
+			style = style.Italic(true)
+		}
+		if span.flags&mdStrike != 0 {
+			style = style.Strikethrough(true)
+		}
+
+		run := mdRun{text: span.text, style: style}
+		if span.flags&mdLink != 0 {
+			run.link = span.text
+		}
+		if span.flags&mdSpoiler != 0 {
+			if revealSpoilers {
+				run.style = style.Background(lipgloss.Color(colors.Selection))
+			} else {
+				// Same width as the text, so revealing doesn't reflow the message
+				run = mdRun{text: maskSpoiler(span.text), style: lipgloss.NewStyle().Foreground(lipgloss.Color(colors.Comment))}
+			}
+		}
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// maskSpoiler replaces each character of text with shade blocks of the same
+// width, keeping the spaces so the masked text wraps like the real one
+func maskSpoiler(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if r == ' ' {
+			b.WriteByte(' ')
+			continue
+		}
+		b.WriteString(strings.Repeat("▒", lipgloss.Width(string(r))))
+	}
+	return b.String()
+}
+
+// toggleSpoilers reveals or hides the ||spoilers|| of the selected message
+func (a *App) toggleSpoilers() {
+	md := a.selectedMessage()
+	if md == nil || !hasSpoiler(md.Content) {
+		a.statusMessage = "No spoilers in this message"
+		a.statusError = false
+		return
+	}
+	if a.revealedSpoilers == nil {
+		a.revealedSpoilers = make(map[uuid.UUID]bool)
+	}
+	if a.revealedSpoilers[md.ID] {
+		delete(a.revealedSpoilers, md.ID)
+		a.statusMessage = "Spoilers hidden"
+	} else {
+		a.revealedSpoilers[md.ID] = true
+		a.statusMessage = "Spoilers revealed"
+	}
+	a.statusError = false
+	a.updateChatContent()
+}
@@ -0,0 +1,166 @@
+package client
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseInline(t *testing.T) {
+	tests := []struct {
+		line string
+		want []mdSpan
+	}{
+		{"", nil},
+		{"plain text", []mdSpan{{"plain text", 0}}},
+		{"**bold** and *it*", []mdSpan{{"bold", mdBold}, {" and ", 0}, {"it", mdItalic}}},
+		{"_it_ ~~gone~~", []mdSpan{{"it", mdItalic}, {" ", 0}, {"gone", mdStrike}}},
+		{"**a *b* c**", []mdSpan{{"a ", mdBold}, {"b", mdBold | mdItalic}, {" c", mdBold}}},
+		{"||secret||", []mdSpan{{"secret", mdSpoiler}}},
+
+		// Delimiters that don't hug their text, or sit inside words, are literal
+		{"* not *", []mdSpan{{"* not *", 0}}},
+		{"snake_case_name", []mdSpan{{"snake_case_name", 0}}},
+		{"2 * 3 * 4", []mdSpan{{"2 * 3 * 4", 0}}},
+		{"**unclosed", []mdSpan{{"**unclosed", 0}}},
+
+		// Code spans take their content verbatim
+		{"`**x**`", []mdSpan{{"**x**", mdCode}}},
+		{"``a ` b``", []mdSpan{{"a ` b", mdCode}}},
+		{"`unclosed", []mdSpan{{"`unclosed", 0}}},
+
+		// Escapes
+		{`\*lit\*`, []mdSpan{{"*lit*", 0}}},
+		{`a\b`, []mdSpan{{`a\b`, 0}}},
+
+		// Links are taken whole, so underscores in them stay put
+		{"see https://x.com/a_b_c ok", []mdSpan{
+			{"see ", 0}, {"https://x.com/a_b_c", mdLink}, {" ok", 0},
+		}},
+		{"**https://x.com**", []mdSpan{{"https://x.com", mdBold | mdLink}}},
+	}
+	for _, tt := range tests {
+		if got := parseInline(tt.line, ""); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseInline(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseInlineMentions(t *testing.T) {
+	tests := []struct {
+		line string
+		want []mdSpan
+	}{
+		{"hi @Alice!", []mdSpan{{"hi ", 0}, {"@Alice", mdMention}, {"!", 0}}},
+		{"@alice", []mdSpan{{"@alice", mdMention}}},
+		{"*@alice*", []mdSpan{{"@alice", mdItalic | mdMention}}},
+		{"@alic", []mdSpan{{"@alic", 0}}},
+	}
+	for _, tt := range tests {
+		if got := parseInline(tt.line, "alice"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseInline(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseBlocks(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []mdBlock
+	}{
+		{"lines", "a\nb", []mdBlock{{kind: mdText, lines: []string{"a", "b"}}}},
+		{"quote", "> q1\n>\n> q2\ntext", []mdBlock{
+			{kind: mdQuote, lines: []string{"q1", "", "q2"}},
+			{kind: mdText, lines: []string{"text"}},
+		}},
+		{"quote needs a space", ">no", []mdBlock{{kind: mdText, lines: []string{">no"}}}},
+		{"fence", "```Go\nx := 1\n```\nafter", []mdBlock{
+			{kind: mdFence, lang: "go", lines: []string{"x := 1"}},
+			{kind: mdText, lines: []string{"after"}},
+		}},
+		{"unclosed fence", "before\n```\n> not a quote\nmore", []mdBlock{
+			{kind: mdText, lines: []string{"before"}},
+			{kind: mdFence, lines: []string{"> not a quote", "more"}},
+		}},
+		{"empty fence", "```\n```", []mdBlock{{kind: mdFence, lines: []string{""}}}},
+		{"one-line fences stay apart", "```a```\n```b```", []mdBlock{
+			{kind: mdFence, lines: []string{"a"}},
+			{kind: mdFence, lines: []string{"b"}},
+		}},
+	}
+	for _, tt := range tests {
+		if got := parseBlocks(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parseBlocks(%q) = %+v, want %+v", tt.name, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestWrapRuns(t *testing.T) {
+	tests := []struct {
+		name  string
+		runs  []string
+		width int
+		hard  bool
+		want  []string
+	}{
+		{"fits", []string{"hello world"}, 20, false, []string{"hello world"}},
+		{"exact fit", []string{"hello world"}, 11, false, []string{"hello world"}},
+		{"breaks between words", []string{"hello world"}, 5, false, []string{"hello", "world"}},
+		{"drops spaces at a wrap", []string{"a  b"}, 2, false, []string{"a", "b"}},
+		{"splits long words", []string{"abcdefgh"}, 3, false, []string{"abc", "def", "gh"}},
+		{"zero width", []string{"ab"}, 0, false, []string{"a", "b"}},
+		{"wide runes", []string{"日本語"}, 4, false, []string{"日本", "語"}},
+		{"word across runs", []string{"foo", "bar baz"}, 6, false, []string{"foobar", "baz"}},
+		{"hard keeps spaces", []string{"ab  cd"}, 3, true, []string{"ab ", " cd"}},
+		{"empty", nil, 10, false, []string{""}},
+	}
+	for _, tt := range tests {
+		runs := make([]mdRun, len(tt.runs))
+		for i, text := range tt.runs {
+			runs[i] = mdRun{text: text}
+		}
+		var got []string
+		for _, row := range wrapRuns(runs, tt.width, tt.hard) {
+			var b strings.Builder
+			for _, run := range row {
+				b.WriteString(run.text)
+			}
+			got = append(got, b.String())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: wrapRuns(%q, %d) = %q, want %q", tt.name, tt.runs, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestWrapRunsKeepsRunsApart(t *testing.T) {
+	runs := []mdRun{{text: "foo"}, {text: "bar", link: "https://x.com"}}
+	rows := wrapRuns(runs, 10, false)
+	if len(rows) != 1 || len(rows[0]) != 2 {
+		t.Fatalf("wrapRuns = %+v, want one row of two runs", rows)
+	}
+	if rows[0][1].link != "https://x.com" {
+		t.Errorf("link lost: %+v", rows[0][1])
+	}
+}
+
+func TestPlainMarkdown(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"**bold** `code`", "bold code"},
+		{"> quoted\n```\n*raw*\n```", "quoted\n*raw*"},
+		{"a ||secret|| b", "a ▒▒▒ b"},
+		{"||one **two**||", "▒▒▒"},
+	}
+	for _, tt := range tests {
+		if got := plainMarkdown(tt.content); got != tt.want {
+			t.Errorf("plainMarkdown(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+	if !hasSpoiler("x ||y||") || hasSpoiler("```\n||y||\n```") {
+		t.Error("hasSpoiler should see spoilers in text but not in code")
+	}
+}
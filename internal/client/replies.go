@@ -0,0 +1,147 @@
+package client
+
+import (
+	"log"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/concord-chat/concord/internal/protocol"
+	"github.com/google/uuid"
+)
+
+// startReply makes the selected message the target of the next send
+func (a *App) startReply() tea.Cmd {
+	md := a.selectedMessage()
+	if md == nil || md.IsSystem || md.IsWhisper {
+		return nil
+	}
+	if a.editingMessageID != uuid.Nil {
+		a.cancelMessageEdit()
+	}
+	// Replies are sent to the channel, so the input box leaves the thread pane
+	a.closeThread()
+	a.replyingTo = md
+	a.messageNavMode = false
+	a.inMessageEditMode = false
+	a.focus = FocusInput
+	a.input.Focus()
+	a.statusMessage = ""
+	a.updateChatContent()
+	return tea.ShowCursor
+}
+
+// jumpToReplyParent selects the message the selected reply answers, loading
+// the history around it when it isn't loaded
+func (a *App) jumpToReplyParent() tea.Cmd {
+	md := a.selectedMessage()
+	if md == nil || md.ReplyToID == nil {
+		a.statusMessage = "The selected message isn't a reply"
+		a.statusError = false
+		return nil
+	}
+	parentID := *md.ReplyToID
+	for i, m := range a.activeConn.GetMessages(a.currentChannel.ID) {
+		if m.ID == parentID {
+			a.messageNavIndex = i
+			a.pendingDeleteID = uuid.Nil
+			a.updateChatContent()
+			return nil
+		}
+	}
+	if parent, known := a.activeConn.ReplyParent(parentID); known && parent == nil {
+		a.statusMessage = "The original message was deleted"
+		a.statusError = true
+		return nil
+	}
+	// The parent is selected once the history around it arrives
+	a.enterCurrentChannelAround(&parentID)
+	return nil
+}
+
+// replyParent finds the message a reply answers among the loaded messages or
+// the fetched parents. known is false while it still has to be fetched.
+func (a *App) replyParent(parentID uuid.UUID, loaded map[uuid.UUID]*MessageDisplay) (parent *MessageDisplay, known bool) {
+	if md, ok := loaded[parentID]; ok {
+		return md, true
+	}
+	return a.activeConn.ReplyParent(parentID)
+}
+
+// fetchReplyParents requests reply parents that aren't loaded, skipping
+// those already fetched or on their way
+func (a *App) fetchReplyParents(channelID uuid.UUID, ids []uuid.UUID) {
+	if len(ids) == 0 || a.activeConn == nil || a.activeConn.Connection == nil {
+		return
+	}
+	ids = a.activeConn.ClaimReplyParents(ids)
+	for len(ids) > 0 {
+		batch := ids[:min(len(ids), 50)]
+		ids = ids[len(batch):]
+		msg, err := protocol.NewMessage(protocol.OpFetchMessages, &protocol.MessageFetchRequest{
+			ChannelID:  channelID,
+			MessageIDs: batch,
+		})
+		if err != nil {
+			log.Printf("Failed to create message fetch request: %v", err)
+			return
+		}
+		if err := a.activeConn.Connection.Send(msg); err != nil {
+			log.Printf("Failed to fetch reply parents: %v", err)
+			return
+		}
+	}
+}
+
+// renderReplyQuote renders the line above a reply: "╭─ @alice what they said"
+func (a *App) renderReplyQuote(parent *MessageDisplay, known bool, width int) string {
+	barStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(a.theme.Colors.Comment))
+	noteStyle := barStyle.Italic(true)
+	bar := barStyle.Render("╭─ ")
+
+	room := width - lipgloss.Width("╭─ ")
+	switch {
+	case parent != nil:
+		author := "@" + parent.AuthorName
+		room -= lipgloss.Width(author + " ")
+		return bar + lipgloss.NewStyle().Foreground(lipgloss.Color(a.theme.Colors.Cyan)).Render(author) +
+			" " + barStyle.Render(quoteSnippet(parent.Content, room))
+	case known:
+		return bar + noteStyle.Render(quoteSnippet("original message was deleted", room))
+	default:
+		return bar + noteStyle.Render(quoteSnippet("loading…", room))
+	}
+}
+
+// renderReplyBanner renders the "replying to" row shown above the input box
+func (a *App) renderReplyBanner(width int) string {
+	md := a.replyingTo
+	style := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(a.theme.Colors.Comment)).
+		Width(width).
+		PaddingLeft(1)
+	author := "@" + md.AuthorName
+	hint := "  (Esc to cancel)"
+	room := width - lipgloss.Width(" ↪ Replying to "+author+" "+hint)
+	line := "↪ Replying to " +
+		lipgloss.NewStyle().Foreground(lipgloss.Color(a.theme.Colors.Cyan)).Bold(true).Render(author) +
+		" " + quoteSnippet(md.Content, room) + hint
+	return style.Render(line)
+}
+
+// quoteSnippet returns the first line of content, without markdown, cut to
+// fit width columns
+func quoteSnippet(content string, width int) string {
+	line, _, more := strings.Cut(strings.TrimSpace(plainMarkdown(content)), "\n")
+	runes := []rune(line)
+	if width < 2 {
+		return ""
+	}
+	if len(runes) > width {
+		return string(runes[:width-1]) + "…"
+	}
+	if more {
+		return line + " …"
+	}
+	return line
+}
@@ -15,18 +15,21 @@ type ClientServerInfo struct {
 	Address          string             `json:"address"`           // Server address (hostname or IP)
 	Port             int                `json:"port"`              // Server port
 	UseTLS           bool               `json:"use_tls"`           // Whether to use TLS/WSS
+	TLSFingerprint   string             `json:"tls_fingerprint,omitempty"` // Certificate pinned on first use (SHA-256)
 	AddedAt          time.Time          `json:"added_at"`          // When server was added
 	LastConnected    *time.Time         `json:"last_connected,omitempty"` // Last successful connection
 	SavedCredentials *SavedCredentials  `json:"saved_credentials,omitempty"` // Saved login credentials
 	UserID           uuid.UUID          `json:"user_id,omitempty"` // User ID on this server
 	IconLetter       string             `json:"icon_letter"`       // Letter shown in server icon (1-2 chars)
 	IconColor        string             `json:"icon_color"`        // Hex color for server icon
+	InviteCode       string             `json:"invite_code,omitempty"` // Redeemed when registering a new account
 }
 
 // SavedCredentials stores login credentials for auto-connect
 type SavedCredentials struct {
 	Email               string `json:"email"`                         // User email
-	Token               string `json:"token"`                         // Auth token (plaintext in Phase 1)
+	Token               string `json:"token,omitempty"`               // Auth token; in memory only, or plaintext in old configs
+	EncryptedToken      string `json:"encrypted_token,omitempty"`     // Token sealed with the vault key
 	AutoConnect         bool   `json:"auto_connect"`                  // Auto-connect on startup
 	RememberCredentials bool   `json:"remember_credentials"`          // Whether to save credentials
 }
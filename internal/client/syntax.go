@@ -0,0 +1,257 @@
+package client
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// codeLang describes enough of a language to colour a fenced code block
+type codeLang struct {
+	keywords     map[string]bool
+	types        map[string]bool // Built-in types and constants
+	lineComment  []string
+	blockComment [2]string
+	quotes       string // Characters that open and close a string
+	foldCase     bool   // Keywords match in any case (SQL)
+}
+
+func wordSet(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		set[w] = true
+	}
+	return set
+}
+
+var (
+	langGo = &codeLang{
+		keywords: wordSet(`break case chan const continue default defer else fallthrough for func go goto if
+			import interface map package range return select struct switch type var`),
+		types: wordSet(`any bool byte complex64 complex128 error float32 float64 int int8 int16 int32 int64
+			rune string uint uint8 uint16 uint32 uint64 uintptr nil true false iota`),
+		lineComment:  []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'`",
+	}
+	langPython = &codeLang{
+		keywords: wordSet(`and as assert async await break class continue def del elif else except finally for
+			from global if import in is lambda nonlocal not or pass raise return try while with yield`),
+		types:       wordSet(`None True False self int str float bool list dict set tuple bytes object`),
+		lineComment: []string{"#"},
+		quotes:      "\"'",
+	}
+	langJS = &codeLang{
+		keywords: wordSet(`async await break case catch class const continue debugger default delete do else
+			enum export extends finally for function if implements import in instanceof interface let new
+			of return super switch this throw try type typeof var void while yield`),
+		types:        wordSet(`true false null undefined NaN string number boolean any never unknown object`),
+		lineComment:  []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'`",
+	}
+	langRust = &codeLang{
+		keywords: wordSet(`as async await break const continue crate dyn else enum extern fn for if impl in
+			let loop match mod move mut pub ref return self Self static struct super trait type unsafe use
+			where while`),
+		types: wordSet(`i8 i16 i32 i64 i128 isize u8 u16 u32 u64 u128 usize f32 f64 bool char str String
+			Vec Box Option Result Some None Ok Err true false`),
+		lineComment:  []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"",
+	}
+	langC = &codeLang{
+		keywords: wordSet(`auto break case catch class const continue default delete do else enum extern
+			final finally for goto if implements import namespace new package private protected public
+			return sizeof static struct switch template this throw throws try typedef union using virtual
+			volatile while`),
+		types: wordSet(`bool char double float int long short signed unsigned void size_t String Object
+			true false null NULL nullptr`),
+		lineComment:  []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "\"'",
+	}
+	langShell = &codeLang{
+		keywords: wordSet(`if then else elif fi for while until do done case esac in function return
+			local export readonly exit source`),
+		types:       wordSet(`echo cd ls cat grep sed awk rm cp mv mkdir sudo git go make true false`),
+		lineComment: []string{"#"},
+		quotes:      "\"'",
+	}
+	langSQL = &codeLang{
+		keywords: wordSet(`select from where insert into values update set delete create table drop alter
+			index join left right inner outer on and or not is in as order by group having limit offset
+			primary key references default unique begin commit rollback distinct union case when then
+			else end`),
+		types:        wordSet(`null true false integer int text real blob datetime boolean varchar`),
+		lineComment:  []string{"--"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "'\"",
+		foldCase:     true,
+	}
+	langData = &codeLang{
+		types:       wordSet(`true false null`),
+		lineComment: []string{"#"},
+		quotes:      "\"'",
+	}
+)
+
+// codeLangs maps the names written after ``` to a language
+var codeLangs = map[string]*codeLang{
+	"go":         langGo,
+	"golang":     langGo,
+	"py":         langPython,
+	"python":     langPython,
+	"js":         langJS,
+	"javascript": langJS,
+	"jsx":        langJS,
+	"ts":         langJS,
+	"typescript": langJS,
+	"tsx":        langJS,
+	"rs":         langRust,
+	"rust":       langRust,
+	"c":          langC,
+	"h":          langC,
+	"cpp":        langC,
+	"c++":        langC,
+	"java":       langC,
+	"cs":         langC,
+	"csharp":     langC,
+	"sh":         langShell,
+	"bash":       langShell,
+	"zsh":        langShell,
+	"shell":      langShell,
+	"sql":        langSQL,
+	"json":       langData,
+	"yaml":       langData,
+	"yml":        langData,
+	"toml":       langData,
+}
+
+// highlightCode colours the lines of a fenced block with the theme palette.
+// Unknown languages are drawn in one colour. Block comments carry across lines.
+func (a *App) highlightCode(lines []string, lang string) [][]mdRun {
+	colors := a.theme.Colors
+	base := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(colors.Foreground)).
+		Background(lipgloss.Color(colors.CurrentLine))
+	keyword := base.Foreground(lipgloss.Color(colors.Pink))
+	typ := base.Foreground(lipgloss.Color(colors.Cyan))
+	str := base.Foreground(lipgloss.Color(colors.Yellow))
+	number := base.Foreground(lipgloss.Color(colors.Purple))
+	function := base.Foreground(lipgloss.Color(colors.Green))
+	comment := base.Foreground(lipgloss.Color(colors.Comment)).Italic(true)
+
+	spec := codeLangs[lang]
+	inComment := false
+	out := make([][]mdRun, len(lines))
+	for n, line := range lines {
+		line = strings.ReplaceAll(line, "\t", "    ")
+		if spec == nil {
+			out[n] = []mdRun{{text: line, style: base}}
+			continue
+		}
+
+		var runs []mdRun
+		emit := func(text string, style lipgloss.Style) {
+			if text != "" {
+				runs = append(runs, mdRun{text: text, style: style})
+			}
+		}
+		plain := 0
+		for i := 0; i < len(line); {
+			rest := line[i:]
+			start := i
+			style := base
+			switch {
+			case inComment:
+				end := strings.Index(rest, spec.blockComment[1])
+				if end < 0 {
+					i = len(line)
+				} else {
+					i += end + len(spec.blockComment[1])
+					inComment = false
+				}
+				style = comment
+			case hasAnyPrefix(rest, spec.lineComment):
+				i = len(line)
+				style = comment
+			case spec.blockComment[0] != "" && strings.HasPrefix(rest, spec.blockComment[0]):
+				open := len(spec.blockComment[0])
+				if end := strings.Index(rest[open:], spec.blockComment[1]); end < 0 {
+					i = len(line)
+					inComment = true
+				} else {
+					i += open + end + len(spec.blockComment[1])
+				}
+				style = comment
+			case strings.IndexByte(spec.quotes, rest[0]) >= 0:
+				i = stringEnd(line, i)
+				style = str
+			case isDigit(rest[0]) && (i == 0 || !isWordByte(line[i-1])):
+				for i < len(line) && (isWordByte(line[i]) || line[i] == '.') {
+					i++
+				}
+				style = number
+			case isWordByte(rest[0]) && (i == 0 || !isWordByte(line[i-1])):
+				for i < len(line) && isWordByte(line[i]) {
+					i++
+				}
+				word := line[start:i]
+				if spec.foldCase {
+					word = strings.ToLower(word)
+				}
+				switch {
+				case spec.keywords[word]:
+					style = keyword
+				case spec.types[word]:
+					style = typ
+				case strings.HasPrefix(strings.TrimLeft(line[i:], " "), "("):
+					style = function
+				default:
+					continue
+				}
+			default:
+				i++
+				continue
+			}
+			emit(line[plain:start], base)
+			emit(line[start:i], style)
+			plain = i
+		}
+		emit(line[plain:], base)
+		if runs == nil {
+			runs = []mdRun{{text: "", style: base}}
+		}
+		out[n] = runs
+	}
+	return out
+}
+
+// stringEnd returns the index just past the string literal opening at line[i],
+// or the end of the line if it isn't closed there
+func stringEnd(line string, i int) int {
+	quote := line[i]
+	for j := i + 1; j < len(line); j++ {
+		switch line[j] {
+		case '\\':
+			j++
+		case quote:
+			return j + 1
+		}
+	}
+	return len(line)
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func isDigit(b byte) bool {
+	return '0' <= b && b <= '9'
+}
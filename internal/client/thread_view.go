@@ -0,0 +1,441 @@
+package client
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/concord-chat/concord/internal/models"
+	"github.com/concord-chat/concord/internal/protocol"
+	"github.com/google/uuid"
+)
+
+// Replies requested per page of thread history
+const threadPageSize = 50
+
+// ThreadState is the thread open in the split pane beside the chat
+type ThreadState struct {
+	Thread   *models.Channel
+	Viewport viewport.Model
+	HasMore  bool // Older replies exist beyond the ones loaded
+	Loading  bool // A page of history has been requested
+
+	ShowSpoilers bool // ||Spoilers|| in the replies are revealed ("s" in the pane)
+
+	typingExpiry map[uuid.UUID]time.Time // userID → when the typing indicator expires
+	typingUsers  []string
+}
+
+// composeChannel is where the input box posts: the open thread, or the current channel
+func (a *App) composeChannel() *models.Channel {
+	if a.thread != nil {
+		return a.thread.Thread
+	}
+	return a.currentChannel
+}
+
+// openThread shows a thread in the split pane and moves the input box there
+func (a *App) openThread(thread *models.Channel) {
+	if a.activeConn == nil {
+		return
+	}
+	a.thread = &ThreadState{Thread: thread, Viewport: viewport.New(0, 0)}
+	a.replyingTo = nil
+	a.messageNavMode = false
+	a.inMessageEditMode = false
+	a.focus = FocusInput
+	a.input.Focus()
+	a.updateViewportSize()
+	a.reloadThread()
+	a.updateChatContent()
+	a.statusMessage = fmt.Sprintf("Opened thread %s (Esc in the thread or /thread close to return)", thread.Name)
+	a.statusError = false
+}
+
+// closeThread closes the thread pane and gives the input box back to the channel
+func (a *App) closeThread() {
+	if a.thread == nil {
+		return
+	}
+	a.thread = nil
+	if a.focus == FocusThread {
+		a.focus = FocusChat
+	}
+	a.updateViewportSize()
+	a.updateChatContent()
+}
+
+// reloadThread marks the open thread read and fetches its newest replies
+func (a *App) reloadThread() {
+	threadID := a.thread.Thread.ID
+	if thread := a.activeConn.GetThread(threadID); thread != nil {
+		a.thread.Thread = thread
+	}
+	if a.currentClientServer != nil {
+		serverID := a.currentClientServer.ID
+		delete(a.unreadCounts[serverID], threadID)
+		delete(a.mentionCounts[serverID], threadID)
+	}
+	a.thread.typingExpiry = nil
+	a.thread.typingUsers = nil
+	a.activeConn.ClearMessages(threadID)
+	a.requestThreadHistory(nil)
+	a.updateThreadContent()
+}
+
+// requestThreadHistory asks for a page of the open thread's replies, the
+// newest ones or those before a message
+func (a *App) requestThreadHistory(before *uuid.UUID) {
+	if a.activeConn == nil || a.activeConn.Connection == nil {
+		return
+	}
+	req := &protocol.MessageHistoryRequest{
+		ChannelID: a.thread.Thread.ID,
+		Limit:     threadPageSize,
+		Before:    before,
+	}
+	msg, err := protocol.NewMessage(protocol.OpRequestMessages, req)
+	if err != nil {
+		log.Printf("Failed to create thread history request: %v", err)
+		return
+	}
+	if err := a.activeConn.Connection.Send(msg); err != nil {
+		log.Printf("Failed to request thread history: %v", err)
+		return
+	}
+	a.thread.Loading = true
+}
+
+// loadOlderThreadReplies requests the page before the oldest loaded reply
+func (a *App) loadOlderThreadReplies() {
+	if a.thread == nil || !a.thread.HasMore || a.thread.Loading || a.activeConn == nil {
+		return
+	}
+	messages := a.activeConn.GetMessages(a.thread.Thread.ID)
+	if len(messages) == 0 {
+		return
+	}
+	before := messages[0].ID
+	a.requestThreadHistory(&before)
+}
+
+// showThreadHistory redraws the thread pane after a page of history arrives.
+// An older page keeps the replies on screen where they were.
+func (a *App) showThreadHistory(hasMore, older bool) {
+	a.thread.HasMore = hasMore
+	a.thread.Loading = false
+	linesBefore := a.thread.Viewport.TotalLineCount()
+	offset := a.thread.Viewport.YOffset
+	a.updateThreadContent()
+	if older {
+		a.thread.Viewport.SetYOffset(offset + a.thread.Viewport.TotalLineCount() - linesBefore)
+	} else {
+		a.thread.Viewport.GotoBottom()
+	}
+}
+
+// scrollThread scrolls the thread pane by delta lines, paging in older
+// replies on reaching the top
+func (a *App) scrollThread(delta int) {
+	if a.thread == nil {
+		return
+	}
+	if delta < 0 {
+		a.thread.Viewport.LineUp(-delta)
+	} else {
+		a.thread.Viewport.LineDown(delta)
+	}
+	if a.thread.Viewport.AtTop() {
+		a.loadOlderThreadReplies()
+	}
+}
+
+// refreshOpenThread redraws the thread pane if channelID is the thread open on sc
+func (a *App) refreshOpenThread(sc *ServerConnection, channelID uuid.UUID) {
+	if a.activeConn == sc && a.thread != nil && a.thread.Thread.ID == channelID {
+		a.updateThreadContent()
+	}
+}
+
+// refreshThreadAnchor redraws the chat if it shows the anchor of a thread on sc
+func (a *App) refreshThreadAnchor(sc *ServerConnection, threadID uuid.UUID) {
+	if a.activeConn != sc || a.currentChannel == nil {
+		return
+	}
+	if thread := sc.GetThread(threadID); thread != nil && thread.ParentID == a.currentChannel.ID {
+		a.updateChatContent()
+	}
+}
+
+// applyThreadUpdate stores a renamed, archived or reopened thread
+func (a *App) applyThreadUpdate(sc *ServerConnection, thread *models.Channel) {
+	sc.UpsertThread(thread)
+	if a.activeConn == sc && a.thread != nil && a.thread.Thread.ID == thread.ID {
+		if thread.Thread != nil && a.thread.Thread.Thread != nil && thread.Thread.Archived != a.thread.Thread.Thread.Archived {
+			if thread.Thread.Archived {
+				a.statusMessage = fmt.Sprintf("Thread %s was archived — replying reopens it", thread.Name)
+			} else {
+				a.statusMessage = fmt.Sprintf("Thread %s was reopened", thread.Name)
+			}
+			a.statusError = false
+		}
+		a.thread.Thread = thread
+	}
+	a.refreshThreadAnchor(sc, thread.ID)
+}
+
+// removeThread drops a deleted or hidden thread, closing it if it was open
+func (a *App) removeThread(sc *ServerConnection, threadID uuid.UUID) {
+	thread := sc.GetThread(threadID)
+	sc.RemoveThread(threadID)
+	delete(a.unreadCounts[sc.ServerID], threadID)
+	delete(a.mentionCounts[sc.ServerID], threadID)
+	if a.activeConn != sc {
+		return
+	}
+	if a.thread != nil && a.thread.Thread.ID == threadID {
+		a.closeThread()
+		a.statusMessage = "The thread is no longer available"
+		a.statusError = true
+	} else if thread != nil && a.currentChannel != nil && thread.ParentID == a.currentChannel.ID {
+		a.updateChatContent()
+	}
+}
+
+// threadFromSelectedMessage opens the selected message's thread, or fills in
+// /thread create to start one from it
+func (a *App) threadFromSelectedMessage() tea.Cmd {
+	md := a.selectedMessage()
+	if md == nil || md.IsSystem || md.IsWhisper || a.activeConn == nil || a.currentChannel == nil {
+		return nil
+	}
+	if thread := a.activeConn.ThreadsByAnchor(a.currentChannel.ID)[md.ID]; thread != nil {
+		a.openThread(thread)
+		return tea.ShowCursor
+	}
+
+	a.messageNavMode = false
+	a.inMessageEditMode = false
+	a.focus = FocusInput
+	a.input.Focus()
+	if a.currentChannel.Type != models.ChannelTypeText {
+		a.statusMessage = "Threads can only be started in text channels"
+		a.statusError = true
+	} else {
+		a.threadAnchor = md.ID
+		a.input.SetValue("/thread create ")
+		a.statusMessage = fmt.Sprintf("Name the thread on %s's message and press Enter", md.AuthorName)
+		a.statusError = false
+	}
+	a.updateChatContent()
+	return tea.ShowCursor
+}
+
+// noteThreadTyping shows userID as typing in the open thread
+func (a *App) noteThreadTyping(userID uuid.UUID) {
+	if a.thread.typingExpiry == nil {
+		a.thread.typingExpiry = make(map[uuid.UUID]time.Time)
+	}
+	a.thread.typingExpiry[userID] = time.Now().Add(10 * time.Second)
+	a.thread.typingUsers = a.typingNames(a.thread.typingExpiry)
+}
+
+// pruneThreadTyping drops expired typing indicators from the open thread
+func (a *App) pruneThreadTyping(now time.Time) {
+	if a.thread == nil || len(a.thread.typingExpiry) == 0 {
+		return
+	}
+	for uid, exp := range a.thread.typingExpiry {
+		if now.After(exp) {
+			delete(a.thread.typingExpiry, uid)
+		}
+	}
+	a.thread.typingUsers = a.typingNames(a.thread.typingExpiry)
+}
+
+// splitThreadPane divides the chat column between the chat panel and an
+// open thread, which takes two fifths of it. The thread pane's border comes
+// out of its share.
+func (a *App) splitThreadPane(chatWidth int) (int, int) {
+	if a.thread == nil {
+		return chatWidth, 0
+	}
+	threadWidth := max(chatWidth*2/5, 30)
+	return chatWidth - threadWidth, threadWidth - 2
+}
+
+// resizeThreadPane sizes the thread viewport and the input box, which lives
+// in the thread pane while it's open. Mirrors renderThreadPanel.
+func (a *App) resizeThreadPane(width int) {
+	interiorWidth := width - 2
+	a.input.SetWidth(interiorWidth - 2)
+
+	// Same panel height as renderMainView; the pane stacks header and spacer,
+	// viewport, typing row and input box like the chat panel
+	threadHeight := a.height - 2 - 6 - 2 - 1
+	if interiorWidth > 0 {
+		a.thread.Viewport.Width = interiorWidth
+	}
+	if threadHeight > 2 {
+		a.thread.Viewport.Height = threadHeight - 2
+	}
+}
+
+// updateThreadContent rebuilds the thread viewport from the cached replies
+func (a *App) updateThreadContent() {
+	if a.thread == nil || a.activeConn == nil {
+		return
+	}
+	width := a.thread.Viewport.Width
+	var content strings.Builder
+
+	commentStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(a.theme.Colors.Comment)).
+		Italic(true).
+		Width(width)
+
+	if a.thread.HasMore {
+		content.WriteString(commentStyle.Render("↑ older replies"))
+		content.WriteString("\n")
+	} else if anchor := a.threadAnchorMessage(); anchor != nil {
+		// The whole thread is loaded, so start with the message it hangs off
+		content.WriteString(commentStyle.Render("↱ " + anchor.AuthorName + ": " + plainMarkdown(anchor.Content)))
+		content.WriteString("\n")
+		content.WriteString(commentStyle.Render(strings.Repeat("─", max(width, 0))))
+		content.WriteString("\n")
+	}
+
+	timestampStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(a.theme.Semantic.ChatTimestamp)).
+		Faint(true)
+
+	var prev *MessageDisplay
+	for _, msg := range a.activeConn.GetMessages(a.thread.Thread.ID) {
+		// Group consecutive replies by the same author within five minutes
+		if prev == nil || prev.AuthorID != msg.AuthorID || msg.CreatedAt.Sub(prev.CreatedAt) >= 5*time.Minute {
+			authorStyle := a.styles.UsernameOther
+			if msg.IsOwn {
+				authorStyle = a.styles.UsernameSelf
+			}
+			timestamp := msg.CreatedAt.Format("15:04")
+			if msg.EditedAt != nil {
+				timestamp += " (edited)"
+			}
+			header := fmt.Sprintf("%s  %s", authorStyle.Render(msg.AuthorName), timestampStyle.Render(timestamp))
+			content.WriteString(lipgloss.NewStyle().Width(width).Render(header))
+			content.WriteString("\n")
+		}
+		prev = msg
+
+		content.WriteString(a.renderMessageContent(msg.Content, width, a.thread.ShowSpoilers))
+		content.WriteString("\n")
+		if len(msg.Reactions) > 0 {
+			content.WriteString(lipgloss.NewStyle().Width(width).Render(a.renderReactions(msg.Reactions)))
+			content.WriteString("\n")
+		}
+	}
+
+	a.thread.Viewport.SetContent(content.String())
+}
+
+// threadAnchorMessage returns the open thread's anchor if the parent channel has it cached
+func (a *App) threadAnchorMessage() *MessageDisplay {
+	for _, md := range a.activeConn.GetMessages(a.thread.Thread.ParentID) {
+		if md.ID == a.thread.Thread.ParentMessageID {
+			return md
+		}
+	}
+	return nil
+}
+
+// renderThreadSummary renders the line under a thread's anchor message:
+// "🧵 name · 3 replies · 1 new · archived"
+func (a *App) renderThreadSummary(thread *models.Channel) string {
+	nameStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(a.theme.Colors.Cyan)).Bold(true)
+	metaStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(a.theme.Colors.Comment))
+	newStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(a.theme.Colors.Yellow)).Bold(true)
+
+	count, archived := 0, false
+	if thread.Thread != nil {
+		count, archived = thread.Thread.MessageCount, thread.Thread.Archived
+	}
+	replies := fmt.Sprintf("%d replies", count)
+	if count == 1 {
+		replies = "1 reply"
+	}
+
+	line := "  " + nameStyle.Render("🧵 "+thread.Name) + metaStyle.Render(" · "+replies)
+	if a.currentClientServer != nil {
+		if unread := a.unreadCounts[a.currentClientServer.ID][thread.ID]; unread > 0 {
+			line += metaStyle.Render(" · ") + newStyle.Render(fmt.Sprintf("%d new", unread))
+		}
+	}
+	if archived {
+		line += metaStyle.Render(" · archived")
+	}
+	return line
+}
+
+// renderThreadPanel renders the open thread beside the chat: header, replies,
+// typing row and the input box
+func (a *App) renderThreadPanel(width, height int) string {
+	a.resizeThreadPane(width)
+	thread := a.thread.Thread
+	threadHeight := height - 6 - 2 - 1
+
+	headerStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(a.theme.Colors.Foreground)).
+		Background(lipgloss.Color(a.theme.Colors.Selection)).
+		Bold(true).
+		Width(width).
+		Padding(0, 1)
+	title := "🧵 " + thread.Name
+	if thread.Thread != nil && thread.Thread.Archived {
+		title += " (archived)"
+	}
+	header := headerStyle.Render(title)
+	spacer := lipgloss.NewStyle().Width(width).Height(1).Render("")
+
+	borderColor := lipgloss.Color(a.theme.Colors.Selection)
+	if a.focus == FocusThread {
+		borderColor = lipgloss.Color(a.theme.Colors.Purple)
+	}
+	viewStyle := lipgloss.NewStyle().
+		Width(width).
+		Height(threadHeight).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(borderColor)
+
+	threadContent := a.thread.Viewport.View()
+	if len(a.activeConn.GetMessages(thread.ID)) == 0 && !a.thread.Loading {
+		threadContent = lipgloss.NewStyle().
+			Foreground(lipgloss.Color(a.theme.Colors.Comment)).
+			Italic(true).
+			Width(width - 2).
+			Align(lipgloss.Center).
+			MarginTop((threadHeight - 2) / 3).
+			Render("No replies yet")
+	}
+	replies := viewStyle.Render(threadContent)
+
+	typing := lipgloss.NewStyle().Width(width).Height(1).Render("")
+	if len(a.thread.typingUsers) > 0 {
+		typing = lipgloss.NewStyle().Width(width).Render(a.renderTypingLine(a.thread.typingUsers))
+	}
+
+	inputBorderColor := lipgloss.Color(a.theme.Colors.Comment)
+	if a.focus == FocusInput {
+		inputBorderColor = lipgloss.Color(a.theme.Colors.Purple)
+	}
+	input := lipgloss.NewStyle().
+		Width(width).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(inputBorderColor).
+		Render(a.injectMentionGhost(a.input.View()))
+
+	return lipgloss.JoinVertical(lipgloss.Left, header, spacer, replies, typing, input)
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/concord-chat/concord/pkg/crypto"
+)
+
+// CertificateMismatchError is returned when a server presents a different
+// certificate from the one pinned on first use
+type CertificateMismatchError struct {
+	Pinned    string
+	Presented string
+}
+
+func (e *CertificateMismatchError) Error() string {
+	return fmt.Sprintf("server certificate changed (pinned %s, got %s); if the server "+
+		"replaced it, forget the old one with F in Manage Servers", e.Pinned, e.Presented)
+}
+
+// pinnedTLSConfig returns TLS settings for connecting to host that accept
+// certificates from a trusted CA as usual and otherwise trust the server's
+// certificate on first use. The CA check is against host itself, an IP
+// address or a name, since no server name is sent when dialing an IP.
+// pinned returns the fingerprint pinned so far ("" if none); onPin is called
+// when an untrusted certificate is accepted for the first time. Once a
+// certificate is pinned, only that certificate is accepted.
+func pinnedTLSConfig(host string, pinned func() string, onPin func(fingerprint string)) *tls.Config {
+	host = strings.Trim(host, "[]") // Bracketed IPv6 literal
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: host,
+		// Verification happens in VerifyConnection so self-signed certificates can be pinned
+		InsecureSkipVerify: true,
+	}
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("server presented no certificate")
+		}
+		leaf := cs.PeerCertificates[0]
+		fingerprint := crypto.CertFingerprint(leaf.Raw)
+
+		if pin := pinned(); pin != "" {
+			if pin != fingerprint {
+				return &CertificateMismatchError{Pinned: pin, Presented: fingerprint}
+			}
+			return nil
+		}
+		if host == "" {
+			return errors.New("no host to verify the server certificate against")
+		}
+
+		// DNSName may hold an IP address, which is matched against IP SANs
+		opts := x509.VerifyOptions{
+			DNSName:       host,
+			Roots:         cfg.RootCAs,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		if _, err := leaf.Verify(opts); err == nil {
+			return nil
+		}
+
+		if onPin != nil {
+			onPin(fingerprint)
+		}
+		return nil
+	}
+	return cfg
+}
@@ -0,0 +1,209 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/concord-chat/concord/pkg/crypto"
+)
+
+// testCA issues certificates that a config with its pool as RootCAs trusts
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue returns a certificate for hosts signed by the CA, or self-signed
+// when ca is nil. IP addresses go in the IP SANs.
+func (ca *testCA) issue(t *testing.T, hosts ...string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: hosts[0]},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	parent, signer := template, key
+	if ca != nil {
+		parent, signer = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// handshake runs a TLS handshake between cfg and a server presenting cert
+func handshake(t *testing.T, cfg *tls.Config, cert tls.Certificate) error {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		server := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+		server.SetDeadline(time.Now().Add(5 * time.Second))
+		server.Handshake()
+		conn.Close()
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := tls.Client(conn, cfg)
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	err = client.Handshake()
+	conn.Close()
+	<-done
+	return err
+}
+
+// pinRecorder stands in for the saved pin of one server
+type pinRecorder struct {
+	pin    string
+	pinned int // Times onPin was called
+}
+
+func (p *pinRecorder) config(host string, roots *x509.CertPool) *tls.Config {
+	cfg := pinnedTLSConfig(host, func() string { return p.pin }, func(fingerprint string) {
+		p.pin = fingerprint
+		p.pinned++
+	})
+	cfg.RootCAs = roots
+	return cfg
+}
+
+func TestPinnedTLSFirstUse(t *testing.T) {
+	var ca *testCA // Self-signed
+	cert := ca.issue(t, "chat.example.com")
+	fingerprint := crypto.CertFingerprint(cert.Certificate[0])
+
+	p := &pinRecorder{}
+	if err := handshake(t, p.config("chat.example.com", nil), cert); err != nil {
+		t.Fatalf("first connection: %v", err)
+	}
+	if p.pinned != 1 || p.pin != fingerprint {
+		t.Fatalf("pinned %q %d times, want %q once", p.pin, p.pinned, fingerprint)
+	}
+
+	// The pinned certificate keeps working without being pinned again
+	if err := handshake(t, p.config("chat.example.com", nil), cert); err != nil {
+		t.Fatalf("second connection: %v", err)
+	}
+	if p.pinned != 1 {
+		t.Errorf("pinned %d times, want once", p.pinned)
+	}
+}
+
+func TestPinnedTLSMismatch(t *testing.T) {
+	var self *testCA
+	ca := newTestCA(t)
+	p := &pinRecorder{pin: crypto.CertFingerprint(self.issue(t, "chat.example.com").Certificate[0])}
+
+	// Once pinned, even a CA-signed certificate for the right host is refused
+	for name, cert := range map[string]tls.Certificate{
+		"self-signed": self.issue(t, "chat.example.com"),
+		"CA-signed":   ca.issue(t, "chat.example.com"),
+	} {
+		err := handshake(t, p.config("chat.example.com", ca.pool), cert)
+		var mismatch *CertificateMismatchError
+		if !errors.As(err, &mismatch) {
+			t.Errorf("%s: got %v, want a certificate mismatch", name, err)
+			continue
+		}
+		if mismatch.Presented != crypto.CertFingerprint(cert.Certificate[0]) {
+			t.Errorf("%s: presented fingerprint %s", name, mismatch.Presented)
+		}
+	}
+	if p.pinned != 0 {
+		t.Errorf("a mismatched certificate replaced the pin")
+	}
+}
+
+func TestPinnedTLSHostVerification(t *testing.T) {
+	ca := newTestCA(t)
+	tests := []struct {
+		name   string
+		host   string
+		cert   tls.Certificate
+		pinned bool // Accepted by pinning rather than by the CA
+	}{
+		{"CA-signed for the host", "chat.example.com", ca.issue(t, "chat.example.com"), false},
+		{"CA-signed for another name", "chat.example.com", ca.issue(t, "other.example.com"), true},
+		{"CA-signed for the IP", "10.0.0.7", ca.issue(t, "10.0.0.7"), false},
+		{"CA-signed IPv6", "[::1]", ca.issue(t, "::1"), false},
+		{"CA-signed for a name, dialed by IP", "10.0.0.7", ca.issue(t, "chat.example.com"), true},
+		{"CA-signed for another IP", "10.0.0.7", ca.issue(t, "10.0.0.8"), true},
+	}
+	for _, tt := range tests {
+		p := &pinRecorder{}
+		if err := handshake(t, p.config(tt.host, ca.pool), tt.cert); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := p.pinned == 1; got != tt.pinned {
+			t.Errorf("%s: pinned = %v, want %v", tt.name, got, tt.pinned)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/concord-chat/concord/pkg/crypto"
+)
+
+// ErrWrongPassphrase is returned by Unlock when the passphrase doesn't open the vault
+var ErrWrongPassphrase = errors.New("wrong passphrase")
+
+// vaultCheck is sealed into the vault header so a passphrase can be verified
+// before anything is decrypted with it
+const vaultCheck = "concord-vault"
+
+// VaultConfig describes how the key that seals saved passwords and tokens is
+// derived from the user's passphrase (argon2id). Only the salt and cost
+// parameters are stored; the key itself lives in memory.
+type VaultConfig struct {
+	Salt    string `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"` // KiB
+	Threads uint8  `json:"threads"`
+	Check   string `json:"check"` // vaultCheck sealed with the key
+}
+
+func (v *VaultConfig) deriveKey(passphrase string) ([]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(v.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vault salt: %w", err)
+	}
+	return crypto.DeriveKey(passphrase, salt, v.Time, v.Memory, v.Threads), nil
+}
+
+// SetSavePassword controls whether the identity password is written to
+// config.json. When off, only server tokens are kept between runs.
+func (cm *ConfigManager) SetSavePassword(save bool) {
+	cm.mu.Lock()
+	cm.savePassword = save
+	cm.mu.Unlock()
+}
+
+// HasVault reports whether a passphrase has been set up
+func (cm *ConfigManager) HasVault() bool {
+	config, err := cm.LoadAppConfig()
+	return err == nil && config.Vault != nil
+}
+
+// CreateVault sets up the passphrase and seals any plaintext secrets left by
+// older versions. Secrets sealed under a previous, forgotten passphrase
+// can't be read and are dropped.
+func (cm *ConfigManager) CreateVault(passphrase string) error {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+	vault := &VaultConfig{
+		Salt:    base64.StdEncoding.EncodeToString(salt),
+		Time:    3,
+		Memory:  64 * 1024,
+		Threads: 4,
+	}
+	key, err := vault.deriveKey(passphrase)
+	if err != nil {
+		return err
+	}
+	if vault.Check, err = crypto.Seal(key, []byte(vaultCheck)); err != nil {
+		return err
+	}
+
+	// Read both files before the key is set so nothing is opened with it
+	appConfig, err := cm.LoadAppConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load app config: %w", err)
+	}
+	servers, err := cm.LoadServers()
+	if err != nil {
+		return fmt.Errorf("failed to load servers: %w", err)
+	}
+
+	cm.mu.Lock()
+	cm.key = key
+	cm.mu.Unlock()
+
+	appConfig.Vault = vault
+	if appConfig.Identity != nil {
+		appConfig.Identity.EncryptedPassword = ""
+	}
+	if err := cm.SaveAppConfig(appConfig); err != nil {
+		return err
+	}
+	for _, server := range servers.Servers {
+		if server.SavedCredentials != nil {
+			server.SavedCredentials.EncryptedToken = ""
+		}
+	}
+	return cm.SaveServers(servers)
+}
+
+// Unlock derives the vault key from passphrase so saved secrets can be read
+// and written. Plaintext secrets from older versions are sealed on the way.
+func (cm *ConfigManager) Unlock(passphrase string) error {
+	appConfig, err := cm.LoadAppConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load app config: %w", err)
+	}
+	if appConfig.Vault == nil {
+		return errors.New("no passphrase has been set up")
+	}
+
+	key, err := appConfig.Vault.deriveKey(passphrase)
+	if err != nil {
+		return err
+	}
+	if check, err := crypto.Open(key, appConfig.Vault.Check); err != nil || string(check) != vaultCheck {
+		return ErrWrongPassphrase
+	}
+
+	cm.mu.Lock()
+	cm.key = key
+	cm.mu.Unlock()
+
+	return cm.migrate()
+}
+
+// migrate rewrites both files so plaintext secrets are sealed and the
+// save-password setting takes effect
+func (cm *ConfigManager) migrate() error {
+	appConfig, err := cm.LoadAppConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load app config: %w", err)
+	}
+	if err := cm.SaveAppConfig(appConfig); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(cm.serversFilePath); os.IsNotExist(err) {
+		return nil
+	}
+	servers, err := cm.LoadServers()
+	if err != nil {
+		return fmt.Errorf("failed to load servers: %w", err)
+	}
+	return cm.SaveServers(servers)
+}
+
+// openIdentity decrypts the sealed password into Password. Caller holds cm.mu.
+func (cm *ConfigManager) openIdentity(identity *LocalIdentity) {
+	if identity == nil || identity.EncryptedPassword == "" || cm.key == nil {
+		return
+	}
+	password, err := crypto.Open(cm.key, identity.EncryptedPassword)
+	if err != nil {
+		log.Printf("Warning: could not decrypt saved password: %v", err)
+		return
+	}
+	identity.Password = string(password)
+}
+
+// sealIdentity returns a copy of identity fit for disk: the password is
+// sealed, or left out when passwords aren't saved. Caller holds cm.mu.
+func (cm *ConfigManager) sealIdentity(identity *LocalIdentity) (*LocalIdentity, error) {
+	if identity == nil {
+		return nil, nil
+	}
+	sealed := *identity
+	sealed.Password = ""
+	switch {
+	case !cm.savePassword:
+		sealed.EncryptedPassword = ""
+	case identity.Password != "" && cm.key != nil:
+		password, err := crypto.Seal(cm.key, []byte(identity.Password))
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt password: %w", err)
+		}
+		sealed.EncryptedPassword = password
+	}
+	return &sealed, nil
+}
+
+// openCredentials decrypts the sealed token into Token. Caller holds cm.mu.
+func (cm *ConfigManager) openCredentials(creds *SavedCredentials) {
+	if creds == nil || creds.EncryptedToken == "" || cm.key == nil {
+		return
+	}
+	token, err := crypto.Open(cm.key, creds.EncryptedToken)
+	if err != nil {
+		log.Printf("Warning: could not decrypt saved token: %v", err)
+		return
+	}
+	creds.Token = string(token)
+}
+
+// sealServers returns a copy of config with every token sealed. A token that
+// can't be sealed because the vault is locked is not saved. Caller holds cm.mu.
+func (cm *ConfigManager) sealServers(config *ServersConfig) (*ServersConfig, error) {
+	sealed := *config
+	sealed.Servers = make([]*ClientServerInfo, len(config.Servers))
+	for i, server := range config.Servers {
+		s := *server
+		if server.SavedCredentials != nil {
+			creds := *server.SavedCredentials
+			if creds.Token != "" && cm.key != nil {
+				token, err := crypto.Seal(cm.key, []byte(creds.Token))
+				if err != nil {
+					return nil, fmt.Errorf("failed to encrypt token: %w", err)
+				}
+				creds.EncryptedToken = token
+			}
+			creds.Token = ""
+			s.SavedCredentials = &creds
+		}
+		sealed.Servers[i] = &s
+	}
+	return &sealed, nil
+}
+
+// hardenPermissions makes the config directory and files private to the user
+func hardenPermissions(dir string, files ...string) {
+	if err := os.Chmod(dir, 0700); err != nil {
+		log.Printf("Warning: could not restrict %s: %v", dir, err)
+	}
+	for _, path := range files {
+		if err := os.Chmod(path, 0600); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: could not restrict %s: %v", path, err)
+		}
+	}
+}
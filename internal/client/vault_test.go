@@ -0,0 +1,304 @@
+package client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/concord-chat/concord/pkg/crypto"
+)
+
+const (
+	testPassphrase = "correct horse"
+	testPassword   = "hunter2-password"
+	testToken      = "tok-0123456789abcdef"
+)
+
+// newVaultTest returns a config manager over an empty ~/.concord
+func newVaultTest(t *testing.T) *ConfigManager {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	return reopen(t)
+}
+
+// reopen returns a config manager over the same files, as on the next run
+func reopen(t *testing.T) *ConfigManager {
+	t.Helper()
+	cm, err := NewConfigManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cm
+}
+
+// saveSecrets stores an identity password and a server token through cm
+func saveSecrets(t *testing.T, cm *ConfigManager) *ClientServerInfo {
+	t.Helper()
+	if err := cm.SaveIdentity(&LocalIdentity{Alias: "alice", Email: "alice@example.com", Password: testPassword}); err != nil {
+		t.Fatal(err)
+	}
+	server := NewClientServerInfo("Home", "chat.example.com", 8080, true)
+	if err := cm.AddServer(server); err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.SaveServerToken(server.ID, "alice@example.com", testToken, server.ID); err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+// writeJSON writes v to path as is, bypassing the vault
+func writeJSON(t *testing.T, path string, v interface{}) {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertSealedOnDisk checks that neither secret is readable in the files and
+// that both are stored sealed
+func assertSealedOnDisk(t *testing.T, cm *ConfigManager) {
+	t.Helper()
+	for _, path := range []string{cm.configFilePath, cm.serversFilePath} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range []string{testPassword, testToken} {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("%s holds %q in plaintext", path, secret)
+			}
+		}
+	}
+
+	var appConfig AppConfig
+	var servers ServersConfig
+	readJSON(t, cm.configFilePath, &appConfig)
+	readJSON(t, cm.serversFilePath, &servers)
+	if appConfig.Identity == nil || appConfig.Identity.EncryptedPassword == "" {
+		t.Error("password is not stored sealed")
+	}
+	if len(servers.Servers) != 1 || servers.Servers[0].SavedCredentials == nil ||
+		servers.Servers[0].SavedCredentials.EncryptedToken == "" {
+		t.Error("token is not stored sealed")
+	}
+}
+
+func readJSON(t *testing.T, path string, v interface{}) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// savedSecrets returns the password and token as cm reads them
+func savedSecrets(t *testing.T, cm *ConfigManager) (password, token string) {
+	t.Helper()
+	if identity := cm.GetIdentity(); identity != nil {
+		password = identity.Password
+	}
+	servers, err := cm.LoadServers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers.Servers) == 1 && servers.Servers[0].SavedCredentials != nil {
+		token = servers.Servers[0].SavedCredentials.Token
+	}
+	return password, token
+}
+
+func TestVaultUnlock(t *testing.T) {
+	cm := newVaultTest(t)
+	if cm.HasVault() {
+		t.Fatal("new config has a vault")
+	}
+	if err := cm.Unlock(testPassphrase); err == nil || errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("unlock without a vault = %v, want a missing vault error", err)
+	}
+	if err := cm.CreateVault(testPassphrase); err != nil {
+		t.Fatal(err)
+	}
+	if !reopen(t).HasVault() {
+		t.Fatal("vault was not saved")
+	}
+
+	tests := []struct {
+		name       string
+		passphrase string
+		want       error
+	}{
+		{"right passphrase", testPassphrase, nil},
+		{"wrong passphrase", "wrong horse", ErrWrongPassphrase},
+		{"different case", "Correct horse", ErrWrongPassphrase},
+		{"trailing space", testPassphrase + " ", ErrWrongPassphrase},
+		{"empty", "", ErrWrongPassphrase},
+	}
+	for _, tt := range tests {
+		cm := reopen(t)
+		if err := cm.Unlock(tt.passphrase); !errors.Is(err, tt.want) {
+			t.Errorf("%s: unlock = %v, want %v", tt.name, err, tt.want)
+		}
+		if unlocked := cm.key != nil; unlocked != (tt.want == nil) {
+			t.Errorf("%s: unlocked = %v", tt.name, unlocked)
+		}
+	}
+}
+
+func TestVaultRejectsTamperedCheck(t *testing.T) {
+	cm := newVaultTest(t)
+	if err := cm.CreateVault(testPassphrase); err != nil {
+		t.Fatal(err)
+	}
+	var original AppConfig
+	readJSON(t, cm.configFilePath, &original)
+	raw, _ := base64.StdEncoding.DecodeString(original.Vault.Check)
+	flipped := append([]byte(nil), raw...)
+	flipped[len(flipped)-1] ^= 1
+
+	// A check that opens under the key but doesn't hold the check value
+	key, err := original.Vault.deriveKey(testPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := crypto.Seal(key, []byte("something else"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		check string
+	}{
+		{"flipped bit", base64.StdEncoding.EncodeToString(flipped)},
+		{"wrong value", other},
+		{"empty", ""},
+		{"not base64", "not base64!"},
+	}
+	for _, tt := range tests {
+		tampered := original
+		vault := *original.Vault
+		vault.Check = tt.check
+		tampered.Vault = &vault
+		writeJSON(t, cm.configFilePath, &tampered)
+
+		if err := reopen(t).Unlock(testPassphrase); !errors.Is(err, ErrWrongPassphrase) {
+			t.Errorf("%s: unlock = %v, want %v", tt.name, err, ErrWrongPassphrase)
+		}
+	}
+}
+
+func TestVaultSealsSecrets(t *testing.T) {
+	cm := newVaultTest(t)
+	if err := cm.CreateVault(testPassphrase); err != nil {
+		t.Fatal(err)
+	}
+	saveSecrets(t, cm)
+	assertSealedOnDisk(t, cm)
+
+	// Locked, the secrets can't be read
+	locked := reopen(t)
+	if password, token := savedSecrets(t, locked); password != "" || token != "" {
+		t.Errorf("locked vault read password %q and token %q", password, token)
+	}
+
+	unlocked := reopen(t)
+	if err := unlocked.Unlock(testPassphrase); err != nil {
+		t.Fatal(err)
+	}
+	if password, token := savedSecrets(t, unlocked); password != testPassword || token != testToken {
+		t.Errorf("unlocked vault read password %q and token %q", password, token)
+	}
+
+	// A tampered token is dropped rather than read back wrong
+	var servers ServersConfig
+	readJSON(t, cm.serversFilePath, &servers)
+	raw, _ := base64.StdEncoding.DecodeString(servers.Servers[0].SavedCredentials.EncryptedToken)
+	raw[len(raw)/2] ^= 1
+	servers.Servers[0].SavedCredentials.EncryptedToken = base64.StdEncoding.EncodeToString(raw)
+	writeJSON(t, cm.serversFilePath, &servers)
+	if _, token := savedSecrets(t, unlocked); token != "" {
+		t.Errorf("tampered token read as %q", token)
+	}
+}
+
+func TestVaultMigratesPlaintext(t *testing.T) {
+	tests := []struct {
+		name string
+		// Set up the vault before or after the plaintext files are written
+		vaultFirst bool
+	}{
+		{"sealed when the passphrase is chosen", false},
+		{"sealed on unlock", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := newVaultTest(t)
+			if tt.vaultFirst {
+				if err := cm.CreateVault(testPassphrase); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Files as older versions wrote them
+			var appConfig AppConfig
+			if tt.vaultFirst {
+				readJSON(t, cm.configFilePath, &appConfig)
+			}
+			appConfig.Identity = &LocalIdentity{Alias: "alice", Email: "alice@example.com", Password: testPassword}
+			writeJSON(t, cm.configFilePath, &appConfig)
+			server := NewClientServerInfo("Home", "chat.example.com", 8080, true)
+			server.SavedCredentials = &SavedCredentials{Email: "alice@example.com", Token: testToken, AutoConnect: true}
+			writeJSON(t, cm.serversFilePath, &ServersConfig{Version: 1, Servers: []*ClientServerInfo{server}})
+
+			if tt.vaultFirst {
+				if err := reopen(t).Unlock(testPassphrase); err != nil {
+					t.Fatal(err)
+				}
+			} else if err := reopen(t).CreateVault(testPassphrase); err != nil {
+				t.Fatal(err)
+			}
+			assertSealedOnDisk(t, cm)
+
+			next := reopen(t)
+			if err := next.Unlock(testPassphrase); err != nil {
+				t.Fatal(err)
+			}
+			if password, token := savedSecrets(t, next); password != testPassword || token != testToken {
+				t.Errorf("migrated password %q and token %q", password, token)
+			}
+		})
+	}
+}
+
+func TestVaultWithoutSavedPassword(t *testing.T) {
+	cm := newVaultTest(t)
+	if err := cm.CreateVault(testPassphrase); err != nil {
+		t.Fatal(err)
+	}
+	saveSecrets(t, cm)
+
+	next := reopen(t)
+	next.SetSavePassword(false)
+	if err := next.Unlock(testPassphrase); err != nil {
+		t.Fatal(err)
+	}
+	var appConfig AppConfig
+	readJSON(t, cm.configFilePath, &appConfig)
+	if appConfig.Identity == nil || appConfig.Identity.EncryptedPassword != "" {
+		t.Error("password still saved after turning saving off")
+	}
+	if _, token := savedSecrets(t, next); token != testToken {
+		t.Errorf("token = %q, want it kept", token)
+	}
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"fmt"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -317,17 +318,24 @@ func (a *App) handleLoginSubmit() tea.Cmd {
 			a.loginError = "Please enter your password"
 			return nil
 		}
-		if password != a.localIdentity.Password {
+		if a.localIdentity.Password == "" {
+			// Password isn't saved (--no-save-password); the servers check it
+			a.localIdentity.Password = password
+			a.passwordUnverified = true
+		} else if password != a.localIdentity.Password {
 			a.loginError = "Incorrect password"
 			return nil
 		}
 		a.loginError = ""
 		a.view = ViewMain
 		a.statusMessage = "Connecting to servers..."
-		// Auto-connect all configured servers in background
+		// Auto-connect the configured servers that aren't connected yet
 		servers := a.configMgr.GetClientServers()
 		cmds := make([]tea.Cmd, 0, len(servers))
 		for _, server := range servers {
+			if sc := a.connMgr.GetConnection(server.ID); sc != nil && sc.GetState() == StateReady {
+				continue
+			}
 			cmds = append(cmds, a.autoConnectServer(server.ID))
 		}
 		return tea.Batch(cmds...)
@@ -525,8 +533,49 @@ func (a *App) renderServerIcons(width, height int) string {
 		b.WriteString("\n")
 	}
 
+	// Direct messages of the active connection
+	dms := a.sidebarDMChannels()
+	if len(dms) > 0 {
+		b.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color(a.theme.Colors.Comment)).Render("  Direct Messages"))
+		b.WriteString("\n")
+
+		var serverID uuid.UUID
+		if a.currentClientServer != nil {
+			serverID = a.currentClientServer.ID
+		}
+		maxNameLen := innerWidth - 5
+		if maxNameLen < 4 {
+			maxNameLen = 4
+		}
+		for i, dm := range dms {
+			name := "@" + a.activeConn.DMName(dm)
+			if len([]rune(name)) > maxNameLen {
+				name = string([]rune(name)[:maxNameLen-1]) + "…"
+			}
+
+			unreadDot := ""
+			if a.unreadCounts[serverID][dm.ID] > 0 {
+				unreadDot = lipgloss.NewStyle().Foreground(lipgloss.Color(a.theme.Colors.Red)).Render(" ·")
+			}
+
+			isOpen := a.currentChannel != nil && a.currentChannel.ID == dm.ID
+			style := lipgloss.NewStyle().Foreground(lipgloss.Color(a.theme.Colors.Comment))
+			if isOpen || unreadDot != "" {
+				style = lipgloss.NewStyle().Foreground(lipgloss.Color(a.theme.Colors.Foreground))
+			}
+			prefix := "  "
+			if a.serverIndex == len(servers)+i {
+				prefix = "▶ "
+				style = style.Foreground(lipgloss.Color(a.theme.Colors.Purple)).Bold(true)
+			}
+			b.WriteString(prefix + style.Render(name) + unreadDot)
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+	}
+
 	// "Manage Servers" button (highlighted when selected)
-	isAddSelected := a.serverIndex >= len(servers)
+	isAddSelected := a.serverIndex >= len(servers)+len(dms)
 	var addButtonStr string
 	if isAddSelected {
 		addButtonStyle := lipgloss.NewStyle().
@@ -574,6 +623,9 @@ func (a *App) renderMainView() string {
 		chatWidth = availableWidth - serverIconsWidth - channelsWidth - membersWidth
 	}
 
+	// An open thread takes part of the chat column
+	chatWidth, threadWidth := a.splitThreadPane(chatWidth)
+
 	// Height for panels (reserve 1 line for status bar, 1 line for top border visibility)
 	panelHeight := a.height - 2
 
@@ -583,8 +635,13 @@ func (a *App) renderMainView() string {
 	chat := a.renderChatPanel(chatWidth, panelHeight)
 	members := a.renderUserList(membersWidth, panelHeight)
 
-	// Combine panels horizontally (4 columns)
-	mainContent := lipgloss.JoinHorizontal(lipgloss.Top, serverIcons, channels, chat, members)
+	// Combine panels horizontally (4 columns, 5 with a thread open)
+	columns := []string{serverIcons, channels, chat}
+	if a.thread != nil {
+		columns = append(columns, a.renderThreadPanel(threadWidth, panelHeight))
+	}
+	columns = append(columns, members)
+	mainContent := lipgloss.JoinHorizontal(lipgloss.Top, columns...)
 
 	// Add status bar
 	statusBar := a.renderStatusBar()
@@ -900,6 +957,10 @@ func (a *App) renderChatPanel(width, height int) string {
 	headerHeight := 2 // header line + spacer line below it
 	chatHeight := height - inputHeight - headerHeight
 	chatHeight -= 1 // Reserve space for typing indicator (always present, blank when inactive)
+	replying := a.replyingTo != nil && a.thread == nil
+	if replying {
+		chatHeight -= 1 // "Replying to" banner above the input
+	}
 
 	// Channel header
 	headerStyle := lipgloss.NewStyle().
@@ -912,6 +973,9 @@ func (a *App) renderChatPanel(width, height int) string {
 	channelHeader := "Select a channel"
 	if a.currentChannel != nil {
 		channelHeader = "# " + a.currentChannel.Name
+		if a.currentChannel.IsDM() && a.activeConn != nil {
+			channelHeader = "@ " + a.activeConn.DMName(a.currentChannel)
+		}
 		if a.currentChannel.Topic != "" {
 			channelHeader += " - " + a.currentChannel.Topic
 		}
@@ -945,7 +1009,7 @@ func (a *App) renderChatPanel(width, height int) string {
 			pinBuf.WriteString("\n")
 			for i := 0; i < displayCount; i++ {
 				pm := pinnedMsgs[i]
-				snippet := pm.Content
+				snippet := strings.Join(strings.Fields(plainMarkdown(pm.Content)), " ")
 				maxLen := interiorWidth - 10
 				if maxLen < 10 {
 					maxLen = 10
@@ -975,8 +1039,11 @@ func (a *App) renderChatPanel(width, height int) string {
 		chatStyle = chatStyle.BorderForeground(lipgloss.Color(a.theme.Colors.Purple))
 	}
 
-	// Keep textarea width in sync with panel interior
-	a.input.SetWidth(interiorWidth - 2)
+	// Keep textarea width in sync with panel interior (the thread pane
+	// does this while the input box is there)
+	if a.thread == nil {
+		a.input.SetWidth(interiorWidth - 2)
+	}
 
 	// Update viewport size to match interior
 	if a.chatViewport.Width != interiorWidth || a.chatViewport.Height != chatHeight-2 {
@@ -1005,26 +1072,19 @@ func (a *App) renderChatPanel(width, height int) string {
 	chat := chatStyle.Render(chatContent)
 
 	// Typing indicator — always reserve space (render blank when inactive to prevent layout shift).
-	// The braille spinner (typingFrames) advances every 400ms via typingTickMsg.
+	// The braille spinner (typingFrames) advances every 400ms via typingTickMsg,
+	// which also keeps the slowmode countdown on the right of this row ticking.
 	typing := ""
-	if len(a.typingUsers) > 0 {
-		frame := typingFrames[a.typingFrame%len(typingFrames)]
-		var who string
-		switch len(a.typingUsers) {
-		case 1:
-			who = a.typingUsers[0] + " is typing"
-		case 2:
-			who = a.typingUsers[0] + " and " + a.typingUsers[1] + " are typing"
-		default:
-			who = fmt.Sprintf("%d people are typing", len(a.typingUsers))
+	slowmode := a.renderSlowmodeIndicator()
+	if len(a.typingUsers) > 0 || slowmode != "" {
+		typingLine := ""
+		if len(a.typingUsers) > 0 {
+			typingLine = a.renderTypingLine(a.typingUsers)
+		}
+		if slowmode != "" {
+			gap := width - lipgloss.Width(typingLine) - lipgloss.Width(slowmode) - 2
+			typingLine += strings.Repeat(" ", max(gap, 1)) + slowmode
 		}
-		spinnerStyle := lipgloss.NewStyle().
-			Foreground(lipgloss.Color(a.theme.Colors.Cyan)).
-			Bold(true)
-		textStyle := lipgloss.NewStyle().
-			Foreground(lipgloss.Color(a.theme.Colors.Comment)).
-			Italic(true)
-		typingLine := "  " + spinnerStyle.Render(frame) + " " + textStyle.Render(who+"...")
 		typing = lipgloss.NewStyle().Width(width).Render(typingLine)
 	} else {
 		// Render blank line to maintain spacing (prevents border shift when typing starts/stops)
@@ -1042,7 +1102,19 @@ func (a *App) renderChatPanel(width, height int) string {
 		Border(lipgloss.RoundedBorder()).
 		BorderForeground(inputBorderColor)
 
-	input := inputStyle.Render(a.injectMentionGhost(a.input.View()))
+	var input string
+	if a.thread != nil {
+		// The input box is in the thread pane; say so in its place
+		hintStyle := inputStyle.
+			BorderForeground(lipgloss.Color(a.theme.Colors.Selection)).
+			Foreground(lipgloss.Color(a.theme.Colors.Comment)).
+			Italic(true).
+			Height(4).
+			PaddingLeft(1)
+		input = hintStyle.Render("Replying in 🧵 " + a.thread.Thread.Name + " (Esc in the thread or /thread close to return)")
+	} else {
+		input = inputStyle.Render(a.injectMentionGhost(a.input.View()))
+	}
 
 	// Spacer between header and chat viewport (aligns viewport border with panel borders)
 	spacer := lipgloss.NewStyle().Width(width).Height(1).Render("")
@@ -1054,10 +1126,52 @@ func (a *App) renderChatPanel(width, height int) string {
 	}
 	parts = append(parts, chat)
 	parts = append(parts, typing) // Always append (blank or with content)
+	if replying {
+		parts = append(parts, a.renderReplyBanner(width))
+	}
 	parts = append(parts, input)
 	return lipgloss.JoinVertical(lipgloss.Left, parts...)
 }
 
+// renderTypingLine renders "<spinner> alice is typing..." for the typing row
+func (a *App) renderTypingLine(users []string) string {
+	frame := typingFrames[a.typingFrame%len(typingFrames)]
+	var who string
+	switch len(users) {
+	case 1:
+		who = users[0] + " is typing"
+	case 2:
+		who = users[0] + " and " + users[1] + " are typing"
+	default:
+		who = fmt.Sprintf("%d people are typing", len(users))
+	}
+	spinnerStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(a.theme.Colors.Cyan)).
+		Bold(true)
+	textStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(a.theme.Colors.Comment)).
+		Italic(true)
+	return "  " + spinnerStyle.Render(frame) + " " + textStyle.Render(who+"...")
+}
+
+// renderSlowmodeIndicator shows the current channel's slowmode, counting down
+// after we post; empty when the channel has no slowmode
+func (a *App) renderSlowmodeIndicator() string {
+	if a.currentChannel == nil || a.currentChannel.RateLimitPerUser <= 0 {
+		return ""
+	}
+	if wait := a.slowmodeRemaining(); wait > 0 {
+		return lipgloss.NewStyle().
+			Foreground(lipgloss.Color(a.theme.Colors.Orange)).
+			Bold(true).
+			Render("⏱ " + formatCountdown(wait))
+	}
+	return lipgloss.NewStyle().
+		Foreground(lipgloss.Color(a.theme.Colors.Comment)).
+		Italic(true).
+		Render("slowmode " + formatCountdown(time.Duration(a.currentChannel.RateLimitPerUser)*time.Second))
+}
+
 // injectMentionGhost post-processes the textarea View() output to show the
 // top @mention suggestion as inline ghost text (dim italic) immediately after
 // the cursor, replacing an equal number of trailing spaces so line width stays
@@ -1249,9 +1363,7 @@ func (a *App) renderUserList(width, height int) string {
 	// Collect members
 	var members []*MemberDisplay
 	if a.activeConn != nil {
-		a.activeConn.mu.RLock()
-		members = a.activeConn.Members
-		a.activeConn.mu.RUnlock()
+		members = a.activeConn.GetMembers(a.getActiveServerID())
 	}
 
 	if len(members) == 0 {
@@ -1434,6 +1546,111 @@ func (a *App) renderStatusBar() string {
 	return bar
 }
 
+// renderSearchOverlay renders the /search results modal on top of the base view
+func (a *App) renderSearchOverlay(baseView string) string {
+	state := a.searchState
+	if state == nil {
+		return baseView
+	}
+
+	overlayWidth := 90
+	if overlayWidth > a.width-4 {
+		overlayWidth = a.width - 4
+	}
+
+	headerStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(a.theme.Colors.Cyan)).
+		Bold(true).
+		Align(lipgloss.Center).
+		Width(overlayWidth - 2)
+	title := fmt.Sprintf("Search: %s (%d", state.Query, len(state.Results))
+	if state.HasMore {
+		title += "+"
+	}
+	header := headerStyle.Render(title + " results)")
+
+	channelNames := make(map[uuid.UUID]string)
+	for _, ch := range a.getCurrentChannels() {
+		channelNames[ch.ID] = ch.Name
+	}
+
+	// Each result takes two lines; show a window that keeps the selection visible
+	visible := (a.height - 12) / 2
+	if visible < 1 {
+		visible = 1
+	}
+	start := 0
+	if state.SelectedIndex >= visible {
+		start = state.SelectedIndex - visible + 1
+	}
+	end := start + visible
+	if end > len(state.Results) {
+		end = len(state.Results)
+	}
+
+	metaStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(a.theme.Colors.Comment))
+	channelStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(a.theme.Colors.Cyan))
+	authorStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(a.theme.Colors.Purple)).Bold(true)
+	contentStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(a.theme.Colors.Foreground))
+
+	var resultLines []string
+	for i := start; i < end; i++ {
+		r := state.Results[i]
+		author := "unknown"
+		if r.Author != nil {
+			author = r.Author.Username
+		}
+		meta := fmt.Sprintf("%s  %s  %s",
+			channelStyle.Render("#"+channelNames[r.ChannelID]),
+			authorStyle.Render(author),
+			metaStyle.Render(r.CreatedAt.Format("2006-01-02 15:04")))
+
+		// Single-line preview of the message
+		preview := strings.Join(strings.Fields(plainMarkdown(r.Content)), " ")
+		if maxLen := overlayWidth - 8; utf8.RuneCountInString(preview) > maxLen {
+			preview = string([]rune(preview)[:maxLen-1]) + "…"
+		}
+		line := "  " + contentStyle.Render(preview)
+
+		if i == state.SelectedIndex {
+			selected := lipgloss.NewStyle().
+				Background(lipgloss.Color(a.theme.Colors.Selection)).
+				Width(overlayWidth - 4)
+			meta = selected.Render(meta)
+			line = selected.Render(line)
+		}
+		resultLines = append(resultLines, meta, line)
+	}
+
+	hintStyle := lipgloss.NewStyle().
+		Foreground(lipgloss.Color(a.theme.Colors.Comment)).
+		Italic(true).
+		Align(lipgloss.Center).
+		Width(overlayWidth - 2)
+	hints := hintStyle.Render("↑/↓: Select  •  Enter: Jump to message  •  Esc: Close")
+
+	var modalContent strings.Builder
+	modalContent.WriteString(header + "\n\n")
+	for _, line := range resultLines {
+		modalContent.WriteString(line + "\n")
+	}
+	modalContent.WriteString("\n" + hints)
+
+	modalHeight := len(resultLines) + 5 // header + results + footer + spacing
+
+	boxStyle := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color(a.theme.Colors.Purple)).
+		Width(overlayWidth).
+		Height(modalHeight).
+		Padding(1).
+		Background(lipgloss.Color(a.theme.Colors.Background))
+
+	return lipgloss.Place(a.width, a.height, lipgloss.Center, lipgloss.Center, boxStyle.Render(modalContent.String()),
+		lipgloss.WithWhitespaceChars(""),
+		lipgloss.WithWhitespaceForeground(lipgloss.Color(a.theme.Colors.Background)))
+}
+
 // renderLinkBrowserOverlay renders the link browser modal overlay on top of the base view
 func (a *App) renderLinkBrowserOverlay(baseView string) string {
 	if a.linkBrowserState == nil {
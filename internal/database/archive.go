@@ -0,0 +1,874 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/concord-chat/concord/internal/models"
+)
+
+// Archive files are JSON documents identified by format and version. Version
+// is bumped whenever the layout changes in a way older readers can't handle.
+const (
+	ArchiveFormat  = "concord-archive"
+	ArchiveVersion = 1
+)
+
+// systemUserID owns the default server and keeps its ID across hosts
+var systemUserID = uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+// Archive is a portable export of servers and their history. A single-user
+// export sets Subject and holds only that user's own data; it is meant for
+// compliance requests and can't be imported.
+type Archive struct {
+	Format        string            `json:"format"`
+	Version       int               `json:"version"`
+	SchemaVersion int               `json:"schema_version"` // Schema of the exporting database
+	ExportedAt    time.Time         `json:"exported_at"`
+	Subject       *uuid.UUID        `json:"subject,omitempty"`
+	Users         []*ArchiveUser    `json:"users"`
+	Servers       []*ArchiveServer  `json:"servers"`
+	DMChannels    []*ArchiveChannel `json:"dm_channels,omitempty"`
+	Sessions      []*ArchiveSession `json:"sessions,omitempty"` // Single-user export only
+}
+
+// ArchiveUser is a user account. PasswordHash lets members log in on the new
+// host and is left out of single-user exports.
+type ArchiveUser struct {
+	*models.User
+	PasswordHash string `json:"password_hash,omitempty"`
+}
+
+// ArchiveServer is a server with its roles, members, bans and channels
+type ArchiveServer struct {
+	*models.Server
+	Roles    []*models.Role         `json:"roles"`
+	Members  []*models.ServerMember `json:"members"`
+	Bans     []*ArchiveBan          `json:"bans,omitempty"`
+	Channels []*ArchiveChannel      `json:"channels"`
+}
+
+// ArchiveBan is a ban on a server
+type ArchiveBan struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Reason   string    `json:"reason,omitempty"`
+	BannedBy uuid.UUID `json:"banned_by"`
+	BannedAt time.Time `json:"banned_at"`
+}
+
+// ArchiveChannel is a channel or category with its messages, oldest first.
+// Reactions lists the subject's reactions to other users' messages in a
+// single-user export.
+type ArchiveChannel struct {
+	*models.Channel
+	Messages  []*ArchiveMessage  `json:"messages,omitempty"`
+	Reactions []*ArchiveReaction `json:"reactions,omitempty"`
+}
+
+// ArchiveMessage is a message with its individual reactions
+type ArchiveMessage struct {
+	*models.Message
+	Reactions []*ArchiveReaction `json:"reactions,omitempty"`
+}
+
+// ArchiveReaction is one user's reaction to a message. MessageID is only set
+// when the reaction is listed on its channel rather than its message.
+type ArchiveReaction struct {
+	MessageID *uuid.UUID `json:"message_id,omitempty"`
+	UserID    uuid.UUID  `json:"user_id"`
+	Emoji     string     `json:"emoji"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// ArchiveSession is a login session, without its token
+type ArchiveSession struct {
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	IPAddress  string     `json:"ip_address,omitempty"`
+	UserAgent  string     `json:"user_agent,omitempty"`
+}
+
+// ImportResult counts what Import created
+type ImportResult struct {
+	Users    int
+	Servers  int
+	Channels int
+	Messages int
+}
+
+// LookupServer resolves a server by ID or by case-insensitive name
+func (db *DB) LookupServer(ref string) (uuid.UUID, error) {
+	if id, err := uuid.Parse(ref); err == nil {
+		if _, err := db.GetServerByID(id); err != nil {
+			return uuid.Nil, fmt.Errorf("no server with ID %s", ref)
+		}
+		return id, nil
+	}
+
+	var ids []string
+	rows, err := db.Query(`SELECT id FROM servers WHERE LOWER(name) = LOWER(?)`, ref)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return uuid.Nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return uuid.Nil, err
+	}
+
+	switch len(ids) {
+	case 0:
+		return uuid.Nil, fmt.Errorf("no server named %q", ref)
+	case 1:
+		return uuid.Parse(ids[0])
+	default:
+		return uuid.Nil, fmt.Errorf("%d servers are named %q; use the server ID", len(ids), ref)
+	}
+}
+
+// --- Export ---
+
+// Export archives one server, or every server and DM conversation when
+// serverID is uuid.Nil
+func (db *DB) Export(serverID uuid.UUID) (*Archive, error) {
+	a, err := db.newArchive()
+	if err != nil {
+		return nil, err
+	}
+
+	var serverIDs []uuid.UUID
+	if serverID != uuid.Nil {
+		serverIDs = []uuid.UUID{serverID}
+	} else if serverIDs, err = db.queryIDs(`SELECT id FROM servers ORDER BY created_at`); err != nil {
+		return nil, err
+	}
+
+	for _, id := range serverIDs {
+		s, err := db.exportServer(id)
+		if err != nil {
+			return nil, fmt.Errorf("server %s: %w", id, err)
+		}
+		a.Servers = append(a.Servers, s)
+	}
+
+	if serverID != uuid.Nil {
+		// Only the accounts the server refers to
+		a.Users, err = db.archiveUsers(referencedUsers(a), true)
+		return a, err
+	}
+
+	dmIDs, err := db.queryIDs(`SELECT id FROM channels WHERE server_id IS NULL ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range dmIDs {
+		ch, err := db.GetChannelByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if ch.RecipientIDs, err = db.GetDMRecipients(id); err != nil {
+			return nil, err
+		}
+		c := &ArchiveChannel{Channel: ch}
+		if c.Messages, err = db.archiveMessages(id, uuid.Nil); err != nil {
+			return nil, err
+		}
+		a.DMChannels = append(a.DMChannels, c)
+	}
+
+	a.Users, err = db.archiveUsers(nil, true)
+	return a, err
+}
+
+// ExportUser archives the data held about one user: their account, sessions,
+// memberships and bans, and the messages and reactions they posted
+func (db *DB) ExportUser(userID uuid.UUID) (*Archive, error) {
+	a, err := db.newArchive()
+	if err != nil {
+		return nil, err
+	}
+	a.Subject = &userID
+
+	if a.Users, err = db.archiveUsers([]uuid.UUID{userID}, false); err != nil {
+		return nil, err
+	}
+	if len(a.Users) == 0 {
+		return nil, fmt.Errorf("no user with ID %s", userID)
+	}
+	if a.Sessions, err = db.archiveSessions(userID); err != nil {
+		return nil, err
+	}
+
+	id := userID.String()
+	serverIDs, err := db.queryIDs(`
+		SELECT server_id FROM server_members WHERE user_id = ?
+		UNION SELECT server_id FROM bans WHERE user_id = ?
+		UNION SELECT c.server_id FROM messages m JOIN channels c ON c.id = m.channel_id
+			WHERE m.author_id = ? AND c.server_id IS NOT NULL
+		UNION SELECT c.server_id FROM message_reactions r
+			JOIN messages m ON m.id = r.message_id JOIN channels c ON c.id = m.channel_id
+			WHERE r.user_id = ? AND c.server_id IS NOT NULL`,
+		id, id, id, id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, serverID := range serverIDs {
+		server, err := db.GetServerByID(serverID)
+		if err != nil {
+			return nil, err
+		}
+		s := &ArchiveServer{Server: server, Roles: []*models.Role{}, Members: []*models.ServerMember{}}
+		if member, err := db.GetServerMember(serverID, userID); err == nil {
+			s.Members = append(s.Members, member)
+			if s.Roles, err = db.GetMemberRoles(serverID, userID); err != nil {
+				return nil, err
+			}
+		}
+		bans, err := db.archiveBans(serverID)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range bans {
+			if b.UserID == userID {
+				s.Bans = append(s.Bans, b)
+			}
+		}
+
+		channels, err := db.GetServerChannels(serverID)
+		if err != nil {
+			return nil, err
+		}
+		for _, ch := range channels {
+			ch.PermissionOverwrites = nil
+			c, err := db.archiveUserChannel(ch, userID)
+			if err != nil {
+				return nil, err
+			}
+			if c != nil {
+				s.Channels = append(s.Channels, c)
+			}
+		}
+		a.Servers = append(a.Servers, s)
+	}
+
+	dms, err := db.GetUserDMChannels(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, ch := range dms {
+		c, err := db.archiveUserChannel(ch, userID)
+		if err != nil {
+			return nil, err
+		}
+		if c != nil {
+			a.DMChannels = append(a.DMChannels, c)
+		}
+	}
+	return a, nil
+}
+
+// newArchive starts an archive stamped with the current format and schema
+func (db *DB) newArchive() (*Archive, error) {
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	return &Archive{
+		Format:        ArchiveFormat,
+		Version:       ArchiveVersion,
+		SchemaVersion: version,
+		ExportedAt:    time.Now().UTC(),
+		Users:         []*ArchiveUser{},
+		Servers:       []*ArchiveServer{},
+	}, nil
+}
+
+// exportServer archives a server with all of its history
+func (db *DB) exportServer(serverID uuid.UUID) (*ArchiveServer, error) {
+	server, err := db.GetServerByID(serverID)
+	if err != nil {
+		return nil, err
+	}
+	s := &ArchiveServer{Server: server}
+	if s.Roles, err = db.GetServerRoles(serverID); err != nil {
+		return nil, err
+	}
+	if s.Members, err = db.GetServerMembers(serverID); err != nil {
+		return nil, err
+	}
+	if s.Bans, err = db.archiveBans(serverID); err != nil {
+		return nil, err
+	}
+
+	channels, err := db.GetServerChannels(serverID)
+	if err != nil {
+		return nil, err
+	}
+	for _, ch := range channels {
+		c := &ArchiveChannel{Channel: ch}
+		if c.Messages, err = db.archiveMessages(ch.ID, uuid.Nil); err != nil {
+			return nil, err
+		}
+		s.Channels = append(s.Channels, c)
+	}
+	return s, nil
+}
+
+// archiveUserChannel returns the user's messages and reactions in a channel,
+// or nil if there are none
+func (db *DB) archiveUserChannel(ch *models.Channel, userID uuid.UUID) (*ArchiveChannel, error) {
+	c := &ArchiveChannel{Channel: ch}
+	var err error
+	if c.Messages, err = db.archiveMessages(ch.ID, userID); err != nil {
+		return nil, err
+	}
+	for _, m := range c.Messages {
+		m.Reactions = nil // Other users' reactions aren't the subject's data
+	}
+
+	reactions, err := db.archiveReactions(ch.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range reactions {
+		if r.UserID == userID {
+			c.Reactions = append(c.Reactions, r)
+		}
+	}
+
+	if len(c.Messages) == 0 && len(c.Reactions) == 0 {
+		return nil, nil
+	}
+	return c, nil
+}
+
+// archiveMessages returns a channel's messages oldest first with mentions and
+// reactions, optionally only those by authorID
+func (db *DB) archiveMessages(channelID, authorID uuid.UUID) ([]*ArchiveMessage, error) {
+	query := `
+		SELECT id, channel_id, author_id, content, type, created_at, edited_at, is_pinned, reply_to_id
+		FROM messages WHERE channel_id = ?`
+	args := []interface{}{channelID.String()}
+	if authorID != uuid.Nil {
+		query += ` AND author_id = ?`
+		args = append(args, authorID.String())
+	}
+	messages, err := db.queryMessages(query+` ORDER BY created_at, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*ArchiveMessage, len(messages))
+	byID := make(map[uuid.UUID]*ArchiveMessage, len(messages))
+	for i, m := range messages {
+		result[i] = &ArchiveMessage{Message: m}
+		byID[m.ID] = result[i]
+	}
+
+	reactions, err := db.archiveReactions(channelID)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range reactions {
+		if m, ok := byID[*r.MessageID]; ok {
+			r.MessageID = nil
+			m.Reactions = append(m.Reactions, r)
+		}
+	}
+
+	rows, err := db.Query(`
+		SELECT mm.message_id, mm.user_id FROM message_mentions mm
+		JOIN messages m ON m.id = mm.message_id
+		WHERE m.channel_id = ?`, channelID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var messageIDStr, userIDStr string
+		if err := rows.Scan(&messageIDStr, &userIDStr); err != nil {
+			return nil, err
+		}
+		messageID, _ := uuid.Parse(messageIDStr)
+		userID, _ := uuid.Parse(userIDStr)
+		if m, ok := byID[messageID]; ok {
+			m.Mentions = append(m.Mentions, userID)
+		}
+	}
+	return result, rows.Err()
+}
+
+// archiveReactions returns every reaction in a channel, oldest first
+func (db *DB) archiveReactions(channelID uuid.UUID) ([]*ArchiveReaction, error) {
+	rows, err := db.Query(`
+		SELECT r.message_id, r.user_id, r.emoji, r.created_at FROM message_reactions r
+		JOIN messages m ON m.id = r.message_id
+		WHERE m.channel_id = ?
+		ORDER BY r.created_at`, channelID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reactions []*ArchiveReaction
+	for rows.Next() {
+		r := &ArchiveReaction{}
+		var messageIDStr, userIDStr string
+		if err := rows.Scan(&messageIDStr, &userIDStr, &r.Emoji, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		messageID, _ := uuid.Parse(messageIDStr)
+		r.MessageID = &messageID
+		r.UserID, _ = uuid.Parse(userIDStr)
+		reactions = append(reactions, r)
+	}
+	return reactions, rows.Err()
+}
+
+// archiveBans returns a server's bans
+func (db *DB) archiveBans(serverID uuid.UUID) ([]*ArchiveBan, error) {
+	rows, err := db.Query(`
+		SELECT user_id, reason, banned_by, banned_at FROM bans
+		WHERE server_id = ? ORDER BY banned_at`, serverID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bans []*ArchiveBan
+	for rows.Next() {
+		b := &ArchiveBan{}
+		var userIDStr, bannedByStr string
+		var reason sql.NullString
+		if err := rows.Scan(&userIDStr, &reason, &bannedByStr, &b.BannedAt); err != nil {
+			return nil, err
+		}
+		b.UserID, _ = uuid.Parse(userIDStr)
+		b.BannedBy, _ = uuid.Parse(bannedByStr)
+		b.Reason = reason.String
+		bans = append(bans, b)
+	}
+	return bans, rows.Err()
+}
+
+// archiveUsers returns the given users, or all users when ids is nil
+func (db *DB) archiveUsers(ids []uuid.UUID, withPassword bool) ([]*ArchiveUser, error) {
+	query := `
+		SELECT id, username, discriminator, display_name, email, password_hash, avatar_hash,
+			status_text, created_at, updated_at, last_seen_at, is_bot
+		FROM users`
+	var args []interface{}
+	if ids != nil {
+		if len(ids) == 0 {
+			return []*ArchiveUser{}, nil
+		}
+		placeholders := make([]string, len(ids))
+		for i, id := range ids {
+			placeholders[i] = "?"
+			args = append(args, id.String())
+		}
+		query += ` WHERE id IN (` + strings.Join(placeholders, ",") + `)`
+	}
+
+	rows, err := db.Query(query+` ORDER BY created_at`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*ArchiveUser{}
+	for rows.Next() {
+		u := &ArchiveUser{User: &models.User{Status: models.StatusOffline}}
+		var idStr string
+		var displayName, email, avatarHash, statusText sql.NullString
+		var lastSeenAt sql.NullTime
+		err := rows.Scan(&idStr, &u.Username, &u.Discriminator, &displayName, &email,
+			&u.PasswordHash, &avatarHash, &statusText, &u.CreatedAt, &u.UpdatedAt,
+			&lastSeenAt, &u.IsBot)
+		if err != nil {
+			return nil, err
+		}
+		u.ID, _ = uuid.Parse(idStr)
+		u.DisplayName = displayName.String
+		u.Email = email.String
+		u.AvatarHash = avatarHash.String
+		u.StatusText = statusText.String
+		if lastSeenAt.Valid {
+			u.LastSeenAt = lastSeenAt.Time
+		}
+		if !withPassword {
+			u.PasswordHash = ""
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// archiveSessions returns a user's login sessions
+func (db *DB) archiveSessions(userID uuid.UUID) ([]*ArchiveSession, error) {
+	rows, err := db.Query(`
+		SELECT created_at, expires_at, last_used_at, ip_address, user_agent
+		FROM sessions WHERE user_id = ? ORDER BY created_at`, userID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*ArchiveSession
+	for rows.Next() {
+		s := &ArchiveSession{}
+		var lastUsedAt sql.NullTime
+		var ipAddress, userAgent sql.NullString
+		if err := rows.Scan(&s.CreatedAt, &s.ExpiresAt, &lastUsedAt, &ipAddress, &userAgent); err != nil {
+			return nil, err
+		}
+		if lastUsedAt.Valid {
+			s.LastUsedAt = &lastUsedAt.Time
+		}
+		s.IPAddress = ipAddress.String
+		s.UserAgent = userAgent.String
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// queryIDs runs a query selecting a single ID column
+func (db *DB) queryIDs(query string, args ...interface{}) ([]uuid.UUID, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var idStr string
+		if err := rows.Scan(&idStr); err != nil {
+			return nil, err
+		}
+		id, _ := uuid.Parse(idStr)
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// referencedUsers lists every user an archive's servers refer to
+func referencedUsers(a *Archive) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool)
+	var ids []uuid.UUID
+	add := func(id uuid.UUID) {
+		if id != uuid.Nil && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, s := range a.Servers {
+		add(s.OwnerID)
+		for _, m := range s.Members {
+			add(m.UserID)
+		}
+		for _, b := range s.Bans {
+			add(b.UserID)
+			add(b.BannedBy)
+		}
+		for _, c := range s.Channels {
+			for _, m := range c.Messages {
+				add(m.AuthorID)
+				for _, r := range m.Reactions {
+					add(r.UserID)
+				}
+				for _, id := range m.Mentions {
+					add(id)
+				}
+			}
+		}
+	}
+	return ids
+}
+
+// --- Import ---
+
+// Import recreates an archive in an empty database. Every ID except the
+// system user's is replaced with a new one, so references are remapped as
+// rows are inserted. The import runs in one transaction.
+func (db *DB) Import(a *Archive) (*ImportResult, error) {
+	if a.Format != ArchiveFormat {
+		return nil, errors.New("not a Concord archive")
+	}
+	if a.Version < 1 || a.Version > ArchiveVersion {
+		return nil, fmt.Errorf("archive version %d is not supported (this binary reads up to %d)", a.Version, ArchiveVersion)
+	}
+	if a.Subject != nil {
+		return nil, errors.New("single-user exports can't be imported")
+	}
+
+	var servers int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM servers`).Scan(&servers); err != nil {
+		return nil, err
+	}
+	users, err := db.CountRealUsers()
+	if err != nil {
+		return nil, err
+	}
+	if servers > 0 || users > 0 {
+		return nil, errors.New("the database is not empty; import into a new database")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	im := &importer{tx: tx, ids: map[uuid.UUID]uuid.UUID{systemUserID: systemUserID}}
+	for _, u := range a.Users {
+		if u.ID == systemUserID {
+			// An otherwise empty database may already hold the system user
+			_, err = tx.Exec(`DELETE FROM users WHERE id = ?`, systemUserID.String())
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := im.user(u); err != nil {
+			return nil, fmt.Errorf("user %s: %w", u.Username, err)
+		}
+	}
+	for _, s := range a.Servers {
+		if err := im.server(s); err != nil {
+			return nil, fmt.Errorf("server %s: %w", s.Name, err)
+		}
+	}
+	for _, c := range a.DMChannels {
+		if err := im.channel(c, uuid.Nil); err != nil {
+			return nil, fmt.Errorf("DM channel %s: %w", c.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &ImportResult{
+		Users:    len(a.Users),
+		Servers:  len(a.Servers),
+		Channels: im.channels,
+		Messages: im.messages,
+	}, nil
+}
+
+// importer inserts archive rows under freshly generated IDs
+type importer struct {
+	tx       *Tx
+	ids      map[uuid.UUID]uuid.UUID // Archive ID -> new ID
+	channels int
+	messages int
+}
+
+// id returns the new ID for an archive ID, generating one on first use
+func (im *importer) id(old uuid.UUID) uuid.UUID {
+	if old == uuid.Nil {
+		return uuid.Nil
+	}
+	if id, ok := im.ids[old]; ok {
+		return id
+	}
+	id := uuid.New()
+	im.ids[old] = id
+	return id
+}
+
+// nullID maps an optional archive ID to a nullable column value
+func (im *importer) nullID(old uuid.UUID) sql.NullString {
+	if old == uuid.Nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: im.id(old).String(), Valid: true}
+}
+
+func (im *importer) user(u *ArchiveUser) error {
+	var lastSeenAt sql.NullTime
+	if !u.LastSeenAt.IsZero() {
+		lastSeenAt = sql.NullTime{Time: u.LastSeenAt, Valid: true}
+	}
+	_, err := im.tx.Exec(`
+		INSERT INTO users (id, username, discriminator, display_name, email, password_hash,
+			avatar_hash, status, status_text, created_at, updated_at, last_seen_at, is_bot)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		im.id(u.ID).String(), u.Username, u.Discriminator, u.DisplayName, u.Email,
+		u.PasswordHash, u.AvatarHash, models.StatusOffline, u.StatusText,
+		u.CreatedAt, u.UpdatedAt, lastSeenAt, u.IsBot)
+	return err
+}
+
+func (im *importer) server(s *ArchiveServer) error {
+	serverID := im.id(s.ID)
+	_, err := im.tx.Exec(`
+		INSERT INTO servers (id, name, description, icon_hash, owner_id, default_channel_id,
+			system_channel_id, rules_channel_id, max_members, created_at, updated_at,
+			verification_level, explicit_content_filter, invites_enabled,
+			default_invite_max_age, default_invite_max_uses)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		serverID.String(), s.Name, s.Description, s.IconHash, im.id(s.OwnerID).String(),
+		im.nullID(s.DefaultChannelID), im.nullID(s.SystemChannelID), im.nullID(s.RulesChannelID),
+		s.MaxMembers, s.CreatedAt, s.UpdatedAt, s.VerificationLevel, s.ExplicitContentFilter,
+		s.InvitesEnabled, s.DefaultInviteMaxAge, s.DefaultInviteMaxUses)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range s.Roles {
+		_, err := im.tx.Exec(`
+			INSERT INTO roles (id, server_id, name, color, permissions, position,
+				is_hoisted, is_mentionable, is_default, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			im.id(r.ID).String(), serverID.String(), r.Name, r.Color, int64(r.Permissions),
+			r.Position, r.IsHoisted, r.IsMentionable, r.IsDefault, r.CreatedAt, r.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("role %s: %w", r.Name, err)
+		}
+	}
+
+	for _, m := range s.Members {
+		_, err := im.tx.Exec(`
+			INSERT INTO server_members (user_id, server_id, nickname, joined_at, is_muted, is_deafened)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			im.id(m.UserID).String(), serverID.String(), m.Nickname, m.JoinedAt, m.IsMuted, m.IsDeafened)
+		if err != nil {
+			return fmt.Errorf("member %s: %w", m.UserID, err)
+		}
+		for _, roleID := range m.RoleIDs {
+			_, err := im.tx.Exec(`INSERT INTO member_roles (user_id, server_id, role_id) VALUES (?, ?, ?)`,
+				im.id(m.UserID).String(), serverID.String(), im.id(roleID).String())
+			if err != nil {
+				return fmt.Errorf("member %s: %w", m.UserID, err)
+			}
+		}
+	}
+
+	for _, b := range s.Bans {
+		_, err := im.tx.Exec(`
+			INSERT INTO bans (server_id, user_id, reason, banned_by, banned_at)
+			VALUES (?, ?, ?, ?, ?)`,
+			serverID.String(), im.id(b.UserID).String(), b.Reason, im.id(b.BannedBy).String(), b.BannedAt)
+		if err != nil {
+			return fmt.Errorf("ban of %s: %w", b.UserID, err)
+		}
+	}
+
+	// Categories first, since channels reference them
+	channels := append([]*ArchiveChannel(nil), s.Channels...)
+	sort.SliceStable(channels, func(i, j int) bool {
+		return channels[i].Type == models.ChannelTypeCategory && channels[j].Type != models.ChannelTypeCategory
+	})
+	for _, c := range channels {
+		if err := im.channel(c, serverID); err != nil {
+			return fmt.Errorf("channel %s: %w", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// channel inserts a server channel, or a DM channel when serverID is uuid.Nil
+func (im *importer) channel(c *ArchiveChannel, serverID uuid.UUID) error {
+	channelID := im.id(c.ID)
+	var server sql.NullString
+	if serverID != uuid.Nil {
+		server = sql.NullString{String: serverID.String(), Valid: true}
+	}
+	thread := c.Thread
+	if thread == nil {
+		thread = &models.ThreadMetadata{}
+	}
+	lastMessageAt := sql.NullTime{Time: thread.LastMessageAt, Valid: !thread.LastMessageAt.IsZero()}
+	_, err := im.tx.Exec(`
+		INSERT INTO channels (id, server_id, name, topic, type, position, category_id,
+			is_nsfw, rate_limit_per_user, created_at, updated_at,
+			parent_id, parent_message_id, owner_id, archived, auto_archive_minutes,
+			message_count, last_message_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		channelID.String(), server, c.Name, c.Topic, c.Type, c.Position, im.nullID(c.CategoryID),
+		c.IsNSFW, c.RateLimitPerUser, c.CreatedAt, c.UpdatedAt,
+		im.nullID(c.ParentID), im.nullID(c.ParentMessageID), im.nullID(thread.OwnerID), thread.Archived,
+		thread.AutoArchiveMinutes, thread.MessageCount, lastMessageAt)
+	if err != nil {
+		return err
+	}
+	im.channels++
+
+	for _, ow := range c.PermissionOverwrites {
+		_, err := im.tx.Exec(`
+			INSERT INTO permission_overwrites (channel_id, target_id, target_type, allow, deny)
+			VALUES (?, ?, ?, ?, ?)`,
+			channelID.String(), im.id(ow.ID).String(), ow.Type, ow.Allow, ow.Deny)
+		if err != nil {
+			return err
+		}
+	}
+	for _, userID := range c.RecipientIDs {
+		_, err := im.tx.Exec(`INSERT INTO dm_recipients (channel_id, user_id) VALUES (?, ?)`,
+			channelID.String(), im.id(userID).String())
+		if err != nil {
+			return err
+		}
+	}
+
+	// Oldest first, so replies can point at messages already inserted
+	messages := append([]*ArchiveMessage(nil), c.Messages...)
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].CreatedAt.Before(messages[j].CreatedAt)
+	})
+	inserted := make(map[uuid.UUID]bool, len(messages))
+	for _, m := range messages {
+		var replyToID sql.NullString
+		if m.ReplyToID != nil && inserted[*m.ReplyToID] {
+			replyToID = im.nullID(*m.ReplyToID)
+		}
+		var editedAt sql.NullTime
+		if m.EditedAt != nil {
+			editedAt = sql.NullTime{Time: *m.EditedAt, Valid: true}
+		}
+		messageID := im.id(m.ID)
+		_, err := im.tx.Exec(`
+			INSERT INTO messages (id, channel_id, author_id, content, type, created_at,
+				edited_at, is_pinned, reply_to_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			messageID.String(), channelID.String(), im.id(m.AuthorID).String(), m.Content,
+			m.Type, m.CreatedAt, editedAt, m.IsPinned, replyToID)
+		if err != nil {
+			return fmt.Errorf("message %s: %w", m.ID, err)
+		}
+		inserted[m.ID] = true
+		im.messages++
+
+		for _, userID := range m.Mentions {
+			_, err := im.tx.Exec(`INSERT INTO message_mentions (message_id, user_id) VALUES (?, ?) ON CONFLICT DO NOTHING`,
+				messageID.String(), im.id(userID).String())
+			if err != nil {
+				return fmt.Errorf("message %s: %w", m.ID, err)
+			}
+		}
+		for _, r := range m.Reactions {
+			_, err := im.tx.Exec(`
+				INSERT INTO message_reactions (message_id, user_id, emoji, created_at)
+				VALUES (?, ?, ?, ?)
+				ON CONFLICT DO NOTHING`,
+				messageID.String(), im.id(r.UserID).String(), r.Emoji, r.CreatedAt)
+			if err != nil {
+				return fmt.Errorf("message %s: %w", m.ID, err)
+			}
+		}
+	}
+	return nil
+}
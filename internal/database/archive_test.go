@@ -0,0 +1,218 @@
+package database
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/concord-chat/concord/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	src := openSQLiteTest(t)
+	_, _, alice := seed(t, src)
+	bob := createUser(t, src, "bob")
+	carol := createUser(t, src, "carol")
+
+	// A server with a custom role, a ban, a category and a thread
+	server := models.NewServer("Guild", alice.ID)
+	everyone, general, err := src.CreateServerWithDefaults(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mods := models.NewRole(server.ID, "Mods")
+	mods.Position = 1
+	if err := src.CreateRole(mods); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.AddServerMember(models.NewServerMember(bob.ID, server.ID)); err != nil {
+		t.Fatal(err)
+	}
+	for _, roleID := range []uuid.UUID{everyone.ID, mods.ID} {
+		if err := src.AddMemberRole(bob.ID, server.ID, roleID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := src.AddBan(server.ID, carol.ID, alice.ID, "spam"); err != nil {
+		t.Fatal(err)
+	}
+	category := models.NewCategory(server.ID, "Text")
+	if err := src.CreateChannel(category); err != nil {
+		t.Fatal(err)
+	}
+	filed := models.NewTextChannel(server.ID, "filed")
+	filed.CategoryID = category.ID
+	if err := src.CreateChannel(filed); err != nil {
+		t.Fatal(err)
+	}
+
+	first := createMessage(t, src, general.ID, alice.ID, "first")
+	reply := models.NewReply(general.ID, bob.ID, first.ID, "hi <@"+alice.ID.String()+">")
+	if err := src.CreateMessage(reply); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.AddReaction(first.ID, bob.ID, "👍"); err != nil {
+		t.Fatal(err)
+	}
+	thread := models.NewThread(general, first.ID, bob.ID, "side", models.DefaultThreadAutoArchive)
+	if err := src.CreateChannel(thread); err != nil {
+		t.Fatal(err)
+	}
+	createMessage(t, src, thread.ID, bob.ID, "in the thread")
+
+	// Archives travel as JSON
+	exported, err := src.Export(uuid.Nil)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	data, err := json.Marshal(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archive Archive
+	if err := json.Unmarshal(data, &archive); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := openSQLiteTest(t)
+	result, err := dst.Import(&archive)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if result.Servers != 2 || result.Messages != 3 {
+		t.Errorf("imported %d servers and %d messages, want 2 and 3", result.Servers, result.Messages)
+	}
+	if _, err := dst.Import(&archive); err == nil {
+		t.Error("import into a non-empty database succeeded")
+	}
+
+	// Export the copy to compare it with the original
+	got, err := dst.Export(uuid.Nil)
+	if err != nil {
+		t.Fatalf("export imported database: %v", err)
+	}
+	users := make(map[string]*ArchiveUser)
+	for _, u := range got.Users {
+		users[u.Username] = u
+	}
+	for _, orig := range []*models.User{alice, bob, carol} {
+		u := users[orig.Username]
+		if u == nil {
+			t.Fatalf("user %s missing after import", orig.Username)
+		}
+		if u.ID == orig.ID {
+			t.Errorf("user %s kept its ID", orig.Username)
+		}
+		if u.PasswordHash != "hash-"+orig.Username {
+			t.Errorf("user %s password hash = %q", orig.Username, u.PasswordHash)
+		}
+	}
+	newAlice, newBob, newCarol := users["alice"].ID, users["bob"].ID, users["carol"].ID
+
+	var guild, host *ArchiveServer
+	for _, s := range got.Servers {
+		switch s.Name {
+		case "Guild":
+			guild = s
+		default:
+			host = s
+		}
+	}
+	if guild == nil || host == nil {
+		t.Fatalf("imported servers = %d, want the default server and Guild", len(got.Servers))
+	}
+	if host.OwnerID != systemUserID {
+		t.Errorf("default server owner = %s, want the system user", host.OwnerID)
+	}
+	if guild.ID == server.ID || guild.OwnerID != newAlice {
+		t.Errorf("Guild ID %s owner %s; want a new ID owned by alice", guild.ID, guild.OwnerID)
+	}
+
+	var newMods uuid.UUID
+	for _, r := range guild.Roles {
+		if r.Name == "Mods" {
+			newMods = r.ID
+		}
+	}
+	var bobRoles []uuid.UUID
+	for _, m := range guild.Members {
+		if m.UserID == newBob {
+			bobRoles = m.RoleIDs
+		}
+	}
+	if newMods == uuid.Nil || !containsID(bobRoles, newMods) {
+		t.Errorf("bob's roles %v don't include the imported Mods role %s", bobRoles, newMods)
+	}
+	if len(guild.Bans) != 1 || guild.Bans[0].UserID != newCarol || guild.Bans[0].BannedBy != newAlice {
+		t.Errorf("bans were not remapped: %+v", guild.Bans)
+	}
+
+	channels := make(map[string]*ArchiveChannel)
+	for _, c := range guild.Channels {
+		channels[c.Name] = c
+	}
+	newGeneral, newThread := channels["general"], channels["side"]
+	if newGeneral == nil || newThread == nil || channels["Text"] == nil || channels["filed"] == nil {
+		t.Fatalf("imported channels = %v", channels)
+	}
+	if guild.DefaultChannelID != newGeneral.ID {
+		t.Errorf("default channel = %s, want %s", guild.DefaultChannelID, newGeneral.ID)
+	}
+	if channels["filed"].CategoryID != channels["Text"].ID {
+		t.Error("channel category was not remapped")
+	}
+
+	if len(newGeneral.Messages) != 2 {
+		t.Fatalf("general has %d messages, want 2", len(newGeneral.Messages))
+	}
+	newFirst, newReply := newGeneral.Messages[0], newGeneral.Messages[1]
+	if newFirst.ID == first.ID || newFirst.AuthorID != newAlice {
+		t.Errorf("first message ID %s author %s; want a new ID by alice", newFirst.ID, newFirst.AuthorID)
+	}
+	if newReply.ReplyToID == nil || *newReply.ReplyToID != newFirst.ID {
+		t.Errorf("reply points at %v, want %s", newReply.ReplyToID, newFirst.ID)
+	}
+	if !containsID(newReply.Mentions, newAlice) {
+		t.Errorf("reply mentions %v, want alice %s", newReply.Mentions, newAlice)
+	}
+	if len(newFirst.Reactions) != 1 || newFirst.Reactions[0].UserID != newBob {
+		t.Errorf("reactions were not remapped: %+v", newFirst.Reactions)
+	}
+
+	if newThread.ParentID != newGeneral.ID || newThread.ParentMessageID != newFirst.ID {
+		t.Errorf("thread hangs off %s/%s, want %s/%s",
+			newThread.ParentID, newThread.ParentMessageID, newGeneral.ID, newFirst.ID)
+	}
+	if newThread.Thread == nil || newThread.Thread.OwnerID != newBob {
+		t.Errorf("thread owner was not remapped: %+v", newThread.Thread)
+	}
+	if len(newThread.Messages) != 1 {
+		t.Errorf("thread has %d messages, want 1", len(newThread.Messages))
+	}
+}
+
+func TestArchiveImportRejects(t *testing.T) {
+	db := openSQLiteTest(t)
+	subject := uuid.New()
+	for _, tc := range []struct {
+		name    string
+		archive Archive
+	}{
+		{"foreign format", Archive{Format: "other", Version: ArchiveVersion}},
+		{"newer version", Archive{Format: ArchiveFormat, Version: ArchiveVersion + 1}},
+		{"single-user export", Archive{Format: ArchiveFormat, Version: ArchiveVersion, Subject: &subject}},
+	} {
+		if _, err := db.Import(&tc.archive); err == nil {
+			t.Errorf("%s: import succeeded", tc.name)
+		}
+	}
+}
+
+func containsID(ids []uuid.UUID, id uuid.UUID) bool {
+	for _, x := range ids {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
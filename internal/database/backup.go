@@ -0,0 +1,154 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Backup writes a consistent snapshot of the database to path. It uses
+// VACUUM INTO, which is safe while the server is running in WAL mode. The
+// snapshot is written beside path and renamed into place once complete.
+func (db *DB) Backup(path string) error {
+	if db.dialect == dialectPostgres {
+		return errors.New("online backup is only supported for SQLite; use pg_dump for PostgreSQL")
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	if _, err := db.Exec(`VACUUM INTO ?`, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := rebuildSearchIndex(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// rebuildSearchIndex re-derives messages_fts in the SQLite database at path.
+// The index is keyed by the rowids of messages, which VACUUM may renumber.
+func rebuildSearchIndex(path string) error {
+	db, err := Open(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.Exec(`INSERT INTO messages_fts (messages_fts) VALUES ('rebuild')`)
+	return err
+}
+
+// CheckBackup verifies that path is an intact SQLite database with a schema
+// this binary can run, and returns its schema version
+func CheckBackup(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	db, err := Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow(`PRAGMA integrity_check`).Scan(&result); err != nil {
+		return 0, fmt.Errorf("not a readable SQLite database: %w", err)
+	}
+	if result != "ok" {
+		return 0, fmt.Errorf("integrity check failed: %s", result)
+	}
+
+	// Read the version without creating schema_migrations in the backup
+	var tables int
+	err = db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`).Scan(&tables)
+	if err != nil {
+		return 0, err
+	}
+	if tables == 0 {
+		return 0, errors.New("no schema version recorded; not a Concord backup")
+	}
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return 0, err
+	}
+	if version == 0 {
+		return 0, errors.New("no schema version recorded; not a Concord backup")
+	}
+	if version > LatestVersion() {
+		return version, fmt.Errorf("backup schema version %d is newer than this binary supports (%d)", version, LatestVersion())
+	}
+	return version, nil
+}
+
+// Restore replaces the SQLite database at dest with the backup at src after
+// checking it with CheckBackup. The server must be stopped. The replaced
+// database, with its WAL files, is kept beside dest; its path is returned.
+func Restore(src, dest string) (string, error) {
+	if isPostgresURL(dest) {
+		return "", errors.New("restore is only supported for SQLite; use pg_restore for PostgreSQL")
+	}
+	if _, err := CheckBackup(src); err != nil {
+		return "", fmt.Errorf("%s: %w", src, err)
+	}
+
+	// Copy next to dest first so the swap itself is a rename
+	tmp := dest + ".restore"
+	if err := copyFile(src, tmp); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+
+	var kept string
+	if _, err := os.Stat(dest); err == nil {
+		kept = fmt.Sprintf("%s.pre-restore-%s", dest, time.Now().Format("20060102-150405"))
+		if err := os.Rename(dest, kept); err != nil {
+			os.Remove(tmp)
+			return "", err
+		}
+	}
+	// WAL and shared-memory files belong to the old database
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if _, err := os.Stat(dest + suffix); err != nil {
+			continue
+		}
+		if kept != "" {
+			os.Rename(dest+suffix, kept+suffix)
+		} else {
+			os.Remove(dest + suffix)
+		}
+	}
+
+	if err := os.Rename(tmp, dest); err != nil {
+		return kept, err
+	}
+	return kept, nil
+}
+
+// copyFile copies src to dst and syncs it to disk
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	live := filepath.Join(dir, "concord.db")
+	db, err := New(live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, channel, alice := seed(t, db)
+
+	// Leave a gap in the rowids, which VACUUM INTO may close up
+	doomed := createMessage(t, db, channel.ID, alice.ID, "doomed")
+	kept := createMessage(t, db, channel.ID, alice.ID, "survivor")
+	if err := db.DeleteMessage(doomed.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	backup := filepath.Join(dir, "backup.db")
+	if err := db.Backup(backup); err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	if err := db.Backup(backup); err == nil {
+		t.Error("backup overwrote an existing file")
+	}
+	if _, err := os.Stat(backup + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+
+	version, err := CheckBackup(backup)
+	if err != nil {
+		t.Fatalf("check backup: %v", err)
+	}
+	if version != LatestVersion() {
+		t.Errorf("backup schema version = %d, want %d", version, LatestVersion())
+	}
+
+	// Search in the copy still finds the right messages
+	snapshot, err := Open(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := snapshot.SearchMessages(MessageSearch{
+		ChannelIDs: []uuid.UUID{channel.ID},
+		Terms:      []string{"survivor"},
+		Limit:      10,
+	})
+	snapshot.Close()
+	if err != nil {
+		t.Fatalf("search backup: %v", err)
+	}
+	if len(found) != 1 || found[0].ID != kept.ID {
+		t.Errorf("search in backup = %v, want %s", messageIDs(found), kept.ID)
+	}
+
+	// Changes after the backup are undone by restoring it
+	createMessage(t, db, channel.ID, alice.ID, "after the backup")
+	db.Close()
+
+	old, err := Restore(backup, live)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if _, err := os.Stat(old); err != nil {
+		t.Errorf("replaced database not kept: %v", err)
+	}
+	restored, err := New(live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	messages, err := restored.GetChannelMessages(channel.ID, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := messageIDs(messages); len(ids) != 1 || ids[0] != kept.ID {
+		t.Errorf("restored messages = %v, want only %s", ids, kept.ID)
+	}
+}
+
+func TestBackupRejectsNewerSchema(t *testing.T) {
+	dir := t.TempDir()
+	db := openSQLiteTest(t)
+	backup := filepath.Join(dir, "backup.db")
+	if err := db.Backup(backup); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pretend a newer binary migrated the backup
+	newer, err := Open(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = newer.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+		LatestVersion()+1, "from the future", time.Now())
+	newer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := CheckBackup(backup); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("CheckBackup = %v, want a newer schema error", err)
+	}
+
+	live := filepath.Join(dir, "concord.db")
+	if err := os.WriteFile(live, []byte("current"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Restore(backup, live); err == nil {
+		t.Fatal("restore of a newer schema succeeded")
+	}
+	if data, err := os.ReadFile(live); err != nil || string(data) != "current" {
+		t.Errorf("rejected restore touched the live database: %q, %v", data, err)
+	}
+	if _, err := os.Stat(live + ".restore"); !os.IsNotExist(err) {
+		t.Errorf("rejected restore left a copy behind: %v", err)
+	}
+}
+
+func TestCheckBackupRejectsNonBackups(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := CheckBackup(filepath.Join(dir, "missing.db")); err == nil {
+		t.Error("missing file passed")
+	}
+
+	garbage := filepath.Join(dir, "garbage.db")
+	if err := os.WriteFile(garbage, []byte("not a database"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckBackup(garbage); err == nil {
+		t.Error("non-database file passed")
+	}
+
+	// An SQLite file that was never migrated
+	empty := filepath.Join(dir, "empty.db")
+	db, err := Open(empty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE TABLE notes (body TEXT)`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckBackup(empty); err == nil {
+		t.Error("unmigrated database passed")
+	}
+}
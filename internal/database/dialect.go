@@ -0,0 +1,112 @@
+package database
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// dialect identifies the SQL flavour of the underlying database. Queries are
+// written once with ? placeholders and portable syntax; the few statements
+// that differ (schema, full-text search) switch on the dialect.
+type dialect int
+
+const (
+	dialectSQLite dialect = iota
+	dialectPostgres
+)
+
+// schemaTypes fills in the placeholders of the migration scripts
+var schemaTypes = map[dialect]*strings.Replacer{
+	dialectSQLite: strings.NewReplacer(
+		"{{timestamp}}", "DATETIME",
+		"{{bool}}", "INTEGER",
+		"{{true}}", "1",
+		"{{false}}", "0",
+		"{{bigint}}", "INTEGER",
+		"{{set_null}}", "",
+	),
+	dialectPostgres: strings.NewReplacer(
+		"{{timestamp}}", "TIMESTAMPTZ",
+		"{{bool}}", "BOOLEAN",
+		"{{true}}", "TRUE",
+		"{{false}}", "FALSE",
+		"{{bigint}}", "BIGINT",
+		"{{set_null}}", " ON DELETE SET NULL",
+	),
+}
+
+// schema writes a migration script for the dialect
+func (d dialect) schema(script string) string {
+	return schemaTypes[d].Replace(script)
+}
+
+// rebind rewrites ? placeholders to $1, $2, ... for PostgreSQL
+func (d dialect) rebind(query string) string {
+	if d != dialectPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	inQuote := false
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == '\'':
+			inQuote = !inQuote
+		case ch == '?' && !inQuote:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String()
+}
+
+// Exec runs a statement, rebinding placeholders for the dialect
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.Exec(db.dialect.rebind(query), args...)
+}
+
+// Query runs a query, rebinding placeholders for the dialect
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.Query(db.dialect.rebind(query), args...)
+}
+
+// QueryRow runs a single-row query, rebinding placeholders for the dialect
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRow(db.dialect.rebind(query), args...)
+}
+
+// Begin starts a transaction whose statements are rebound like the DB's
+func (db *DB) Begin() (*Tx, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, dialect: db.dialect}, nil
+}
+
+// Tx wraps *sql.Tx so transactional statements use the same placeholders
+type Tx struct {
+	*sql.Tx
+	dialect dialect
+}
+
+// Exec runs a statement in the transaction
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.Exec(tx.dialect.rebind(query), args...)
+}
+
+// Query runs a query in the transaction
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.dialect.rebind(query), args...)
+}
+
+// QueryRow runs a single-row query in the transaction
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRow(tx.dialect.rebind(query), args...)
+}
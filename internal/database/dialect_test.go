@@ -0,0 +1,26 @@
+package database
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`SELECT 1`, `SELECT 1`},
+		{`SELECT * FROM users WHERE id = ?`, `SELECT * FROM users WHERE id = $1`},
+		{`INSERT INTO t (a, b, c) VALUES (?, ?, ?)`, `INSERT INTO t (a, b, c) VALUES ($1, $2, $3)`},
+		{`SELECT '?' FROM t WHERE a = ? AND b LIKE '%?%'`, `SELECT '?' FROM t WHERE a = $1 AND b LIKE '%?%'`},
+		{`SELECT 'it''s' WHERE a = ?`, `SELECT 'it''s' WHERE a = $1`},
+		{`WHERE (created_at, id) < (SELECT created_at, id FROM m WHERE id = ?) LIMIT ?`,
+			`WHERE (created_at, id) < (SELECT created_at, id FROM m WHERE id = $1) LIMIT $2`},
+	}
+	for _, tt := range tests {
+		if got := dialectPostgres.rebind(tt.query); got != tt.want {
+			t.Errorf("rebind(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+		if got := dialectSQLite.rebind(tt.query); got != tt.query {
+			t.Errorf("sqlite rebind changed %q to %q", tt.query, got)
+		}
+	}
+}
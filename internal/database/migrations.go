@@ -0,0 +1,589 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Migration is one numbered, reversible schema change. Migrations are
+// applied in Version order, each in its own transaction.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+
+	// PostgresUp and PostgresDown replace Up and Down on PostgreSQL, for the
+	// steps that can't be written once for both dialects
+	PostgresUp   string
+	PostgresDown string
+}
+
+// migrations is the ordered schema history for both dialects. Append new
+// migrations to the end and never edit one that has shipped. The early steps
+// use IF NOT EXISTS so databases created before versioning adopt them without
+// changes.
+//
+// Column types that differ between dialects are written as placeholders that
+// dialect.schema fills in: {{timestamp}}, {{bool}} with {{true}} and
+// {{false}}, and {{bigint}} for permission bits. {{set_null}} adds
+// ON DELETE SET NULL to a foreign key on PostgreSQL only, since SQLite
+// databases created before PostgreSQL support never had it.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial_schema",
+		Up: `
+		-- Users table
+		CREATE TABLE IF NOT EXISTS users (
+			id TEXT PRIMARY KEY,
+			username TEXT NOT NULL,
+			discriminator TEXT NOT NULL,
+			display_name TEXT,
+			email TEXT UNIQUE,
+			password_hash TEXT NOT NULL,
+			avatar_hash TEXT,
+			status TEXT DEFAULT 'offline',
+			status_text TEXT,
+			created_at {{timestamp}} NOT NULL,
+			updated_at {{timestamp}} NOT NULL,
+			last_seen_at {{timestamp}},
+			is_bot {{bool}} DEFAULT {{false}},
+			UNIQUE(username, discriminator)
+		);
+
+		-- Servers table
+		CREATE TABLE IF NOT EXISTS servers (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			description TEXT,
+			icon_hash TEXT,
+			owner_id TEXT NOT NULL REFERENCES users(id),
+			default_channel_id TEXT,
+			system_channel_id TEXT,
+			rules_channel_id TEXT,
+			max_members INTEGER DEFAULT 1000,
+			created_at {{timestamp}} NOT NULL,
+			updated_at {{timestamp}} NOT NULL,
+			verification_level INTEGER DEFAULT 0,
+			explicit_content_filter INTEGER DEFAULT 0,
+			invites_enabled {{bool}} DEFAULT {{true}},
+			default_invite_max_age INTEGER DEFAULT 86400,
+			default_invite_max_uses INTEGER DEFAULT 0
+		);
+
+		-- Channels table
+		CREATE TABLE IF NOT EXISTS channels (
+			id TEXT PRIMARY KEY,
+			server_id TEXT REFERENCES servers(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			topic TEXT,
+			type INTEGER NOT NULL,
+			position INTEGER DEFAULT 0,
+			category_id TEXT REFERENCES channels(id){{set_null}},
+			is_nsfw {{bool}} DEFAULT {{false}},
+			rate_limit_per_user INTEGER DEFAULT 0,
+			created_at {{timestamp}} NOT NULL,
+			updated_at {{timestamp}} NOT NULL
+		);
+
+		-- Messages table
+		CREATE TABLE IF NOT EXISTS messages (
+			id TEXT PRIMARY KEY,
+			channel_id TEXT NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+			author_id TEXT NOT NULL REFERENCES users(id),
+			content TEXT NOT NULL,
+			type INTEGER DEFAULT 0,
+			created_at {{timestamp}} NOT NULL,
+			edited_at {{timestamp}},
+			is_pinned {{bool}} DEFAULT {{false}},
+			reply_to_id TEXT REFERENCES messages(id)
+		);
+
+		-- Roles table
+		CREATE TABLE IF NOT EXISTS roles (
+			id TEXT PRIMARY KEY,
+			server_id TEXT NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			color INTEGER DEFAULT 0,
+			permissions {{bigint}} NOT NULL,
+			position INTEGER DEFAULT 0,
+			is_hoisted {{bool}} DEFAULT {{false}},
+			is_mentionable {{bool}} DEFAULT {{true}},
+			is_default {{bool}} DEFAULT {{false}},
+			created_at {{timestamp}} NOT NULL,
+			updated_at {{timestamp}} NOT NULL
+		);
+
+		-- Server members junction table
+		CREATE TABLE IF NOT EXISTS server_members (
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			server_id TEXT NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
+			nickname TEXT,
+			joined_at {{timestamp}} NOT NULL,
+			is_muted {{bool}} DEFAULT {{false}},
+			is_deafened {{bool}} DEFAULT {{false}},
+			PRIMARY KEY (user_id, server_id)
+		);
+
+		-- Member roles junction table
+		CREATE TABLE IF NOT EXISTS member_roles (
+			user_id TEXT NOT NULL,
+			server_id TEXT NOT NULL,
+			role_id TEXT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+			PRIMARY KEY (user_id, server_id, role_id),
+			FOREIGN KEY (user_id, server_id) REFERENCES server_members(user_id, server_id) ON DELETE CASCADE
+		);
+
+		-- DM channel recipients
+		CREATE TABLE IF NOT EXISTS dm_recipients (
+			channel_id TEXT NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			PRIMARY KEY (channel_id, user_id)
+		);
+
+		-- Invites table
+		CREATE TABLE IF NOT EXISTS invites (
+			code TEXT PRIMARY KEY,
+			server_id TEXT NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
+			channel_id TEXT REFERENCES channels(id){{set_null}},
+			inviter_id TEXT NOT NULL REFERENCES users(id),
+			max_age INTEGER DEFAULT 86400,
+			max_uses INTEGER DEFAULT 0,
+			uses INTEGER DEFAULT 0,
+			created_at {{timestamp}} NOT NULL,
+			expires_at {{timestamp}},
+			is_revoked {{bool}} DEFAULT {{false}}
+		);
+
+		-- Message mentions
+		CREATE TABLE IF NOT EXISTS message_mentions (
+			message_id TEXT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			PRIMARY KEY (message_id, user_id)
+		);
+
+		-- Message reactions
+		CREATE TABLE IF NOT EXISTS message_reactions (
+			message_id TEXT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			emoji TEXT NOT NULL,
+			created_at {{timestamp}} NOT NULL,
+			PRIMARY KEY (message_id, user_id, emoji)
+		);
+
+		-- Permission overwrites
+		CREATE TABLE IF NOT EXISTS permission_overwrites (
+			channel_id TEXT NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+			target_id TEXT NOT NULL,
+			target_type TEXT NOT NULL,
+			allow {{bigint}} DEFAULT 0,
+			deny {{bigint}} DEFAULT 0,
+			PRIMARY KEY (channel_id, target_id)
+		);
+
+		-- Sessions table for authentication
+		CREATE TABLE IF NOT EXISTS sessions (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			token_hash TEXT NOT NULL UNIQUE,
+			created_at {{timestamp}} NOT NULL,
+			expires_at {{timestamp}} NOT NULL,
+			last_used_at {{timestamp}},
+			ip_address TEXT,
+			user_agent TEXT
+		);
+
+		-- Bans table
+		CREATE TABLE IF NOT EXISTS bans (
+			server_id TEXT NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			reason TEXT,
+			banned_by TEXT NOT NULL REFERENCES users(id),
+			banned_at {{timestamp}} NOT NULL,
+			PRIMARY KEY (server_id, user_id)
+		);
+
+		-- Indexes for common queries
+		CREATE INDEX IF NOT EXISTS idx_messages_channel_created ON messages(channel_id, created_at DESC);
+		CREATE INDEX IF NOT EXISTS idx_messages_author ON messages(author_id);
+		CREATE INDEX IF NOT EXISTS idx_channels_server ON channels(server_id);
+		CREATE INDEX IF NOT EXISTS idx_server_members_server ON server_members(server_id);
+		CREATE INDEX IF NOT EXISTS idx_roles_server ON roles(server_id);
+		CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);
+		CREATE INDEX IF NOT EXISTS idx_sessions_token ON sessions(token_hash);
+		CREATE INDEX IF NOT EXISTS idx_invites_server ON invites(server_id);
+		`,
+		Down: `
+		DROP TABLE IF EXISTS bans;
+		DROP TABLE IF EXISTS sessions;
+		DROP TABLE IF EXISTS permission_overwrites;
+		DROP TABLE IF EXISTS message_reactions;
+		DROP TABLE IF EXISTS message_mentions;
+		DROP TABLE IF EXISTS invites;
+		DROP TABLE IF EXISTS dm_recipients;
+		DROP TABLE IF EXISTS member_roles;
+		DROP TABLE IF EXISTS server_members;
+		DROP TABLE IF EXISTS roles;
+		DROP TABLE IF EXISTS messages;
+		DROP TABLE IF EXISTS channels;
+		DROP TABLE IF EXISTS servers;
+		DROP TABLE IF EXISTS users;
+		`,
+	},
+	{
+		Version: 2,
+		Name:    "dm_delivery",
+		Up: `
+		-- DM messages not yet delivered to an offline recipient
+		CREATE TABLE IF NOT EXISTS dm_undelivered (
+			message_id TEXT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			PRIMARY KEY (message_id, user_id)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_dm_recipients_user ON dm_recipients(user_id);
+		`,
+		Down: `
+		DROP INDEX IF EXISTS idx_dm_recipients_user;
+		DROP TABLE IF EXISTS dm_undelivered;
+		`,
+	},
+	{
+		Version: 3,
+		Name:    "member_timeouts",
+		Up: `
+		-- Timed moderation actions (temporary bans and mutes)
+		CREATE TABLE IF NOT EXISTS member_timeouts (
+			server_id TEXT NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			kind TEXT NOT NULL,
+			reason TEXT,
+			issued_by TEXT NOT NULL REFERENCES users(id),
+			created_at {{timestamp}} NOT NULL,
+			expires_at {{timestamp}} NOT NULL,
+			PRIMARY KEY (server_id, user_id, kind)
+		);
+		`,
+		Down: `
+		DROP TABLE IF EXISTS member_timeouts;
+		`,
+	},
+	{
+		Version: 4,
+		Name:    "audit_log",
+		Up: `
+		-- Moderation and administrative actions
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id TEXT PRIMARY KEY,
+			server_id TEXT NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
+			actor_id TEXT NOT NULL REFERENCES users(id),
+			action TEXT NOT NULL,
+			target_type TEXT NOT NULL,
+			target_id TEXT NOT NULL,
+			target_name TEXT,
+			reason TEXT,
+			before_json TEXT,
+			after_json TEXT,
+			created_at {{timestamp}} NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_audit_log_server_created ON audit_log(server_id, created_at DESC);
+		`,
+		Down: `
+		DROP TABLE IF EXISTS audit_log;
+		`,
+	},
+	{
+		// The index is an external-content table over messages, keyed by
+		// rowid so triggers update it without scanning. The rowid of a table
+		// without an INTEGER PRIMARY KEY is not stable across VACUUM, so
+		// Backup rebuilds the index in its copy. The index is dropped first so
+		// databases that built it before versioning are rebuilt rather than
+		// backfilled twice.
+		Version: 5,
+		Name:    "message_search",
+		Up: `
+		DROP TRIGGER IF EXISTS messages_fts_insert;
+		DROP TRIGGER IF EXISTS messages_fts_delete;
+		DROP TRIGGER IF EXISTS messages_fts_update;
+		DROP TABLE IF EXISTS messages_fts;
+
+		CREATE VIRTUAL TABLE messages_fts USING fts5(content, content='messages', content_rowid='rowid');
+
+		CREATE TRIGGER messages_fts_insert AFTER INSERT ON messages BEGIN
+			INSERT INTO messages_fts (rowid, content) VALUES (new.rowid, new.content);
+		END;
+
+		CREATE TRIGGER messages_fts_delete AFTER DELETE ON messages BEGIN
+			INSERT INTO messages_fts (messages_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+		END;
+
+		CREATE TRIGGER messages_fts_update AFTER UPDATE OF content ON messages BEGIN
+			INSERT INTO messages_fts (messages_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+			INSERT INTO messages_fts (rowid, content) VALUES (new.rowid, new.content);
+		END;
+
+		-- Index existing messages
+		INSERT INTO messages_fts (messages_fts) VALUES ('rebuild');
+		`,
+		Down: `
+		DROP TRIGGER IF EXISTS messages_fts_insert;
+		DROP TRIGGER IF EXISTS messages_fts_delete;
+		DROP TRIGGER IF EXISTS messages_fts_update;
+		DROP TABLE IF EXISTS messages_fts;
+		`,
+		// PostgreSQL keeps the index in a generated tsvector column instead
+		PostgresUp: `
+		ALTER TABLE messages ADD COLUMN search tsvector
+			GENERATED ALWAYS AS (to_tsvector('simple', content)) STORED;
+		CREATE INDEX idx_messages_search ON messages USING GIN (search);
+		`,
+		PostgresDown: `
+		DROP INDEX IF EXISTS idx_messages_search;
+		ALTER TABLE messages DROP COLUMN IF EXISTS search;
+		`,
+	},
+	{
+		// Threads are channels with a parent. The parent columns carry no
+		// foreign keys: anchor messages can be deleted out from under a
+		// thread, and DeleteChannel removes threads with their parent.
+		// Existing roles are left alone; new servers give @everyone the
+		// thread permissions, and older ones opt in by editing the role.
+		Version: 6,
+		Name:    "threads",
+		Up: `
+		ALTER TABLE channels ADD COLUMN parent_id TEXT;
+		ALTER TABLE channels ADD COLUMN parent_message_id TEXT;
+		ALTER TABLE channels ADD COLUMN owner_id TEXT;
+		ALTER TABLE channels ADD COLUMN archived {{bool}} DEFAULT {{false}};
+		ALTER TABLE channels ADD COLUMN auto_archive_minutes INTEGER DEFAULT 0;
+		ALTER TABLE channels ADD COLUMN message_count INTEGER DEFAULT 0;
+		ALTER TABLE channels ADD COLUMN last_message_at {{timestamp}};
+
+		CREATE INDEX IF NOT EXISTS idx_channels_parent ON channels(parent_id);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_channels_parent_message ON channels(parent_message_id);
+		`,
+		Down: `
+		DROP INDEX IF EXISTS idx_channels_parent_message;
+		DROP INDEX IF EXISTS idx_channels_parent;
+		DELETE FROM messages WHERE channel_id IN (SELECT id FROM channels WHERE parent_id IS NOT NULL);
+		DELETE FROM channels WHERE parent_id IS NOT NULL;
+		ALTER TABLE channels DROP COLUMN last_message_at;
+		ALTER TABLE channels DROP COLUMN message_count;
+		ALTER TABLE channels DROP COLUMN auto_archive_minutes;
+		ALTER TABLE channels DROP COLUMN archived;
+		ALTER TABLE channels DROP COLUMN owner_id;
+		ALTER TABLE channels DROP COLUMN parent_message_id;
+		ALTER TABLE channels DROP COLUMN parent_id;
+		`,
+	},
+	{
+		// Expired timeouts are found by comparing expires_at, which SQLite
+		// stores as text. Expiries used to be written in the server's local
+		// zone, so they're rewritten in UTC, the zone AddTimeout now uses,
+		// for the comparison to hold. PostgreSQL compares TIMESTAMPTZ
+		// values directly.
+		Version: 7,
+		Name:    "timeout_expiry_index",
+		Up: `
+		UPDATE member_timeouts
+		SET expires_at = datetime(substr(expires_at, 1, 19)
+			|| substr(expires_at, 20 + instr(substr(expires_at, 20), ' '), 3) || ':'
+			|| substr(expires_at, 23 + instr(substr(expires_at, 20), ' '), 2)) || ' +0000 UTC'
+		WHERE expires_at NOT LIKE '% +0000 UTC%';
+
+		CREATE INDEX IF NOT EXISTS idx_member_timeouts_expires ON member_timeouts(expires_at);
+		`,
+		Down: `
+		DROP INDEX IF EXISTS idx_member_timeouts_expires;
+		`,
+		PostgresUp: `
+		CREATE INDEX IF NOT EXISTS idx_member_timeouts_expires ON member_timeouts(expires_at);
+		`,
+		PostgresDown: `
+		DROP INDEX IF EXISTS idx_member_timeouts_expires;
+		`,
+	},
+}
+
+// LatestVersion returns the schema version this binary migrates to
+func LatestVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// migrations returns the migration list written for the database's dialect
+func (db *DB) migrations() []Migration {
+	list := make([]Migration, len(migrations))
+	for i, m := range migrations {
+		list[i] = m.forDialect(db.dialect)
+	}
+	return list
+}
+
+// forDialect returns m with its scripts written for d
+func (m Migration) forDialect(d dialect) Migration {
+	if d == dialectPostgres && m.PostgresUp != "" {
+		m.Up, m.Down = m.PostgresUp, m.PostgresDown
+	}
+	m.Up, m.Down = d.schema(m.Up), d.schema(m.Down)
+	m.PostgresUp, m.PostgresDown = "", ""
+	return m
+}
+
+// MigrationStatus describes one known migration and whether it has been applied
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// ensureMigrationsTable creates the schema_migrations bookkeeping table
+func (db *DB) ensureMigrationsTable() error {
+	_, err := db.Exec(db.dialect.schema(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at {{timestamp}} NOT NULL
+	)`))
+	return err
+}
+
+// SchemaVersion returns the highest applied migration, 0 for an empty database
+func (db *DB) SchemaVersion() (int, error) {
+	if err := db.ensureMigrationsTable(); err != nil {
+		return 0, err
+	}
+	var version sql.NullInt64
+	if err := db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// checkNotNewer fails if the database was migrated by a newer binary
+func (db *DB) checkNotNewer() (int, error) {
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return 0, err
+	}
+	if current > LatestVersion() {
+		return current, fmt.Errorf("database schema version %d is newer than this binary supports (%d); upgrade concord-server",
+			current, LatestVersion())
+	}
+	return current, nil
+}
+
+// MigrationStatus lists every known migration with its applied time
+func (db *DB) MigrationStatus() ([]MigrationStatus, error) {
+	if err := db.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	known := db.migrations()
+	status := make([]MigrationStatus, len(known))
+	for i, m := range known {
+		status[i].Migration = m
+		if at, ok := applied[m.Version]; ok {
+			status[i].AppliedAt = &at
+		}
+	}
+	return status, nil
+}
+
+// MigrateUp applies pending migrations up to and including target, or all of
+// them when target is 0, and returns the migrations it applied
+func (db *DB) MigrateUp(target int) ([]Migration, error) {
+	current, err := db.checkNotNewer()
+	if err != nil {
+		return nil, err
+	}
+	if target == 0 {
+		target = LatestVersion()
+	}
+	if target > LatestVersion() {
+		return nil, fmt.Errorf("unknown schema version %d (latest is %d)", target, LatestVersion())
+	}
+
+	var applied []Migration
+	for _, m := range db.migrations() {
+		if m.Version <= current || m.Version > target {
+			continue
+		}
+		if err := db.applyMigration(m, true); err != nil {
+			return applied, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+// MigrateDown reverts applied migrations newer than target, newest first,
+// and returns the migrations it reverted
+func (db *DB) MigrateDown(target int) ([]Migration, error) {
+	current, err := db.checkNotNewer()
+	if err != nil {
+		return nil, err
+	}
+	if target < 0 || target > current {
+		return nil, fmt.Errorf("cannot migrate down to version %d from %d", target, current)
+	}
+
+	known := db.migrations()
+	var reverted []Migration
+	for i := len(known) - 1; i >= 0; i-- {
+		m := known[i]
+		if m.Version > current || m.Version <= target {
+			continue
+		}
+		if err := db.applyMigration(m, false); err != nil {
+			return reverted, fmt.Errorf("reverting migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		reverted = append(reverted, m)
+	}
+	return reverted, nil
+}
+
+// applyMigration runs one migration in a transaction and records the result
+func (db *DB) applyMigration(m Migration, up bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if up {
+		if _, err := tx.Exec(m.Up); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+			m.Version, m.Name, time.Now())
+	} else {
+		if _, err := tx.Exec(m.Down); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -11,14 +12,37 @@ import (
 	"github.com/concord-chat/concord/internal/models"
 )
 
-// DB wraps the SQLite database connection
+// DB wraps the database connection. It speaks SQLite or PostgreSQL
+// depending on how it was opened.
 type DB struct {
 	*sql.DB
+	dialect dialect
 }
 
-// New creates a new database connection and initializes schema
-func New(path string) (*DB, error) {
-	db, err := sql.Open("sqlite", path+"?_foreign_keys=on&_journal_mode=WAL")
+// New opens the database and applies any pending schema migrations. It
+// refuses to open a database migrated by a newer binary.
+func New(source string) (*DB, error) {
+	db, err := Open(source)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.MigrateUp(0); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
+	}
+
+	return db, nil
+}
+
+// Open opens the database without touching its schema. A postgres:// or
+// postgresql:// URL selects PostgreSQL; anything else is an SQLite file path.
+func Open(source string) (*DB, error) {
+	if isPostgresURL(source) {
+		return openPostgres(source)
+	}
+
+	db, err := sql.Open("sqlite", source+"?_foreign_keys=on&_journal_mode=WAL")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -28,201 +52,7 @@ func New(path string) (*DB, error) {
 	db.SetMaxIdleConns(1)
 	db.SetConnMaxLifetime(time.Hour)
 
-	wrapper := &DB{db}
-	if err := wrapper.initSchema(); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to initialize schema: %w", err)
-	}
-
-	return wrapper, nil
-}
-
-// initSchema creates the database tables if they don't exist
-func (db *DB) initSchema() error {
-	schema := `
-	-- Users table
-	CREATE TABLE IF NOT EXISTS users (
-		id TEXT PRIMARY KEY,
-		username TEXT NOT NULL,
-		discriminator TEXT NOT NULL,
-		display_name TEXT,
-		email TEXT UNIQUE,
-		password_hash TEXT NOT NULL,
-		avatar_hash TEXT,
-		status TEXT DEFAULT 'offline',
-		status_text TEXT,
-		created_at DATETIME NOT NULL,
-		updated_at DATETIME NOT NULL,
-		last_seen_at DATETIME,
-		is_bot INTEGER DEFAULT 0,
-		UNIQUE(username, discriminator)
-	);
-
-	-- Servers table
-	CREATE TABLE IF NOT EXISTS servers (
-		id TEXT PRIMARY KEY,
-		name TEXT NOT NULL,
-		description TEXT,
-		icon_hash TEXT,
-		owner_id TEXT NOT NULL REFERENCES users(id),
-		default_channel_id TEXT,
-		system_channel_id TEXT,
-		rules_channel_id TEXT,
-		max_members INTEGER DEFAULT 1000,
-		created_at DATETIME NOT NULL,
-		updated_at DATETIME NOT NULL,
-		verification_level INTEGER DEFAULT 0,
-		explicit_content_filter INTEGER DEFAULT 0,
-		invites_enabled INTEGER DEFAULT 1,
-		default_invite_max_age INTEGER DEFAULT 86400,
-		default_invite_max_uses INTEGER DEFAULT 0
-	);
-
-	-- Channels table
-	CREATE TABLE IF NOT EXISTS channels (
-		id TEXT PRIMARY KEY,
-		server_id TEXT REFERENCES servers(id) ON DELETE CASCADE,
-		name TEXT NOT NULL,
-		topic TEXT,
-		type INTEGER NOT NULL,
-		position INTEGER DEFAULT 0,
-		category_id TEXT REFERENCES channels(id),
-		is_nsfw INTEGER DEFAULT 0,
-		rate_limit_per_user INTEGER DEFAULT 0,
-		created_at DATETIME NOT NULL,
-		updated_at DATETIME NOT NULL
-	);
-
-	-- Messages table
-	CREATE TABLE IF NOT EXISTS messages (
-		id TEXT PRIMARY KEY,
-		channel_id TEXT NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
-		author_id TEXT NOT NULL REFERENCES users(id),
-		content TEXT NOT NULL,
-		type INTEGER DEFAULT 0,
-		created_at DATETIME NOT NULL,
-		edited_at DATETIME,
-		is_pinned INTEGER DEFAULT 0,
-		reply_to_id TEXT REFERENCES messages(id)
-	);
-
-	-- Roles table
-	CREATE TABLE IF NOT EXISTS roles (
-		id TEXT PRIMARY KEY,
-		server_id TEXT NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
-		name TEXT NOT NULL,
-		color INTEGER DEFAULT 0,
-		permissions INTEGER NOT NULL,
-		position INTEGER DEFAULT 0,
-		is_hoisted INTEGER DEFAULT 0,
-		is_mentionable INTEGER DEFAULT 1,
-		is_default INTEGER DEFAULT 0,
-		created_at DATETIME NOT NULL,
-		updated_at DATETIME NOT NULL
-	);
-
-	-- Server members junction table
-	CREATE TABLE IF NOT EXISTS server_members (
-		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-		server_id TEXT NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
-		nickname TEXT,
-		joined_at DATETIME NOT NULL,
-		is_muted INTEGER DEFAULT 0,
-		is_deafened INTEGER DEFAULT 0,
-		PRIMARY KEY (user_id, server_id)
-	);
-
-	-- Member roles junction table
-	CREATE TABLE IF NOT EXISTS member_roles (
-		user_id TEXT NOT NULL,
-		server_id TEXT NOT NULL,
-		role_id TEXT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
-		PRIMARY KEY (user_id, server_id, role_id),
-		FOREIGN KEY (user_id, server_id) REFERENCES server_members(user_id, server_id) ON DELETE CASCADE
-	);
-
-	-- DM channel recipients
-	CREATE TABLE IF NOT EXISTS dm_recipients (
-		channel_id TEXT NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
-		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-		PRIMARY KEY (channel_id, user_id)
-	);
-
-	-- Invites table
-	CREATE TABLE IF NOT EXISTS invites (
-		code TEXT PRIMARY KEY,
-		server_id TEXT NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
-		channel_id TEXT REFERENCES channels(id),
-		inviter_id TEXT NOT NULL REFERENCES users(id),
-		max_age INTEGER DEFAULT 86400,
-		max_uses INTEGER DEFAULT 0,
-		uses INTEGER DEFAULT 0,
-		created_at DATETIME NOT NULL,
-		expires_at DATETIME,
-		is_revoked INTEGER DEFAULT 0
-	);
-
-	-- Message mentions
-	CREATE TABLE IF NOT EXISTS message_mentions (
-		message_id TEXT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
-		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-		PRIMARY KEY (message_id, user_id)
-	);
-
-	-- Message reactions
-	CREATE TABLE IF NOT EXISTS message_reactions (
-		message_id TEXT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
-		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-		emoji TEXT NOT NULL,
-		created_at DATETIME NOT NULL,
-		PRIMARY KEY (message_id, user_id, emoji)
-	);
-
-	-- Permission overwrites
-	CREATE TABLE IF NOT EXISTS permission_overwrites (
-		channel_id TEXT NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
-		target_id TEXT NOT NULL,
-		target_type TEXT NOT NULL,
-		allow INTEGER DEFAULT 0,
-		deny INTEGER DEFAULT 0,
-		PRIMARY KEY (channel_id, target_id)
-	);
-
-	-- Sessions table for authentication
-	CREATE TABLE IF NOT EXISTS sessions (
-		id TEXT PRIMARY KEY,
-		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-		token_hash TEXT NOT NULL UNIQUE,
-		created_at DATETIME NOT NULL,
-		expires_at DATETIME NOT NULL,
-		last_used_at DATETIME,
-		ip_address TEXT,
-		user_agent TEXT
-	);
-
-	-- Bans table
-	CREATE TABLE IF NOT EXISTS bans (
-		server_id TEXT NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
-		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-		reason TEXT,
-		banned_by TEXT NOT NULL REFERENCES users(id),
-		banned_at DATETIME NOT NULL,
-		PRIMARY KEY (server_id, user_id)
-	);
-
-	-- Indexes for common queries
-	CREATE INDEX IF NOT EXISTS idx_messages_channel_created ON messages(channel_id, created_at DESC);
-	CREATE INDEX IF NOT EXISTS idx_messages_author ON messages(author_id);
-	CREATE INDEX IF NOT EXISTS idx_channels_server ON channels(server_id);
-	CREATE INDEX IF NOT EXISTS idx_server_members_server ON server_members(server_id);
-	CREATE INDEX IF NOT EXISTS idx_roles_server ON roles(server_id);
-	CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);
-	CREATE INDEX IF NOT EXISTS idx_sessions_token ON sessions(token_hash);
-	CREATE INDEX IF NOT EXISTS idx_invites_server ON invites(server_id);
-	`
-
-	_, err := db.Exec(schema)
-	return err
+	return &DB{DB: db, dialect: dialectSQLite}, nil
 }
 
 // --- User Operations ---
@@ -273,6 +103,27 @@ func (db *DB) GetUserByID(id uuid.UUID) (*models.User, error) {
 	return user, nil
 }
 
+// GetUserByUsername looks a user up by case-insensitive username, preferring
+// a current member of serverID when several users share the name
+func (db *DB) GetUserByUsername(serverID uuid.UUID, username string) (*models.User, error) {
+	var idStr string
+	err := db.QueryRow(`
+		SELECT u.id FROM users u
+		LEFT JOIN server_members sm ON sm.user_id = u.id AND sm.server_id = ?
+		WHERE LOWER(u.username) = LOWER(?)
+		ORDER BY sm.user_id IS NULL
+		LIMIT 1`,
+		serverID.String(), username).Scan(&idStr)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no user named %q", username)
+	}
+	if err != nil {
+		return nil, err
+	}
+	id, _ := uuid.Parse(idStr)
+	return db.GetUserByID(id)
+}
+
 // GetUserByEmail retrieves a user by their email
 func (db *DB) GetUserByEmail(email string) (*models.User, string, error) {
 	user := &models.User{}
@@ -414,11 +265,86 @@ func (db *DB) GetUserServers(userID uuid.UUID) ([]*models.Server, error) {
 	return servers, rows.Err()
 }
 
+// CreateServerWithDefaults inserts server with an @everyone role and a
+// #general channel, and makes its owner the first member
+func (db *DB) CreateServerWithDefaults(server *models.Server) (*models.Role, *models.Channel, error) {
+	if err := db.CreateServer(server); err != nil {
+		return nil, nil, fmt.Errorf("failed to create server: %w", err)
+	}
+
+	everyoneRole := models.NewEveryoneRole(server.ID)
+	if err := db.CreateRole(everyoneRole); err != nil {
+		return nil, nil, fmt.Errorf("failed to create @everyone role: %w", err)
+	}
+
+	generalChannel := models.NewTextChannel(server.ID, "general")
+	if err := db.CreateChannel(generalChannel); err != nil {
+		return nil, nil, fmt.Errorf("failed to create default channel: %w", err)
+	}
+	_, err := db.Exec(`UPDATE servers SET default_channel_id = ?, updated_at = ? WHERE id = ?`,
+		generalChannel.ID.String(), time.Now(), server.ID.String())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to update server default channel: %w", err)
+	}
+	server.DefaultChannelID = generalChannel.ID
+
+	member := &models.ServerMember{
+		UserID:   server.OwnerID,
+		ServerID: server.ID,
+		JoinedAt: time.Now(),
+	}
+	if err := db.AddServerMember(member); err != nil {
+		return nil, nil, fmt.Errorf("failed to add owner: %w", err)
+	}
+	if err := db.AddMemberRole(server.OwnerID, server.ID, everyoneRole.ID); err != nil {
+		return nil, nil, fmt.Errorf("failed to assign @everyone role: %w", err)
+	}
+
+	return everyoneRole, generalChannel, nil
+}
+
+// DeleteServer deletes a server with its channels, messages, roles,
+// members, invites and moderation records. Rows are removed child-first
+// since SQLite doesn't enforce the cascades.
+func (db *DB) DeleteServer(serverID uuid.UUID) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	const channels = `SELECT id FROM channels WHERE server_id = ?`
+	const messages = `SELECT id FROM messages WHERE channel_id IN (` + channels + `)`
+	statements := []string{
+		`DELETE FROM message_mentions WHERE message_id IN (` + messages + `)`,
+		`DELETE FROM message_reactions WHERE message_id IN (` + messages + `)`,
+		`DELETE FROM dm_undelivered WHERE message_id IN (` + messages + `)`,
+		`DELETE FROM messages WHERE channel_id IN (` + channels + `)`,
+		`DELETE FROM permission_overwrites WHERE channel_id IN (` + channels + `)`,
+		`DELETE FROM invites WHERE server_id = ?`,
+		`DELETE FROM channels WHERE server_id = ?`,
+		`DELETE FROM member_roles WHERE server_id = ?`,
+		`DELETE FROM server_members WHERE server_id = ?`,
+		`DELETE FROM roles WHERE server_id = ?`,
+		`DELETE FROM bans WHERE server_id = ?`,
+		`DELETE FROM member_timeouts WHERE server_id = ?`,
+		`DELETE FROM audit_log WHERE server_id = ?`,
+		`DELETE FROM servers WHERE id = ?`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt, serverID.String()); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
 // --- Channel Operations ---
 
 // CreateChannel inserts a new channel
 func (db *DB) CreateChannel(channel *models.Channel) error {
-	var serverID, categoryID sql.NullString
+	var serverID, categoryID, parentID, parentMessageID, ownerID sql.NullString
 	if channel.ServerID != uuid.Nil {
 		serverID.String = channel.ServerID.String()
 		serverID.Valid = true
@@ -427,24 +353,93 @@ func (db *DB) CreateChannel(channel *models.Channel) error {
 		categoryID.String = channel.CategoryID.String()
 		categoryID.Valid = true
 	}
+	if channel.ParentID != uuid.Nil {
+		parentID.String = channel.ParentID.String()
+		parentID.Valid = true
+		parentMessageID.String = channel.ParentMessageID.String()
+		parentMessageID.Valid = true
+	}
+
+	var archived bool
+	var autoArchive, messageCount int
+	var lastMessageAt sql.NullTime
+	if t := channel.Thread; t != nil {
+		ownerID.String = t.OwnerID.String()
+		ownerID.Valid = true
+		archived, autoArchive, messageCount = t.Archived, t.AutoArchiveMinutes, t.MessageCount
+		lastMessageAt.Time = t.LastMessageAt
+		lastMessageAt.Valid = !t.LastMessageAt.IsZero()
+	}
 
 	_, err := db.Exec(`
 		INSERT INTO channels (id, server_id, name, topic, type, position, category_id,
-			is_nsfw, rate_limit_per_user, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			is_nsfw, rate_limit_per_user, created_at, updated_at,
+			parent_id, parent_message_id, owner_id, archived, auto_archive_minutes,
+			message_count, last_message_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		channel.ID.String(), serverID, channel.Name, channel.Topic, channel.Type,
 		channel.Position, categoryID, channel.IsNSFW, channel.RateLimitPerUser,
-		channel.CreatedAt, channel.UpdatedAt)
+		channel.CreatedAt, channel.UpdatedAt,
+		parentID, parentMessageID, ownerID, archived, autoArchive,
+		messageCount, lastMessageAt)
 	return err
 }
 
-// GetServerChannels retrieves all channels for a server
-func (db *DB) GetServerChannels(serverID uuid.UUID) ([]*models.Channel, error) {
-	rows, err := db.Query(`
-		SELECT id, server_id, name, topic, type, position, category_id,
-			is_nsfw, rate_limit_per_user, created_at, updated_at
-		FROM channels WHERE server_id = ?
-		ORDER BY position`, serverID.String())
+// channelColumns is the standard column list read by scanChannel
+const channelColumns = `id, server_id, name, topic, type, position, category_id,
+	is_nsfw, rate_limit_per_user, created_at, updated_at,
+	parent_id, parent_message_id, owner_id, archived, auto_archive_minutes,
+	message_count, last_message_at`
+
+// scanChannel scans a channels row selected with channelColumns
+func scanChannel(row rowScanner) (*models.Channel, error) {
+	ch := &models.Channel{}
+	var idStr string
+	var serverIDStr, topic, categoryID sql.NullString
+	var parentID, parentMessageID, ownerID sql.NullString
+	var archived sql.NullBool
+	var autoArchive, messageCount sql.NullInt64
+	var lastMessageAt sql.NullTime
+
+	err := row.Scan(&idStr, &serverIDStr, &ch.Name, &topic, &ch.Type,
+		&ch.Position, &categoryID, &ch.IsNSFW, &ch.RateLimitPerUser,
+		&ch.CreatedAt, &ch.UpdatedAt,
+		&parentID, &parentMessageID, &ownerID, &archived, &autoArchive,
+		&messageCount, &lastMessageAt)
+	if err != nil {
+		return nil, err
+	}
+
+	ch.ID, _ = uuid.Parse(idStr)
+	if serverIDStr.Valid {
+		ch.ServerID, _ = uuid.Parse(serverIDStr.String)
+	}
+	if topic.Valid {
+		ch.Topic = topic.String
+	}
+	if categoryID.Valid {
+		ch.CategoryID, _ = uuid.Parse(categoryID.String)
+	}
+	if parentID.Valid {
+		ch.ParentID, _ = uuid.Parse(parentID.String)
+		ch.ParentMessageID, _ = uuid.Parse(parentMessageID.String)
+	}
+	if ch.Type == models.ChannelTypeThread {
+		ch.Thread = &models.ThreadMetadata{
+			Archived:           archived.Bool,
+			AutoArchiveMinutes: int(autoArchive.Int64),
+			MessageCount:       int(messageCount.Int64),
+			LastMessageAt:      lastMessageAt.Time,
+		}
+		ch.Thread.OwnerID, _ = uuid.Parse(ownerID.String)
+	}
+	return ch, nil
+}
+
+// queryChannels runs a query selecting channelColumns and loads the
+// overwrites of every channel it returns
+func (db *DB) queryChannels(query string, args ...interface{}) ([]*models.Channel, error) {
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -452,42 +447,35 @@ func (db *DB) GetServerChannels(serverID uuid.UUID) ([]*models.Channel, error) {
 
 	var channels []*models.Channel
 	for rows.Next() {
-		ch := &models.Channel{}
-		var idStr, serverIDStr string
-		var categoryID sql.NullString
-
-		err := rows.Scan(&idStr, &serverIDStr, &ch.Name, &ch.Topic, &ch.Type,
-			&ch.Position, &categoryID, &ch.IsNSFW, &ch.RateLimitPerUser,
-			&ch.CreatedAt, &ch.UpdatedAt)
+		ch, err := scanChannel(rows)
 		if err != nil {
 			return nil, err
 		}
-
-		ch.ID, _ = uuid.Parse(idStr)
-		ch.ServerID, _ = uuid.Parse(serverIDStr)
-		if categoryID.Valid {
-			ch.CategoryID, _ = uuid.Parse(categoryID.String)
-		}
-
 		channels = append(channels, ch)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return channels, rows.Err()
+	if err := db.loadOverwrites(channels); err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+// GetServerChannels retrieves all channels for a server, threads included
+func (db *DB) GetServerChannels(serverID uuid.UUID) ([]*models.Channel, error) {
+	return db.queryChannels(`
+		SELECT `+channelColumns+`
+		FROM channels WHERE server_id = ?
+		ORDER BY position, created_at`, serverID.String())
 }
 
 // GetChannelByID retrieves a channel by its ID
 func (db *DB) GetChannelByID(channelID uuid.UUID) (*models.Channel, error) {
-	var ch models.Channel
-	var idStr, serverIDStr string
-	var topic sql.NullString
-	var categoryID sql.NullString
-
-	err := db.QueryRow(`
-		SELECT id, server_id, name, topic, type, position, category_id,
-			is_nsfw, rate_limit_per_user, created_at, updated_at
-		FROM channels WHERE id = ?`, channelID.String()).
-		Scan(&idStr, &serverIDStr, &ch.Name, &topic, &ch.Type, &ch.Position,
-			&categoryID, &ch.IsNSFW, &ch.RateLimitPerUser, &ch.CreatedAt, &ch.UpdatedAt)
+	ch, err := scanChannel(db.QueryRow(`
+		SELECT `+channelColumns+`
+		FROM channels WHERE id = ?`, channelID.String()))
 
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("channel not found")
@@ -496,16 +484,106 @@ func (db *DB) GetChannelByID(channelID uuid.UUID) (*models.Channel, error) {
 		return nil, err
 	}
 
-	ch.ID, _ = uuid.Parse(idStr)
-	ch.ServerID, _ = uuid.Parse(serverIDStr)
-	if topic.Valid {
-		ch.Topic = topic.String
+	if err := db.loadOverwrites([]*models.Channel{ch}); err != nil {
+		return nil, err
 	}
-	if categoryID.Valid {
-		ch.CategoryID, _ = uuid.Parse(categoryID.String)
+	return ch, nil
+}
+
+// GetChannelThreads returns the threads under a channel, oldest first
+func (db *DB) GetChannelThreads(parentID uuid.UUID) ([]*models.Channel, error) {
+	return db.queryChannels(`
+		SELECT `+channelColumns+`
+		FROM channels WHERE parent_id = ?
+		ORDER BY created_at`, parentID.String())
+}
+
+// GetMessageThread returns the thread anchored to a message, or nil when it has none
+func (db *DB) GetMessageThread(messageID uuid.UUID) (*models.Channel, error) {
+	ch, err := scanChannel(db.QueryRow(`
+		SELECT `+channelColumns+`
+		FROM channels WHERE parent_message_id = ?`, messageID.String()))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return ch, err
+}
+
+// GetOpenThreads returns every thread that isn't archived, for the
+// auto-archive sweep
+func (db *DB) GetOpenThreads() ([]*models.Channel, error) {
+	return db.queryChannels(`
+		SELECT `+channelColumns+`
+		FROM channels WHERE type = ? AND archived = FALSE`, models.ChannelTypeThread)
+}
+
+// SetThreadArchived archives or reopens a thread. Reopening counts as
+// activity so the thread isn't swept again straight away.
+func (db *DB) SetThreadArchived(threadID uuid.UUID, archived bool) error {
+	now := time.Now()
+	if archived {
+		_, err := db.Exec(`UPDATE channels SET archived = ?, updated_at = ? WHERE id = ?`,
+			true, now, threadID.String())
+		return err
 	}
+	_, err := db.Exec(`UPDATE channels SET archived = ?, last_message_at = ?, updated_at = ? WHERE id = ?`,
+		false, now, now, threadID.String())
+	return err
+}
 
-	return &ch, nil
+// loadOverwrites fills in the permission overwrites of each channel
+func (db *DB) loadOverwrites(channels []*models.Channel) error {
+	if len(channels) == 0 {
+		return nil
+	}
+
+	byID := make(map[string]*models.Channel, len(channels))
+	placeholders := make([]string, len(channels))
+	args := make([]interface{}, len(channels))
+	for i, ch := range channels {
+		byID[ch.ID.String()] = ch
+		placeholders[i] = "?"
+		args[i] = ch.ID.String()
+	}
+
+	rows, err := db.Query(`
+		SELECT channel_id, target_id, target_type, allow, deny FROM permission_overwrites
+		WHERE channel_id IN (`+strings.Join(placeholders, ",")+`)`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var channelIDStr, targetIDStr string
+		var ow models.PermissionOverwrite
+		if err := rows.Scan(&channelIDStr, &targetIDStr, &ow.Type, &ow.Allow, &ow.Deny); err != nil {
+			return err
+		}
+		ow.ID, _ = uuid.Parse(targetIDStr)
+		if ch, ok := byID[channelIDStr]; ok {
+			ch.PermissionOverwrites = append(ch.PermissionOverwrites, ow)
+		}
+	}
+	return rows.Err()
+}
+
+// SetChannelOverwrite creates or replaces the overwrite for a role or member on a channel
+func (db *DB) SetChannelOverwrite(channelID uuid.UUID, ow models.PermissionOverwrite) error {
+	_, err := db.Exec(`
+		INSERT INTO permission_overwrites (channel_id, target_id, target_type, allow, deny)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(channel_id, target_id) DO UPDATE SET target_type=excluded.target_type,
+			allow=excluded.allow, deny=excluded.deny`,
+		channelID.String(), ow.ID.String(), ow.Type, ow.Allow, ow.Deny)
+	return err
+}
+
+// DeleteChannelOverwrite removes the overwrite for a role or member on a channel
+func (db *DB) DeleteChannelOverwrite(channelID, targetID uuid.UUID) error {
+	_, err := db.Exec(`DELETE FROM permission_overwrites WHERE channel_id = ? AND target_id = ?`,
+		channelID.String(), targetID.String())
+	return err
 }
 
 // UpdateChannel updates an existing channel
@@ -527,7 +605,7 @@ func (db *DB) UpdateChannel(channel *models.Channel) error {
 	return err
 }
 
-// DeleteChannel deletes a channel and all its messages
+// DeleteChannel deletes a channel, its threads and all their messages
 func (db *DB) DeleteChannel(channelID uuid.UUID) error {
 	tx, err := db.Begin()
 	if err != nil {
@@ -536,12 +614,21 @@ func (db *DB) DeleteChannel(channelID uuid.UUID) error {
 	defer tx.Rollback()
 
 	// Delete messages first (foreign key constraint)
+	_, err = tx.Exec(`DELETE FROM messages WHERE channel_id IN (SELECT id FROM channels WHERE parent_id = ?)`,
+		channelID.String())
+	if err != nil {
+		return err
+	}
 	_, err = tx.Exec(`DELETE FROM messages WHERE channel_id = ?`, channelID.String())
 	if err != nil {
 		return err
 	}
 
-	// Delete channel
+	// Delete threads, then the channel
+	_, err = tx.Exec(`DELETE FROM channels WHERE parent_id = ?`, channelID.String())
+	if err != nil {
+		return err
+	}
 	_, err = tx.Exec(`DELETE FROM channels WHERE id = ?`, channelID.String())
 	if err != nil {
 		return err
@@ -598,6 +685,162 @@ func (db *DB) GetServerMember(serverID, userID uuid.UUID) (*models.ServerMember,
 	return &member, nil
 }
 
+// --- Direct Message Operations ---
+
+// CreateDMChannel inserts a DM channel together with its recipients
+func (db *DB) CreateDMChannel(channel *models.Channel) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO channels (id, server_id, name, type, created_at, updated_at)
+		VALUES (?, NULL, ?, ?, ?, ?)`,
+		channel.ID.String(), channel.Name, channel.Type, channel.CreatedAt, channel.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range channel.RecipientIDs {
+		_, err = tx.Exec(`INSERT INTO dm_recipients (channel_id, user_id) VALUES (?, ?)`,
+			channel.ID.String(), userID.String())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetDMChannelBetween finds the one-to-one DM channel between two users
+func (db *DB) GetDMChannelBetween(userA, userB uuid.UUID) (*models.Channel, error) {
+	var idStr string
+	err := db.QueryRow(`
+		SELECT c.id FROM channels c
+		JOIN dm_recipients a ON a.channel_id = c.id AND a.user_id = ?
+		JOIN dm_recipients b ON b.channel_id = c.id AND b.user_id = ?
+		WHERE c.type = ?
+		LIMIT 1`,
+		userA.String(), userB.String(), models.ChannelTypeDM).Scan(&idStr)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("channel not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	id, _ := uuid.Parse(idStr)
+	channel, err := db.GetChannelByID(id)
+	if err != nil {
+		return nil, err
+	}
+	channel.RecipientIDs, err = db.GetDMRecipients(id)
+	return channel, err
+}
+
+// GetUserDMChannels returns the DM channels a user belongs to, with recipients
+func (db *DB) GetUserDMChannels(userID uuid.UUID) ([]*models.Channel, error) {
+	rows, err := db.Query(`
+		SELECT c.id, c.name, c.type, c.created_at, c.updated_at
+		FROM channels c
+		JOIN dm_recipients r ON r.channel_id = c.id
+		WHERE r.user_id = ?
+		ORDER BY c.created_at`, userID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channels []*models.Channel
+	for rows.Next() {
+		ch := &models.Channel{}
+		var idStr string
+		if err := rows.Scan(&idStr, &ch.Name, &ch.Type, &ch.CreatedAt, &ch.UpdatedAt); err != nil {
+			return nil, err
+		}
+		ch.ID, _ = uuid.Parse(idStr)
+		channels = append(channels, ch)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, ch := range channels {
+		if ch.RecipientIDs, err = db.GetDMRecipients(ch.ID); err != nil {
+			return nil, err
+		}
+	}
+	return channels, nil
+}
+
+// GetDMRecipients returns the user IDs that belong to a DM channel
+func (db *DB) GetDMRecipients(channelID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := db.Query(`SELECT user_id FROM dm_recipients WHERE channel_id = ?`, channelID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var idStr string
+		if err := rows.Scan(&idStr); err != nil {
+			return nil, err
+		}
+		id, _ := uuid.Parse(idStr)
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// AddUndeliveredMessage queues a DM for a recipient who is offline
+func (db *DB) AddUndeliveredMessage(messageID, userID uuid.UUID) error {
+	_, err := db.Exec(`INSERT INTO dm_undelivered (message_id, user_id) VALUES (?, ?) ON CONFLICT DO NOTHING`,
+		messageID.String(), userID.String())
+	return err
+}
+
+// TakeUndeliveredMessages returns a user's queued DMs in chronological order
+// and clears the queue.
+func (db *DB) TakeUndeliveredMessages(userID uuid.UUID) ([]*models.Message, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT m.id, m.channel_id, m.author_id, m.content, m.type, m.created_at, m.edited_at, m.is_pinned, m.reply_to_id
+		FROM messages m
+		JOIN dm_undelivered u ON u.message_id = m.id
+		WHERE u.user_id = ?
+		ORDER BY m.created_at`, userID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []*models.Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM dm_undelivered WHERE user_id = ?`, userID.String()); err != nil {
+		return nil, err
+	}
+	return messages, tx.Commit()
+}
+
 // --- Message Operations ---
 
 // CreateMessage inserts a new message
@@ -616,43 +859,336 @@ func (db *DB) CreateMessage(msg *models.Message) error {
 	if err != nil {
 		return err
 	}
-
-	// Insert mentions
-	for _, userID := range msg.Mentions {
-		_, err = db.Exec(`INSERT OR IGNORE INTO message_mentions (message_id, user_id) VALUES (?, ?)`,
-			msg.ID.String(), userID.String())
-		if err != nil {
-			return err
-		}
+
+	// Keep the reply count and activity time of threads current
+	_, err = db.Exec(`
+		UPDATE channels SET message_count = message_count + 1, last_message_at = ?
+		WHERE id = ? AND type = ?`,
+		msg.CreatedAt, msg.ChannelID.String(), models.ChannelTypeThread)
+	if err != nil {
+		return err
+	}
+
+	// Insert mentions
+	for _, userID := range msg.Mentions {
+		_, err = db.Exec(`INSERT INTO message_mentions (message_id, user_id) VALUES (?, ?) ON CONFLICT DO NOTHING`,
+			msg.ID.String(), userID.String())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetChannelMessages retrieves messages for a channel with pagination
+func (db *DB) GetChannelMessages(channelID uuid.UUID, limit int, before *uuid.UUID) ([]*models.Message, error) {
+	var query string
+	var args []interface{}
+
+	if before != nil {
+		query = `
+			SELECT id, channel_id, author_id, content, type, created_at, edited_at, is_pinned, reply_to_id
+			FROM messages
+			WHERE channel_id = ? AND (created_at, id) < (SELECT created_at, id FROM messages WHERE id = ?)
+			ORDER BY created_at DESC, id DESC
+			LIMIT ?`
+		args = []interface{}{channelID.String(), before.String(), limit}
+	} else {
+		query = `
+			SELECT id, channel_id, author_id, content, type, created_at, edited_at, is_pinned, reply_to_id
+			FROM messages
+			WHERE channel_id = ?
+			ORDER BY created_at DESC, id DESC
+			LIMIT ?`
+		args = []interface{}{channelID.String(), limit}
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*models.Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := db.loadReactions(messages); err != nil {
+		return nil, err
+	}
+
+	// The query fetches the most-recent N rows with DESC order (needed for
+	// correct LIMIT behaviour). Reverse to chronological order (oldest first)
+	// so the client can simply append new real-time messages to the end.
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	return messages, nil
+}
+
+// GetChannelMessagesAround retrieves up to limit messages centred on messageID,
+// in chronological order, so a message can be shown in context
+func (db *DB) GetChannelMessagesAround(channelID, messageID uuid.UUID, limit int) ([]*models.Message, error) {
+	var createdAt time.Time
+	err := db.QueryRow(`SELECT created_at FROM messages WHERE id = ? AND channel_id = ?`,
+		messageID.String(), channelID.String()).Scan(&createdAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("message not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	after := limit / 2
+	before := limit - after
+
+	// The target and the messages leading up to it, newest first
+	older, err := db.queryMessages(`
+		SELECT id, channel_id, author_id, content, type, created_at, edited_at, is_pinned, reply_to_id
+		FROM messages
+		WHERE channel_id = ? AND (created_at, id) <= (?, ?)
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?`, channelID.String(), createdAt, messageID.String(), before)
+	if err != nil {
+		return nil, err
+	}
+	newer, err := db.queryMessages(`
+		SELECT id, channel_id, author_id, content, type, created_at, edited_at, is_pinned, reply_to_id
+		FROM messages
+		WHERE channel_id = ? AND (created_at, id) > (?, ?)
+		ORDER BY created_at ASC, id ASC
+		LIMIT ?`, channelID.String(), createdAt, messageID.String(), after)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*models.Message, 0, len(older)+len(newer))
+	for i := len(older) - 1; i >= 0; i-- {
+		messages = append(messages, older[i])
+	}
+	messages = append(messages, newer...)
+
+	if err := db.loadReactions(messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// MessageSearch describes a full-text message search
+type MessageSearch struct {
+	ChannelIDs []uuid.UUID // Channels to search; required
+	Terms      []string    // Words that must all appear; empty to match on filters alone
+	AuthorID   *uuid.UUID
+	Before     *time.Time
+	After      *time.Time
+	HasLink    bool
+	Limit      int
+}
+
+// SearchMessages returns the messages matching search, newest first
+func (db *DB) SearchMessages(search MessageSearch) ([]*models.Message, error) {
+	if len(search.ChannelIDs) == 0 {
+		return nil, nil
+	}
+
+	query := `
+		SELECT m.id, m.channel_id, m.author_id, m.content, m.type, m.created_at, m.edited_at, m.is_pinned, m.reply_to_id
+		FROM messages m`
+	var conds []string
+	var args []interface{}
+
+	if len(search.Terms) > 0 {
+		if db.dialect == dialectPostgres {
+			conds = append(conds, "m.search @@ plainto_tsquery('simple', ?)")
+			args = append(args, strings.Join(search.Terms, " "))
+		} else {
+			query += ` JOIN messages_fts f ON f.rowid = m.rowid`
+			conds = append(conds, "messages_fts MATCH ?")
+			args = append(args, ftsMatch(search.Terms))
+		}
+	}
+
+	placeholders := make([]string, len(search.ChannelIDs))
+	for i, id := range search.ChannelIDs {
+		placeholders[i] = "?"
+		args = append(args, id.String())
+	}
+	conds = append(conds, "m.channel_id IN ("+strings.Join(placeholders, ", ")+")")
+
+	if search.AuthorID != nil {
+		conds = append(conds, "m.author_id = ?")
+		args = append(args, search.AuthorID.String())
+	}
+	if search.Before != nil {
+		conds = append(conds, "m.created_at < ?")
+		args = append(args, *search.Before)
+	}
+	if search.After != nil {
+		conds = append(conds, "m.created_at >= ?")
+		args = append(args, *search.After)
+	}
+	if search.HasLink {
+		conds = append(conds, "(m.content LIKE '%http://%' OR m.content LIKE '%https://%')")
+	}
+
+	query += " WHERE " + strings.Join(conds, " AND ") + " ORDER BY m.created_at DESC LIMIT ?"
+	args = append(args, search.Limit)
+
+	return db.queryMessages(query, args...)
+}
+
+// ftsMatch builds an FTS5 expression requiring every term, each quoted so
+// punctuation and FTS operators in user input are matched literally
+func ftsMatch(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(quoted, " ")
+}
+
+// queryMessages runs a query selecting the standard message columns
+func (db *DB) queryMessages(query string, args ...interface{}) ([]*models.Message, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*models.Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMessage scans a messages row selected with the standard column list:
+// id, channel_id, author_id, content, type, created_at, edited_at, is_pinned, reply_to_id
+func scanMessage(row rowScanner) (*models.Message, error) {
+	msg := &models.Message{}
+	var idStr, channelIDStr, authorIDStr string
+	var editedAt sql.NullTime
+	var replyToID sql.NullString
+
+	err := row.Scan(&idStr, &channelIDStr, &authorIDStr, &msg.Content,
+		&msg.Type, &msg.CreatedAt, &editedAt, &msg.IsPinned, &replyToID)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.ID, _ = uuid.Parse(idStr)
+	msg.ChannelID, _ = uuid.Parse(channelIDStr)
+	msg.AuthorID, _ = uuid.Parse(authorIDStr)
+	if editedAt.Valid {
+		msg.EditedAt = &editedAt.Time
+	}
+	if replyToID.Valid {
+		id, _ := uuid.Parse(replyToID.String)
+		msg.ReplyToID = &id
+	}
+	return msg, nil
+}
+
+// GetMessageByID retrieves a single message
+func (db *DB) GetMessageByID(id uuid.UUID) (*models.Message, error) {
+	row := db.QueryRow(`
+		SELECT id, channel_id, author_id, content, type, created_at, edited_at, is_pinned, reply_to_id
+		FROM messages WHERE id = ?`, id.String())
+	msg, err := scanMessage(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("message not found")
+	}
+	return msg, err
+}
+
+// SetMessagePinned sets the pinned state of a message
+func (db *DB) SetMessagePinned(id uuid.UUID, pinned bool) error {
+	_, err := db.Exec(`UPDATE messages SET is_pinned = ? WHERE id = ?`, pinned, id.String())
+	return err
+}
+
+// UpdateMessage persists edited message content and its edit timestamp
+func (db *DB) UpdateMessage(msg *models.Message) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE messages SET content = ?, edited_at = ? WHERE id = ?`,
+		msg.Content, msg.EditedAt, msg.ID.String())
+	if err != nil {
+		return err
+	}
+
+	// Mentions are derived from content, so replace them
+	if _, err = tx.Exec(`DELETE FROM message_mentions WHERE message_id = ?`, msg.ID.String()); err != nil {
+		return err
+	}
+	for _, userID := range msg.Mentions {
+		_, err = tx.Exec(`INSERT INTO message_mentions (message_id, user_id) VALUES (?, ?) ON CONFLICT DO NOTHING`,
+			msg.ID.String(), userID.String())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteMessage deletes a message; replies to it keep their content but lose the reference
+func (db *DB) DeleteMessage(id uuid.UUID) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(`UPDATE messages SET reply_to_id = NULL WHERE reply_to_id = ?`, id.String()); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE channels SET message_count = message_count - 1
+		WHERE id = (SELECT channel_id FROM messages WHERE id = ?) AND type = ? AND message_count > 0`,
+		id.String(), models.ChannelTypeThread)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`DELETE FROM messages WHERE id = ?`, id.String()); err != nil {
+		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
-// GetChannelMessages retrieves messages for a channel with pagination
-func (db *DB) GetChannelMessages(channelID uuid.UUID, limit int, before *uuid.UUID) ([]*models.Message, error) {
-	var query string
-	var args []interface{}
-
-	if before != nil {
-		query = `
-			SELECT id, channel_id, author_id, content, type, created_at, edited_at, is_pinned, reply_to_id
-			FROM messages
-			WHERE channel_id = ? AND created_at < (SELECT created_at FROM messages WHERE id = ?)
-			ORDER BY created_at DESC
-			LIMIT ?`
-		args = []interface{}{channelID.String(), before.String(), limit}
-	} else {
-		query = `
-			SELECT id, channel_id, author_id, content, type, created_at, edited_at, is_pinned, reply_to_id
-			FROM messages
-			WHERE channel_id = ?
-			ORDER BY created_at DESC
-			LIMIT ?`
-		args = []interface{}{channelID.String(), limit}
-	}
-
-	rows, err := db.Query(query, args...)
+// GetPinnedMessages returns all pinned messages in a channel, oldest first
+func (db *DB) GetPinnedMessages(channelID uuid.UUID) ([]*models.Message, error) {
+	rows, err := db.Query(`
+		SELECT id, channel_id, author_id, content, type, created_at, edited_at, is_pinned, reply_to_id
+		FROM messages
+		WHERE channel_id = ? AND is_pinned = TRUE
+		ORDER BY created_at ASC`, channelID.String())
 	if err != nil {
 		return nil, err
 	}
@@ -660,43 +1196,79 @@ func (db *DB) GetChannelMessages(channelID uuid.UUID, limit int, before *uuid.UU
 
 	var messages []*models.Message
 	for rows.Next() {
-		msg := &models.Message{}
-		var idStr, channelIDStr, authorIDStr string
-		var editedAt sql.NullTime
-		var replyToID sql.NullString
-
-		err := rows.Scan(&idStr, &channelIDStr, &authorIDStr, &msg.Content,
-			&msg.Type, &msg.CreatedAt, &editedAt, &msg.IsPinned, &replyToID)
+		msg, err := scanMessage(rows)
 		if err != nil {
 			return nil, err
 		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
 
-		msg.ID, _ = uuid.Parse(idStr)
-		msg.ChannelID, _ = uuid.Parse(channelIDStr)
-		msg.AuthorID, _ = uuid.Parse(authorIDStr)
-		if editedAt.Valid {
-			msg.EditedAt = &editedAt.Time
-		}
-		if replyToID.Valid {
-			id, _ := uuid.Parse(replyToID.String)
-			msg.ReplyToID = &id
-		}
+// --- Reaction Operations ---
 
-		messages = append(messages, msg)
+// AddReaction records a user's reaction. It returns false if the user had
+// already reacted with that emoji.
+func (db *DB) AddReaction(messageID, userID uuid.UUID, emoji string) (bool, error) {
+	result, err := db.Exec(`
+		INSERT INTO message_reactions (message_id, user_id, emoji, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT DO NOTHING`,
+		messageID.String(), userID.String(), emoji, time.Now())
+	if err != nil {
+		return false, err
 	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
+// RemoveReaction deletes a user's reaction. It returns false if there was none.
+func (db *DB) RemoveReaction(messageID, userID uuid.UUID, emoji string) (bool, error) {
+	result, err := db.Exec(`DELETE FROM message_reactions WHERE message_id = ? AND user_id = ? AND emoji = ?`,
+		messageID.String(), userID.String(), emoji)
+	if err != nil {
+		return false, err
 	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
 
-	// The query fetches the most-recent N rows with DESC order (needed for
-	// correct LIMIT behaviour). Reverse to chronological order (oldest first)
-	// so the client can simply append new real-time messages to the end.
-	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
-		messages[i], messages[j] = messages[j], messages[i]
+// loadReactions fills in the aggregated reactions of each message, ordered by
+// when each emoji was first used
+func (db *DB) loadReactions(messages []*models.Message) error {
+	if len(messages) == 0 {
+		return nil
 	}
 
-	return messages, nil
+	byID := make(map[string]*models.Message, len(messages))
+	placeholders := make([]string, len(messages))
+	args := make([]interface{}, len(messages))
+	for i, m := range messages {
+		byID[m.ID.String()] = m
+		placeholders[i] = "?"
+		args[i] = m.ID.String()
+	}
+
+	rows, err := db.Query(`
+		SELECT message_id, user_id, emoji FROM message_reactions
+		WHERE message_id IN (`+strings.Join(placeholders, ",")+`)
+		ORDER BY created_at`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageIDStr, userIDStr, emoji string
+		if err := rows.Scan(&messageIDStr, &userIDStr, &emoji); err != nil {
+			return err
+		}
+		userID, _ := uuid.Parse(userIDStr)
+		if m, ok := byID[messageIDStr]; ok {
+			m.AddReaction(emoji, userID)
+		}
+	}
+	return rows.Err()
 }
 
 // --- Member Operations ---
@@ -926,6 +1498,215 @@ func (db *DB) GetRoleByID(roleID uuid.UUID) (*models.Role, error) {
 	return &r, nil
 }
 
+// UpdateRole saves a role's name, color, permissions and display flags
+func (db *DB) UpdateRole(role *models.Role) error {
+	_, err := db.Exec(`
+		UPDATE roles SET name = ?, color = ?, permissions = ?, is_hoisted = ?,
+			is_mentionable = ?, updated_at = ?
+		WHERE id = ?`,
+		role.Name, role.Color, int64(role.Permissions), role.IsHoisted,
+		role.IsMentionable, role.UpdatedAt, role.ID.String())
+	return err
+}
+
+// DeleteRole deletes a role along with its member assignments and channel overwrites
+func (db *DB) DeleteRole(roleID uuid.UUID) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(`DELETE FROM member_roles WHERE role_id = ?`, roleID.String()); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`DELETE FROM permission_overwrites WHERE target_id = ?`, roleID.String()); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`DELETE FROM roles WHERE id = ?`, roleID.String()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MoveRole places a role at position among the server's non-default roles and
+// renumbers them 1..n (the default role stays at 0). Returns the roles whose
+// position changed.
+func (db *DB) MoveRole(serverID, roleID uuid.UUID, position int) ([]*models.Role, error) {
+	roles, err := db.GetServerRoles(serverID)
+	if err != nil {
+		return nil, err
+	}
+
+	// GetServerRoles is highest first; build the list lowest first without the moved role
+	var moved *models.Role
+	ordered := make([]*models.Role, 0, len(roles))
+	for i := len(roles) - 1; i >= 0; i-- {
+		switch {
+		case roles[i].IsDefault:
+		case roles[i].ID == roleID:
+			moved = roles[i]
+		default:
+			ordered = append(ordered, roles[i])
+		}
+	}
+	if moved == nil {
+		return nil, fmt.Errorf("role not found")
+	}
+
+	idx := position - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx > len(ordered) {
+		idx = len(ordered)
+	}
+	ordered = append(ordered[:idx], append([]*models.Role{moved}, ordered[idx:]...)...)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var changed []*models.Role
+	for i, r := range ordered {
+		if r.Position == i+1 {
+			continue
+		}
+		r.Position = i + 1
+		r.UpdatedAt = now
+		if _, err := tx.Exec(`UPDATE roles SET position = ?, updated_at = ? WHERE id = ?`,
+			r.Position, r.UpdatedAt, r.ID.String()); err != nil {
+			return nil, err
+		}
+		changed = append(changed, r)
+	}
+
+	return changed, tx.Commit()
+}
+
+// --- Invite Operations ---
+
+// CreateInvite stores a new invite
+func (db *DB) CreateInvite(invite *models.Invite) error {
+	var channelID sql.NullString
+	if invite.ChannelID != uuid.Nil {
+		channelID.String = invite.ChannelID.String()
+		channelID.Valid = true
+	}
+	var expiresAt sql.NullTime
+	if invite.ExpiresAt != nil {
+		expiresAt.Time = *invite.ExpiresAt
+		expiresAt.Valid = true
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO invites (code, server_id, channel_id, inviter_id, max_age, max_uses, uses, created_at, expires_at, is_revoked)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		invite.Code, invite.ServerID.String(), channelID, invite.InviterID.String(),
+		invite.MaxAge, invite.MaxUses, invite.Uses, invite.CreatedAt, expiresAt, invite.IsRevoked)
+	return err
+}
+
+// scanInvite scans an invites row selected with the standard column list
+func scanInvite(row rowScanner) (*models.Invite, error) {
+	invite := &models.Invite{}
+	var serverIDStr, inviterIDStr string
+	var channelID sql.NullString
+	var expiresAt sql.NullTime
+
+	err := row.Scan(&invite.Code, &serverIDStr, &channelID, &inviterIDStr,
+		&invite.MaxAge, &invite.MaxUses, &invite.Uses, &invite.CreatedAt, &expiresAt, &invite.IsRevoked)
+	if err != nil {
+		return nil, err
+	}
+
+	invite.ServerID, _ = uuid.Parse(serverIDStr)
+	invite.InviterID, _ = uuid.Parse(inviterIDStr)
+	if channelID.Valid {
+		invite.ChannelID, _ = uuid.Parse(channelID.String)
+	}
+	if expiresAt.Valid {
+		invite.ExpiresAt = &expiresAt.Time
+	}
+	return invite, nil
+}
+
+// GetInvite retrieves an invite by code
+func (db *DB) GetInvite(code string) (*models.Invite, error) {
+	row := db.QueryRow(`
+		SELECT code, server_id, channel_id, inviter_id, max_age, max_uses, uses, created_at, expires_at, is_revoked
+		FROM invites WHERE code = ?`, code)
+	invite, err := scanInvite(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("invite not found")
+	}
+	return invite, err
+}
+
+// GetServerInvites returns all non-revoked invites for a server, newest first
+func (db *DB) GetServerInvites(serverID uuid.UUID) ([]*models.Invite, error) {
+	rows, err := db.Query(`
+		SELECT code, server_id, channel_id, inviter_id, max_age, max_uses, uses, created_at, expires_at, is_revoked
+		FROM invites
+		WHERE server_id = ? AND is_revoked = FALSE
+		ORDER BY created_at DESC`, serverID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invites []*models.Invite
+	for rows.Next() {
+		invite, err := scanInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, invite)
+	}
+	return invites, rows.Err()
+}
+
+// RevokeInvite marks an invite as revoked
+func (db *DB) RevokeInvite(code string) error {
+	_, err := db.Exec(`UPDATE invites SET is_revoked = TRUE WHERE code = ?`, code)
+	return err
+}
+
+// UseInvite consumes one use of an invite and adds member to its server in
+// one transaction. It returns false, adding no one, if the invite was revoked
+// or its use limit was reached in the meantime.
+func (db *DB) UseInvite(code string, member *models.ServerMember) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE invites SET uses = uses + 1
+		WHERE code = ? AND is_revoked = FALSE AND (max_uses = 0 OR uses < max_uses)`, code)
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO server_members (user_id, server_id, nickname, joined_at, is_muted, is_deafened)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		member.UserID.String(), member.ServerID.String(), member.Nickname,
+		member.JoinedAt, member.IsMuted, member.IsDeafened)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
 // --- Session Operations ---
 
 // CreateSession creates a new authentication session
@@ -941,24 +1722,65 @@ func (db *DB) CreateSession(userID uuid.UUID, tokenHash, ipAddress, userAgent st
 	return sessionID, nil
 }
 
-// GetSessionByToken retrieves a session by token hash
-func (db *DB) GetSessionByToken(tokenHash string) (uuid.UUID, error) {
-	var userIDStr string
-	var expiresAt time.Time
-
-	err := db.QueryRow(`
-		SELECT user_id, expires_at FROM sessions 
+// GetSessionByToken retrieves the unexpired session for a token hash
+func (db *DB) GetSessionByToken(tokenHash string) (*models.Session, error) {
+	row := db.QueryRow(`
+		SELECT id, user_id, created_at, expires_at, last_used_at, ip_address, user_agent
+		FROM sessions
 		WHERE token_hash = ? AND expires_at > ?`,
-		tokenHash, time.Now()).Scan(&userIDStr, &expiresAt)
+		tokenHash, time.Now())
+	return scanSession(row)
+}
+
+// TouchSession records a use of a session and slides its expiry to expiresAt
+func (db *DB) TouchSession(sessionID uuid.UUID, expiresAt time.Time) error {
+	_, err := db.Exec(`UPDATE sessions SET last_used_at = ?, expires_at = ? WHERE id = ?`,
+		time.Now(), expiresAt, sessionID.String())
+	return err
+}
+
+// GetUserSessions lists a user's unexpired sessions, most recently used first
+func (db *DB) GetUserSessions(userID uuid.UUID) ([]*models.Session, error) {
+	rows, err := db.Query(`
+		SELECT id, user_id, created_at, expires_at, last_used_at, ip_address, user_agent
+		FROM sessions
+		WHERE user_id = ? AND expires_at > ?
+		ORDER BY COALESCE(last_used_at, created_at) DESC`,
+		userID.String(), time.Now())
 	if err != nil {
-		return uuid.Nil, err
+		return nil, err
 	}
+	defer rows.Close()
 
-	// Update last used
-	db.Exec(`UPDATE sessions SET last_used_at = ? WHERE token_hash = ?`, time.Now(), tokenHash)
+	var sessions []*models.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
 
-	userID, _ := uuid.Parse(userIDStr)
-	return userID, nil
+// scanSession reads a session row selected as in GetUserSessions
+func scanSession(row rowScanner) (*models.Session, error) {
+	var idStr, userIDStr string
+	var lastUsedAt sql.NullTime
+	var ipAddress, userAgent sql.NullString
+	session := &models.Session{}
+	if err := row.Scan(&idStr, &userIDStr, &session.CreatedAt, &session.ExpiresAt,
+		&lastUsedAt, &ipAddress, &userAgent); err != nil {
+		return nil, err
+	}
+	session.ID, _ = uuid.Parse(idStr)
+	session.UserID, _ = uuid.Parse(userIDStr)
+	if lastUsedAt.Valid {
+		session.LastUsedAt = &lastUsedAt.Time
+	}
+	session.IPAddress = ipAddress.String
+	session.UserAgent = userAgent.String
+	return session, nil
 }
 
 // DeleteSession removes a session
@@ -967,6 +1789,17 @@ func (db *DB) DeleteSession(tokenHash string) error {
 	return err
 }
 
+// DeleteUserSession removes one of a user's sessions, reporting whether it existed
+func (db *DB) DeleteUserSession(userID, sessionID uuid.UUID) (bool, error) {
+	result, err := db.Exec(`DELETE FROM sessions WHERE id = ? AND user_id = ?`,
+		sessionID.String(), userID.String())
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
 // DeleteUserSessions removes all sessions for a user
 func (db *DB) DeleteUserSessions(userID uuid.UUID) error {
 	_, err := db.Exec(`DELETE FROM sessions WHERE user_id = ?`, userID.String())
@@ -1139,14 +1972,85 @@ func (db *DB) IsBanned(serverID, userID uuid.UUID) (bool, error) {
 	return count > 0, err
 }
 
+// RemoveBan lifts a ban for a user on a server.
+func (db *DB) RemoveBan(serverID, userID uuid.UUID) error {
+	_, err := db.Exec(`DELETE FROM bans WHERE server_id = ? AND user_id = ?`,
+		serverID.String(), userID.String())
+	return err
+}
+
+// GetBannedUserByUsername finds a banned user on a server by username (case-insensitive).
+func (db *DB) GetBannedUserByUsername(serverID uuid.UUID, username string) (*models.User, error) {
+	var idStr string
+	err := db.QueryRow(`
+		SELECT u.id FROM users u
+		JOIN bans b ON b.user_id = u.id
+		WHERE b.server_id = ? AND LOWER(u.username) = LOWER(?)`,
+		serverID.String(), username).Scan(&idStr)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no banned user named %q", username)
+	}
+	if err != nil {
+		return nil, err
+	}
+	id, _ := uuid.Parse(idStr)
+	return db.GetUserByID(id)
+}
+
+// AddTimeout records a moderation action that lifts automatically at expiresAt.
+// The expiry is stored in UTC so GetExpiredTimeouts can compare it in SQL.
+func (db *DB) AddTimeout(t *models.MemberTimeout) error {
+	_, err := db.Exec(`
+		INSERT INTO member_timeouts (server_id, user_id, kind, reason, issued_by, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(server_id, user_id, kind) DO UPDATE SET reason=excluded.reason, issued_by=excluded.issued_by,
+			created_at=excluded.created_at, expires_at=excluded.expires_at`,
+		t.ServerID.String(), t.UserID.String(), string(t.Kind), t.Reason, t.IssuedBy.String(),
+		t.CreatedAt, t.ExpiresAt.UTC())
+	return err
+}
+
+// RemoveTimeout deletes a timed entry, e.g. when a mute or ban is lifted by hand.
+func (db *DB) RemoveTimeout(serverID, userID uuid.UUID, kind models.TimeoutKind) error {
+	_, err := db.Exec(`DELETE FROM member_timeouts WHERE server_id = ? AND user_id = ? AND kind = ?`,
+		serverID.String(), userID.String(), string(kind))
+	return err
+}
+
+// GetExpiredTimeouts returns all timed entries whose expiry has passed.
+func (db *DB) GetExpiredTimeouts() ([]*models.MemberTimeout, error) {
+	rows, err := db.Query(`
+		SELECT server_id, user_id, kind, reason, issued_by, created_at, expires_at
+		FROM member_timeouts
+		WHERE expires_at <= ?`, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expired []*models.MemberTimeout
+	for rows.Next() {
+		t := &models.MemberTimeout{}
+		var serverIDStr, userIDStr, kind, issuedByStr string
+		var reason sql.NullString
+		if err := rows.Scan(&serverIDStr, &userIDStr, &kind, &reason, &issuedByStr,
+			&t.CreatedAt, &t.ExpiresAt); err != nil {
+			return nil, err
+		}
+		t.ServerID, _ = uuid.Parse(serverIDStr)
+		t.UserID, _ = uuid.Parse(userIDStr)
+		t.IssuedBy, _ = uuid.Parse(issuedByStr)
+		t.Kind = models.TimeoutKind(kind)
+		t.Reason = reason.String
+		expired = append(expired, t)
+	}
+	return expired, rows.Err()
+}
+
 // SetMemberMuted sets the server-mute state for a member.
 func (db *DB) SetMemberMuted(serverID, userID uuid.UUID, muted bool) error {
-	val := 0
-	if muted {
-		val = 1
-	}
 	_, err := db.Exec(`UPDATE server_members SET is_muted = ? WHERE server_id = ? AND user_id = ?`,
-		val, serverID.String(), userID.String())
+		muted, serverID.String(), userID.String())
 	return err
 }
 
@@ -1220,3 +2124,93 @@ func (db *DB) EnsureAdminRole(email string) error {
 	// Make them the server owner
 	return db.UpdateServerOwner(server.ID, user.ID)
 }
+
+// --- Audit Log ---
+
+// AuditLogFilter narrows an audit log query; empty fields match everything
+type AuditLogFilter struct {
+	Action  string     // Action prefix, e.g. "channel" or "member_ban"
+	ActorID *uuid.UUID // Only actions by this user
+	Target  string     // Case-insensitive substring of the target name
+}
+
+// AddAuditLogEntry records a moderation or administrative action
+func (db *DB) AddAuditLogEntry(entry *models.AuditLogEntry) error {
+	var before, after sql.NullString
+	if len(entry.Before) > 0 {
+		before = sql.NullString{String: string(entry.Before), Valid: true}
+	}
+	if len(entry.After) > 0 {
+		after = sql.NullString{String: string(entry.After), Valid: true}
+	}
+	_, err := db.Exec(`
+		INSERT INTO audit_log (id, server_id, actor_id, action, target_type, target_id,
+			target_name, reason, before_json, after_json, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.ID.String(), entry.ServerID.String(), entry.ActorID.String(), string(entry.Action),
+		entry.TargetType, entry.TargetID, entry.TargetName, entry.Reason, before, after, entry.CreatedAt)
+	return err
+}
+
+// GetAuditLog returns a server's audit log entries, newest first. Pass the ID
+// of the oldest entry already seen as before to fetch the next page.
+func (db *DB) GetAuditLog(serverID uuid.UUID, filter AuditLogFilter, limit int, before *uuid.UUID) ([]*models.AuditLogEntry, error) {
+	conditions := []string{"server_id = ?"}
+	args := []interface{}{serverID.String()}
+
+	if filter.Action != "" {
+		conditions = append(conditions, "action LIKE ?")
+		args = append(args, filter.Action+"%")
+	}
+	if filter.ActorID != nil {
+		conditions = append(conditions, "actor_id = ?")
+		args = append(args, filter.ActorID.String())
+	}
+	if filter.Target != "" {
+		conditions = append(conditions, "LOWER(target_name) LIKE ?")
+		args = append(args, "%"+strings.ToLower(filter.Target)+"%")
+	}
+	if before != nil {
+		// Entries can share a timestamp, so page on (created_at, id)
+		conditions = append(conditions, "(created_at, id) < (SELECT created_at, id FROM audit_log WHERE id = ?)")
+		args = append(args, before.String())
+	}
+	args = append(args, limit)
+
+	rows, err := db.Query(`
+		SELECT id, server_id, actor_id, action, target_type, target_id,
+			target_name, reason, before_json, after_json, created_at
+		FROM audit_log
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.AuditLogEntry
+	for rows.Next() {
+		e := &models.AuditLogEntry{}
+		var idStr, serverIDStr, actorIDStr, action string
+		var targetName, reason, before, after sql.NullString
+		if err := rows.Scan(&idStr, &serverIDStr, &actorIDStr, &action, &e.TargetType, &e.TargetID,
+			&targetName, &reason, &before, &after, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.ID, _ = uuid.Parse(idStr)
+		e.ServerID, _ = uuid.Parse(serverIDStr)
+		e.ActorID, _ = uuid.Parse(actorIDStr)
+		e.Action = models.AuditAction(action)
+		e.TargetName = targetName.String
+		e.Reason = reason.String
+		if before.Valid {
+			e.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			e.After = json.RawMessage(after.String)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/concord-chat/concord/internal/models"
+)
+
+// Store is the persistence layer the server depends on. *DB implements it
+// for both SQLite and PostgreSQL; see Open.
+type Store interface {
+	// Users
+	CreateUser(user *models.User, passwordHash string) error
+	GetUserByID(id uuid.UUID) (*models.User, error)
+	GetUserByEmail(email string) (*models.User, string, error)
+	GetUserByUsername(serverID uuid.UUID, username string) (*models.User, error)
+	GetUsersByIDs(ids []uuid.UUID) ([]*models.User, error)
+	UpdateUserStatus(userID uuid.UUID, status models.UserStatus, statusText string) error
+	CountRealUsers() (int, error)
+
+	// Servers
+	GetServerByID(id uuid.UUID) (*models.Server, error)
+	GetUserServers(userID uuid.UUID) ([]*models.Server, error)
+	CreateServerWithDefaults(server *models.Server) (*models.Role, *models.Channel, error)
+	DeleteServer(serverID uuid.UUID) error
+	UpdateServerOwner(serverID, ownerID uuid.UUID) error
+	EnsureDefaultServer() (*models.Server, *models.Role, error)
+	EnsureAdminRole(email string) error
+
+	// Channels
+	CreateChannel(channel *models.Channel) error
+	GetChannelByID(channelID uuid.UUID) (*models.Channel, error)
+	GetServerChannels(serverID uuid.UUID) ([]*models.Channel, error)
+	UpdateChannel(channel *models.Channel) error
+	DeleteChannel(channelID uuid.UUID) error
+	SetChannelOverwrite(channelID uuid.UUID, ow models.PermissionOverwrite) error
+	DeleteChannelOverwrite(channelID, targetID uuid.UUID) error
+
+	// Threads
+	GetChannelThreads(parentID uuid.UUID) ([]*models.Channel, error)
+	GetMessageThread(messageID uuid.UUID) (*models.Channel, error)
+	GetOpenThreads() ([]*models.Channel, error)
+	SetThreadArchived(threadID uuid.UUID, archived bool) error
+
+	// Direct messages
+	CreateDMChannel(channel *models.Channel) error
+	GetDMChannelBetween(userA, userB uuid.UUID) (*models.Channel, error)
+	GetDMRecipients(channelID uuid.UUID) ([]uuid.UUID, error)
+	GetUserDMChannels(userID uuid.UUID) ([]*models.Channel, error)
+	AddUndeliveredMessage(messageID, userID uuid.UUID) error
+	TakeUndeliveredMessages(userID uuid.UUID) ([]*models.Message, error)
+
+	// Messages
+	CreateMessage(msg *models.Message) error
+	GetMessageByID(id uuid.UUID) (*models.Message, error)
+	GetChannelMessages(channelID uuid.UUID, limit int, before *uuid.UUID) ([]*models.Message, error)
+	GetChannelMessagesAround(channelID, messageID uuid.UUID, limit int) ([]*models.Message, error)
+	SearchMessages(search MessageSearch) ([]*models.Message, error)
+	UpdateMessage(msg *models.Message) error
+	DeleteMessage(id uuid.UUID) error
+	SetMessagePinned(id uuid.UUID, pinned bool) error
+	GetPinnedMessages(channelID uuid.UUID) ([]*models.Message, error)
+	AddReaction(messageID, userID uuid.UUID, emoji string) (bool, error)
+	RemoveReaction(messageID, userID uuid.UUID, emoji string) (bool, error)
+
+	// Members
+	AddServerMember(member *models.ServerMember) error
+	RemoveServerMember(userID, serverID uuid.UUID) error
+	GetServerMember(serverID, userID uuid.UUID) (*models.ServerMember, error)
+	GetServerMembers(serverID uuid.UUID) ([]*models.ServerMember, error)
+	SetMemberMuted(serverID, userID uuid.UUID, muted bool) error
+
+	// Roles
+	CreateRole(role *models.Role) error
+	GetRoleByID(roleID uuid.UUID) (*models.Role, error)
+	GetRoleByName(serverID uuid.UUID, name string) (*models.Role, error)
+	GetServerRoles(serverID uuid.UUID) ([]*models.Role, error)
+	GetMemberRoles(serverID, userID uuid.UUID) ([]*models.Role, error)
+	UpdateRole(role *models.Role) error
+	MoveRole(serverID, roleID uuid.UUID, position int) ([]*models.Role, error)
+	DeleteRole(roleID uuid.UUID) error
+	AddMemberRole(userID, serverID, roleID uuid.UUID) error
+	RemoveMemberRole(userID, serverID, roleID uuid.UUID) error
+
+	// Invites
+	CreateInvite(invite *models.Invite) error
+	GetInvite(code string) (*models.Invite, error)
+	GetServerInvites(serverID uuid.UUID) ([]*models.Invite, error)
+	UseInvite(code string, member *models.ServerMember) (bool, error)
+	RevokeInvite(code string) error
+
+	// Sessions
+	CreateSession(userID uuid.UUID, tokenHash, ipAddress, userAgent string, expiresAt time.Time) (string, error)
+	GetSessionByToken(tokenHash string) (*models.Session, error)
+	TouchSession(sessionID uuid.UUID, expiresAt time.Time) error
+	GetUserSessions(userID uuid.UUID) ([]*models.Session, error)
+	DeleteSession(tokenHash string) error
+	DeleteUserSession(userID, sessionID uuid.UUID) (bool, error)
+	DeleteUserSessions(userID uuid.UUID) error
+
+	// Moderation
+	AddBan(serverID, userID, bannedByID uuid.UUID, reason string) error
+	RemoveBan(serverID, userID uuid.UUID) error
+	IsBanned(serverID, userID uuid.UUID) (bool, error)
+	GetBannedUserByUsername(serverID uuid.UUID, username string) (*models.User, error)
+	AddTimeout(t *models.MemberTimeout) error
+	RemoveTimeout(serverID, userID uuid.UUID, kind models.TimeoutKind) error
+	GetExpiredTimeouts() ([]*models.MemberTimeout, error)
+
+	// Audit log
+	AddAuditLogEntry(entry *models.AuditLogEntry) error
+	GetAuditLog(serverID uuid.UUID, filter AuditLogFilter, limit int, before *uuid.UUID) ([]*models.AuditLogEntry, error)
+
+	// Maintenance
+	Backup(path string) error
+	Close() error
+}
+
+var _ Store = (*DB)(nil)
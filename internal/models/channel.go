@@ -15,6 +15,14 @@ const (
 	ChannelTypeCategory                    // Channel category/folder
 	ChannelTypeDM                          // Direct message
 	ChannelTypeGroupDM                     // Group direct message
+	ChannelTypeThread                      // Thread spawned from a message
+)
+
+// Auto-archive bounds for threads, in minutes
+const (
+	DefaultThreadAutoArchive = 24 * 60
+	MinThreadAutoArchive     = 60
+	MaxThreadAutoArchive     = 7 * 24 * 60
 )
 
 // Channel represents a communication channel within a server
@@ -36,6 +44,20 @@ type Channel struct {
 	
 	// For DM channels
 	RecipientIDs []uuid.UUID `json:"recipient_ids,omitempty"`
+
+	// For threads: the text channel and message the thread hangs off
+	ParentID        uuid.UUID       `json:"parent_id,omitempty"`
+	ParentMessageID uuid.UUID       `json:"parent_message_id,omitempty"`
+	Thread          *ThreadMetadata `json:"thread,omitempty"`
+}
+
+// ThreadMetadata holds the state that only threads have
+type ThreadMetadata struct {
+	OwnerID            uuid.UUID `json:"owner_id"`
+	Archived           bool      `json:"archived"`
+	AutoArchiveMinutes int       `json:"auto_archive_minutes"` // Inactivity before the thread archives itself
+	MessageCount       int       `json:"message_count"`
+	LastMessageAt      time.Time `json:"last_message_at,omitempty"`
 }
 
 // PermissionOverwrite allows/denies specific permissions for a role or user
@@ -101,9 +123,43 @@ func NewDMChannel(userIDs ...uuid.UUID) *Channel {
 	}
 }
 
+// NewThread creates a thread in parent anchored to the message with messageID
+func NewThread(parent *Channel, messageID, ownerID uuid.UUID, name string, autoArchiveMinutes int) *Channel {
+	now := time.Now()
+	return &Channel{
+		ID:              uuid.New(),
+		ServerID:        parent.ServerID,
+		Name:            name,
+		Type:            ChannelTypeThread,
+		ParentID:        parent.ID,
+		ParentMessageID: messageID,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		Thread: &ThreadMetadata{
+			OwnerID:            ownerID,
+			AutoArchiveMinutes: autoArchiveMinutes,
+			LastMessageAt:      now,
+		},
+	}
+}
+
 // IsTextBased returns true if the channel supports text messages
 func (c *Channel) IsTextBased() bool {
-	return c.Type == ChannelTypeText || c.Type == ChannelTypeDM || c.Type == ChannelTypeGroupDM
+	return c.Type == ChannelTypeText || c.Type == ChannelTypeDM || c.Type == ChannelTypeGroupDM || c.Type == ChannelTypeThread
+}
+
+// IsThread returns true if this channel is a thread under a text channel
+func (c *Channel) IsThread() bool {
+	return c.Type == ChannelTypeThread
+}
+
+// ArchiveDue reports whether an open thread has been idle past its
+// auto-archive window at now
+func (c *Channel) ArchiveDue(now time.Time) bool {
+	if c.Thread == nil || c.Thread.Archived || c.Thread.AutoArchiveMinutes <= 0 {
+		return false
+	}
+	return now.Sub(c.Thread.LastMessageAt) >= time.Duration(c.Thread.AutoArchiveMinutes)*time.Minute
 }
 
 // IsVoiceBased returns true if the channel supports voice
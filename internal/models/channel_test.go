@@ -0,0 +1,46 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestChannelArchiveDue(t *testing.T) {
+	parent := NewTextChannel(uuid.New(), "general")
+	thread := NewThread(parent, uuid.New(), uuid.New(), "side", MinThreadAutoArchive)
+	last := thread.Thread.LastMessageAt
+	window := time.Duration(MinThreadAutoArchive) * time.Minute
+
+	tests := []struct {
+		name  string
+		setup func(c *Channel)
+		now   time.Time
+		want  bool
+	}{
+		{"just active", nil, last, false},
+		{"inside the window", nil, last.Add(window - time.Second), false},
+		{"at the window", nil, last.Add(window), true},
+		{"past the window", nil, last.Add(24 * time.Hour), true},
+		{"already archived", func(c *Channel) { c.Thread.Archived = true }, last.Add(24 * time.Hour), false},
+		{"no auto-archive", func(c *Channel) { c.Thread.AutoArchiveMinutes = 0 }, last.Add(24 * time.Hour), false},
+		{"recent reply", func(c *Channel) { c.Thread.LastMessageAt = last.Add(23*time.Hour + 30*time.Minute) }, last.Add(24 * time.Hour), false},
+	}
+	for _, tt := range tests {
+		c := *thread
+		meta := *thread.Thread
+		c.Thread = &meta
+		if tt.setup != nil {
+			tt.setup(&c)
+		}
+		if got := c.ArchiveDue(tt.now); got != tt.want {
+			t.Errorf("%s: ArchiveDue = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Channels that aren't threads never archive
+	if parent.ArchiveDue(last.Add(365 * 24 * time.Hour)) {
+		t.Error("text channel is due for archiving")
+	}
+}
@@ -53,7 +53,9 @@ const (
 		PermissionReadMessageHistory |
 		PermissionAddReactions |
 		PermissionEmbedLinks |
-		PermissionAttachFiles
+		PermissionAttachFiles |
+		PermissionCreateThreads |
+		PermissionSendMessagesThreads
 
 	PermissionsVoice = PermissionConnect |
 		PermissionSpeak |
@@ -116,6 +118,8 @@ func NewEveryoneRole(serverID uuid.UUID) *Role {
 			PermissionSendMessages |
 			PermissionReadMessageHistory |
 			PermissionAddReactions |
+			PermissionCreateThreads |
+			PermissionSendMessagesThreads |
 			PermissionManageChannels,
 		Position:    0,
 		IsHoisted:   false,
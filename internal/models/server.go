@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -174,3 +175,54 @@ func (s *Server) Update(name, description string) {
 	}
 	s.UpdatedAt = time.Now()
 }
+
+// AuditAction identifies a moderation or administrative action in the audit log
+type AuditAction string
+
+const (
+	AuditChannelCreate   AuditAction = "channel_create"
+	AuditChannelUpdate   AuditAction = "channel_update"
+	AuditChannelDelete   AuditAction = "channel_delete"
+	AuditOverwriteSet    AuditAction = "overwrite_set"
+	AuditOverwriteDelete AuditAction = "overwrite_delete"
+	AuditRoleCreate      AuditAction = "role_create"
+	AuditRoleUpdate      AuditAction = "role_update"
+	AuditRoleDelete      AuditAction = "role_delete"
+	AuditRoleAssign      AuditAction = "role_assign"
+	AuditRoleRemove      AuditAction = "role_remove"
+	AuditMemberKick      AuditAction = "member_kick"
+	AuditMemberBan       AuditAction = "member_ban"
+	AuditMemberUnban     AuditAction = "member_unban"
+	AuditMemberMute      AuditAction = "member_mute"
+	AuditMemberUnmute    AuditAction = "member_unmute"
+	AuditMemberTimeout   AuditAction = "member_timeout"
+	AuditMemberLeave     AuditAction = "member_leave"
+	AuditMessageEdit     AuditAction = "message_edit"
+	AuditMessageDelete   AuditAction = "message_delete"
+	AuditMessagePin      AuditAction = "message_pin"
+	AuditMessageUnpin    AuditAction = "message_unpin"
+	AuditThreadCreate    AuditAction = "thread_create"
+	AuditThreadArchive   AuditAction = "thread_archive"
+	AuditThreadUnarchive AuditAction = "thread_unarchive"
+	AuditInviteCreate    AuditAction = "invite_create"
+	AuditInviteRevoke    AuditAction = "invite_revoke"
+	AuditServerCreate    AuditAction = "server_create"
+	AuditServerBackup    AuditAction = "server_backup"
+	AuditServerTransfer  AuditAction = "server_transfer"
+)
+
+// AuditLogEntry records who did what to which target on a server. Before and
+// After hold JSON snapshots of the target where the action changed it.
+type AuditLogEntry struct {
+	ID         uuid.UUID       `json:"id"`
+	ServerID   uuid.UUID       `json:"server_id"`
+	ActorID    uuid.UUID       `json:"actor_id"`
+	Action     AuditAction     `json:"action"`
+	TargetType string          `json:"target_type"`           // "channel", "role", "member", "message", "invite" or "server"
+	TargetID   string          `json:"target_id"`             // UUID, or invite code
+	TargetName string          `json:"target_name,omitempty"` // Name at the time of the action
+	Reason     string          `json:"reason,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
@@ -131,3 +131,39 @@ func (m *ServerMember) RemoveRole(roleID uuid.UUID) {
 		}
 	}
 }
+
+// TimeoutKind identifies which moderation action a timed entry lifts on expiry
+type TimeoutKind string
+
+const (
+	TimeoutKindBan  TimeoutKind = "ban"  // Temporary ban (/timeout)
+	TimeoutKindMute TimeoutKind = "mute" // Timed server-mute (/mute @user <minutes>)
+)
+
+// MemberTimeout is a moderation action that expires automatically
+type MemberTimeout struct {
+	ServerID  uuid.UUID   `json:"server_id"`
+	UserID    uuid.UUID   `json:"user_id"`
+	Kind      TimeoutKind `json:"kind"`
+	Reason    string      `json:"reason,omitempty"`
+	IssuedBy  uuid.UUID   `json:"issued_by"`
+	CreatedAt time.Time   `json:"created_at"`
+	ExpiresAt time.Time   `json:"expires_at"`
+}
+
+// IsExpired checks if the timeout has elapsed
+func (t *MemberTimeout) IsExpired() bool {
+	return time.Now().After(t.ExpiresAt)
+}
+
+// Session is a login session: one issued auth token, typically one device
+type Session struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	IPAddress  string     `json:"ip_address,omitempty"`
+	UserAgent  string     `json:"user_agent,omitempty"`
+	Current    bool       `json:"current"` // The session of the connection that asked
+}
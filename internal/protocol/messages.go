@@ -30,6 +30,36 @@ const (
 	OpBanMember        OpCode = 20 // Ban a member from the server
 	OpMuteMember       OpCode = 21 // Server-mute a member
 	OpWhisper          OpCode = 22 // Send an ephemeral DM to another connected user
+	OpUnbanMember      OpCode = 23 // Lift a ban from a user
+	OpTimeoutMember    OpCode = 24 // Temporarily ban a member
+	OpPinMessage       OpCode = 25 // Pin a message in a channel
+	OpUnpinMessage     OpCode = 26 // Unpin a message in a channel
+	OpInviteCreate     OpCode = 27 // Create an invite code
+	OpInviteList       OpCode = 28 // List a server's active invites
+	OpInviteRevoke     OpCode = 29 // Revoke an invite code
+	OpResume           OpCode = 30 // Resume a dropped session
+	OpDMOpen           OpCode = 31 // Open (or reuse) a DM channel with a user
+	OpMessageEdit      OpCode = 32 // Edit a message
+	OpMessageDelete    OpCode = 33 // Delete a message
+	OpReactionAdd      OpCode = 34 // Add a reaction to a message
+	OpReactionRemove   OpCode = 35 // Remove own reaction from a message
+	OpOverwriteSet     OpCode = 36 // Set a channel permission overwrite
+	OpOverwriteDelete  OpCode = 37 // Clear a channel permission overwrite
+	OpRoleCreate       OpCode = 38 // Create a custom role
+	OpRoleUpdate       OpCode = 39 // Edit or reorder a role
+	OpRoleDelete       OpCode = 40 // Delete a custom role
+	OpAuditLog         OpCode = 41 // Request a page of the server audit log
+	OpSearch           OpCode = 42 // Full-text search of a server's messages
+	OpBackup           OpCode = 43 // Write a database backup on the host (Administrator)
+	OpSessionList      OpCode = 44 // List the caller's login sessions
+	OpSessionRevoke    OpCode = 45 // Revoke login sessions (or log out)
+	OpServerCreate     OpCode = 46 // Create a server owned by the caller
+	OpServerLeave      OpCode = 47 // Leave a server
+	OpServerDelete     OpCode = 48 // Delete a server (owner only)
+	OpServerTransfer   OpCode = 49 // Transfer server ownership (owner only)
+	OpThreadCreate     OpCode = 50 // Start a thread from a message
+	OpThreadArchive    OpCode = 51 // Archive or reopen a thread
+	OpFetchMessages    OpCode = 52 // Fetch specific messages by ID (reply previews)
 
 	// Server -> Client operations
 	OpDispatch       OpCode = 10 // Event dispatch (most messages)
@@ -60,6 +90,10 @@ const (
 	EventChannelCreate    EventType = "CHANNEL_CREATE"
 	EventChannelUpdate    EventType = "CHANNEL_UPDATE"
 	EventChannelDelete    EventType = "CHANNEL_DELETE"
+
+	// Thread events
+	EventThreadCreate     EventType = "THREAD_CREATE"
+	EventThreadUpdate     EventType = "THREAD_UPDATE"
 	
 	// Message events
 	EventMessageCreate    EventType = "MESSAGE_CREATE"
@@ -68,6 +102,9 @@ const (
 	EventMessageReactionAdd EventType = "MESSAGE_REACTION_ADD"
 	EventMessageReactionRemove EventType = "MESSAGE_REACTION_REMOVE"
 	EventMessagesHistory  EventType = "MESSAGES_HISTORY"
+	EventMessagesFetched  EventType = "MESSAGES_FETCHED"
+	EventMessagePin       EventType = "MESSAGE_PIN"
+	EventMessageUnpin     EventType = "MESSAGE_UNPIN"
 
 	// User events
 	EventPresenceUpdate   EventType = "PRESENCE_UPDATE"
@@ -77,6 +114,29 @@ const (
 	// Whisper events
 	EventWhisperCreate    EventType = "WHISPER_CREATE"
 
+	// Direct message events
+	EventDMChannelOpen    EventType = "DM_CHANNEL_OPEN"
+
+	// System events
+	EventSystemMessage    EventType = "SYSTEM_MESSAGE"
+
+	// Invite events
+	EventInviteCreate     EventType = "INVITE_CREATE"
+	EventInviteDelete     EventType = "INVITE_DELETE"
+	EventInvitesList      EventType = "INVITES_LIST"
+
+	// Audit events
+	EventAuditLog         EventType = "AUDIT_LOG"
+
+	// Search events
+	EventSearchResults    EventType = "SEARCH_RESULTS"
+
+	// Maintenance events
+	EventBackupComplete   EventType = "BACKUP_COMPLETE"
+
+	// Account events
+	EventSessionsList     EventType = "SESSIONS_LIST"
+
 	// Role events
 	EventRoleCreate       EventType = "ROLE_CREATE"
 	EventRoleUpdate       EventType = "ROLE_UPDATE"
@@ -137,6 +197,21 @@ type ConnectionProperties struct {
 	Device  string `json:"device"`
 }
 
+// ResumePayload is sent instead of IDENTIFY to continue a dropped session.
+// Seq is the last dispatch sequence number the client received.
+type ResumePayload struct {
+	Token     string `json:"token"`
+	SessionID string `json:"session_id"`
+	Seq       int64  `json:"seq"`
+}
+
+// InvalidSessionPayload accompanies OpInvalidSession. When Resumable is false
+// after a RESUME, the socket stays open and the client should IDENTIFY.
+type InvalidSessionPayload struct {
+	Reason    string `json:"reason"`
+	Resumable bool   `json:"resumable"`
+}
+
 // HeartbeatPayload is sent to keep the connection alive
 type HeartbeatPayload struct {
 	LastSequence *int64 `json:"last_sequence"`
@@ -172,11 +247,12 @@ type ChannelCreateRequest struct {
 
 // ChannelUpdateRequest is sent by clients to update a channel
 type ChannelUpdateRequest struct {
-	ServerID   uuid.UUID  `json:"server_id"`
-	ChannelID  uuid.UUID  `json:"channel_id"`
-	Name       *string    `json:"name,omitempty"`
-	CategoryID *uuid.UUID `json:"category_id,omitempty"`
-	Position   *int       `json:"position,omitempty"`
+	ServerID         uuid.UUID  `json:"server_id"`
+	ChannelID        uuid.UUID  `json:"channel_id"`
+	Name             *string    `json:"name,omitempty"`
+	CategoryID       *uuid.UUID `json:"category_id,omitempty"`
+	Position         *int       `json:"position,omitempty"`
+	RateLimitPerUser *int       `json:"rate_limit_per_user,omitempty"` // Slowmode seconds, 0 = off
 }
 
 // ChannelDeleteRequest is sent by clients to delete a channel
@@ -190,6 +266,7 @@ type MessageHistoryRequest struct {
 	ChannelID uuid.UUID  `json:"channel_id"`
 	Limit     int        `json:"limit,omitempty"`     // Default: 200
 	Before    *uuid.UUID `json:"before,omitempty"`    // Pagination
+	Around    *uuid.UUID `json:"around,omitempty"`    // Centre the page on this message
 }
 
 // RoleAssignRequest assigns a role to a member
@@ -206,6 +283,102 @@ type RoleRemoveRequest struct {
 	RoleName string    `json:"role_name"`
 }
 
+// RoleCreateRequest creates a custom role just above @everyone
+type RoleCreateRequest struct {
+	ServerID    uuid.UUID          `json:"server_id"`
+	Name        string             `json:"name"`
+	Color       int                `json:"color,omitempty"`
+	Permissions *models.Permission `json:"permissions,omitempty"` // Default: text permissions
+	IsHoisted   bool               `json:"is_hoisted,omitempty"`
+}
+
+// RoleUpdateRequest edits a role; nil fields are left unchanged
+type RoleUpdateRequest struct {
+	ServerID    uuid.UUID          `json:"server_id"`
+	RoleID      uuid.UUID          `json:"role_id"`
+	Name        *string            `json:"name,omitempty"`
+	Color       *int               `json:"color,omitempty"`
+	Permissions *models.Permission `json:"permissions,omitempty"`
+	IsHoisted   *bool              `json:"is_hoisted,omitempty"`
+	Position    *int               `json:"position,omitempty"` // 1 = lowest custom role
+}
+
+// RoleDeleteRequest deletes a custom role
+type RoleDeleteRequest struct {
+	ServerID uuid.UUID `json:"server_id"`
+	RoleID   uuid.UUID `json:"role_id"`
+}
+
+// AuditLogRequest requests a page of a server's audit log, newest first
+type AuditLogRequest struct {
+	ServerID uuid.UUID  `json:"server_id"`
+	Action   string     `json:"action,omitempty"`   // Action prefix, e.g. "channel" or "member_ban"
+	ActorID  *uuid.UUID `json:"actor_id,omitempty"` // Only actions by this user
+	Target   string     `json:"target,omitempty"`   // Substring of the target name
+	Before   *uuid.UUID `json:"before,omitempty"`   // Pagination: oldest entry already seen
+	Limit    int        `json:"limit,omitempty"`    // Default: 25, max 100
+}
+
+// SearchRequest searches a server's messages. Query holds free text plus
+// optional from:@user, in:#channel, before:YYYY-MM-DD, after:YYYY-MM-DD
+// and has:link filters.
+type SearchRequest struct {
+	ServerID uuid.UUID `json:"server_id"`
+	Query    string    `json:"query"`
+	Limit    int       `json:"limit,omitempty"` // Default: 25, max 100
+}
+
+// BackupRequest asks the host to back up its database. The backup covers the
+// whole database, so the caller must be an administrator of the host's default
+// server whichever ServerID the request comes from.
+type BackupRequest struct {
+	ServerID uuid.UUID `json:"server_id"`
+}
+
+// SessionRevokeRequest revokes the caller's login sessions; set exactly one
+// field. Revoked sessions' sockets are closed with CloseSessionRevoked.
+type SessionRevokeRequest struct {
+	SessionID *uuid.UUID `json:"session_id,omitempty"` // One session from SESSIONS_LIST
+	Others    bool       `json:"others,omitempty"`     // Every session but this connection's
+	Current   bool       `json:"current,omitempty"`    // This connection's session (log out)
+}
+
+// ServerCreateRequest creates a server with an @everyone role and a
+// #general channel, owned by the caller
+type ServerCreateRequest struct {
+	Name string `json:"name"`
+}
+
+// ServerLeaveRequest leaves a server. The owner must transfer or delete it instead.
+type ServerLeaveRequest struct {
+	ServerID uuid.UUID `json:"server_id"`
+}
+
+// ServerDeleteRequest deletes a server with all its channels and messages
+type ServerDeleteRequest struct {
+	ServerID uuid.UUID `json:"server_id"`
+}
+
+// ServerTransferRequest makes another member the server's owner
+type ServerTransferRequest struct {
+	ServerID uuid.UUID `json:"server_id"`
+	UserID   uuid.UUID `json:"user_id"`
+}
+
+// ThreadCreateRequest starts a thread from a message in a text channel
+type ThreadCreateRequest struct {
+	ChannelID          uuid.UUID `json:"channel_id"`
+	MessageID          uuid.UUID `json:"message_id"`
+	Name               string    `json:"name"`
+	AutoArchiveMinutes int       `json:"auto_archive_minutes,omitempty"` // Default: one day
+}
+
+// ThreadArchiveRequest archives a thread, or reopens it when Archived is false
+type ThreadArchiveRequest struct {
+	ThreadID uuid.UUID `json:"thread_id"`
+	Archived bool      `json:"archived"`
+}
+
 // KickMemberRequest kicks a member from a server
 type KickMemberRequest struct {
 	ServerID uuid.UUID `json:"server_id"`
@@ -222,9 +395,55 @@ type BanMemberRequest struct {
 
 // MuteMemberRequest server-mutes (or unmutes) a member
 type MuteMemberRequest struct {
+	ServerID        uuid.UUID `json:"server_id"`
+	UserID          uuid.UUID `json:"user_id"`
+	Mute            bool      `json:"mute"`                       // true=mute, false=unmute
+	DurationMinutes int       `json:"duration_minutes,omitempty"` // 0 = until unmuted
+}
+
+// UnbanMemberRequest lifts a ban. The user is identified by username because
+// banned users are no longer in the member list.
+type UnbanMemberRequest struct {
 	ServerID uuid.UUID `json:"server_id"`
-	UserID   uuid.UUID `json:"user_id"`
-	Mute     bool      `json:"mute"` // true=mute, false=unmute
+	Username string    `json:"username"`
+}
+
+// TimeoutMemberRequest temporarily bans a member from a server
+type TimeoutMemberRequest struct {
+	ServerID        uuid.UUID `json:"server_id"`
+	UserID          uuid.UUID `json:"user_id"`
+	DurationMinutes int       `json:"duration_minutes"`
+	Reason          string    `json:"reason,omitempty"`
+}
+
+// PinMessageRequest pins a message in a channel
+type PinMessageRequest struct {
+	ChannelID uuid.UUID `json:"channel_id"`
+	MessageID uuid.UUID `json:"message_id"`
+}
+
+// UnpinMessageRequest unpins a message in a channel
+type UnpinMessageRequest struct {
+	ChannelID uuid.UUID `json:"channel_id"`
+	MessageID uuid.UUID `json:"message_id"`
+}
+
+// InviteCreateRequest creates an invite. Nil limits fall back to the server defaults.
+type InviteCreateRequest struct {
+	ServerID uuid.UUID `json:"server_id"`
+	MaxAge   *int      `json:"max_age,omitempty"`  // Seconds, 0 = never expire
+	MaxUses  *int      `json:"max_uses,omitempty"` // 0 = unlimited
+}
+
+// InviteListRequest lists a server's active invites
+type InviteListRequest struct {
+	ServerID uuid.UUID `json:"server_id"`
+}
+
+// InviteRevokeRequest revokes an invite
+type InviteRevokeRequest struct {
+	ServerID uuid.UUID `json:"server_id"`
+	Code     string    `json:"code"`
 }
 
 // WhisperPayload is sent by a client to whisper to another user
@@ -240,6 +459,53 @@ type WhisperCreatePayload struct {
 	Timestamp time.Time    `json:"timestamp"`
 }
 
+// MessageEditRequest replaces the content of a message
+type MessageEditRequest struct {
+	ChannelID uuid.UUID `json:"channel_id"`
+	MessageID uuid.UUID `json:"message_id"`
+	Content   string    `json:"content"`
+}
+
+// MessageFetchRequest asks for specific messages of a channel, such as the
+// parents of replies outside the loaded history
+type MessageFetchRequest struct {
+	ChannelID  uuid.UUID   `json:"channel_id"`
+	MessageIDs []uuid.UUID `json:"message_ids"` // At most 50
+}
+
+// MessageDeleteRequest deletes a message
+type MessageDeleteRequest struct {
+	ChannelID uuid.UUID `json:"channel_id"`
+	MessageID uuid.UUID `json:"message_id"`
+}
+
+// ReactionRequest adds or removes the caller's reaction on a message
+type ReactionRequest struct {
+	ChannelID uuid.UUID `json:"channel_id"`
+	MessageID uuid.UUID `json:"message_id"`
+	Emoji     string    `json:"emoji"`
+}
+
+// OverwriteSetRequest sets the allow/deny bits for a role or member on a channel
+type OverwriteSetRequest struct {
+	ChannelID  uuid.UUID `json:"channel_id"`
+	TargetID   uuid.UUID `json:"target_id"`
+	TargetType string    `json:"target_type"` // "role" or "member"
+	Allow      int64     `json:"allow"`
+	Deny       int64     `json:"deny"`
+}
+
+// OverwriteDeleteRequest clears the overwrite for a role or member on a channel
+type OverwriteDeleteRequest struct {
+	ChannelID uuid.UUID `json:"channel_id"`
+	TargetID  uuid.UUID `json:"target_id"`
+}
+
+// DMOpenRequest opens a persistent DM channel with another user
+type DMOpenRequest struct {
+	RecipientID uuid.UUID `json:"recipient_id"`
+}
+
 // --- Server -> Client Payloads ---
 
 // HelloPayload is sent on initial connection
@@ -253,6 +519,8 @@ type ReadyPayload struct {
 	User        *models.User     `json:"user"`
 	Servers     []*models.Server `json:"servers"`
 	PrivateChannels []*models.Channel `json:"private_channels,omitempty"`
+	PrivateChannelUsers []*models.User `json:"private_channel_users,omitempty"` // Recipients of PrivateChannels
+	UndeliveredMessages []*MessageDisplay `json:"undelivered_messages,omitempty"` // DMs received while offline
 	ResumeURL   string           `json:"resume_url,omitempty"`
 }
 
@@ -265,6 +533,17 @@ type ServerCreatePayload struct {
 	Users    []*models.User         `json:"users"`
 }
 
+// ServerUpdatePayload is dispatched when a server's name or owner changes
+type ServerUpdatePayload struct {
+	*models.Server
+}
+
+// ServerDeletePayload is dispatched when a server is deleted or the user
+// leaves, is kicked or is banned from it
+type ServerDeletePayload struct {
+	ServerID uuid.UUID `json:"server_id"`
+}
+
 // --- Event Payloads ---
 
 // MessageCreatePayload is dispatched when a message is created
@@ -280,6 +559,9 @@ type MessageHistoryPayload struct {
 	ChannelID uuid.UUID        `json:"channel_id"`
 	Messages  []*MessageDisplay `json:"messages"`
 	HasMore   bool             `json:"has_more"`
+	PinnedMessages []*models.Message `json:"pinned_messages,omitempty"`
+	Around    *uuid.UUID       `json:"around,omitempty"` // Echoes MessageHistoryRequest.Around
+	Before    *uuid.UUID       `json:"before,omitempty"` // Echoes MessageHistoryRequest.Before
 }
 
 // MessageDisplay is the client-side message representation
@@ -288,6 +570,14 @@ type MessageDisplay struct {
 	Author *models.User `json:"author"`
 }
 
+// MessagesFetchedPayload answers a MessageFetchRequest. Missing lists the
+// requested IDs that no longer exist in the channel.
+type MessagesFetchedPayload struct {
+	ChannelID uuid.UUID         `json:"channel_id"`
+	Messages  []*MessageDisplay `json:"messages"`
+	Missing   []uuid.UUID       `json:"missing,omitempty"`
+}
+
 // MessageUpdatePayload is dispatched when a message is edited
 type MessageUpdatePayload struct {
 	ID        uuid.UUID  `json:"id"`
@@ -303,6 +593,38 @@ type MessageDeletePayload struct {
 	ServerID  uuid.UUID `json:"server_id,omitempty"`
 }
 
+// MessagePinPayload is dispatched when a message is pinned or unpinned
+type MessagePinPayload struct {
+	ChannelID uuid.UUID       `json:"channel_id"`
+	ServerID  uuid.UUID       `json:"server_id,omitempty"`
+	Message   *models.Message `json:"message"`
+}
+
+// DMChannelPayload is dispatched when a DM channel is opened
+type DMChannelPayload struct {
+	Channel    *models.Channel `json:"channel"`
+	Recipients []*models.User  `json:"recipients"`
+}
+
+// InvitePayload is dispatched when an invite is created or revoked
+type InvitePayload struct {
+	ServerID uuid.UUID      `json:"server_id"`
+	Invite   *models.Invite `json:"invite"`
+}
+
+// InvitesListPayload answers an InviteListRequest
+type InvitesListPayload struct {
+	ServerID uuid.UUID        `json:"server_id"`
+	Invites  []*models.Invite `json:"invites"`
+}
+
+// SystemMessagePayload is dispatched for server-wide moderation announcements
+type SystemMessagePayload struct {
+	ServerID  uuid.UUID `json:"server_id"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
 // TypingStartEventPayload is dispatched when a user starts typing
 type TypingStartEventPayload struct {
 	ChannelID uuid.UUID    `json:"channel_id"`
@@ -341,6 +663,47 @@ type ServerMemberUpdatePayload struct {
 	Roles    []*models.Role       `json:"roles"`
 }
 
+// RolePayload is dispatched when a role is created or updated
+type RolePayload struct {
+	ServerID uuid.UUID    `json:"server_id"`
+	Role     *models.Role `json:"role"`
+}
+
+// RoleDeletePayload is dispatched when a role is deleted
+type RoleDeletePayload struct {
+	ServerID uuid.UUID `json:"server_id"`
+	RoleID   uuid.UUID `json:"role_id"`
+}
+
+// AuditLogPayload answers an AuditLogRequest
+type AuditLogPayload struct {
+	ServerID uuid.UUID               `json:"server_id"`
+	Entries  []*models.AuditLogEntry `json:"entries"`
+	Users    []*models.User          `json:"users"` // Actors referenced by Entries
+	HasMore  bool                    `json:"has_more"`
+}
+
+// SearchResultsPayload answers a SearchRequest, newest match first
+type SearchResultsPayload struct {
+	ServerID uuid.UUID         `json:"server_id"`
+	Query    string            `json:"query"`
+	Results  []*MessageDisplay `json:"results"`
+	HasMore  bool              `json:"has_more"`
+}
+
+// BackupCompletePayload answers a BackupRequest with the file written on the host
+type BackupCompletePayload struct {
+	File  string `json:"file"`
+	Bytes int64  `json:"bytes"`
+}
+
+// SessionsListPayload lists the caller's unexpired login sessions, most
+// recently used first. Revoked counts sessions just revoked, if any.
+type SessionsListPayload struct {
+	Sessions []*models.Session `json:"sessions"`
+	Revoked  int               `json:"revoked,omitempty"`
+}
+
 // ChannelCreatePayload is dispatched when a channel is created
 type ChannelCreatePayload struct {
 	*models.Channel
@@ -351,6 +714,16 @@ type ChannelUpdatePayload struct {
 	*models.Channel
 }
 
+// ThreadCreatePayload is dispatched to the parent channel when a thread is started
+type ThreadCreatePayload struct {
+	*models.Channel
+}
+
+// ThreadUpdatePayload is dispatched when a thread is archived or reopened
+type ThreadUpdatePayload struct {
+	*models.Channel
+}
+
 // ChannelDeletePayload is dispatched when a channel is deleted
 type ChannelDeletePayload struct {
 	ChannelID uuid.UUID `json:"channel_id"`
@@ -371,8 +744,9 @@ type ReactionPayload struct {
 
 // ErrorPayload represents an error response
 type ErrorPayload struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code       int    `json:"code"`
+	Message    string `json:"message"`
+	RetryAfter int    `json:"retry_after,omitempty"` // Seconds until a rate-limited action may be retried
 }
 
 // Common error codes
@@ -387,6 +761,8 @@ const (
 	ErrorCodeSessionInvalid    = 4007
 	ErrorCodeSessionTimeout    = 4008
 	ErrorCodeAlreadyAuthenticated = 4009
+	ErrorCodeRoleHierarchy     = 4010 // Target member or role is at or above the caller's highest role
+	ErrorCodeUnknownChannel    = 4011 // Channel doesn't exist or has been deleted
 )
 
 // CloseCode represents WebSocket close codes
@@ -409,4 +785,5 @@ const (
 	CloseInvalidAPIVersion CloseCode = 4012
 	CloseInvalidIntents   CloseCode = 4013
 	CloseDisallowedIntents CloseCode = 4014
+	CloseSessionRevoked   CloseCode = 4015 // Login session revoked or logged out; don't reconnect
 )
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reasons a WebSocket connection is refused or dropped, as reported by /api/metrics
+const (
+	rejectOrigin          = "origin"           // Origin header not allowed
+	rejectServerFull      = "server_full"      // max_connections reached
+	rejectIPLimit         = "ip_limit"         // max_connections_per_ip reached
+	rejectIdentifyTimeout = "identify_timeout" // no successful IDENTIFY in time
+	rejectRateLimited     = "rate_limited"     // disconnected by the rate limiter
+)
+
+var rejectReasons = []string{rejectOrigin, rejectServerFull, rejectIPLimit, rejectIdentifyTimeout, rejectRateLimited}
+
+// admission decides which WebSocket connections the server accepts and
+// counts the ones it turns away
+type admission struct {
+	allowedOrigins  []string
+	maxConnections  int // 0 means unlimited
+	maxPerIP        int // 0 means unlimited
+	identifyTimeout time.Duration
+
+	mu       sync.Mutex
+	open     int
+	perIP    map[string]int
+	accepted int64
+	rejected map[string]int64
+}
+
+func newAdmission(config *Config) *admission {
+	return &admission{
+		allowedOrigins:  config.AllowedOrigins,
+		maxConnections:  config.MaxConnections,
+		maxPerIP:        config.MaxConnectionsPerIP,
+		identifyTimeout: time.Duration(config.IdentifyTimeout) * time.Second,
+		perIP:           make(map[string]int),
+		rejected:        make(map[string]int64),
+	}
+}
+
+// checkOrigin is the upgrader's CheckOrigin hook. Native clients send no
+// Origin header and are always allowed; browsers must come from this host
+// or an origin in allowed_origins.
+func (a *admission) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || a.originAllowed(origin, r.Host) {
+		return true
+	}
+	a.reject(rejectOrigin)
+	log.Printf("Rejected WebSocket from %s: origin %q not allowed", r.RemoteAddr, origin)
+	return false
+}
+
+func (a *admission) originAllowed(origin, host string) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, host) {
+		return true
+	}
+	for _, allowed := range a.allowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// admit reserves a connection slot for ip, returning the rejection reason
+// when the server or the address is at its limit. Every admitted
+// connection must be released.
+func (a *admission) admit(ip string) (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	reason := ""
+	switch {
+	case a.maxConnections > 0 && a.open >= a.maxConnections:
+		reason = rejectServerFull
+	case a.maxPerIP > 0 && a.perIP[ip] >= a.maxPerIP:
+		reason = rejectIPLimit
+	}
+	if reason != "" {
+		a.rejected[reason]++
+		log.Printf("Rejected WebSocket from %s: %s", ip, reason)
+		return reason, false
+	}
+
+	a.open++
+	a.perIP[ip]++
+	return "", true
+}
+
+// accept counts a connection that completed the WebSocket handshake
+func (a *admission) accept() {
+	a.mu.Lock()
+	a.accepted++
+	a.mu.Unlock()
+}
+
+// release frees the slot taken by admit
+func (a *admission) release(ip string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.open--
+	if a.perIP[ip] <= 1 {
+		delete(a.perIP, ip)
+	} else {
+		a.perIP[ip]--
+	}
+}
+
+// reject counts a connection refused or dropped for reason
+func (a *admission) reject(reason string) {
+	a.mu.Lock()
+	a.rejected[reason]++
+	a.mu.Unlock()
+}
+
+// writeMetrics writes the connection counters in the Prometheus text format
+func (a *admission) writeMetrics(w io.Writer) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP concord_connections_open WebSocket connections currently open.")
+	fmt.Fprintln(w, "# TYPE concord_connections_open gauge")
+	fmt.Fprintf(w, "concord_connections_open %d\n", a.open)
+	fmt.Fprintln(w, "# HELP concord_connections_accepted_total WebSocket connections accepted.")
+	fmt.Fprintln(w, "# TYPE concord_connections_accepted_total counter")
+	fmt.Fprintf(w, "concord_connections_accepted_total %d\n", a.accepted)
+	fmt.Fprintln(w, "# HELP concord_connections_rejected_total WebSocket connections refused or dropped, by reason.")
+	fmt.Fprintln(w, "# TYPE concord_connections_rejected_total counter")
+	for _, reason := range rejectReasons {
+		fmt.Fprintf(w, "concord_connections_rejected_total{reason=%q} %d\n", reason, a.rejected[reason])
+	}
+}
+
+// remoteIP returns the address a request came from, without the port
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/concord-chat/concord/internal/database"
+)
+
+// Backup files are named concord-YYYYMMDD-HHMMSS.mmm.db so they sort by age
+const (
+	backupPrefix     = "concord-"
+	backupExt        = ".db"
+	backupTimeFormat = "20060102-150405.000"
+
+	// Shortest gap between on-demand backups across the whole host
+	minBackupInterval = time.Minute
+)
+
+// BackupConfig controls where database backups go and how often they run
+type BackupConfig struct {
+	Dir           string `toml:"dir"`            // Directory for scheduled and on-demand backups
+	IntervalHours int    `toml:"interval_hours"` // 0 disables scheduled backups
+	Keep          int    `toml:"keep"`           // Backups to retain in Dir; 0 keeps all
+}
+
+// Backups writes timestamped database snapshots and prunes old ones
+type Backups struct {
+	db     database.Store
+	config BackupConfig
+	mu     sync.Mutex // One backup at a time
+	last   time.Time  // When the last backup finished
+}
+
+// NewBackups creates a backup runner for db
+func NewBackups(db database.Store, config BackupConfig) *Backups {
+	return &Backups{db: db, config: config}
+}
+
+// Run writes a new backup into the backup directory, applies retention, and
+// returns the path and size of the file written
+func (b *Backups) Run() (string, int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.run()
+}
+
+// Request runs an on-demand backup like Run, unless another backup finished
+// less than minBackupInterval ago; then it returns how long to wait instead
+func (b *Backups) Request() (path string, size int64, wait time.Duration, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if wait := time.Until(b.last.Add(minBackupInterval)); wait > 0 {
+		return "", 0, wait, nil
+	}
+	path, size, err = b.run()
+	return path, size, 0, err
+}
+
+func (b *Backups) run() (string, int64, error) {
+	if err := os.MkdirAll(b.config.Dir, 0700); err != nil {
+		return "", 0, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	path := b.nextPath(time.Now())
+	if err := b.db.Backup(path); err != nil {
+		return "", 0, err
+	}
+	b.last = time.Now()
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", 0, err
+	}
+
+	b.prune()
+	return path, info.Size(), nil
+}
+
+// nextPath returns an unused backup path for a backup taken at now, moving
+// forward a millisecond at a time past existing files so names stay in order
+func (b *Backups) nextPath(now time.Time) string {
+	for {
+		path := filepath.Join(b.config.Dir, backupPrefix+now.Format(backupTimeFormat)+backupExt)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+		now = now.Add(time.Millisecond)
+	}
+}
+
+// prune deletes the oldest backups beyond the configured retention
+func (b *Backups) prune() {
+	if b.config.Keep <= 0 {
+		return
+	}
+	entries, err := os.ReadDir(b.config.Dir)
+	if err != nil {
+		log.Printf("Failed to list backups: %v", err)
+		return
+	}
+
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && strings.HasPrefix(name, backupPrefix) && strings.HasSuffix(name, backupExt) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for len(names) > b.config.Keep {
+		path := filepath.Join(b.config.Dir, names[0])
+		if err := os.Remove(path); err != nil {
+			log.Printf("Failed to remove old backup %s: %v", path, err)
+		} else {
+			log.Printf("Removed old backup %s", path)
+		}
+		names = names[1:]
+	}
+}
+
+// schedule runs a backup every IntervalHours
+func (b *Backups) schedule() {
+	ticker := time.NewTicker(time.Duration(b.config.IntervalHours) * time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		path, size, err := b.Run()
+		if err != nil {
+			log.Printf("Scheduled backup failed: %v", err)
+			continue
+		}
+		log.Printf("Scheduled backup written to %s (%d bytes)", path, size)
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/concord-chat/concord/internal/models"
+	"github.com/concord-chat/concord/internal/protocol"
+	"github.com/google/uuid"
+)
+
+func TestBackupNamesAreUniqueAndOrdered(t *testing.T) {
+	ts := newTestServer(t)
+	b := NewBackups(ts.db, BackupConfig{Dir: t.TempDir()})
+
+	// Backups taken within the same second must not collide
+	var paths []string
+	for i := 0; i < 3; i++ {
+		path, _, err := b.Run()
+		if err != nil {
+			t.Fatalf("backup %d: %v", i, err)
+		}
+		paths = append(paths, filepath.Base(path))
+	}
+	if !sort.StringsAreSorted(paths) || paths[0] == paths[1] || paths[1] == paths[2] {
+		t.Errorf("backup names %v are not unique and in order", paths)
+	}
+}
+
+func TestBackupPruneKeepsNewest(t *testing.T) {
+	ts := newTestServer(t)
+	dir := t.TempDir()
+	b := NewBackups(ts.db, BackupConfig{Dir: dir, Keep: 2})
+
+	var last string
+	for i := 0; i < 3; i++ {
+		path, _, err := b.Run()
+		if err != nil {
+			t.Fatalf("backup %d: %v", i, err)
+		}
+		last = path
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("kept %d backups, want 2", len(entries))
+	}
+	if _, err := os.Stat(last); err != nil {
+		t.Errorf("newest backup was pruned: %v", err)
+	}
+}
+
+func TestBackupRequiresHostAdmin(t *testing.T) {
+	ts := newTestServer(t)
+	ts.h.backups = NewBackups(ts.db, BackupConfig{Dir: t.TempDir()})
+
+	// Owning a server of one's own doesn't make someone a host administrator
+	mallory := ts.addMember(t, "mallory")
+	own := models.NewServer("mallory's", mallory.ID)
+	if _, _, err := ts.db.CreateServerWithDefaults(own); err != nil {
+		t.Fatal(err)
+	}
+	c := ts.connect(mallory)
+	requestBackup(t, ts, c, own.ID)
+	if e := lastError(t, c); e == nil || e.Code != protocol.ErrorCodeForbidden {
+		t.Fatalf("server owner backup: got %+v, want forbidden", e)
+	}
+
+	// An administrator of the default server may back up, once a minute
+	admin := ts.addMember(t, "admin")
+	role := models.NewRole(ts.server.ID, "Admin")
+	role.Permissions = models.PermissionAdministrator
+	role.Position = 1
+	if err := ts.db.CreateRole(role); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.db.AddMemberRole(admin.ID, ts.server.ID, role.ID); err != nil {
+		t.Fatal(err)
+	}
+	c = ts.connect(admin)
+	requestBackup(t, ts, c, ts.server.ID)
+	if e := lastError(t, c); e != nil {
+		t.Fatalf("host admin backup rejected: %s", e.Message)
+	}
+
+	// The host-wide interval holds across connections
+	c = ts.connect(admin)
+	requestBackup(t, ts, c, ts.server.ID)
+	if e := lastError(t, c); e == nil || e.Code != protocol.ErrorCodeRateLimited {
+		t.Fatalf("second backup from a new connection: got %+v, want a rate limit error", e)
+	}
+
+	// A database failure isn't reported as a permission problem
+	ts.db.Close()
+	c = ts.connect(admin)
+	requestBackup(t, ts, c, ts.server.ID)
+	if e := lastError(t, c); e == nil || e.Code != protocol.ErrorCodeServerError {
+		t.Fatalf("backup with the database down: got %+v, want a server error", e)
+	}
+}
+
+func requestBackup(t *testing.T, ts *testServer, c *Client, serverID uuid.UUID) {
+	t.Helper()
+	ts.h.HandleBackup(c, request(t, protocol.OpBackup, &protocol.BackupRequest{ServerID: serverID}))
+}
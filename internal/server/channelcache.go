@@ -0,0 +1,44 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// channelServers caches which server each channel belongs to (uuid.Nil for
+// DMs) so routing typing events doesn't need the database.
+// Channels never move between servers, so entries only go stale when a
+// channel or its server is deleted.
+type channelServers struct {
+	mu      sync.RWMutex
+	servers map[uuid.UUID]uuid.UUID // channel -> server
+}
+
+func newChannelServers() *channelServers {
+	return &channelServers{servers: make(map[uuid.UUID]uuid.UUID)}
+}
+
+// get returns the cached server of a channel
+func (cs *channelServers) get(channelID uuid.UUID) (uuid.UUID, bool) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	serverID, ok := cs.servers[channelID]
+	return serverID, ok
+}
+
+// set records the server a channel belongs to
+func (cs *channelServers) set(channelID, serverID uuid.UUID) {
+	cs.mu.Lock()
+	cs.servers[channelID] = serverID
+	cs.mu.Unlock()
+}
+
+// forget drops deleted channels
+func (cs *channelServers) forget(channelIDs ...uuid.UUID) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for _, id := range channelIDs {
+		delete(cs.servers, id)
+	}
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/concord-chat/concord/internal/models"
+	"github.com/concord-chat/concord/internal/protocol"
+	"github.com/google/uuid"
+)
+
+func TestChannelServersCache(t *testing.T) {
+	cs := newChannelServers()
+	a, b, server := uuid.New(), uuid.New(), uuid.New()
+
+	cs.set(a, server)
+	cs.set(b, uuid.Nil)
+	if got, ok := cs.get(a); !ok || got != server {
+		t.Errorf("get(a) = %s, %v; want %s", got, ok, server)
+	}
+	// DMs are cached with no server
+	if got, ok := cs.get(b); !ok || got != uuid.Nil {
+		t.Errorf("get(dm) = %s, %v; want nil server", got, ok)
+	}
+
+	cs.forget(a, b)
+	if _, ok := cs.get(a); ok {
+		t.Error("forgotten channel still cached")
+	}
+	if _, ok := cs.get(b); ok {
+		t.Error("forgotten DM still cached")
+	}
+}
+
+func TestChannelServersLoadedOnMiss(t *testing.T) {
+	ts := newTestServer(t)
+	if _, ok := ts.h.channels.get(ts.general.ID); ok {
+		t.Fatal("channel cached before first use")
+	}
+	got, err := ts.h.channelServer(ts.general.ID)
+	if err != nil || got != ts.server.ID {
+		t.Fatalf("channelServer = %s, %v; want %s", got, err, ts.server.ID)
+	}
+	if cached, ok := ts.h.channels.get(ts.general.ID); !ok || cached != ts.server.ID {
+		t.Error("channelServer didn't cache its result")
+	}
+	if _, err := ts.h.channelServer(uuid.New()); err == nil {
+		t.Error("unknown channel resolved to a server")
+	}
+}
+
+func TestChannelServersForgetDeletedChannels(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.connect(ts.addMember(t, "alice"))
+
+	// A channel with a thread, both cached
+	channel := models.NewTextChannel(ts.server.ID, "doomed")
+	if err := ts.db.CreateChannel(channel); err != nil {
+		t.Fatal(err)
+	}
+	anchor := models.NewMessage(channel.ID, alice.UserID, "anchor")
+	if err := ts.db.CreateMessage(anchor); err != nil {
+		t.Fatal(err)
+	}
+	thread := models.NewThread(channel, anchor.ID, alice.UserID, "side", 60)
+	if err := ts.db.CreateChannel(thread); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []uuid.UUID{channel.ID, thread.ID} {
+		if _, err := ts.h.channelServer(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// @everyone may manage channels by default
+	ts.h.HandleDeleteChannel(alice, request(t, protocol.OpChannelDelete, &protocol.ChannelDeleteRequest{
+		ServerID:  ts.server.ID,
+		ChannelID: channel.ID,
+	}))
+	if e := lastError(t, alice); e != nil {
+		t.Fatalf("delete channel: %s", e.Message)
+	}
+	for _, id := range []uuid.UUID{channel.ID, thread.ID} {
+		if _, ok := ts.h.channels.get(id); ok {
+			t.Errorf("channel %s still cached after deletion", id)
+		}
+	}
+}
+
+func TestChannelServersForgetDeletedServer(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.connect(ts.addMember(t, "alice"))
+
+	ts.h.HandleServerCreate(alice, request(t, protocol.OpServerCreate, &protocol.ServerCreateRequest{Name: "mine"}))
+	if e := lastError(t, alice); e != nil {
+		t.Fatalf("create server: %s", e.Message)
+	}
+	servers, err := ts.db.GetUserServers(alice.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var own *models.Server
+	for _, s := range servers {
+		if s.OwnerID == alice.UserID {
+			own = s
+		}
+	}
+	if own == nil {
+		t.Fatal("created server not found")
+	}
+	channels, err := ts.db.GetServerChannels(own.ID)
+	if err != nil || len(channels) == 0 {
+		t.Fatalf("server channels = %v, %v", channels, err)
+	}
+	if got, ok := ts.h.channels.get(channels[0].ID); !ok || got != own.ID {
+		t.Fatal("new server's channel wasn't cached")
+	}
+
+	ts.h.HandleServerDelete(alice, request(t, protocol.OpServerDelete, &protocol.ServerDeleteRequest{ServerID: own.ID}))
+	if e := lastError(t, alice); e != nil {
+		t.Fatalf("delete server: %s", e.Message)
+	}
+	for _, ch := range channels {
+		if _, ok := ts.h.channels.get(ch.ID); ok {
+			t.Errorf("channel %s still cached after its server was deleted", ch.Name)
+		}
+	}
+}
+
+func TestChannelServersDropStaleEntryOnSend(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.connect(ts.addMember(t, "alice"))
+
+	// An entry left behind for a channel that no longer exists
+	gone := uuid.New()
+	ts.h.channels.set(gone, ts.server.ID)
+	ts.h.HandleSendMessage(alice, request(t, protocol.OpSendMessage, &protocol.SendMessagePayload{
+		ChannelID: gone,
+		Content:   "hello?",
+	}))
+	if e := lastError(t, alice); e == nil || e.Code != protocol.ErrorCodeUnknownChannel {
+		t.Fatalf("send to deleted channel: got %+v, want unknown channel", e)
+	}
+	if _, ok := ts.h.channels.get(gone); ok {
+		t.Error("stale entry kept after the channel wasn't found")
+	}
+
+	// Sending loads the channel anyway, so it fills the cache for typing
+	sendMessage(t, ts, alice, "hello")
+	if e := lastError(t, alice); e != nil {
+		t.Fatalf("send: %s", e.Message)
+	}
+	if got, ok := ts.h.channels.get(ts.general.ID); !ok || got != ts.server.ID {
+		t.Error("sending didn't cache the channel's server")
+	}
+}
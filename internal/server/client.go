@@ -51,6 +51,10 @@ type Client struct {
 	// Server memberships
 	ServerIDs []uuid.UUID
 
+	// Login session (sessions table row) the connection authenticated with
+	authSessionID    uuid.UUID
+	lastSessionTouch time.Time
+
 	// Last received sequence number
 	lastSeq int64
 	seqMu   sync.Mutex
@@ -61,15 +65,25 @@ type Client struct {
 
 	// Handlers for processing messages
 	handlers *Handlers
+
+	// Rate limits on inbound frames, used only by ReadPump
+	limiter *rateLimiter
+
+	// Connection slot held until ReadPump exits
+	admission *admission
+	remoteIP  string
 }
 
 // NewClient creates a new client instance
-func NewClient(conn *websocket.Conn, hub *Hub, handlers *Handlers) *Client {
+func NewClient(conn *websocket.Conn, hub *Hub, handlers *Handlers, admission *admission, remoteIP string) *Client {
 	return &Client{
-		conn:     conn,
-		hub:      hub,
-		send:     make(chan *protocol.Message, sendBufferSize),
-		handlers: handlers,
+		conn:      conn,
+		hub:       hub,
+		send:      make(chan *protocol.Message, sendBufferSize),
+		handlers:  handlers,
+		limiter:   newRateLimiter(),
+		admission: admission,
+		remoteIP:  remoteIP,
 	}
 }
 
@@ -78,8 +92,14 @@ func (c *Client) ReadPump() {
 	defer func() {
 		c.hub.unregister <- c
 		c.conn.Close()
+		c.admission.release(c.remoteIP)
 	}()
 
+	if timeout := c.admission.identifyTimeout; timeout > 0 {
+		identifyTimer := time.AfterFunc(timeout, c.identifyExpired)
+		defer identifyTimer.Stop()
+	}
+
 	c.conn.SetReadLimit(maxMessageSize)
 	c.conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.conn.SetPongHandler(func(string) error {
@@ -97,8 +117,22 @@ func (c *Client) ReadPump() {
 		}
 
 		var msg protocol.Message
-		if err := json.Unmarshal(data, &msg); err != nil {
-			log.Printf("Failed to parse message: %v", err)
+		parseErr := json.Unmarshal(data, &msg)
+
+		// Malformed frames count against the connection limit too
+		if !c.limiter.allow(msg.Op) {
+			if c.limiter.strike() {
+				log.Printf("Disconnecting %s: rate limited repeatedly", c.UserID)
+				c.admission.reject(rejectRateLimited)
+				c.closeWith(protocol.CloseRateLimited, "Rate limited")
+				break
+			}
+			c.sendError(protocol.ErrorCodeRateLimited, "You are sending too fast")
+			continue
+		}
+
+		if parseErr != nil {
+			log.Printf("Failed to parse message: %v", parseErr)
 			c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid message format")
 			continue
 		}
@@ -166,6 +200,9 @@ func (c *Client) handleMessage(msg *protocol.Message) {
 	case protocol.OpIdentify:
 		c.handleIdentify(msg)
 
+	case protocol.OpResume:
+		c.handleResume(msg)
+
 	case protocol.OpHeartbeat:
 		c.handleHeartbeat(msg)
 
@@ -239,6 +276,146 @@ func (c *Client) handleMessage(msg *protocol.Message) {
 			c.handlers.HandleWhisper(c, msg)
 		})
 
+	case protocol.OpUnbanMember:
+		c.requireAuth(func() {
+			c.handlers.HandleUnbanMember(c, msg)
+		})
+
+	case protocol.OpTimeoutMember:
+		c.requireAuth(func() {
+			c.handlers.HandleTimeoutMember(c, msg)
+		})
+
+	case protocol.OpPinMessage:
+		c.requireAuth(func() {
+			c.handlers.HandlePinMessage(c, msg)
+		})
+
+	case protocol.OpUnpinMessage:
+		c.requireAuth(func() {
+			c.handlers.HandleUnpinMessage(c, msg)
+		})
+
+	case protocol.OpInviteCreate:
+		c.requireAuth(func() {
+			c.handlers.HandleInviteCreate(c, msg)
+		})
+
+	case protocol.OpInviteList:
+		c.requireAuth(func() {
+			c.handlers.HandleInviteList(c, msg)
+		})
+
+	case protocol.OpInviteRevoke:
+		c.requireAuth(func() {
+			c.handlers.HandleInviteRevoke(c, msg)
+		})
+
+	case protocol.OpDMOpen:
+		c.requireAuth(func() {
+			c.handlers.HandleDMOpen(c, msg)
+		})
+
+	case protocol.OpMessageEdit:
+		c.requireAuth(func() {
+			c.handlers.HandleEditMessage(c, msg)
+		})
+
+	case protocol.OpMessageDelete:
+		c.requireAuth(func() {
+			c.handlers.HandleDeleteMessage(c, msg)
+		})
+
+	case protocol.OpReactionAdd:
+		c.requireAuth(func() {
+			c.handlers.HandleReaction(c, msg, true)
+		})
+
+	case protocol.OpReactionRemove:
+		c.requireAuth(func() {
+			c.handlers.HandleReaction(c, msg, false)
+		})
+
+	case protocol.OpOverwriteSet:
+		c.requireAuth(func() {
+			c.handlers.HandleOverwriteSet(c, msg)
+		})
+
+	case protocol.OpOverwriteDelete:
+		c.requireAuth(func() {
+			c.handlers.HandleOverwriteDelete(c, msg)
+		})
+
+	case protocol.OpRoleCreate:
+		c.requireAuth(func() {
+			c.handlers.HandleRoleCreate(c, msg)
+		})
+
+	case protocol.OpRoleUpdate:
+		c.requireAuth(func() {
+			c.handlers.HandleRoleUpdate(c, msg)
+		})
+
+	case protocol.OpRoleDelete:
+		c.requireAuth(func() {
+			c.handlers.HandleRoleDelete(c, msg)
+		})
+
+	case protocol.OpAuditLog:
+		c.requireAuth(func() {
+			c.handlers.HandleAuditLog(c, msg)
+		})
+
+	case protocol.OpSearch:
+		c.requireAuth(func() {
+			c.handlers.HandleSearch(c, msg)
+		})
+	case protocol.OpBackup:
+		c.requireAuth(func() {
+			c.handlers.HandleBackup(c, msg)
+		})
+
+	case protocol.OpSessionList:
+		c.requireAuth(func() {
+			c.handlers.HandleSessionList(c, msg)
+		})
+
+	case protocol.OpSessionRevoke:
+		c.requireAuth(func() {
+			c.handlers.HandleSessionRevoke(c, msg)
+		})
+
+	case protocol.OpServerCreate:
+		c.requireAuth(func() {
+			c.handlers.HandleServerCreate(c, msg)
+		})
+	case protocol.OpServerLeave:
+		c.requireAuth(func() {
+			c.handlers.HandleServerLeave(c, msg)
+		})
+	case protocol.OpServerDelete:
+		c.requireAuth(func() {
+			c.handlers.HandleServerDelete(c, msg)
+		})
+	case protocol.OpServerTransfer:
+		c.requireAuth(func() {
+			c.handlers.HandleServerTransfer(c, msg)
+		})
+
+	case protocol.OpThreadCreate:
+		c.requireAuth(func() {
+			c.handlers.HandleThreadCreate(c, msg)
+		})
+	case protocol.OpThreadArchive:
+		c.requireAuth(func() {
+			c.handlers.HandleThreadArchive(c, msg)
+		})
+
+	case protocol.OpFetchMessages:
+		c.requireAuth(func() {
+			c.handlers.HandleFetchMessages(c, msg)
+		})
+
 	default:
 		log.Printf("Unknown opcode: %d", msg.Op)
 		c.sendError(protocol.ErrorCodeUnknown, "Unknown operation")
@@ -262,7 +439,7 @@ func (c *Client) handleIdentify(msg *protocol.Message) {
 	}
 
 	// Authenticate the user
-	user, serverIDs, err := c.handlers.Authenticate(payload.Token)
+	user, serverIDs, authSessionID, err := c.handlers.Authenticate(payload.Token)
 	if err != nil {
 		log.Printf("Authentication failed: %v", err)
 		c.sendInvalidSession("Authentication failed")
@@ -274,10 +451,15 @@ func (c *Client) handleIdentify(msg *protocol.Message) {
 	c.User = user
 	c.ServerIDs = serverIDs
 	c.SessionID = uuid.New().String()
+	c.authSessionID = authSessionID
+	c.lastSessionTouch = time.Now()
 	c.authenticated = true
 
-	// Register with hub
-	c.hub.register <- c
+	// Register with hub. This runs synchronously so the channel
+	// subscriptions made below find the client.
+	c.hub.StartSession(c)
+	c.hub.TrackAuthSession(c)
+	c.hub.registerClient(c)
 
 	// Update user status to online
 	user.SetOnline()
@@ -285,10 +467,14 @@ func (c *Client) handleIdentify(msg *protocol.Message) {
 
 	// Send READY response
 	servers, _ := c.handlers.GetUserServers(user.ID)
+	dmChannels, dmUsers, undelivered := c.handlers.loadPrivateChannels(user.ID)
 	readyPayload := &protocol.ReadyPayload{
-		SessionID: c.SessionID,
-		User:      user,
-		Servers:   servers,
+		SessionID:           c.SessionID,
+		User:                user,
+		Servers:             servers,
+		PrivateChannels:     dmChannels,
+		PrivateChannelUsers: dmUsers,
+		UndeliveredMessages: undelivered,
 	}
 
 	readyMsg, err := protocol.NewMessage(protocol.OpReady, readyPayload)
@@ -300,8 +486,9 @@ func (c *Client) handleIdentify(msg *protocol.Message) {
 	c.send <- readyMsg
 
 	// Send SERVER_CREATE for each server with full data (channels, members, roles, users)
-	for i, server := range servers {
+	for _, server := range servers {
 		channels, _ := c.handlers.db.GetServerChannels(server.ID)
+		channels = c.handlers.visibleChannels(user.ID, server.ID, channels)
 		members, _ := c.handlers.db.GetServerMembers(server.ID)
 		roles, _ := c.handlers.db.GetServerRoles(server.ID)
 
@@ -312,7 +499,7 @@ func (c *Client) handleIdentify(msg *protocol.Message) {
 		}
 		users, _ := c.handlers.db.GetUsersByIDs(userIDs)
 
-		// CRITICAL FIX: Auto-join all channels in this server
+		// Auto-join every channel the user can view in this server
 		// This ensures the client receives MESSAGE_CREATE broadcasts
 		for _, channel := range channels {
 			c.hub.JoinChannel(c.UserID, channel.ID)
@@ -326,15 +513,11 @@ func (c *Client) handleIdentify(msg *protocol.Message) {
 			Users:    users,
 		}
 
-		// Use sequence number starting from 1
-		seq := int64(i + 1)
-		serverCreateMsg, err := protocol.NewDispatch(protocol.EventServerCreate, seq, serverCreatePayload)
-		if err != nil {
+		// Use the hub sequence so a later RESUME can find this dispatch
+		if err := c.SendDispatch(protocol.EventServerCreate, serverCreatePayload); err != nil {
 			log.Printf("Failed to create SERVER_CREATE message: %v", err)
 			continue
 		}
-
-		c.send <- serverCreateMsg
 		log.Printf("Sent SERVER_CREATE for server %s with %d channels, %d members, %d roles, %d users (auto-joined %d channels)",
 			server.Name, len(channels), len(members), len(roles), len(users), len(channels))
 
@@ -360,12 +543,92 @@ func (c *Client) handleIdentify(msg *protocol.Message) {
 		}
 	}
 
+	// Subscribe to DM channels so new direct messages arrive live
+	for _, channel := range dmChannels {
+		c.hub.JoinChannel(c.UserID, channel.ID)
+	}
+
 	// Broadcast presence update to all servers
 	c.hub.BroadcastPresenceUpdate(user, serverIDs)
 
 	log.Printf("User authenticated: %s (%s)", user.Username, user.ID)
 }
 
+// handleResume re-attaches a reconnecting client to its previous session and
+// replays the dispatches it missed. If the session can't be resumed the socket
+// is kept open and the client is told to IDENTIFY instead.
+func (c *Client) handleResume(msg *protocol.Message) {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+
+	if c.authenticated {
+		c.sendError(protocol.ErrorCodeAlreadyAuthenticated, "Already authenticated")
+		return
+	}
+
+	var payload protocol.ResumePayload
+	if err := json.Unmarshal(msg.Data, &payload); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid resume payload")
+		return
+	}
+
+	// Re-validate the token; it may have been revoked while disconnected
+	user, serverIDs, authSessionID, err := c.handlers.Authenticate(payload.Token)
+	if err != nil {
+		log.Printf("Resume authentication failed: %v", err)
+		c.sendInvalidSession("Authentication failed")
+		return
+	}
+
+	c.UserID = user.ID
+	c.User = user
+	c.ServerIDs = serverIDs
+	c.SessionID = payload.SessionID
+
+	var channelIDs []uuid.UUID
+	for _, serverID := range serverIDs {
+		channels, _ := c.handlers.db.GetServerChannels(serverID)
+		for _, channel := range c.handlers.visibleChannels(user.ID, serverID, channels) {
+			channelIDs = append(channelIDs, channel.ID)
+		}
+	}
+	dmChannels, _ := c.handlers.db.GetUserDMChannels(user.ID)
+	for _, channel := range dmChannels {
+		channelIDs = append(channelIDs, channel.ID)
+	}
+
+	if !c.hub.ResumeSession(c, payload.Seq, channelIDs) {
+		c.UserID = uuid.Nil
+		c.User = nil
+		c.ServerIDs = nil
+		c.SessionID = ""
+		c.rejectResume("Session cannot be resumed")
+		return
+	}
+	c.authSessionID = authSessionID
+	c.lastSessionTouch = time.Now()
+	c.authenticated = true
+	c.hub.TrackAuthSession(c)
+
+	c.SendDispatch(protocol.EventResumed, nil)
+
+	user.SetOnline()
+	c.handlers.UpdateUserStatus(user)
+	c.hub.BroadcastPresenceUpdate(user, serverIDs)
+}
+
+// identifyExpired drops a connection that has not authenticated in time so
+// idle sockets can't hold connection slots
+func (c *Client) identifyExpired() {
+	if c.IsAuthenticated() {
+		return
+	}
+	log.Printf("Closing connection from %s: no IDENTIFY within %s", c.remoteIP, c.admission.identifyTimeout)
+	c.admission.reject(rejectIdentifyTimeout)
+	c.closeWith(protocol.CloseNotAuthenticated, "Identify timed out")
+	c.conn.Close()
+}
+
 // handleHeartbeat processes heartbeat messages
 func (c *Client) handleHeartbeat(msg *protocol.Message) {
 	var payload protocol.HeartbeatPayload
@@ -381,6 +644,12 @@ func (c *Client) handleHeartbeat(msg *protocol.Message) {
 		c.seqMu.Unlock()
 	}
 
+	// Keep the login session alive while the client stays connected
+	if c.IsAuthenticated() && time.Since(c.lastSessionTouch) >= sessionTouchInterval {
+		c.lastSessionTouch = time.Now()
+		c.handlers.touchSession(c.authSessionID)
+	}
+
 	// Send heartbeat ACK
 	ackMsg, _ := protocol.NewMessage(protocol.OpHeartbeatAck, nil)
 	c.send <- ackMsg
@@ -402,11 +671,23 @@ func (c *Client) requireAuth(handler func()) {
 
 // sendError sends an error message to the client
 func (c *Client) sendError(code int, message string) {
-	payload := &protocol.ErrorPayload{
+	c.sendErrorPayload(&protocol.ErrorPayload{
 		Code:    code,
 		Message: message,
-	}
+	})
+}
 
+// sendRateLimited tells the client to wait before retrying an action
+func (c *Client) sendRateLimited(message string, retryAfter time.Duration) {
+	c.sendErrorPayload(&protocol.ErrorPayload{
+		Code:       protocol.ErrorCodeRateLimited,
+		Message:    message,
+		RetryAfter: int((retryAfter + time.Second - 1) / time.Second),
+	})
+}
+
+// sendErrorPayload delivers an error dispatch
+func (c *Client) sendErrorPayload(payload *protocol.ErrorPayload) {
 	// For errors, we use a dispatch with no event type
 	data, _ := json.Marshal(payload)
 	msg := &protocol.Message{
@@ -438,6 +719,14 @@ func (c *Client) sendInvalidSession(reason string) {
 	}()
 }
 
+// rejectResume tells the client its session is gone without closing the
+// socket, so it can IDENTIFY on the same connection.
+func (c *Client) rejectResume(reason string) {
+	payload := &protocol.InvalidSessionPayload{Reason: reason, Resumable: false}
+	msg, _ := protocol.NewMessage(protocol.OpInvalidSession, payload)
+	c.Send(msg)
+}
+
 // Send sends a message to the client
 func (c *Client) Send(msg *protocol.Message) {
 	select {
@@ -455,6 +744,7 @@ func (c *Client) SendDispatch(eventType protocol.EventType, data interface{}) er
 		return err
 	}
 
+	c.hub.recordDispatch(c, msg)
 	c.Send(msg)
 	return nil
 }
@@ -473,6 +763,13 @@ func (c *Client) GetLastSequence() int64 {
 	return c.lastSeq
 }
 
+// closeWith sends a close frame with code and reason. WriteControl may be
+// called alongside WritePump.
+func (c *Client) closeWith(code protocol.CloseCode, reason string) {
+	c.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(int(code), reason), time.Now().Add(writeWait))
+}
+
 // Close gracefully closes the client connection
 func (c *Client) Close() {
 	c.conn.WriteMessage(websocket.CloseMessage,
@@ -5,7 +5,11 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"math"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,45 +20,56 @@ import (
 
 // Handlers contains methods for handling client messages
 type Handlers struct {
-	db            *database.DB
+	db            database.Store
 	hub           *Hub
 	typingManager *TypingManager
+	backups       *Backups
+	slowmode      *slowmode
+	channels      *channelServers
 }
 
 // NewHandlers creates a new Handlers instance
-func NewHandlers(db *database.DB, hub *Hub) *Handlers {
+func NewHandlers(db database.Store, hub *Hub) *Handlers {
 	h := &Handlers{
 		db:  db,
 		hub: hub,
 	}
 	h.typingManager = NewTypingManager(hub)
+	h.slowmode = newSlowmode()
+	h.channels = newChannelServers()
+	go h.expireTimeouts()
+	go h.archiveIdleThreads()
+	go h.slowmode.expire()
 	return h
 }
 
-// Authenticate validates a token and returns the associated user
-func (h *Handlers) Authenticate(token string) (*models.User, []uuid.UUID, error) {
+// Authenticate validates a token and returns the associated user, their
+// servers and the login session the token belongs to. Each use slides the
+// session's expiry.
+func (h *Handlers) Authenticate(token string) (*models.User, []uuid.UUID, uuid.UUID, error) {
 	// Hash the token to look up the session
 	tokenHash := hashToken(token)
 	log.Printf("Authenticating token (first 8 chars): %s..., hash: %s", token[:min(8, len(token))], tokenHash[:16])
 
-	userID, err := h.db.GetSessionByToken(tokenHash)
+	session, err := h.db.GetSessionByToken(tokenHash)
 	if err != nil {
 		log.Printf("Session not found for token hash: %s, error: %v", tokenHash[:16], err)
-		return nil, nil, errors.New("invalid or expired token")
+		return nil, nil, uuid.Nil, errors.New("invalid or expired token")
 	}
+	userID := session.UserID
 	log.Printf("Session found for user ID: %s", userID)
 
 	user, err := h.db.GetUserByID(userID)
 	if err != nil {
 		log.Printf("User not found for ID %s: %v", userID, err)
-		return nil, nil, errors.New("user not found")
+		return nil, nil, uuid.Nil, errors.New("user not found")
 	}
 	log.Printf("User authenticated: ID=%s, Username=%s#%s", user.ID, user.Username, user.Discriminator)
 
 	// Get user's server memberships
 	servers, err := h.db.GetUserServers(userID)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, uuid.Nil, err
 	}
 
 	serverIDs := make([]uuid.UUID, len(servers))
@@ -62,7 +77,16 @@ func (h *Handlers) Authenticate(token string) (*models.User, []uuid.UUID, error)
 		serverIDs[i] = s.ID
 	}
 
-	return user, serverIDs, nil
+	h.touchSession(session.ID)
+	return user, serverIDs, session.ID, nil
+}
+
+// touchSession marks a login session as used now and pushes its expiry out
+// to a full sessionLifetime
+func (h *Handlers) touchSession(sessionID uuid.UUID) {
+	if err := h.db.TouchSession(sessionID, time.Now().Add(sessionLifetime)); err != nil {
+		log.Printf("Failed to update session %s: %v", sessionID, err)
+	}
 }
 
 // min returns the minimum of two integers
@@ -116,6 +140,92 @@ func (h *Handlers) checkPermission(userID, serverID uuid.UUID, perm models.Permi
 	return errors.New("insufficient permissions")
 }
 
+// memberPermissions resolves a user's server-level permissions and returns the
+// calculator and member needed to apply channel overwrites on top of them.
+func (h *Handlers) memberPermissions(userID, serverID uuid.UUID) (*models.PermissionCalculator, *models.ServerMember, models.Permission, error) {
+	server, err := h.db.GetServerByID(serverID)
+	if err != nil {
+		return nil, nil, 0, errors.New("server not found")
+	}
+	member, err := h.db.GetServerMember(serverID, userID)
+	if err != nil {
+		return nil, nil, 0, errors.New("not a member of this server")
+	}
+	roles, err := h.db.GetServerRoles(serverID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	everyone := &models.Role{}
+	var memberRoles []*models.Role
+	for _, role := range roles {
+		if role.IsDefault {
+			everyone = role
+		}
+		if member.HasRole(role.ID) {
+			memberRoles = append(memberRoles, role)
+		}
+	}
+
+	calc := models.NewPermissionCalculator(server.OwnerID, everyone)
+	return calc, member, calc.ComputeBasePermissions(member, memberRoles), nil
+}
+
+// checkChannelPermission verifies a user holds every bit of perm in a server
+// channel once the channel's permission overwrites are applied. Threads use
+// their parent channel's overwrites.
+func (h *Handlers) checkChannelPermission(userID uuid.UUID, channel *models.Channel, perm models.Permission) error {
+	calc, member, base, err := h.memberPermissions(userID, channel.ServerID)
+	if err != nil {
+		return err
+	}
+	if channel.IsThread() {
+		if channel, err = h.db.GetChannelByID(channel.ParentID); err != nil {
+			return err
+		}
+	}
+	if calc.ComputeOverwrites(base, member, channel)&perm != perm {
+		return errors.New("insufficient permissions")
+	}
+	return nil
+}
+
+// visibleChannels filters a server's channels down to those userID may view
+func (h *Handlers) visibleChannels(userID, serverID uuid.UUID, channels []*models.Channel) []*models.Channel {
+	calc, member, base, err := h.memberPermissions(userID, serverID)
+	if err != nil {
+		return nil
+	}
+	byID := channelsByID(channels)
+	visible := make([]*models.Channel, 0, len(channels))
+	for _, ch := range channels {
+		target := overwriteSource(ch, byID)
+		if target != nil && calc.ComputeOverwrites(base, member, target)&models.PermissionViewChannels != 0 {
+			visible = append(visible, ch)
+		}
+	}
+	return visible
+}
+
+// channelsByID indexes a server's channels for overwriteSource
+func channelsByID(channels []*models.Channel) map[uuid.UUID]*models.Channel {
+	byID := make(map[uuid.UUID]*models.Channel, len(channels))
+	for _, ch := range channels {
+		byID[ch.ID] = ch
+	}
+	return byID
+}
+
+// overwriteSource returns the channel whose overwrites apply to ch: the
+// parent for a thread, otherwise ch itself. It is nil for a thread whose
+// parent isn't in byID.
+func overwriteSource(ch *models.Channel, byID map[uuid.UUID]*models.Channel) *models.Channel {
+	if ch.IsThread() {
+		return byID[ch.ParentID]
+	}
+	return ch
+}
+
 // HandleSendMessage processes a message send request
 func (h *Handlers) HandleSendMessage(c *Client, msg *protocol.Message) {
 	var payload protocol.SendMessagePayload
@@ -130,13 +240,45 @@ func (h *Handlers) HandleSendMessage(c *Client, msg *protocol.Message) {
 		return
 	}
 
-	// Reject messages from server-muted members
-	if len(c.ServerIDs) > 0 {
-		member, err := h.db.GetServerMember(c.ServerIDs[0], c.UserID)
-		if err == nil && member.IsMuted {
+	// The send path needs the whole channel (slowmode, overwrites, thread
+	// state), so load it once and refresh the routing cache from it
+	channel, err := h.db.GetChannelByID(payload.ChannelID)
+	if err != nil {
+		h.channels.forget(payload.ChannelID)
+		c.sendError(protocol.ErrorCodeUnknownChannel, "Channel not found")
+		return
+	}
+	h.channels.set(channel.ID, channel.ServerID)
+
+	var recipients []uuid.UUID
+	var member *models.ServerMember
+	if channel.IsDM() {
+		// Only the channel's recipients may post in a DM
+		recipients, err = h.db.GetDMRecipients(payload.ChannelID)
+		if err != nil || !containsUUID(recipients, c.UserID) {
+			c.sendError(protocol.ErrorCodeForbidden, "You are not part of this conversation")
+			return
+		}
+	} else {
+		member, err = h.db.GetServerMember(channel.ServerID, c.UserID)
+		if err != nil {
+			c.sendError(protocol.ErrorCodeForbidden, "Not a member of this server")
+			return
+		}
+		// Reject messages from server-muted members
+		if member.IsMuted {
 			c.sendError(protocol.ErrorCodeForbidden, "You are muted on this server")
 			return
 		}
+
+		send := models.PermissionSendMessages
+		if channel.IsThread() {
+			send = models.PermissionSendMessagesThreads
+		}
+		if err := h.checkChannelPermission(c.UserID, channel, models.PermissionViewChannels|send); err != nil {
+			c.sendError(protocol.ErrorCodeForbidden, "You cannot send messages in this channel")
+			return
+		}
 	}
 
 	if len(payload.Content) > 2000 {
@@ -144,36 +286,69 @@ func (h *Handlers) HandleSendMessage(c *Client, msg *protocol.Message) {
 		return
 	}
 
-	// Create the message
+	// Create the message; a reply must point at a message in the same channel
 	newMsg := models.NewMessage(payload.ChannelID, c.UserID, payload.Content)
 	if payload.ReplyToID != nil {
+		parent, err := h.db.GetMessageByID(*payload.ReplyToID)
+		if err != nil || parent.ChannelID != payload.ChannelID {
+			c.sendError(protocol.ErrorCodeNotFound, "The message you replied to no longer exists")
+			return
+		}
 		newMsg.ReplyToID = payload.ReplyToID
 	}
 
+	// Slowmode, once the message is known to be valid; members who can manage
+	// the channel's messages are exempt. Manage Channels doesn't count since
+	// @everyone has it by default.
+	slowed := channel.RateLimitPerUser > 0 && !channel.IsDM() &&
+		h.checkChannelPermission(c.UserID, channel, models.PermissionManageMessages) != nil
+	if slowed {
+		if wait := h.slowmode.take(channel.ID, c.UserID, channel.RateLimitPerUser); wait > 0 {
+			c.sendRateLimited(fmt.Sprintf("Slowmode is on in #%s; wait %s", channel.Name, wait.Round(time.Second)), wait)
+			return
+		}
+	}
+
 	// Save to database
 	if err := h.db.CreateMessage(newMsg); err != nil {
 		log.Printf("Failed to save message: %v", err)
+		if slowed {
+			h.slowmode.refund(channel.ID, c.UserID)
+		}
 		c.sendError(protocol.ErrorCodeServerError, "Failed to save message")
 		return
 	}
 
+	// Replying in an archived thread reopens it
+	if channel.IsThread() && channel.Thread.Archived {
+		if err := h.setThreadArchived(channel, false); err != nil {
+			log.Printf("Failed to reopen thread %s: %v", channel.ID, err)
+		}
+	}
+
 	// Stop typing indicator for this user
 	h.typingManager.StopTyping(c.UserID, payload.ChannelID)
 
-	// Get channel to determine server ID
-	// For now, we'll broadcast to channel subscribers
-	// TODO: Look up channel and get server ID for proper broadcasting
-
 	// Create the response payload
 	responsePayload := &protocol.MessageCreatePayload{
 		Message: newMsg,
 		Author:  c.User,
+		Member:  member,
 		Nonce:   payload.Nonce,
 	}
 
 	// Broadcast to channel
 	h.hub.BroadcastToChannel(payload.ChannelID, protocol.EventMessageCreate, responsePayload, nil)
 
+	// Queue DMs for offline recipients; they receive them with their next READY
+	for _, userID := range recipients {
+		if userID != c.UserID && !h.hub.IsUserOnline(userID) {
+			if err := h.db.AddUndeliveredMessage(newMsg.ID, userID); err != nil {
+				log.Printf("Failed to queue DM for %s: %v", userID, err)
+			}
+		}
+	}
+
 	log.Printf("Message sent: channel=%s, author=%s", payload.ChannelID, c.User.Username)
 }
 
@@ -185,9 +360,32 @@ func (h *Handlers) HandleTypingStart(c *Client, msg *protocol.Message) {
 		return
 	}
 
-	// TODO: Look up channel to get server ID
-	// For now, use a nil UUID
-	h.typingManager.StartTyping(c.UserID, payload.ChannelID, uuid.Nil)
+	serverID, err := h.channelServer(payload.ChannelID)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeUnknownChannel, "Channel not found")
+		return
+	}
+	// Only members (or DM recipients) who can see the channel are subscribed
+	// to it; typing anywhere else is dropped quietly
+	if !h.hub.IsInChannel(c.UserID, payload.ChannelID) {
+		return
+	}
+
+	h.typingManager.StartTyping(c.UserID, payload.ChannelID, serverID)
+}
+
+// channelServer returns the server a channel belongs to, or uuid.Nil for a
+// DM, loading it into the cache on first use
+func (h *Handlers) channelServer(channelID uuid.UUID) (uuid.UUID, error) {
+	if serverID, ok := h.channels.get(channelID); ok {
+		return serverID, nil
+	}
+	channel, err := h.db.GetChannelByID(channelID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	h.channels.set(channel.ID, channel.ServerID)
+	return channel.ServerID, nil
 }
 
 // HandlePresenceUpdate processes a presence update
@@ -245,11 +443,12 @@ func (h *Handlers) HandleRequestGuild(c *Client, msg *protocol.Message) {
 		return
 	}
 
-	// Get channels
+	// Get the channels the user can see
 	channels, err := h.db.GetServerChannels(payload.ServerID)
 	if err != nil {
 		log.Printf("Failed to get channels: %v", err)
 	}
+	channels = h.visibleChannels(c.UserID, payload.ServerID, channels)
 
 	// Get roles
 	roles, err := h.db.GetServerRoles(payload.ServerID)
@@ -274,10 +473,377 @@ func (h *Handlers) HandleRequestGuild(c *Client, msg *protocol.Message) {
 	c.SendDispatch(protocol.EventServerCreate, guildData)
 }
 
-// HandleJoinServer handles a user joining a server via invite
-func (h *Handlers) HandleJoinServer(c *Client, inviteCode string) error {
-	// TODO: Implement invite validation and server join logic
-	return nil
+// Invite redemption errors
+var (
+	ErrInviteInvalid = errors.New("invite is invalid or has expired")
+	ErrInviteBanned  = errors.New("you are banned from this server")
+)
+
+// RedeemInvite validates an invite code and adds the user to its server.
+// Redeeming an invite for a server the user already belongs to is a no-op and
+// does not consume a use.
+func (h *Handlers) RedeemInvite(userID uuid.UUID, code string) (*models.Server, error) {
+	invite, err := h.db.GetInvite(code)
+	if err != nil || !invite.IsUsable() {
+		return nil, ErrInviteInvalid
+	}
+	server, err := h.db.GetServerByID(invite.ServerID)
+	if err != nil {
+		return nil, ErrInviteInvalid
+	}
+	if banned, err := h.db.IsBanned(server.ID, userID); err != nil {
+		return nil, err
+	} else if banned {
+		return nil, ErrInviteBanned
+	}
+	if _, err := h.db.GetServerMember(server.ID, userID); err == nil {
+		return server, nil
+	}
+
+	// Consume the use and add the member together so concurrent redemptions
+	// can't exceed max_uses and a failed join doesn't burn a use
+	member := models.NewServerMember(userID, server.ID)
+	ok, err := h.db.UseInvite(code, member)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInviteInvalid
+	}
+
+	if err := h.HandleJoinServer(member, server); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// HandleJoinServer assigns @everyone to a member who was just added to a
+// server and notifies existing members. If the user is online, their session
+// is subscribed to the server and receives a SERVER_CREATE with the full
+// server state.
+func (h *Handlers) HandleJoinServer(member *models.ServerMember, server *models.Server) error {
+	userID := member.UserID
+	roles, err := h.db.GetServerRoles(server.ID)
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if role.IsDefault {
+			if err := h.db.AddMemberRole(userID, server.ID, role.ID); err != nil {
+				log.Printf("Failed to assign @everyone role: %v", err)
+			}
+			member.AddRole(role.ID)
+			break
+		}
+	}
+	user, err := h.db.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	addPayload := &protocol.ServerMemberAddPayload{ServerID: server.ID, Member: member, User: user}
+	h.hub.BroadcastToServer(server.ID, protocol.EventServerMemberAdd, addPayload, &userID)
+
+	if !h.hub.IsUserOnline(userID) {
+		return nil
+	}
+	h.hub.AddClientToServer(userID, server.ID)
+	channels, _ := h.db.GetServerChannels(server.ID)
+	channels = h.visibleChannels(userID, server.ID, channels)
+	for _, channel := range channels {
+		h.hub.JoinChannel(userID, channel.ID)
+	}
+	members, _ := h.db.GetServerMembers(server.ID)
+	userIDs := make([]uuid.UUID, 0, len(members))
+	for _, m := range members {
+		userIDs = append(userIDs, m.UserID)
+	}
+	users, _ := h.db.GetUsersByIDs(userIDs)
+	createPayload := &protocol.ServerCreatePayload{
+		Server:   server,
+		Channels: channels,
+		Members:  members,
+		Roles:    roles,
+		Users:    users,
+	}
+	return h.hub.SendToUser(userID, protocol.EventServerCreate, createPayload)
+}
+
+// HandleServerCreate creates a server owned by the caller, with an @everyone
+// role and a #general channel, and sends it to them as a SERVER_CREATE
+func (h *Handlers) HandleServerCreate(c *Client, msg *protocol.Message) {
+	var req protocol.ServerCreateRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid payload")
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Server name cannot be empty")
+		return
+	}
+	if len(name) > 100 {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Server name too long (max 100 characters)")
+		return
+	}
+
+	server := models.NewServer(name, c.UserID)
+	everyoneRole, generalChannel, err := h.db.CreateServerWithDefaults(server)
+	if err != nil {
+		log.Printf("Failed to create server %q: %v", name, err)
+		c.sendError(protocol.ErrorCodeServerError, "Failed to create server")
+		return
+	}
+	log.Printf("Server created: ID=%s, Name=%s, Owner=%s", server.ID, server.Name, c.UserID)
+	h.channels.set(generalChannel.ID, server.ID)
+
+	member, err := h.db.GetServerMember(server.ID, c.UserID)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeServerError, "Failed to create server")
+		return
+	}
+	h.hub.AddClientToServer(c.UserID, server.ID)
+	h.hub.JoinChannel(c.UserID, generalChannel.ID)
+	c.SendDispatch(protocol.EventServerCreate, &protocol.ServerCreatePayload{
+		Server:   server,
+		Channels: []*models.Channel{generalChannel},
+		Members:  []*models.ServerMember{member},
+		Roles:    []*models.Role{everyoneRole},
+		Users:    []*models.User{c.User},
+	})
+	h.audit(c, server.ID, models.AuditServerCreate, serverTarget(server), "", nil, snapshot(server))
+}
+
+// HandleServerLeave removes the caller from a server. The owner has to
+// transfer ownership or delete the server instead.
+func (h *Handlers) HandleServerLeave(c *Client, msg *protocol.Message) {
+	var req protocol.ServerLeaveRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid payload")
+		return
+	}
+	server, err := h.db.GetServerByID(req.ServerID)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeNotFound, "Server not found")
+		return
+	}
+	if _, err := h.db.GetServerMember(server.ID, c.UserID); err != nil {
+		c.sendError(protocol.ErrorCodeNotFound, "Not a member of this server")
+		return
+	}
+	if server.OwnerID == c.UserID {
+		c.sendError(protocol.ErrorCodeForbidden, "The owner can't leave; transfer ownership or delete the server")
+		return
+	}
+
+	roles, _ := h.db.GetMemberRoles(server.ID, c.UserID)
+	for _, role := range roles {
+		_ = h.db.RemoveMemberRole(c.UserID, server.ID, role.ID)
+	}
+	if err := h.db.RemoveServerMember(c.UserID, server.ID); err != nil {
+		c.sendError(protocol.ErrorCodeServerError, "Failed to leave server")
+		return
+	}
+	h.removeMember(c.UserID, server.ID)
+	removePayload := &protocol.ServerMemberRemovePayload{ServerID: server.ID, User: c.User}
+	h.hub.BroadcastToServer(server.ID, protocol.EventServerMemberRemove, removePayload, nil)
+	h.audit(c, server.ID, models.AuditMemberLeave, userTarget(c.User), "", snapshot(roles), nil)
+}
+
+// HandleServerDelete deletes a server with everything in it (owner only).
+// Every member still connected receives a SERVER_DELETE.
+func (h *Handlers) HandleServerDelete(c *Client, msg *protocol.Message) {
+	var req protocol.ServerDeleteRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid payload")
+		return
+	}
+	server, err := h.db.GetServerByID(req.ServerID)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeNotFound, "Server not found")
+		return
+	}
+	if server.OwnerID != c.UserID {
+		c.sendError(protocol.ErrorCodeForbidden, "Only the server owner can delete the server")
+		return
+	}
+
+	// Channels are needed afterwards to unsubscribe connected members
+	channels, err := h.db.GetServerChannels(server.ID)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeServerError, "Failed to delete server")
+		return
+	}
+	if err := h.db.DeleteServer(server.ID); err != nil {
+		log.Printf("Failed to delete server %s: %v", server.ID, err)
+		c.sendError(protocol.ErrorCodeServerError, "Failed to delete server")
+		return
+	}
+	log.Printf("Server deleted: ID=%s, Name=%s, by %s", server.ID, server.Name, c.UserID)
+	for _, channel := range channels {
+		h.channels.forget(channel.ID)
+	}
+
+	for _, userID := range h.hub.GetOnlineUsers(server.ID) {
+		h.removeFromServer(userID, server.ID, channels)
+	}
+}
+
+// HandleServerTransfer makes another member the server's owner (owner only)
+func (h *Handlers) HandleServerTransfer(c *Client, msg *protocol.Message) {
+	var req protocol.ServerTransferRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid payload")
+		return
+	}
+	server, err := h.db.GetServerByID(req.ServerID)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeNotFound, "Server not found")
+		return
+	}
+	if server.OwnerID != c.UserID {
+		c.sendError(protocol.ErrorCodeForbidden, "Only the server owner can transfer ownership")
+		return
+	}
+	if req.UserID == c.UserID {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "You already own this server")
+		return
+	}
+	if _, err := h.db.GetServerMember(server.ID, req.UserID); err != nil {
+		c.sendError(protocol.ErrorCodeNotFound, "New owner must be a member of the server")
+		return
+	}
+
+	if err := h.db.UpdateServerOwner(server.ID, req.UserID); err != nil {
+		c.sendError(protocol.ErrorCodeServerError, "Failed to transfer ownership")
+		return
+	}
+	server.OwnerID = req.UserID
+	h.hub.BroadcastToServer(server.ID, protocol.EventServerUpdate, &protocol.ServerUpdatePayload{Server: server}, nil)
+	h.audit(c, server.ID, models.AuditServerTransfer, h.memberTarget(req.UserID), "",
+		snapshot(map[string]uuid.UUID{"owner_id": c.UserID}), snapshot(map[string]uuid.UUID{"owner_id": req.UserID}))
+}
+
+// removeFromServer unsubscribes a user's connection from a server they are no
+// longer in (left, kicked, banned or deleted) and tells their client to drop it
+func (h *Handlers) removeFromServer(userID, serverID uuid.UUID, channels []*models.Channel) {
+	h.hub.RemoveClientFromServer(userID, serverID)
+	for _, channel := range channels {
+		h.hub.LeaveChannel(userID, channel.ID)
+	}
+	h.hub.SendToUser(userID, protocol.EventServerDelete, &protocol.ServerDeletePayload{ServerID: serverID})
+}
+
+// removeMember is removeFromServer for a member who left or was removed
+// from a server that still exists
+func (h *Handlers) removeMember(userID, serverID uuid.UUID) {
+	channels, _ := h.db.GetServerChannels(serverID)
+	h.removeFromServer(userID, serverID, channels)
+}
+
+// HandleInviteCreate creates an invite code (requires PermissionCreateInvite).
+// The invite is returned only to the creator.
+func (h *Handlers) HandleInviteCreate(c *Client, msg *protocol.Message) {
+	var req protocol.InviteCreateRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid payload")
+		return
+	}
+	if err := h.checkPermission(c.UserID, req.ServerID, models.PermissionCreateInvite); err != nil {
+		c.sendError(protocol.ErrorCodeForbidden, err.Error())
+		return
+	}
+	server, err := h.db.GetServerByID(req.ServerID)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeNotFound, "Server not found")
+		return
+	}
+	if !server.InvitesEnabled {
+		c.sendError(protocol.ErrorCodeForbidden, "Invites are disabled on this server")
+		return
+	}
+
+	invite := server.GenerateInvite(c.UserID, uuid.Nil)
+	if req.MaxAge != nil || req.MaxUses != nil {
+		if req.MaxAge != nil {
+			invite.MaxAge = *req.MaxAge
+		}
+		if req.MaxUses != nil {
+			invite.MaxUses = *req.MaxUses
+		}
+		if invite.MaxAge < 0 || invite.MaxUses < 0 {
+			c.sendError(protocol.ErrorCodeInvalidPayload, "Invite limits cannot be negative")
+			return
+		}
+		invite.ExpiresAt = nil
+		if invite.MaxAge > 0 {
+			expiresAt := invite.CreatedAt.Add(time.Duration(invite.MaxAge) * time.Second)
+			invite.ExpiresAt = &expiresAt
+		}
+	}
+
+	if err := h.db.CreateInvite(invite); err != nil {
+		log.Printf("Failed to create invite: %v", err)
+		c.sendError(protocol.ErrorCodeServerError, "Failed to create invite")
+		return
+	}
+	c.SendDispatch(protocol.EventInviteCreate, &protocol.InvitePayload{ServerID: req.ServerID, Invite: invite})
+	h.audit(c, req.ServerID, models.AuditInviteCreate, inviteTarget(invite), "", nil, snapshot(invite))
+}
+
+// HandleInviteList lists a server's active invites (requires PermissionManageServer).
+func (h *Handlers) HandleInviteList(c *Client, msg *protocol.Message) {
+	var req protocol.InviteListRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid payload")
+		return
+	}
+	if err := h.checkPermission(c.UserID, req.ServerID, models.PermissionManageServer); err != nil {
+		c.sendError(protocol.ErrorCodeForbidden, err.Error())
+		return
+	}
+	invites, err := h.db.GetServerInvites(req.ServerID)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeServerError, "Failed to list invites")
+		return
+	}
+	// Hide invites that can no longer be redeemed
+	active := make([]*models.Invite, 0, len(invites))
+	for _, invite := range invites {
+		if invite.IsUsable() {
+			active = append(active, invite)
+		}
+	}
+	c.SendDispatch(protocol.EventInvitesList, &protocol.InvitesListPayload{ServerID: req.ServerID, Invites: active})
+}
+
+// HandleInviteRevoke revokes an invite. The inviter may revoke their own invites;
+// anyone else needs PermissionManageServer.
+func (h *Handlers) HandleInviteRevoke(c *Client, msg *protocol.Message) {
+	var req protocol.InviteRevokeRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid payload")
+		return
+	}
+	invite, err := h.db.GetInvite(req.Code)
+	if err != nil || invite.ServerID != req.ServerID {
+		c.sendError(protocol.ErrorCodeNotFound, "Invite not found")
+		return
+	}
+	if invite.InviterID != c.UserID {
+		if err := h.checkPermission(c.UserID, req.ServerID, models.PermissionManageServer); err != nil {
+			c.sendError(protocol.ErrorCodeForbidden, err.Error())
+			return
+		}
+	}
+	if err := h.db.RevokeInvite(req.Code); err != nil {
+		c.sendError(protocol.ErrorCodeServerError, "Failed to revoke invite")
+		return
+	}
+	before := snapshot(invite)
+	invite.Revoke()
+	c.SendDispatch(protocol.EventInviteDelete, &protocol.InvitePayload{ServerID: req.ServerID, Invite: invite})
+	h.audit(c, req.ServerID, models.AuditInviteRevoke, inviteTarget(invite), "", before, nil)
 }
 
 // HandleCreateChannel handles channel creation requests
@@ -329,17 +895,22 @@ func (h *Handlers) HandleCreateChannel(c *Client, msg *protocol.Message) {
 		c.sendError(protocol.ErrorCodeServerError, "Failed to create channel")
 		return
 	}
+	h.channels.set(channel.ID, channel.ServerID)
 
-	// Auto-join all connected users on this server to the new channel
-	onlineUsers := h.hub.GetOnlineUsers(req.ServerID)
-	for _, userID := range onlineUsers {
+	// Auto-join connected users on this server who can see the new channel
+	viewers := h.channelViewers(channel)
+	for _, userID := range viewers {
 		h.hub.JoinChannel(userID, channel.ID)
 	}
-	log.Printf("Auto-joined %d users to new channel %s", len(onlineUsers), channel.Name)
+	log.Printf("Auto-joined %d users to new channel %s", len(viewers), channel.Name)
 
-	// Broadcast to all server members
+	// Tell only the members who can see it
 	payload := protocol.ChannelCreatePayload{Channel: channel}
-	h.hub.BroadcastToServer(req.ServerID, protocol.EventChannelCreate, payload, nil)
+	for _, userID := range viewers {
+		h.hub.SendToUser(userID, protocol.EventChannelCreate, payload)
+	}
+
+	h.audit(c, req.ServerID, models.AuditChannelCreate, channelTarget(channel), "", nil, snapshot(channel))
 }
 
 // HandleUpdateChannel handles channel update requests
@@ -359,7 +930,7 @@ func (h *Handlers) HandleUpdateChannel(c *Client, msg *protocol.Message) {
 	// Get existing channel
 	channel, err := h.db.GetChannelByID(req.ChannelID)
 	if err != nil {
-		c.sendError(protocol.ErrorCodeNotFound, "Channel not found")
+		c.sendError(protocol.ErrorCodeUnknownChannel, "Channel not found")
 		return
 	}
 
@@ -369,6 +940,8 @@ func (h *Handlers) HandleUpdateChannel(c *Client, msg *protocol.Message) {
 		return
 	}
 
+	before := snapshot(channel)
+
 	// Apply updates
 	if req.Name != nil {
 		if *req.Name == "" {
@@ -383,15 +956,30 @@ func (h *Handlers) HandleUpdateChannel(c *Client, msg *protocol.Message) {
 	if req.Position != nil {
 		channel.Position = *req.Position
 	}
+	if req.RateLimitPerUser != nil {
+		if *req.RateLimitPerUser < 0 || *req.RateLimitPerUser > maxSlowmodeSeconds {
+			c.sendError(protocol.ErrorCodeInvalidPayload, fmt.Sprintf("Slowmode must be between 0 and %d seconds", maxSlowmodeSeconds))
+			return
+		}
+		if channel.RateLimitPerUser != *req.RateLimitPerUser {
+			channel.RateLimitPerUser = *req.RateLimitPerUser
+			h.slowmode.reset(channel.ID)
+		}
+	}
 
 	if err := h.db.UpdateChannel(channel); err != nil {
 		c.sendError(protocol.ErrorCodeServerError, "Failed to update channel")
 		return
 	}
 
-	// Broadcast to all server members
+	// Tell only the members who can see it; the client adds unknown channels
+	// on CHANNEL_UPDATE, so a broadcast would reveal hidden ones
 	payload := protocol.ChannelUpdatePayload{Channel: channel}
-	h.hub.BroadcastToServer(req.ServerID, protocol.EventChannelUpdate, payload, nil)
+	for _, userID := range h.channelViewers(channel) {
+		h.hub.SendToUser(userID, protocol.EventChannelUpdate, payload)
+	}
+
+	h.audit(c, req.ServerID, models.AuditChannelUpdate, channelTarget(channel), "", before, snapshot(channel))
 }
 
 // HandleDeleteChannel handles channel deletion requests
@@ -411,7 +999,7 @@ func (h *Handlers) HandleDeleteChannel(c *Client, msg *protocol.Message) {
 	// Get channel to verify it exists and belongs to this server
 	channel, err := h.db.GetChannelByID(req.ChannelID)
 	if err != nil {
-		c.sendError(protocol.ErrorCodeNotFound, "Channel not found")
+		c.sendError(protocol.ErrorCodeUnknownChannel, "Channel not found")
 		return
 	}
 
@@ -420,18 +1008,166 @@ func (h *Handlers) HandleDeleteChannel(c *Client, msg *protocol.Message) {
 		return
 	}
 
+	// Threads go with their parent
+	threads, err := h.db.GetChannelThreads(req.ChannelID)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeServerError, "Failed to delete channel")
+		return
+	}
+	// Permissions can't be checked once it's gone
+	viewers := h.channelViewers(channel)
+
 	if err := h.db.DeleteChannel(req.ChannelID); err != nil {
 		c.sendError(protocol.ErrorCodeServerError, "Failed to delete channel")
 		return
 	}
+	h.channels.forget(req.ChannelID)
+	for _, thread := range threads {
+		h.channels.forget(thread.ID)
+	}
 
-	// Broadcast to all server members
+	// Tell only the members who could see it
 	payload := protocol.ChannelDeletePayload{
 		ChannelID: req.ChannelID,
 		ServerID:  req.ServerID,
 		Type:      channel.Type,
 	}
-	h.hub.BroadcastToServer(req.ServerID, protocol.EventChannelDelete, payload, nil)
+	for _, userID := range viewers {
+		h.hub.SendToUser(userID, protocol.EventChannelDelete, payload)
+	}
+
+	h.audit(c, req.ServerID, models.AuditChannelDelete, channelTarget(channel), "", snapshot(channel), nil)
+}
+
+// HandleThreadCreate starts a thread from a message in a text channel
+// (requires PermissionCreateThreads). Everyone subscribed to the parent
+// channel is subscribed to the thread and gets THREAD_CREATE.
+func (h *Handlers) HandleThreadCreate(c *Client, msg *protocol.Message) {
+	var req protocol.ThreadCreateRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid request format")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Thread name cannot be empty")
+		return
+	}
+	if len(req.Name) > 100 {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Thread name too long (max 100 characters)")
+		return
+	}
+	if req.AutoArchiveMinutes == 0 {
+		req.AutoArchiveMinutes = models.DefaultThreadAutoArchive
+	}
+	if req.AutoArchiveMinutes < models.MinThreadAutoArchive || req.AutoArchiveMinutes > models.MaxThreadAutoArchive {
+		c.sendError(protocol.ErrorCodeInvalidPayload, fmt.Sprintf("Auto-archive must be between %d and %d minutes",
+			models.MinThreadAutoArchive, models.MaxThreadAutoArchive))
+		return
+	}
+
+	parent, err := h.db.GetChannelByID(req.ChannelID)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeUnknownChannel, "Channel not found")
+		return
+	}
+	if parent.Type != models.ChannelTypeText {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Threads can only be started in server text channels")
+		return
+	}
+	if err := h.checkChannelPermission(c.UserID, parent, models.PermissionViewChannels|models.PermissionCreateThreads); err != nil {
+		c.sendError(protocol.ErrorCodeForbidden, "You cannot start threads in this channel")
+		return
+	}
+
+	anchor, err := h.db.GetMessageByID(req.MessageID)
+	if err != nil || anchor.ChannelID != parent.ID {
+		c.sendError(protocol.ErrorCodeNotFound, "Message not found")
+		return
+	}
+	if existing, _ := h.db.GetMessageThread(anchor.ID); existing != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, fmt.Sprintf("That message already has a thread (%s)", existing.Name))
+		return
+	}
+
+	thread := models.NewThread(parent, anchor.ID, c.UserID, req.Name, req.AutoArchiveMinutes)
+	if err := h.db.CreateChannel(thread); err != nil {
+		log.Printf("Failed to create thread: %v", err)
+		c.sendError(protocol.ErrorCodeServerError, "Failed to create thread")
+		return
+	}
+	h.channels.set(thread.ID, thread.ServerID)
+
+	// Whoever can see the parent can see the thread
+	for _, userID := range h.hub.GetOnlineUsers(parent.ServerID) {
+		if h.hub.IsInChannel(userID, parent.ID) {
+			h.hub.JoinChannel(userID, thread.ID)
+		}
+	}
+
+	payload := protocol.ThreadCreatePayload{Channel: thread}
+	h.hub.BroadcastToChannel(parent.ID, protocol.EventThreadCreate, payload, nil)
+
+	log.Printf("Thread created: %s in #%s by %s", thread.Name, parent.Name, c.UserID)
+	h.audit(c, thread.ServerID, models.AuditThreadCreate, channelTarget(thread), "", nil, snapshot(thread))
+}
+
+// HandleThreadArchive archives or reopens a thread. The thread's creator
+// and members with PermissionManageMessages in the parent channel may do so.
+func (h *Handlers) HandleThreadArchive(c *Client, msg *protocol.Message) {
+	var req protocol.ThreadArchiveRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid request format")
+		return
+	}
+
+	thread, err := h.db.GetChannelByID(req.ThreadID)
+	if err != nil || !thread.IsThread() {
+		c.sendError(protocol.ErrorCodeUnknownChannel, "Thread not found")
+		return
+	}
+	if err := h.checkChannelPermission(c.UserID, thread, models.PermissionViewChannels); err != nil {
+		c.sendError(protocol.ErrorCodeUnknownChannel, "Thread not found")
+		return
+	}
+	if thread.Thread.OwnerID != c.UserID &&
+		h.checkChannelPermission(c.UserID, thread, models.PermissionManageMessages) != nil {
+		c.sendError(protocol.ErrorCodeForbidden, "Only the thread's creator or a moderator can do that")
+		return
+	}
+
+	// Nothing to change; resend the current state so the client catches up
+	if thread.Thread.Archived == req.Archived {
+		c.SendDispatch(protocol.EventThreadUpdate, protocol.ThreadUpdatePayload{Channel: thread})
+		return
+	}
+
+	if err := h.setThreadArchived(thread, req.Archived); err != nil {
+		log.Printf("Failed to update thread %s: %v", thread.ID, err)
+		c.sendError(protocol.ErrorCodeServerError, "Failed to update thread")
+		return
+	}
+	action := models.AuditThreadArchive
+	if !req.Archived {
+		action = models.AuditThreadUnarchive
+	}
+	h.audit(c, thread.ServerID, action, channelTarget(thread), "", nil, nil)
+}
+
+// setThreadArchived stores a thread's archived state and broadcasts
+// THREAD_UPDATE to everyone subscribed to it
+func (h *Handlers) setThreadArchived(thread *models.Channel, archived bool) error {
+	if err := h.db.SetThreadArchived(thread.ID, archived); err != nil {
+		return err
+	}
+	thread.Thread.Archived = archived
+	if !archived {
+		thread.Thread.LastMessageAt = time.Now()
+	}
+	payload := protocol.ThreadUpdatePayload{Channel: thread}
+	h.hub.BroadcastToChannel(thread.ID, protocol.EventThreadUpdate, payload, nil)
+	return nil
 }
 
 // HandleRequestMessages handles message history requests
@@ -449,8 +1185,30 @@ func (h *Handlers) HandleRequestMessages(c *Client, msg *protocol.Message) {
 
 	log.Printf("HandleRequestMessages: user=%s, channel=%s, limit=%d", c.UserID, req.ChannelID, req.Limit)
 
+	channel, err := h.db.GetChannelByID(req.ChannelID)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeUnknownChannel, "Channel not found")
+		return
+	}
+	if channel.IsDM() {
+		// DM history is only visible to the channel's recipients
+		recipients, err := h.db.GetDMRecipients(channel.ID)
+		if err != nil || !containsUUID(recipients, c.UserID) {
+			c.sendError(protocol.ErrorCodeForbidden, "You are not part of this conversation")
+			return
+		}
+	} else if err := h.checkChannelPermission(c.UserID, channel, models.PermissionViewChannels|models.PermissionReadMessageHistory); err != nil {
+		c.sendError(protocol.ErrorCodeForbidden, "You cannot read this channel's history")
+		return
+	}
+
 	// Get messages from database
-	messages, err := h.db.GetChannelMessages(req.ChannelID, req.Limit, nil)
+	var messages []*models.Message
+	if req.Around != nil {
+		messages, err = h.db.GetChannelMessagesAround(req.ChannelID, *req.Around, req.Limit)
+	} else {
+		messages, err = h.db.GetChannelMessages(req.ChannelID, req.Limit, req.Before)
+	}
 	if err != nil {
 		c.sendError(protocol.ErrorCodeServerError, "Failed to retrieve messages")
 		log.Printf("Failed to get channel messages: %v", err)
@@ -475,37 +1233,245 @@ func (h *Handlers) HandleRequestMessages(c *Client, msg *protocol.Message) {
 		})
 	}
 
+	pinned, err := h.db.GetPinnedMessages(req.ChannelID)
+	if err != nil {
+		log.Printf("Failed to get pinned messages: %v", err)
+	}
+
 	// Send history via OpDispatch
 	payload := &protocol.MessageHistoryPayload{
-		ChannelID: req.ChannelID,
-		Messages:  displayMessages,
-		HasMore:   len(messages) == req.Limit, // Simple pagination check
+		ChannelID:      req.ChannelID,
+		Messages:       displayMessages,
+		HasMore:        len(messages) == req.Limit, // Simple pagination check
+		PinnedMessages: pinned,
+		Around:         req.Around,
+		Before:         req.Before,
 	}
 
 	h.hub.SendToUser(c.UserID, protocol.EventMessagesHistory, payload)
 }
 
+// HandleFetchMessages sends specific messages of a channel, such as the
+// parents of replies that aren't in the caller's loaded history
+func (h *Handlers) HandleFetchMessages(c *Client, msg *protocol.Message) {
+	var req protocol.MessageFetchRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid fetch request")
+		return
+	}
+	if len(req.MessageIDs) == 0 || len(req.MessageIDs) > 50 {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Fetch 1-50 messages at a time")
+		return
+	}
+
+	channel, err := h.db.GetChannelByID(req.ChannelID)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeUnknownChannel, "Channel not found")
+		return
+	}
+	if channel.IsDM() {
+		recipients, err := h.db.GetDMRecipients(channel.ID)
+		if err != nil || !containsUUID(recipients, c.UserID) {
+			c.sendError(protocol.ErrorCodeForbidden, "You are not part of this conversation")
+			return
+		}
+	} else if err := h.checkChannelPermission(c.UserID, channel, models.PermissionViewChannels|models.PermissionReadMessageHistory); err != nil {
+		c.sendError(protocol.ErrorCodeForbidden, "You cannot read this channel's history")
+		return
+	}
+
+	payload := &protocol.MessagesFetchedPayload{ChannelID: req.ChannelID}
+	for _, id := range req.MessageIDs {
+		dbMsg, err := h.db.GetMessageByID(id)
+		if err != nil || dbMsg.ChannelID != req.ChannelID {
+			payload.Missing = append(payload.Missing, id)
+			continue
+		}
+		author, err := h.db.GetUserByID(dbMsg.AuthorID)
+		if err != nil {
+			payload.Missing = append(payload.Missing, id)
+			continue
+		}
+		payload.Messages = append(payload.Messages, &protocol.MessageDisplay{Message: dbMsg, Author: author})
+	}
+	c.SendDispatch(protocol.EventMessagesFetched, payload)
+}
+
+// HandleEditMessage replaces a message's content
+func (h *Handlers) HandleEditMessage(c *Client, msg *protocol.Message) {
+	var req protocol.MessageEditRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid edit payload")
+		return
+	}
+	if len(req.Content) == 0 || len(req.Content) > 2000 {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Message content must be 1-2000 characters")
+		return
+	}
+
+	message, channel, ok := h.authorizeMessageChange(c, req.ChannelID, req.MessageID)
+	if !ok {
+		return
+	}
+
+	before := snapshot(message)
+	message.Edit(req.Content)
+	if err := h.db.UpdateMessage(message); err != nil {
+		log.Printf("Failed to update message: %v", err)
+		c.sendError(protocol.ErrorCodeServerError, "Failed to edit message")
+		return
+	}
+
+	payload := &protocol.MessageUpdatePayload{
+		ID:        message.ID,
+		ChannelID: message.ChannelID,
+		Content:   message.Content,
+		EditedAt:  message.EditedAt,
+	}
+	h.hub.BroadcastToChannel(message.ChannelID, protocol.EventMessageUpdate, payload, nil)
+
+	// As with deletes, authors editing their own messages aren't moderation
+	if message.AuthorID != c.UserID {
+		h.audit(c, channel.ServerID, models.AuditMessageEdit, messageTarget(message, channel), "", before, snapshot(message))
+	}
+}
+
 // HandleDeleteMessage handles message deletion
-func (h *Handlers) HandleDeleteMessage(c *Client, messageID, channelID uuid.UUID) error {
-	// TODO: Implement permission checking and message deletion
-	// For now, just broadcast the delete event
+func (h *Handlers) HandleDeleteMessage(c *Client, msg *protocol.Message) {
+	var req protocol.MessageDeleteRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid delete payload")
+		return
+	}
+
+	message, channel, ok := h.authorizeMessageChange(c, req.ChannelID, req.MessageID)
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteMessage(message.ID); err != nil {
+		log.Printf("Failed to delete message: %v", err)
+		c.sendError(protocol.ErrorCodeServerError, "Failed to delete message")
+		return
+	}
 
 	payload := &protocol.MessageDeletePayload{
-		ID:        messageID,
-		ChannelID: channelID,
+		ID:        message.ID,
+		ChannelID: message.ChannelID,
+		ServerID:  channel.ServerID,
 	}
+	h.hub.BroadcastToChannel(message.ChannelID, protocol.EventMessageDelete, payload, nil)
 
-	h.hub.BroadcastToChannel(channelID, protocol.EventMessageDelete, payload, nil)
-	return nil
+	// Authors deleting their own messages aren't moderation
+	if message.AuthorID != c.UserID {
+		h.audit(c, channel.ServerID, models.AuditMessageDelete, messageTarget(message, channel), "", snapshot(message), nil)
+	}
+}
+
+// authorizeMessageChange loads a message for editing or deletion. The author
+// may change it while they can still view the channel; others also need
+// ManageMessages in the channel. Errors are reported to the client and ok is
+// false.
+func (h *Handlers) authorizeMessageChange(c *Client, channelID, messageID uuid.UUID) (*models.Message, *models.Channel, bool) {
+	message, err := h.db.GetMessageByID(messageID)
+	if err != nil || message.ChannelID != channelID {
+		c.sendError(protocol.ErrorCodeNotFound, "Message not found")
+		return nil, nil, false
+	}
+	channel, err := h.db.GetChannelByID(channelID)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeUnknownChannel, "Channel not found")
+		return nil, nil, false
+	}
+
+	if !channel.IsDM() {
+		if err := h.checkChannelPermission(c.UserID, channel, models.PermissionViewChannels); err != nil {
+			c.sendError(protocol.ErrorCodeUnknownChannel, "Channel not found")
+			return nil, nil, false
+		}
+	}
+	if message.AuthorID == c.UserID {
+		return message, channel, true
+	}
+	if channel.IsDM() {
+		c.sendError(protocol.ErrorCodeForbidden, "You can only change your own messages")
+		return nil, nil, false
+	}
+	if err := h.checkChannelPermission(c.UserID, channel, models.PermissionManageMessages); err != nil {
+		c.sendError(protocol.ErrorCodeForbidden, err.Error())
+		return nil, nil, false
+	}
+	return message, channel, true
 }
 
-// HandleReaction handles adding/removing reactions
-func (h *Handlers) HandleReaction(c *Client, messageID, channelID uuid.UUID, emoji string, add bool) error {
+// HandleReaction handles adding/removing the caller's reaction on a message
+func (h *Handlers) HandleReaction(c *Client, msg *protocol.Message, add bool) {
+	var req protocol.ReactionRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid reaction payload")
+		return
+	}
+	req.Emoji = strings.TrimSpace(req.Emoji)
+	if req.Emoji == "" || len(req.Emoji) > 32 || strings.ContainsAny(req.Emoji, " \t\n") {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid emoji")
+		return
+	}
+
+	message, err := h.db.GetMessageByID(req.MessageID)
+	if err != nil || message.ChannelID != req.ChannelID {
+		c.sendError(protocol.ErrorCodeNotFound, "Message not found")
+		return
+	}
+	channel, err := h.db.GetChannelByID(req.ChannelID)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeUnknownChannel, "Channel not found")
+		return
+	}
+
+	// Adding needs AddReactions in the channel (or DM membership); removing
+	// your own only needs the channel to still be visible
+	if channel.IsDM() {
+		if add {
+			recipients, err := h.db.GetDMRecipients(channel.ID)
+			if err != nil || !containsUUID(recipients, c.UserID) {
+				c.sendError(protocol.ErrorCodeForbidden, "You are not part of this conversation")
+				return
+			}
+		}
+	} else {
+		if err := h.checkChannelPermission(c.UserID, channel, models.PermissionViewChannels); err != nil {
+			c.sendError(protocol.ErrorCodeUnknownChannel, "Channel not found")
+			return
+		}
+		if add {
+			if err := h.checkChannelPermission(c.UserID, channel, models.PermissionAddReactions); err != nil {
+				c.sendError(protocol.ErrorCodeForbidden, err.Error())
+				return
+			}
+		}
+	}
+
+	var changed bool
+	if add {
+		changed, err = h.db.AddReaction(message.ID, c.UserID, req.Emoji)
+	} else {
+		changed, err = h.db.RemoveReaction(message.ID, c.UserID, req.Emoji)
+	}
+	if err != nil {
+		log.Printf("Failed to update reaction: %v", err)
+		c.sendError(protocol.ErrorCodeServerError, "Failed to update reaction")
+		return
+	}
+	if !changed {
+		return
+	}
+
 	payload := &protocol.ReactionPayload{
 		UserID:    c.UserID,
-		ChannelID: channelID,
-		MessageID: messageID,
-		Emoji:     emoji,
+		ChannelID: channel.ID,
+		MessageID: message.ID,
+		ServerID:  channel.ServerID,
+		Emoji:     req.Emoji,
 	}
 
 	eventType := protocol.EventMessageReactionAdd
@@ -513,8 +1479,7 @@ func (h *Handlers) HandleReaction(c *Client, messageID, channelID uuid.UUID, emo
 		eventType = protocol.EventMessageReactionRemove
 	}
 
-	h.hub.BroadcastToChannel(channelID, eventType, payload, nil)
-	return nil
+	h.hub.BroadcastToChannel(channel.ID, eventType, payload, nil)
 }
 
 // hashToken creates a SHA-256 hash of a token
@@ -523,14 +1488,22 @@ func hashToken(token string) string {
 	return hex.EncodeToString(hash[:])
 }
 
+const (
+	// A login session expires after this long without being used
+	sessionLifetime = 30 * 24 * time.Hour
+
+	// How often a connected client's session is marked as used
+	sessionTouchInterval = 10 * time.Minute
+)
+
 // CreateAuthToken generates a new authentication token for a user
 func (h *Handlers) CreateAuthToken(userID uuid.UUID, ipAddress, userAgent string) (string, error) {
 	// Generate a random token
 	token := uuid.New().String() + uuid.New().String()
 	tokenHash := hashToken(token)
 
-	// Token expires in 30 days
-	expiresAt := time.Now().Add(30 * 24 * time.Hour)
+	// Token expires after sessionLifetime without use
+	expiresAt := time.Now().Add(sessionLifetime)
 
 	_, err := h.db.CreateSession(userID, tokenHash, ipAddress, userAgent, expiresAt)
 	if err != nil {
@@ -551,6 +1524,91 @@ func (h *Handlers) RevokeAllUserTokens(userID uuid.UUID) error {
 	return h.db.DeleteUserSessions(userID)
 }
 
+// HandleSessionList sends the caller their login sessions
+func (h *Handlers) HandleSessionList(c *Client, msg *protocol.Message) {
+	h.sendSessions(c, 0)
+}
+
+// HandleSessionRevoke revokes one, all other, or the current login session
+// of the caller and closes the sockets using them
+func (h *Handlers) HandleSessionRevoke(c *Client, msg *protocol.Message) {
+	var req protocol.SessionRevokeRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid revoke request")
+		return
+	}
+
+	var targets []uuid.UUID
+	switch {
+	case req.Current:
+		targets = []uuid.UUID{c.authSessionID}
+	case req.Others:
+		sessions, err := h.db.GetUserSessions(c.UserID)
+		if err != nil {
+			c.sendError(protocol.ErrorCodeServerError, "Failed to load sessions")
+			return
+		}
+		for _, session := range sessions {
+			if session.ID != c.authSessionID {
+				targets = append(targets, session.ID)
+			}
+		}
+	case req.SessionID != nil:
+		targets = []uuid.UUID{*req.SessionID}
+	default:
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Say which session to revoke")
+		return
+	}
+
+	revoked := 0
+	loggedOut := false
+	for _, id := range targets {
+		ok, err := h.db.DeleteUserSession(c.UserID, id)
+		if err != nil {
+			log.Printf("Failed to revoke session %s: %v", id, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		revoked++
+		if id == c.authSessionID {
+			loggedOut = true
+		}
+	}
+	if req.SessionID != nil && revoked == 0 {
+		c.sendError(protocol.ErrorCodeNotFound, "Session not found")
+		return
+	}
+	log.Printf("Revoked %d session(s) for user %s", revoked, c.UserID)
+
+	if loggedOut {
+		h.hub.CloseAuthSessions(targets, "Logged out")
+		return
+	}
+	h.hub.CloseAuthSessions(targets, "Session revoked")
+	h.sendSessions(c, revoked)
+}
+
+// sendSessions dispatches SESSIONS_LIST to c, marking its own session
+func (h *Handlers) sendSessions(c *Client, revoked int) {
+	sessions, err := h.db.GetUserSessions(c.UserID)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeServerError, "Failed to load sessions")
+		return
+	}
+	for _, session := range sessions {
+		session.Current = session.ID == c.authSessionID
+	}
+	if sessions == nil {
+		sessions = []*models.Session{}
+	}
+	c.SendDispatch(protocol.EventSessionsList, &protocol.SessionsListPayload{
+		Sessions: sessions,
+		Revoked:  revoked,
+	})
+}
+
 // HandleRoleAssign assigns a named role to a member (requires PermissionManageRoles).
 func (h *Handlers) HandleRoleAssign(c *Client, msg *protocol.Message) {
 	var req protocol.RoleAssignRequest
@@ -567,11 +1625,17 @@ func (h *Handlers) HandleRoleAssign(c *Client, msg *protocol.Message) {
 		c.sendError(protocol.ErrorCodeNotFound, "Role not found")
 		return
 	}
+	if err := h.checkHierarchy(c.UserID, req.ServerID, &req.UserID, role); err != nil {
+		c.sendError(protocol.ErrorCodeRoleHierarchy, err.Error())
+		return
+	}
 	if err := h.db.AddMemberRole(req.UserID, req.ServerID, role.ID); err != nil {
 		c.sendError(protocol.ErrorCodeServerError, "Failed to assign role")
 		return
 	}
 	h.broadcastMemberUpdate(req.ServerID, req.UserID)
+	h.refreshMemberChannels(req.ServerID, req.UserID)
+	h.audit(c, req.ServerID, models.AuditRoleAssign, h.memberTarget(req.UserID), "", nil, snapshot(role))
 }
 
 // HandleRoleRemove removes a named role from a member (requires PermissionManageRoles).
@@ -590,92 +1654,639 @@ func (h *Handlers) HandleRoleRemove(c *Client, msg *protocol.Message) {
 		c.sendError(protocol.ErrorCodeNotFound, "Role not found")
 		return
 	}
+	if err := h.checkHierarchy(c.UserID, req.ServerID, &req.UserID, role); err != nil {
+		c.sendError(protocol.ErrorCodeRoleHierarchy, err.Error())
+		return
+	}
 	if err := h.db.RemoveMemberRole(req.UserID, req.ServerID, role.ID); err != nil {
 		c.sendError(protocol.ErrorCodeServerError, "Failed to remove role")
 		return
 	}
 	h.broadcastMemberUpdate(req.ServerID, req.UserID)
+	h.refreshMemberChannels(req.ServerID, req.UserID)
+	h.audit(c, req.ServerID, models.AuditRoleRemove, h.memberTarget(req.UserID), "", snapshot(role), nil)
 }
 
-// HandleKickMember removes a member from the server (requires PermissionKickMembers).
-func (h *Handlers) HandleKickMember(c *Client, msg *protocol.Message) {
-	var req protocol.KickMemberRequest
+// HandleRoleCreate creates a custom role at the bottom of the hierarchy (requires PermissionManageRoles).
+func (h *Handlers) HandleRoleCreate(c *Client, msg *protocol.Message) {
+	var req protocol.RoleCreateRequest
 	if err := json.Unmarshal(msg.Data, &req); err != nil {
 		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid payload")
 		return
 	}
-	if err := h.checkPermission(c.UserID, req.ServerID, models.PermissionKickMembers); err != nil {
+	if err := h.checkPermission(c.UserID, req.ServerID, models.PermissionManageRoles); err != nil {
 		c.sendError(protocol.ErrorCodeForbidden, err.Error())
 		return
 	}
-	target, err := h.db.GetUserByID(req.UserID)
-	if err != nil {
-		c.sendError(protocol.ErrorCodeNotFound, "User not found")
-		return
-	}
-	if err := h.db.RemoveServerMember(req.UserID, req.ServerID); err != nil {
-		c.sendError(protocol.ErrorCodeServerError, "Failed to kick member")
+
+	role := models.NewRole(req.ServerID, strings.TrimSpace(req.Name))
+	role.IsHoisted = req.IsHoisted
+	if !h.validRoleName(c, req.ServerID, uuid.Nil, role.Name) || !validRoleColor(c, req.Color) {
 		return
 	}
-	// Notify server of removal
-	removePayload := &protocol.ServerMemberRemovePayload{ServerID: req.ServerID, User: target}
-	h.hub.BroadcastToServer(req.ServerID, protocol.EventServerMemberRemove, removePayload, nil)
-	// Force-close the kicked user's connection
-	h.hub.mu.RLock()
-	kicked, ok := h.hub.clients[req.UserID]
-	h.hub.mu.RUnlock()
-	if ok {
-		kicked.conn.Close()
+	role.Color = req.Color
+	if req.Permissions != nil {
+		if !h.canGrant(c, req.ServerID, *req.Permissions) {
+			return
+		}
+		role.Permissions = *req.Permissions
 	}
-}
 
-// HandleBanMember bans a member from the server (requires PermissionBanMembers).
-func (h *Handlers) HandleBanMember(c *Client, msg *protocol.Message) {
-	var req protocol.BanMemberRequest
-	if err := json.Unmarshal(msg.Data, &req); err != nil {
-		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid payload")
-		return
-	}
-	if err := h.checkPermission(c.UserID, req.ServerID, models.PermissionBanMembers); err != nil {
-		c.sendError(protocol.ErrorCodeForbidden, err.Error())
+	role.Position = 1
+	if err := h.db.CreateRole(role); err != nil {
+		log.Printf("Failed to create role: %v", err)
+		c.sendError(protocol.ErrorCodeServerError, "Failed to create role")
 		return
 	}
-	target, err := h.db.GetUserByID(req.UserID)
+	// Renumber so the new role sits directly above @everyone
+	changed, err := h.db.MoveRole(req.ServerID, role.ID, 1)
 	if err != nil {
-		c.sendError(protocol.ErrorCodeNotFound, "User not found")
-		return
-	}
-	if err := h.db.AddBan(req.ServerID, req.UserID, c.UserID, req.Reason); err != nil {
-		c.sendError(protocol.ErrorCodeServerError, "Failed to ban member")
-		return
+		log.Printf("Failed to position role: %v", err)
 	}
-	_ = h.db.RemoveServerMember(req.UserID, req.ServerID)
-	removePayload := &protocol.ServerMemberRemovePayload{ServerID: req.ServerID, User: target}
-	h.hub.BroadcastToServer(req.ServerID, protocol.EventServerMemberRemove, removePayload, nil)
-	h.hub.mu.RLock()
-	banned, ok := h.hub.clients[req.UserID]
-	h.hub.mu.RUnlock()
-	if ok {
-		banned.conn.Close()
+
+	h.hub.BroadcastToServer(req.ServerID, protocol.EventRoleCreate, &protocol.RolePayload{ServerID: req.ServerID, Role: role}, nil)
+	h.audit(c, req.ServerID, models.AuditRoleCreate, roleTarget(role), "", nil, snapshot(role))
+	for _, r := range changed {
+		if r.ID != role.ID {
+			h.hub.BroadcastToServer(req.ServerID, protocol.EventRoleUpdate, &protocol.RolePayload{ServerID: req.ServerID, Role: r}, nil)
+		}
 	}
 }
 
-// HandleMuteMember server-mutes or unmutes a member (requires PermissionMuteMembers).
-func (h *Handlers) HandleMuteMember(c *Client, msg *protocol.Message) {
-	var req protocol.MuteMemberRequest
+// HandleRoleUpdate edits or reorders a role below the caller's highest role (requires PermissionManageRoles).
+func (h *Handlers) HandleRoleUpdate(c *Client, msg *protocol.Message) {
+	var req protocol.RoleUpdateRequest
 	if err := json.Unmarshal(msg.Data, &req); err != nil {
 		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid payload")
 		return
 	}
-	if err := h.checkPermission(c.UserID, req.ServerID, models.PermissionMuteMembers); err != nil {
-		c.sendError(protocol.ErrorCodeForbidden, err.Error())
+	role, ok := h.manageableRole(c, req.ServerID, req.RoleID)
+	if !ok {
+		return
+	}
+	before := snapshot(role)
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if role.IsDefault {
+			c.sendError(protocol.ErrorCodeInvalidPayload, "The everyone role cannot be renamed")
+			return
+		}
+		if !h.validRoleName(c, req.ServerID, role.ID, name) {
+			return
+		}
+		role.Name = name
+	}
+	if req.Color != nil {
+		if !validRoleColor(c, *req.Color) {
+			return
+		}
+		role.SetColor(*req.Color)
+	}
+	permsChanged := false
+	if req.Permissions != nil && *req.Permissions != role.Permissions {
+		// Only newly added bits need to be held by the caller
+		if !h.canGrant(c, req.ServerID, *req.Permissions&^role.Permissions) {
+			return
+		}
+		role.SetPermissions(*req.Permissions)
+		permsChanged = true
+	}
+	if req.IsHoisted != nil {
+		role.IsHoisted = *req.IsHoisted
+		role.UpdatedAt = time.Now()
+	}
+
+	if req.Name != nil || req.Color != nil || permsChanged || req.IsHoisted != nil {
+		if err := h.db.UpdateRole(role); err != nil {
+			log.Printf("Failed to update role: %v", err)
+			c.sendError(protocol.ErrorCodeServerError, "Failed to update role")
+			return
+		}
+		h.hub.BroadcastToServer(req.ServerID, protocol.EventRoleUpdate, &protocol.RolePayload{ServerID: req.ServerID, Role: role}, nil)
+	}
+
+	if req.Position != nil && !h.moveRole(c, role, *req.Position) {
+		return
+	}
+	h.audit(c, req.ServerID, models.AuditRoleUpdate, roleTarget(role), "", before, snapshot(role))
+
+	// View permissions may have changed for everyone holding the role
+	if permsChanged {
+		h.refreshServerChannels(req.ServerID)
+	}
+}
+
+// HandleRoleDelete deletes a custom role below the caller's highest role (requires PermissionManageRoles).
+func (h *Handlers) HandleRoleDelete(c *Client, msg *protocol.Message) {
+	var req protocol.RoleDeleteRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid payload")
+		return
+	}
+	role, ok := h.manageableRole(c, req.ServerID, req.RoleID)
+	if !ok {
+		return
+	}
+	if role.IsDefault {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "The everyone role cannot be deleted")
+		return
+	}
+
+	if err := h.db.DeleteRole(role.ID); err != nil {
+		log.Printf("Failed to delete role: %v", err)
+		c.sendError(protocol.ErrorCodeServerError, "Failed to delete role")
+		return
+	}
+
+	h.hub.BroadcastToServer(req.ServerID, protocol.EventRoleDelete, &protocol.RoleDeletePayload{ServerID: req.ServerID, RoleID: role.ID}, nil)
+	h.refreshServerChannels(req.ServerID)
+	h.audit(c, req.ServerID, models.AuditRoleDelete, roleTarget(role), "", snapshot(role), nil)
+}
+
+// moveRole places role at position (1 = lowest custom role), keeping it below
+// the caller's highest role, and broadcasts every role whose position changed.
+// It returns false if the move was rejected.
+func (h *Handlers) moveRole(c *Client, role *models.Role, position int) bool {
+	if role.IsDefault {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "The everyone role cannot be moved")
+		return false
+	}
+	if position < 1 {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Position must be 1 or more")
+		return false
+	}
+
+	actorPos, err := h.rolePosition(c.UserID, role.ServerID)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeForbidden, err.Error())
+		return false
+	}
+	if actorPos != math.MaxInt {
+		roles, err := h.db.GetServerRoles(role.ServerID)
+		if err != nil {
+			c.sendError(protocol.ErrorCodeServerError, "Failed to load roles")
+			return false
+		}
+		// Custom roles below the caller, including the one being moved
+		below := 0
+		for _, r := range roles {
+			if !r.IsDefault && r.Position < actorPos {
+				below++
+			}
+		}
+		if position > below {
+			c.sendError(protocol.ErrorCodeRoleHierarchy, "You can only move roles below your highest role")
+			return false
+		}
+	}
+
+	changed, err := h.db.MoveRole(role.ServerID, role.ID, position)
+	if err != nil {
+		log.Printf("Failed to move role: %v", err)
+		c.sendError(protocol.ErrorCodeServerError, "Failed to move role")
+		return false
+	}
+	for _, r := range changed {
+		if r.ID == role.ID {
+			role.Position = r.Position
+		}
+		h.hub.BroadcastToServer(role.ServerID, protocol.EventRoleUpdate, &protocol.RolePayload{ServerID: role.ServerID, Role: r}, nil)
+	}
+	return true
+}
+
+// manageableRole loads a role the caller may edit: it requires
+// PermissionManageRoles and the role must sit below the caller's highest role
+func (h *Handlers) manageableRole(c *Client, serverID, roleID uuid.UUID) (*models.Role, bool) {
+	if err := h.checkPermission(c.UserID, serverID, models.PermissionManageRoles); err != nil {
+		c.sendError(protocol.ErrorCodeForbidden, err.Error())
+		return nil, false
+	}
+	role, err := h.db.GetRoleByID(roleID)
+	if err != nil || role.ServerID != serverID {
+		c.sendError(protocol.ErrorCodeNotFound, "Role not found")
+		return nil, false
+	}
+	if err := h.checkHierarchy(c.UserID, serverID, nil, role); err != nil {
+		c.sendError(protocol.ErrorCodeRoleHierarchy, err.Error())
+		return nil, false
+	}
+	return role, true
+}
+
+// checkHierarchy verifies the actor outranks a target member and/or a role
+// being granted or edited on a server. Either target may be nil. The server
+// owner outranks everyone and can't be targeted by anyone else.
+func (h *Handlers) checkHierarchy(actorID, serverID uuid.UUID, targetID *uuid.UUID, role *models.Role) error {
+	actorPos, err := h.rolePosition(actorID, serverID)
+	if err != nil {
+		return err
+	}
+	if targetID != nil && *targetID != actorID {
+		targetPos, err := h.rolePosition(*targetID, serverID)
+		if err != nil {
+			return err
+		}
+		if targetPos == math.MaxInt {
+			return errors.New("the server owner outranks every role")
+		}
+		if targetPos >= actorPos {
+			return errors.New("that member's highest role is at or above yours")
+		}
+	}
+	if role != nil && role.Position >= actorPos {
+		return fmt.Errorf("the %s role is at or above your highest role", role.Name)
+	}
+	return nil
+}
+
+// rolePosition returns the position of a user's highest role on a server.
+// The server owner outranks every role.
+func (h *Handlers) rolePosition(userID, serverID uuid.UUID) (int, error) {
+	server, err := h.db.GetServerByID(serverID)
+	if err != nil {
+		return 0, errors.New("server not found")
+	}
+	if server.OwnerID == userID {
+		return math.MaxInt, nil
+	}
+	roles, err := h.db.GetMemberRoles(serverID, userID)
+	if err != nil {
+		return 0, err
+	}
+	highest := 0
+	for _, r := range roles {
+		if r.Position > highest {
+			highest = r.Position
+		}
+	}
+	return highest, nil
+}
+
+// canGrant reports whether the caller holds every bit in perms, so roles can't
+// be used to escalate beyond the caller's own permissions
+func (h *Handlers) canGrant(c *Client, serverID uuid.UUID, perms models.Permission) bool {
+	_, _, base, err := h.memberPermissions(c.UserID, serverID)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeForbidden, err.Error())
+		return false
+	}
+	if perms&^base != 0 {
+		c.sendError(protocol.ErrorCodeForbidden, "You cannot grant permissions you do not have")
+		return false
+	}
+	return true
+}
+
+// validRoleName checks a role name is non-empty and unique on the server
+func (h *Handlers) validRoleName(c *Client, serverID, roleID uuid.UUID, name string) bool {
+	if name == "" || len(name) > 32 {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Role name must be 1-32 characters")
+		return false
+	}
+	if existing, err := h.db.GetRoleByName(serverID, name); err == nil && existing.ID != roleID {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "A role with that name already exists")
+		return false
+	}
+	return true
+}
+
+// validRoleColor checks color is a 24-bit RGB value
+func validRoleColor(c *Client, color int) bool {
+	if color < 0 || color > 0xFFFFFF {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Color must be an RGB value between 000000 and FFFFFF")
+		return false
+	}
+	return true
+}
+
+// refreshServerChannels re-evaluates channel visibility for every online
+// member after a role's permissions change or it is deleted
+func (h *Handlers) refreshServerChannels(serverID uuid.UUID) {
+	for _, userID := range h.hub.GetOnlineUsers(serverID) {
+		h.refreshMemberChannels(serverID, userID)
+	}
+}
+
+// HandleKickMember removes a member from the server (requires PermissionKickMembers).
+func (h *Handlers) HandleKickMember(c *Client, msg *protocol.Message) {
+	var req protocol.KickMemberRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid payload")
+		return
+	}
+	if err := h.checkPermission(c.UserID, req.ServerID, models.PermissionKickMembers); err != nil {
+		c.sendError(protocol.ErrorCodeForbidden, err.Error())
+		return
+	}
+	if err := h.checkHierarchy(c.UserID, req.ServerID, &req.UserID, nil); err != nil {
+		c.sendError(protocol.ErrorCodeRoleHierarchy, err.Error())
+		return
+	}
+	target, err := h.db.GetUserByID(req.UserID)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeNotFound, "User not found")
+		return
+	}
+	if err := h.db.RemoveServerMember(req.UserID, req.ServerID); err != nil {
+		c.sendError(protocol.ErrorCodeServerError, "Failed to kick member")
+		return
+	}
+	// Notify server of removal
+	removePayload := &protocol.ServerMemberRemovePayload{ServerID: req.ServerID, User: target}
+	h.hub.BroadcastToServer(req.ServerID, protocol.EventServerMemberRemove, removePayload, nil)
+	// Drop the server from the kicked user's connection; their other servers stay
+	h.removeMember(req.UserID, req.ServerID)
+	h.audit(c, req.ServerID, models.AuditMemberKick, userTarget(target), req.Reason, nil, nil)
+}
+
+// HandleBanMember bans a member from the server (requires PermissionBanMembers).
+func (h *Handlers) HandleBanMember(c *Client, msg *protocol.Message) {
+	var req protocol.BanMemberRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid payload")
+		return
+	}
+	if err := h.checkPermission(c.UserID, req.ServerID, models.PermissionBanMembers); err != nil {
+		c.sendError(protocol.ErrorCodeForbidden, err.Error())
+		return
+	}
+	if err := h.checkHierarchy(c.UserID, req.ServerID, &req.UserID, nil); err != nil {
+		c.sendError(protocol.ErrorCodeRoleHierarchy, err.Error())
+		return
+	}
+	target, err := h.db.GetUserByID(req.UserID)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeNotFound, "User not found")
+		return
+	}
+	if err := h.db.AddBan(req.ServerID, req.UserID, c.UserID, req.Reason); err != nil {
+		c.sendError(protocol.ErrorCodeServerError, "Failed to ban member")
+		return
+	}
+	// A permanent ban supersedes any pending timeout
+	_ = h.db.RemoveTimeout(req.ServerID, req.UserID, models.TimeoutKindBan)
+	_ = h.db.RemoveServerMember(req.UserID, req.ServerID)
+	removePayload := &protocol.ServerMemberRemovePayload{ServerID: req.ServerID, User: target}
+	h.hub.BroadcastToServer(req.ServerID, protocol.EventServerMemberRemove, removePayload, nil)
+	h.removeMember(req.UserID, req.ServerID)
+	h.audit(c, req.ServerID, models.AuditMemberBan, userTarget(target), req.Reason, nil, nil)
+}
+
+// HandleMuteMember server-mutes or unmutes a member (requires PermissionMuteMembers).
+func (h *Handlers) HandleMuteMember(c *Client, msg *protocol.Message) {
+	var req protocol.MuteMemberRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid payload")
+		return
+	}
+	if err := h.checkPermission(c.UserID, req.ServerID, models.PermissionMuteMembers); err != nil {
+		c.sendError(protocol.ErrorCodeForbidden, err.Error())
+		return
+	}
+	if err := h.checkHierarchy(c.UserID, req.ServerID, &req.UserID, nil); err != nil {
+		c.sendError(protocol.ErrorCodeRoleHierarchy, err.Error())
 		return
 	}
 	if err := h.db.SetMemberMuted(req.ServerID, req.UserID, req.Mute); err != nil {
 		c.sendError(protocol.ErrorCodeServerError, "Failed to update mute state")
 		return
 	}
+	// A timed mute is lifted by expireTimeouts; any other change clears a pending expiry
+	if req.Mute && req.DurationMinutes > 0 {
+		now := time.Now()
+		timeout := &models.MemberTimeout{
+			ServerID:  req.ServerID,
+			UserID:    req.UserID,
+			Kind:      models.TimeoutKindMute,
+			IssuedBy:  c.UserID,
+			CreatedAt: now,
+			ExpiresAt: now.Add(time.Duration(req.DurationMinutes) * time.Minute),
+		}
+		if err := h.db.AddTimeout(timeout); err != nil {
+			log.Printf("Failed to record mute expiry: %v", err)
+		}
+	} else if err := h.db.RemoveTimeout(req.ServerID, req.UserID, models.TimeoutKindMute); err != nil {
+		log.Printf("Failed to clear mute expiry: %v", err)
+	}
 	h.broadcastMemberUpdate(req.ServerID, req.UserID)
+
+	if req.Mute {
+		var after json.RawMessage
+		if req.DurationMinutes > 0 {
+			after = snapshot(map[string]int{"duration_minutes": req.DurationMinutes})
+		}
+		h.audit(c, req.ServerID, models.AuditMemberMute, h.memberTarget(req.UserID), "", nil, after)
+	} else {
+		h.audit(c, req.ServerID, models.AuditMemberUnmute, h.memberTarget(req.UserID), "", nil, nil)
+	}
+}
+
+// HandleUnbanMember lifts a ban (requires PermissionBanMembers).
+func (h *Handlers) HandleUnbanMember(c *Client, msg *protocol.Message) {
+	var req protocol.UnbanMemberRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid payload")
+		return
+	}
+	if err := h.checkPermission(c.UserID, req.ServerID, models.PermissionBanMembers); err != nil {
+		c.sendError(protocol.ErrorCodeForbidden, err.Error())
+		return
+	}
+	target, err := h.db.GetBannedUserByUsername(req.ServerID, req.Username)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeNotFound, "No banned user with that name")
+		return
+	}
+	if err := h.db.RemoveBan(req.ServerID, target.ID); err != nil {
+		c.sendError(protocol.ErrorCodeServerError, "Failed to unban member")
+		return
+	}
+	_ = h.db.RemoveTimeout(req.ServerID, target.ID, models.TimeoutKindBan)
+	h.broadcastSystemMessage(req.ServerID, fmt.Sprintf("%s was unbanned by %s", target.Username, c.User.Username))
+	h.audit(c, req.ServerID, models.AuditMemberUnban, userTarget(target), "", nil, nil)
+}
+
+// HandleTimeoutMember temporarily bans a member (requires PermissionKickMembers).
+// The ban is lifted automatically by expireTimeouts once the duration elapses.
+// A timeout removes the member, matching the client's /timeout; a timed
+// server-mute that keeps them in the server is HandleMuteMember's job.
+func (h *Handlers) HandleTimeoutMember(c *Client, msg *protocol.Message) {
+	var req protocol.TimeoutMemberRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid payload")
+		return
+	}
+	if req.DurationMinutes <= 0 {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Timeout duration must be a positive number of minutes")
+		return
+	}
+	if err := h.checkPermission(c.UserID, req.ServerID, models.PermissionKickMembers); err != nil {
+		c.sendError(protocol.ErrorCodeForbidden, err.Error())
+		return
+	}
+	if err := h.checkHierarchy(c.UserID, req.ServerID, &req.UserID, nil); err != nil {
+		c.sendError(protocol.ErrorCodeRoleHierarchy, err.Error())
+		return
+	}
+	target, err := h.db.GetUserByID(req.UserID)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeNotFound, "User not found")
+		return
+	}
+	// Expiry lifts the ban outright, so it must not stack on an existing one
+	if banned, err := h.db.IsBanned(req.ServerID, req.UserID); err != nil {
+		c.sendError(protocol.ErrorCodeServerError, "Failed to time out member")
+		return
+	} else if banned {
+		c.sendError(protocol.ErrorCodeInvalidPayload, target.Username+" is already banned")
+		return
+	}
+	now := time.Now()
+	timeout := &models.MemberTimeout{
+		ServerID:  req.ServerID,
+		UserID:    req.UserID,
+		Kind:      models.TimeoutKindBan,
+		Reason:    req.Reason,
+		IssuedBy:  c.UserID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Duration(req.DurationMinutes) * time.Minute),
+	}
+	if err := h.db.AddBan(req.ServerID, req.UserID, c.UserID, req.Reason); err != nil {
+		c.sendError(protocol.ErrorCodeServerError, "Failed to time out member")
+		return
+	}
+	if err := h.db.AddTimeout(timeout); err != nil {
+		// Without an expiry the ban would be permanent; roll it back
+		_ = h.db.RemoveBan(req.ServerID, req.UserID)
+		c.sendError(protocol.ErrorCodeServerError, "Failed to time out member")
+		return
+	}
+	_ = h.db.RemoveServerMember(req.UserID, req.ServerID)
+	removePayload := &protocol.ServerMemberRemovePayload{ServerID: req.ServerID, User: target}
+	h.hub.BroadcastToServer(req.ServerID, protocol.EventServerMemberRemove, removePayload, nil)
+	h.broadcastSystemMessage(req.ServerID, fmt.Sprintf("%s was timed out for %d minutes by %s",
+		target.Username, req.DurationMinutes, c.User.Username))
+	h.removeMember(req.UserID, req.ServerID)
+	h.audit(c, req.ServerID, models.AuditMemberTimeout, userTarget(target), req.Reason, nil, snapshot(timeout))
+}
+
+// HandlePinMessage pins a message (requires PermissionPinMessages).
+func (h *Handlers) HandlePinMessage(c *Client, msg *protocol.Message) {
+	var req protocol.PinMessageRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid payload")
+		return
+	}
+	h.setMessagePinned(c, req.ChannelID, req.MessageID, true)
+}
+
+// HandleUnpinMessage unpins a message (requires PermissionPinMessages).
+func (h *Handlers) HandleUnpinMessage(c *Client, msg *protocol.Message) {
+	var req protocol.UnpinMessageRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid payload")
+		return
+	}
+	h.setMessagePinned(c, req.ChannelID, req.MessageID, false)
+}
+
+// setMessagePinned is the shared implementation of pin and unpin.
+func (h *Handlers) setMessagePinned(c *Client, channelID, messageID uuid.UUID, pinned bool) {
+	channel, err := h.db.GetChannelByID(channelID)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeUnknownChannel, "Channel not found")
+		return
+	}
+	if err := h.checkPermission(c.UserID, channel.ServerID, models.PermissionPinMessages); err != nil {
+		c.sendError(protocol.ErrorCodeForbidden, err.Error())
+		return
+	}
+	message, err := h.db.GetMessageByID(messageID)
+	if err != nil || message.ChannelID != channelID {
+		c.sendError(protocol.ErrorCodeNotFound, "Message not found")
+		return
+	}
+	if err := h.db.SetMessagePinned(messageID, pinned); err != nil {
+		c.sendError(protocol.ErrorCodeServerError, "Failed to update pin state")
+		return
+	}
+	message.IsPinned = pinned
+
+	eventType := protocol.EventMessagePin
+	if !pinned {
+		eventType = protocol.EventMessageUnpin
+	}
+	payload := &protocol.MessagePinPayload{
+		ChannelID: channelID,
+		ServerID:  channel.ServerID,
+		Message:   message,
+	}
+	// The payload carries the message, so only the channel's viewers get it
+	h.hub.BroadcastToChannel(channelID, eventType, payload, nil)
+
+	action := models.AuditMessagePin
+	if !pinned {
+		action = models.AuditMessageUnpin
+	}
+	h.audit(c, channel.ServerID, action, messageTarget(message, channel), "", nil, nil)
+}
+
+// expireTimeouts periodically lifts timed mutes and temporary bans whose expiry has passed.
+func (h *Handlers) expireTimeouts() {
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		expired, err := h.db.GetExpiredTimeouts()
+		if err != nil {
+			log.Printf("Failed to load expired timeouts: %v", err)
+			continue
+		}
+		for _, t := range expired {
+			switch t.Kind {
+			case models.TimeoutKindMute:
+				if err := h.db.SetMemberMuted(t.ServerID, t.UserID, false); err != nil {
+					log.Printf("Failed to lift mute for %s: %v", t.UserID, err)
+					continue
+				}
+				h.broadcastMemberUpdate(t.ServerID, t.UserID)
+			case models.TimeoutKindBan:
+				if err := h.db.RemoveBan(t.ServerID, t.UserID); err != nil {
+					log.Printf("Failed to lift timeout for %s: %v", t.UserID, err)
+					continue
+				}
+			}
+			if err := h.db.RemoveTimeout(t.ServerID, t.UserID, t.Kind); err != nil {
+				log.Printf("Failed to remove expired timeout: %v", err)
+			}
+		}
+	}
+}
+
+// archiveIdleThreads periodically archives threads that have gone without
+// messages for longer than their auto-archive window.
+func (h *Handlers) archiveIdleThreads() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		threads, err := h.db.GetOpenThreads()
+		if err != nil {
+			log.Printf("Failed to load open threads: %v", err)
+			continue
+		}
+		now := time.Now()
+		for _, thread := range threads {
+			if !thread.ArchiveDue(now) {
+				continue
+			}
+			if err := h.setThreadArchived(thread, true); err != nil {
+				log.Printf("Failed to archive thread %s: %v", thread.ID, err)
+			}
+		}
+	}
 }
 
 // HandleWhisper routes an ephemeral DM to a specific connected user.
@@ -706,6 +2317,618 @@ func (h *Handlers) HandleWhisper(c *Client, msg *protocol.Message) {
 	_ = h.hub.SendToUser(c.UserID, protocol.EventWhisperCreate, dispatch)
 }
 
+// HandleOverwriteSet sets a role or member permission overwrite on a channel
+func (h *Handlers) HandleOverwriteSet(c *Client, msg *protocol.Message) {
+	var req protocol.OverwriteSetRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid overwrite payload")
+		return
+	}
+	if req.Allow&req.Deny != 0 {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "A permission cannot be both allowed and denied")
+		return
+	}
+
+	channel, ok := h.overwriteChannel(c, req.ChannelID)
+	if !ok {
+		return
+	}
+
+	switch req.TargetType {
+	case "role":
+		role, err := h.db.GetRoleByID(req.TargetID)
+		if err != nil || role.ServerID != channel.ServerID {
+			c.sendError(protocol.ErrorCodeNotFound, "Role not found")
+			return
+		}
+	case "member":
+		if _, err := h.db.GetServerMember(channel.ServerID, req.TargetID); err != nil {
+			c.sendError(protocol.ErrorCodeNotFound, "Member not found")
+			return
+		}
+	default:
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Overwrite target must be a role or member")
+		return
+	}
+
+	// An overwrite with nothing allowed or denied is the same as none
+	var err error
+	var after json.RawMessage
+	if req.Allow == 0 && req.Deny == 0 {
+		err = h.db.DeleteChannelOverwrite(channel.ID, req.TargetID)
+	} else {
+		ow := models.PermissionOverwrite{
+			ID:    req.TargetID,
+			Type:  req.TargetType,
+			Allow: req.Allow,
+			Deny:  req.Deny,
+		}
+		err = h.db.SetChannelOverwrite(channel.ID, ow)
+		after = snapshot(ow)
+	}
+	if err != nil {
+		log.Printf("Failed to save overwrite: %v", err)
+		c.sendError(protocol.ErrorCodeServerError, "Failed to save overwrite")
+		return
+	}
+
+	h.refreshChannelAccess(channel.ID)
+	h.audit(c, channel.ServerID, models.AuditOverwriteSet, channelTarget(channel), "",
+		overwriteSnapshot(channel, req.TargetID), after)
+}
+
+// HandleOverwriteDelete clears a role or member permission overwrite on a channel
+func (h *Handlers) HandleOverwriteDelete(c *Client, msg *protocol.Message) {
+	var req protocol.OverwriteDeleteRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid overwrite payload")
+		return
+	}
+
+	channel, ok := h.overwriteChannel(c, req.ChannelID)
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteChannelOverwrite(channel.ID, req.TargetID); err != nil {
+		log.Printf("Failed to delete overwrite: %v", err)
+		c.sendError(protocol.ErrorCodeServerError, "Failed to delete overwrite")
+		return
+	}
+
+	h.refreshChannelAccess(channel.ID)
+	h.audit(c, channel.ServerID, models.AuditOverwriteDelete, channelTarget(channel), "",
+		overwriteSnapshot(channel, req.TargetID), nil)
+}
+
+// overwriteChannel loads a server channel whose overwrites the caller may edit
+func (h *Handlers) overwriteChannel(c *Client, channelID uuid.UUID) (*models.Channel, bool) {
+	channel, err := h.db.GetChannelByID(channelID)
+	if err != nil || channel.IsDM() {
+		c.sendError(protocol.ErrorCodeUnknownChannel, "Channel not found")
+		return nil, false
+	}
+	if channel.IsThread() {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Threads follow their parent channel's overwrites")
+		return nil, false
+	}
+	if err := h.checkPermission(c.UserID, channel.ServerID, models.PermissionManageRoles); err != nil {
+		c.sendError(protocol.ErrorCodeForbidden, err.Error())
+		return nil, false
+	}
+	return channel, true
+}
+
+// refreshChannelAccess re-evaluates who can see a channel after its overwrites
+// change. Online members who can view it get a CHANNEL_UPDATE (adding it if it
+// was hidden); those who lost access are unsubscribed and get CHANNEL_DELETE.
+// The channel's threads follow along, with events only where access changed.
+func (h *Handlers) refreshChannelAccess(channelID uuid.UUID) {
+	channel, err := h.db.GetChannelByID(channelID)
+	if err != nil {
+		return
+	}
+	threads, _ := h.db.GetChannelThreads(channelID)
+	for _, userID := range h.hub.GetOnlineUsers(channel.ServerID) {
+		h.syncChannelSubscription(userID, channel, true)
+		for _, thread := range threads {
+			h.syncChannelSubscription(userID, thread, false)
+		}
+	}
+}
+
+// refreshMemberChannels re-evaluates which channels a member can see after
+// their roles change, sending CHANNEL_UPDATE/CHANNEL_DELETE only on change
+func (h *Handlers) refreshMemberChannels(serverID, userID uuid.UUID) {
+	if !h.hub.IsUserOnline(userID) {
+		return
+	}
+	channels, err := h.db.GetServerChannels(serverID)
+	if err != nil {
+		return
+	}
+	for _, channel := range channels {
+		h.syncChannelSubscription(userID, channel, false)
+	}
+}
+
+// channelViewers returns the online members of a channel's server who may
+// view it
+func (h *Handlers) channelViewers(channel *models.Channel) []uuid.UUID {
+	var viewers []uuid.UUID
+	for _, userID := range h.hub.GetOnlineUsers(channel.ServerID) {
+		if h.checkChannelPermission(userID, channel, models.PermissionViewChannels) == nil {
+			viewers = append(viewers, userID)
+		}
+	}
+	return viewers
+}
+
+// syncChannelSubscription joins or leaves the hub channel for userID based on
+// PermissionViewChannels and tells the client. When always is false, nothing
+// is sent if visibility didn't change.
+func (h *Handlers) syncChannelSubscription(userID uuid.UUID, channel *models.Channel, always bool) {
+	canView := h.checkChannelPermission(userID, channel, models.PermissionViewChannels) == nil
+	wasSubscribed := h.hub.IsInChannel(userID, channel.ID)
+
+	if canView {
+		h.hub.JoinChannel(userID, channel.ID)
+		if always || !wasSubscribed {
+			h.hub.SendToUser(userID, protocol.EventChannelUpdate, protocol.ChannelUpdatePayload{Channel: channel})
+		}
+		return
+	}
+
+	h.hub.LeaveChannel(userID, channel.ID)
+	if always || wasSubscribed {
+		h.hub.SendToUser(userID, protocol.EventChannelDelete, protocol.ChannelDeletePayload{
+			ChannelID: channel.ID,
+			ServerID:  channel.ServerID,
+			Type:      channel.Type,
+		})
+	}
+}
+
+// HandleDMOpen opens the persistent DM channel between the caller and another
+// user, creating it on first use. Both users must share a server.
+func (h *Handlers) HandleDMOpen(c *Client, msg *protocol.Message) {
+	var req protocol.DMOpenRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid DM request")
+		return
+	}
+	if req.RecipientID == c.UserID {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "You cannot DM yourself")
+		return
+	}
+
+	recipient, err := h.db.GetUserByID(req.RecipientID)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeNotFound, "User not found")
+		return
+	}
+	if !h.sharesServer(c, recipient.ID) {
+		c.sendError(protocol.ErrorCodeForbidden, "You can only message members of your servers")
+		return
+	}
+
+	channel, err := h.db.GetDMChannelBetween(c.UserID, recipient.ID)
+	created := false
+	if err != nil {
+		channel = models.NewDMChannel(c.UserID, recipient.ID)
+		if err := h.db.CreateDMChannel(channel); err != nil {
+			log.Printf("Failed to create DM channel: %v", err)
+			c.sendError(protocol.ErrorCodeServerError, "Failed to open DM")
+			return
+		}
+		created = true
+	}
+
+	h.hub.JoinChannel(c.UserID, channel.ID)
+	h.hub.JoinChannel(recipient.ID, channel.ID)
+
+	payload := &protocol.DMChannelPayload{
+		Channel:    channel,
+		Recipients: []*models.User{c.User, recipient},
+	}
+	c.SendDispatch(protocol.EventDMChannelOpen, payload)
+	if created {
+		h.hub.SendToUser(recipient.ID, protocol.EventDMChannelOpen, payload)
+	}
+}
+
+// loadPrivateChannels gathers a user's DM channels, the users on the other end
+// and any DMs that arrived while they were offline, for the READY payload.
+func (h *Handlers) loadPrivateChannels(userID uuid.UUID) ([]*models.Channel, []*models.User, []*protocol.MessageDisplay) {
+	channels, err := h.db.GetUserDMChannels(userID)
+	if err != nil {
+		log.Printf("Failed to load DM channels for %s: %v", userID, err)
+		return nil, nil, nil
+	}
+
+	var userIDs []uuid.UUID
+	seen := make(map[uuid.UUID]bool)
+	for _, ch := range channels {
+		for _, id := range ch.RecipientIDs {
+			if !seen[id] {
+				seen[id] = true
+				userIDs = append(userIDs, id)
+			}
+		}
+	}
+	users, _ := h.db.GetUsersByIDs(userIDs)
+	usersByID := make(map[uuid.UUID]*models.User, len(users))
+	for _, u := range users {
+		usersByID[u.ID] = u
+	}
+
+	messages, err := h.db.TakeUndeliveredMessages(userID)
+	if err != nil {
+		log.Printf("Failed to load undelivered DMs for %s: %v", userID, err)
+	}
+	var undelivered []*protocol.MessageDisplay
+	for _, m := range messages {
+		undelivered = append(undelivered, &protocol.MessageDisplay{Message: m, Author: usersByID[m.AuthorID]})
+	}
+
+	return channels, users, undelivered
+}
+
+// sharesServer reports whether userID is a member of any of the client's servers
+func (h *Handlers) sharesServer(c *Client, userID uuid.UUID) bool {
+	for _, serverID := range c.ServerIDs {
+		if _, err := h.db.GetServerMember(serverID, userID); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// containsUUID reports whether id is in ids
+func containsUUID(ids []uuid.UUID, id uuid.UUID) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// broadcastSystemMessage announces a moderation event to everyone on a server.
+func (h *Handlers) broadcastSystemMessage(serverID uuid.UUID, content string) {
+	payload := &protocol.SystemMessagePayload{
+		ServerID:  serverID,
+		Content:   content,
+		Timestamp: time.Now(),
+	}
+	h.hub.BroadcastToServer(serverID, protocol.EventSystemMessage, payload, nil)
+}
+
+// auditTarget identifies what an audit log entry acted on
+type auditTarget struct {
+	Type string
+	ID   string
+	Name string
+}
+
+func channelTarget(ch *models.Channel) auditTarget {
+	return auditTarget{Type: "channel", ID: ch.ID.String(), Name: "#" + ch.Name}
+}
+
+func roleTarget(role *models.Role) auditTarget {
+	return auditTarget{Type: "role", ID: role.ID.String(), Name: role.Name}
+}
+
+func userTarget(user *models.User) auditTarget {
+	return auditTarget{Type: "member", ID: user.ID.String(), Name: user.Username}
+}
+
+func serverTarget(server *models.Server) auditTarget {
+	return auditTarget{Type: "server", ID: server.ID.String(), Name: server.Name}
+}
+
+func inviteTarget(invite *models.Invite) auditTarget {
+	return auditTarget{Type: "invite", ID: invite.Code, Name: invite.Code}
+}
+
+// messageTarget names a message by its channel, since messages have no name
+func messageTarget(message *models.Message, ch *models.Channel) auditTarget {
+	return auditTarget{Type: "message", ID: message.ID.String(), Name: "#" + ch.Name}
+}
+
+// memberTarget looks up a member's username for an audit entry
+func (h *Handlers) memberTarget(userID uuid.UUID) auditTarget {
+	if user, err := h.db.GetUserByID(userID); err == nil {
+		return userTarget(user)
+	}
+	return auditTarget{Type: "member", ID: userID.String()}
+}
+
+// snapshot encodes v for an audit entry's before/after state
+func snapshot(v interface{}) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// overwriteSnapshot encodes a channel's current overwrite for targetID, or nil if none
+func overwriteSnapshot(ch *models.Channel, targetID uuid.UUID) json.RawMessage {
+	for _, ow := range ch.PermissionOverwrites {
+		if ow.ID == targetID {
+			return snapshot(ow)
+		}
+	}
+	return nil
+}
+
+// audit records an action in the server's audit log. Failures are logged
+// rather than reported, since the action itself has already succeeded.
+func (h *Handlers) audit(c *Client, serverID uuid.UUID, action models.AuditAction, target auditTarget, reason string, before, after json.RawMessage) {
+	entry := &models.AuditLogEntry{
+		ID:         uuid.New(),
+		ServerID:   serverID,
+		ActorID:    c.UserID,
+		Action:     action,
+		TargetType: target.Type,
+		TargetID:   target.ID,
+		TargetName: target.Name,
+		Reason:     reason,
+		Before:     before,
+		After:      after,
+		CreatedAt:  time.Now(),
+	}
+	if err := h.db.AddAuditLogEntry(entry); err != nil {
+		log.Printf("Failed to write audit log entry %s: %v", action, err)
+	}
+}
+
+// HandleAuditLog returns a page of the server's audit log (requires PermissionManageServer)
+func (h *Handlers) HandleAuditLog(c *Client, msg *protocol.Message) {
+	var req protocol.AuditLogRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid payload")
+		return
+	}
+	if err := h.checkPermission(c.UserID, req.ServerID, models.PermissionManageServer); err != nil {
+		c.sendError(protocol.ErrorCodeForbidden, err.Error())
+		return
+	}
+
+	limit := req.Limit
+	if limit <= 0 || limit > 100 {
+		limit = 25
+	}
+	filter := database.AuditLogFilter{Action: req.Action, ActorID: req.ActorID, Target: req.Target}
+	// Fetch one extra row to learn whether another page exists
+	entries, err := h.db.GetAuditLog(req.ServerID, filter, limit+1, req.Before)
+	if err != nil {
+		log.Printf("Failed to load audit log: %v", err)
+		c.sendError(protocol.ErrorCodeServerError, "Failed to load audit log")
+		return
+	}
+	hasMore := len(entries) > limit
+	if hasMore {
+		entries = entries[:limit]
+	}
+
+	// Include actors so the client can show names for users who have left
+	seen := make(map[uuid.UUID]bool)
+	var users []*models.User
+	for _, e := range entries {
+		if seen[e.ActorID] {
+			continue
+		}
+		seen[e.ActorID] = true
+		if user, err := h.db.GetUserByID(e.ActorID); err == nil {
+			users = append(users, user)
+		}
+	}
+
+	c.SendDispatch(protocol.EventAuditLog, &protocol.AuditLogPayload{
+		ServerID: req.ServerID,
+		Entries:  entries,
+		Users:    users,
+		HasMore:  hasMore,
+	})
+}
+
+// searchQuery is a parsed SearchRequest.Query
+type searchQuery struct {
+	terms   []string
+	from    string // Username from from:@user
+	in      string // Channel name from in:#channel
+	before  *time.Time
+	after   *time.Time
+	hasLink bool
+}
+
+// parseSearchQuery splits a search query into free-text terms and filters.
+// Dates are whole days in server local time; before: excludes the given day.
+func parseSearchQuery(query string) (*searchQuery, error) {
+	q := &searchQuery{}
+	for _, field := range strings.Fields(query) {
+		key, value, ok := strings.Cut(field, ":")
+		if !ok || value == "" {
+			q.terms = append(q.terms, field)
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "from":
+			q.from = strings.TrimPrefix(value, "@")
+		case "in":
+			q.in = strings.TrimPrefix(value, "#")
+		case "before", "after":
+			day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+			if err != nil {
+				return nil, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", value)
+			}
+			if strings.EqualFold(key, "before") {
+				q.before = &day
+			} else {
+				q.after = &day
+			}
+		case "has":
+			if !strings.EqualFold(value, "link") {
+				return nil, fmt.Errorf("unknown filter has:%s", value)
+			}
+			q.hasLink = true
+		default:
+			q.terms = append(q.terms, field)
+		}
+	}
+	if len(q.terms) == 0 && q.from == "" && q.in == "" && q.before == nil && q.after == nil && !q.hasLink {
+		return nil, errors.New("search query is empty")
+	}
+	return q, nil
+}
+
+// HandleSearch runs a full-text search over the server channels the caller can read
+func (h *Handlers) HandleSearch(c *Client, msg *protocol.Message) {
+	var req protocol.SearchRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid payload")
+		return
+	}
+	query, err := parseSearchQuery(req.Query)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, err.Error())
+		return
+	}
+
+	calc, member, base, err := h.memberPermissions(c.UserID, req.ServerID)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeForbidden, err.Error())
+		return
+	}
+	channels, err := h.db.GetServerChannels(req.ServerID)
+	if err != nil {
+		c.sendError(protocol.ErrorCodeServerError, "Failed to load channels")
+		return
+	}
+
+	limit := req.Limit
+	if limit <= 0 || limit > 100 {
+		limit = 25
+	}
+	search := database.MessageSearch{
+		Terms:   query.terms,
+		Before:  query.before,
+		After:   query.after,
+		HasLink: query.hasLink,
+		Limit:   limit + 1, // One extra row to learn whether more matches exist
+	}
+
+	const readable = models.PermissionViewChannels | models.PermissionReadMessageHistory
+	byID := channelsByID(channels)
+	for _, ch := range channels {
+		if query.in != "" && !strings.EqualFold(ch.Name, query.in) {
+			continue
+		}
+		if target := overwriteSource(ch, byID); target != nil && calc.ComputeOverwrites(base, member, target)&readable == readable {
+			search.ChannelIDs = append(search.ChannelIDs, ch.ID)
+		}
+	}
+	if query.in != "" && len(search.ChannelIDs) == 0 {
+		c.sendError(protocol.ErrorCodeNotFound, fmt.Sprintf("No channel named #%s", query.in))
+		return
+	}
+
+	if query.from != "" {
+		author, err := h.db.GetUserByUsername(req.ServerID, query.from)
+		if err != nil {
+			c.sendError(protocol.ErrorCodeNotFound, fmt.Sprintf("No user named @%s", query.from))
+			return
+		}
+		search.AuthorID = &author.ID
+	}
+
+	messages, err := h.db.SearchMessages(search)
+	if err != nil {
+		log.Printf("Failed to search messages: %v", err)
+		c.sendError(protocol.ErrorCodeServerError, "Search failed")
+		return
+	}
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	authors := make(map[uuid.UUID]*models.User)
+	results := make([]*protocol.MessageDisplay, 0, len(messages))
+	for _, m := range messages {
+		author, ok := authors[m.AuthorID]
+		if !ok {
+			author, err = h.db.GetUserByID(m.AuthorID)
+			if err != nil {
+				log.Printf("Failed to get author for message %s: %v", m.ID, err)
+				continue
+			}
+			authors[m.AuthorID] = author
+		}
+		results = append(results, &protocol.MessageDisplay{Message: m, Author: author})
+	}
+
+	c.SendDispatch(protocol.EventSearchResults, &protocol.SearchResultsPayload{
+		ServerID: req.ServerID,
+		Query:    req.Query,
+		Results:  results,
+		HasMore:  hasMore,
+	})
+}
+
+// checkHostAdmin reports whether userID is an administrator of the host's
+// default server, which no one can create for themselves, and returns its ID.
+// The error is only set when the server couldn't be loaded.
+func (h *Handlers) checkHostAdmin(userID uuid.UUID) (uuid.UUID, bool, error) {
+	server, _, err := h.db.EnsureDefaultServer()
+	if err != nil {
+		return uuid.Nil, false, err
+	}
+	return server.ID, h.checkPermission(userID, server.ID, models.PermissionAdministrator) == nil, nil
+}
+
+// HandleBackup writes a database backup into the configured backup directory
+func (h *Handlers) HandleBackup(c *Client, msg *protocol.Message) {
+	var req protocol.BackupRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		c.sendError(protocol.ErrorCodeInvalidPayload, "Invalid payload")
+		return
+	}
+	// Backups cover the whole host, so administering some server isn't enough
+	hostServerID, ok, err := h.checkHostAdmin(c.UserID)
+	if err != nil {
+		log.Printf("Failed to load the default server for a backup by %s: %v", c.UserID, err)
+		c.sendError(protocol.ErrorCodeServerError, "Backup failed")
+		return
+	}
+	if !ok {
+		c.sendError(protocol.ErrorCodeForbidden, "Only administrators of the host's first server can back it up")
+		return
+	}
+
+	path, size, wait, err := h.backups.Request()
+	if err != nil {
+		log.Printf("Backup requested by %s failed: %v", c.UserID, err)
+		c.sendError(protocol.ErrorCodeServerError, "Backup failed")
+		return
+	}
+	if wait > 0 {
+		c.sendRateLimited(fmt.Sprintf("A backup was just taken; try again in %s", wait.Round(time.Second)), wait)
+		return
+	}
+	log.Printf("Backup requested by %s written to %s (%d bytes)", c.UserID, path, size)
+
+	file := filepath.Base(path)
+	h.audit(c, hostServerID, models.AuditServerBackup, auditTarget{Type: "database", ID: file, Name: file}, "", nil, nil)
+
+	c.SendDispatch(protocol.EventBackupComplete, &protocol.BackupCompletePayload{
+		File:  file,
+		Bytes: size,
+	})
+}
+
 // broadcastMemberUpdate fetches updated member data and broadcasts EventServerMemberUpdate.
 func (h *Handlers) broadcastMemberUpdate(serverID, userID uuid.UUID) {
 	member, err := h.db.GetServerMember(serverID, userID)
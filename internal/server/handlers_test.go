@@ -0,0 +1,1120 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/concord-chat/concord/internal/database"
+	"github.com/concord-chat/concord/internal/models"
+	"github.com/concord-chat/concord/internal/protocol"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// testServer is a Handlers backed by a fresh SQLite database, with the
+// default server and its #general channel
+type testServer struct {
+	h        *Handlers
+	db       *database.DB
+	server   *models.Server
+	everyone *models.Role
+	general  *models.Channel
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	db, err := database.New(filepath.Join(t.TempDir(), "concord.db"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	server, everyone, err := db.EnsureDefaultServer()
+	if err != nil {
+		t.Fatalf("create default server: %v", err)
+	}
+	general, err := db.GetChannelByID(server.DefaultChannelID)
+	if err != nil {
+		t.Fatalf("load #general: %v", err)
+	}
+	return &testServer{
+		h:        NewHandlers(db, NewHub()),
+		db:       db,
+		server:   server,
+		everyone: everyone,
+		general:  general,
+	}
+}
+
+// addMember creates a user who belongs to the default server with only @everyone
+func (ts *testServer) addMember(t *testing.T, name string) *models.User {
+	t.Helper()
+	user := models.NewUser(name, name+"@example.com")
+	if err := ts.db.CreateUser(user, ""); err != nil {
+		t.Fatalf("create user %s: %v", name, err)
+	}
+	if err := ts.db.AddServerMember(models.NewServerMember(user.ID, ts.server.ID)); err != nil {
+		t.Fatalf("add member %s: %v", name, err)
+	}
+	if err := ts.db.AddMemberRole(user.ID, ts.server.ID, ts.everyone.ID); err != nil {
+		t.Fatalf("assign @everyone to %s: %v", name, err)
+	}
+	return user
+}
+
+// connect returns an authenticated client for user that isn't attached to a socket
+func (ts *testServer) connect(user *models.User) *Client {
+	return &Client{
+		hub:      ts.h.hub,
+		send:     make(chan *protocol.Message, sendBufferSize),
+		handlers: ts.h,
+		limiter:  newRateLimiter(),
+		UserID:   user.ID,
+		User:     user,
+	}
+}
+
+// online connects user and registers the connection with the hub, as
+// IDENTIFY does
+func (ts *testServer) online(t *testing.T, user *models.User) *Client {
+	t.Helper()
+	c := ts.connect(user)
+	servers, err := ts.db.GetUserServers(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range servers {
+		c.ServerIDs = append(c.ServerIDs, s.ID)
+	}
+	ts.h.hub.registerClient(c)
+	return c
+}
+
+// flush delivers the broadcasts queued on the hub, as its Run loop would
+func (ts *testServer) flush() {
+	for {
+		select {
+		case msg := <-ts.h.hub.broadcast:
+			ts.h.hub.broadcastMessage(msg)
+		default:
+			return
+		}
+	}
+}
+
+// privateChannel creates a text channel in the default server that
+// @everyone can't view
+func (ts *testServer) privateChannel(t *testing.T, name string) *models.Channel {
+	t.Helper()
+	channel := models.NewTextChannel(ts.server.ID, name)
+	if err := ts.db.CreateChannel(channel); err != nil {
+		t.Fatal(err)
+	}
+	err := ts.db.SetChannelOverwrite(channel.ID, models.PermissionOverwrite{
+		ID:   ts.everyone.ID,
+		Type: "role",
+		Deny: int64(models.PermissionViewChannels),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return channel
+}
+
+// dispatch decodes the last event of the given type sent to c into v and
+// reports whether there was one. Everything queued for c is consumed.
+func dispatch(t *testing.T, c *Client, event protocol.EventType, v interface{}) bool {
+	t.Helper()
+	var last *protocol.Message
+	for {
+		select {
+		case msg := <-c.send:
+			if msg.Type == event {
+				last = msg
+			}
+			continue
+		default:
+		}
+		break
+	}
+	if last == nil {
+		return false
+	}
+	if err := json.Unmarshal(last.Data, v); err != nil {
+		t.Fatalf("decode %s: %v", event, err)
+	}
+	return true
+}
+
+// channelNames lists the names of channels
+func channelNames(channels []*models.Channel) []string {
+	names := make([]string, len(channels))
+	for i, ch := range channels {
+		names[i] = ch.Name
+	}
+	return names
+}
+
+// login gives c a login session of its own on a real socket, as Identify
+// does, and returns the session and the far end of the socket
+func (ts *testServer) login(t *testing.T, c *Client) (uuid.UUID, *websocket.Conn) {
+	t.Helper()
+	id, err := ts.db.CreateSession(c.UserID, uuid.NewString(), "127.0.0.1", "test", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.authSessionID = uuid.MustParse(id)
+
+	conns := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+	remote, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { remote.Close() })
+	c.conn = <-conns
+	ts.h.hub.TrackAuthSession(c)
+	return c.authSessionID, remote
+}
+
+// closeCode waits briefly for conn to be closed and returns the close code,
+// or 0 if it stayed open
+func closeCode(t *testing.T, conn *websocket.Conn) int {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	_, _, err := conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		return closeErr.Code
+	}
+	var netErr interface{ Timeout() bool }
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return 0
+	}
+	t.Fatalf("read: %v", err)
+	return 0
+}
+
+// lastError returns the most recent error sent to c, or nil if there was none
+func lastError(t *testing.T, c *Client) *protocol.ErrorPayload {
+	t.Helper()
+	var last *protocol.ErrorPayload
+	for {
+		select {
+		case msg := <-c.send:
+			if msg.Op != protocol.OpDispatch || msg.Type != "" {
+				continue
+			}
+			var payload protocol.ErrorPayload
+			if err := json.Unmarshal(msg.Data, &payload); err != nil {
+				t.Fatalf("decode error payload: %v", err)
+			}
+			last = &payload
+		default:
+			return last
+		}
+	}
+}
+
+// request builds the frame a client sends for op
+func request(t *testing.T, op protocol.OpCode, payload interface{}) *protocol.Message {
+	t.Helper()
+	msg, err := protocol.NewMessage(op, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func sendMessage(t *testing.T, ts *testServer, c *Client, content string) {
+	t.Helper()
+	ts.h.HandleSendMessage(c, request(t, protocol.OpSendMessage, &protocol.SendMessagePayload{
+		ChannelID: ts.general.ID,
+		Content:   content,
+	}))
+}
+
+func TestSlowmodeAppliesToPlainMembers(t *testing.T) {
+	ts := newTestServer(t)
+	ts.general.RateLimitPerUser = 60
+	if err := ts.db.UpdateChannel(ts.general); err != nil {
+		t.Fatal(err)
+	}
+
+	// @everyone holds Manage Channels by default, which must not exempt anyone
+	if !ts.everyone.HasPermission(models.PermissionManageChannels) {
+		t.Fatal("expected @everyone to have Manage Channels")
+	}
+	alice := ts.connect(ts.addMember(t, "alice"))
+
+	sendMessage(t, ts, alice, "first")
+	if e := lastError(t, alice); e != nil {
+		t.Fatalf("first message rejected: %s", e.Message)
+	}
+	sendMessage(t, ts, alice, "second")
+	e := lastError(t, alice)
+	if e == nil || e.Code != protocol.ErrorCodeRateLimited {
+		t.Fatalf("second message inside the window: got %+v, want a rate limit error", e)
+	}
+	if e.RetryAfter <= 0 || e.RetryAfter > 60 {
+		t.Errorf("RetryAfter = %d, want 1..60", e.RetryAfter)
+	}
+
+	messages, err := ts.db.GetChannelMessages(ts.general.ID, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 {
+		t.Errorf("stored %d messages, want 1", len(messages))
+	}
+}
+
+func TestSlowmodeSkipsRejectedMessages(t *testing.T) {
+	ts := newTestServer(t)
+	ts.general.RateLimitPerUser = 60
+	if err := ts.db.UpdateChannel(ts.general); err != nil {
+		t.Fatal(err)
+	}
+	alice := ts.connect(ts.addMember(t, "alice"))
+
+	// A reply to a message that doesn't exist is refused without using the slot
+	missing := uuid.New()
+	ts.h.HandleSendMessage(alice, request(t, protocol.OpSendMessage, &protocol.SendMessagePayload{
+		ChannelID: ts.general.ID,
+		Content:   "re: nothing",
+		ReplyToID: &missing,
+	}))
+	if e := lastError(t, alice); e == nil || e.Code != protocol.ErrorCodeNotFound {
+		t.Fatalf("reply to a missing message: got %+v, want not found", e)
+	}
+	sendMessage(t, ts, alice, "first")
+	if e := lastError(t, alice); e != nil {
+		t.Fatalf("message after a rejected one: %s", e.Message)
+	}
+}
+
+func TestSlowmodeExemptsManageMessages(t *testing.T) {
+	ts := newTestServer(t)
+	ts.general.RateLimitPerUser = 60
+	if err := ts.db.UpdateChannel(ts.general); err != nil {
+		t.Fatal(err)
+	}
+
+	mod := ts.addMember(t, "mod")
+	role := models.NewRole(ts.server.ID, "Moderator")
+	role.Permissions = models.PermissionManageMessages
+	role.Position = 1
+	if err := ts.db.CreateRole(role); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.db.AddMemberRole(mod.ID, ts.server.ID, role.ID); err != nil {
+		t.Fatal(err)
+	}
+	c := ts.connect(mod)
+
+	for _, content := range []string{"one", "two", "three"} {
+		sendMessage(t, ts, c, content)
+		if e := lastError(t, c); e != nil {
+			t.Fatalf("message %q rejected: %s", content, e.Message)
+		}
+	}
+}
+
+func TestSessionRevokeClosesSockets(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.addMember(t, "alice")
+	phone, laptop := ts.connect(alice), ts.connect(alice)
+	_, phoneSocket := ts.login(t, phone)
+	laptopSession, laptopSocket := ts.login(t, laptop)
+	bob := ts.connect(ts.addMember(t, "bob"))
+	bobSession, bobSocket := ts.login(t, bob)
+
+	// Someone else's session is not found and stays open
+	ts.h.HandleSessionRevoke(phone, request(t, protocol.OpSessionRevoke, &protocol.SessionRevokeRequest{SessionID: &bobSession}))
+	if e := lastError(t, phone); e == nil || e.Code != protocol.ErrorCodeNotFound {
+		t.Fatalf("revoke another user's session: got %+v, want not found", e)
+	}
+	if code := closeCode(t, bobSocket); code != 0 {
+		t.Errorf("other user's socket closed with %d", code)
+	}
+
+	ts.h.HandleSessionRevoke(phone, request(t, protocol.OpSessionRevoke, &protocol.SessionRevokeRequest{SessionID: &laptopSession}))
+	if e := lastError(t, phone); e != nil {
+		t.Fatalf("revoke: %s", e.Message)
+	}
+	if code := closeCode(t, laptopSocket); code != int(protocol.CloseSessionRevoked) {
+		t.Errorf("revoked socket close code = %d, want %d", code, protocol.CloseSessionRevoked)
+	}
+	if code := closeCode(t, phoneSocket); code != 0 {
+		t.Errorf("revoking socket closed with %d", code)
+	}
+	sessions, err := ts.db.GetUserSessions(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != phone.authSessionID {
+		t.Errorf("%d sessions left, want only the phone's", len(sessions))
+	}
+}
+
+func TestSessionRevokeCurrentLogsOut(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.addMember(t, "alice")
+	c := ts.connect(alice)
+	_, socket := ts.login(t, c)
+
+	ts.h.HandleSessionRevoke(c, request(t, protocol.OpSessionRevoke, &protocol.SessionRevokeRequest{Current: true}))
+	if code := closeCode(t, socket); code != int(protocol.CloseSessionRevoked) {
+		t.Errorf("close code = %d, want %d", code, protocol.CloseSessionRevoked)
+	}
+	if sessions, err := ts.db.GetUserSessions(alice.ID); err != nil || len(sessions) != 0 {
+		t.Errorf("sessions after logout = %d, %v", len(sessions), err)
+	}
+}
+
+func TestJoinServerHidesDeniedChannels(t *testing.T) {
+	ts := newTestServer(t)
+	secret := ts.privateChannel(t, "secret")
+	invite := &models.Invite{Code: "join-me", ServerID: ts.server.ID, CreatedAt: time.Now()}
+	if err := ts.db.CreateInvite(invite); err != nil {
+		t.Fatal(err)
+	}
+
+	// Bob is online but in no servers until he redeems the invite
+	bob := models.NewUser("bob", "bob@example.com")
+	if err := ts.db.CreateUser(bob, ""); err != nil {
+		t.Fatal(err)
+	}
+	c := ts.online(t, bob)
+	if _, err := ts.h.RedeemInvite(bob.ID, invite.Code); err != nil {
+		t.Fatalf("redeem invite: %v", err)
+	}
+	ts.flush()
+
+	var created protocol.ServerCreatePayload
+	if !dispatch(t, c, protocol.EventServerCreate, &created) {
+		t.Fatal("no SERVER_CREATE after joining")
+	}
+	names := channelNames(created.Channels)
+	if containsString(names, secret.Name) || !containsString(names, ts.general.Name) {
+		t.Errorf("SERVER_CREATE channels = %v, want general without secret", names)
+	}
+	if ts.h.hub.IsInChannel(bob.ID, secret.ID) {
+		t.Error("joining subscribed to a channel hidden from the member")
+	}
+	if !ts.h.hub.IsInChannel(bob.ID, ts.general.ID) {
+		t.Error("joining didn't subscribe to #general")
+	}
+
+	// Asking for the server again doesn't reveal it either
+	ts.h.HandleRequestGuild(c, request(t, protocol.OpRequestGuild, map[string]uuid.UUID{"server_id": ts.server.ID}))
+	var guild struct {
+		Channels []*models.Channel `json:"channels"`
+	}
+	if !dispatch(t, c, protocol.EventServerCreate, &guild) {
+		t.Fatal("no SERVER_CREATE for the guild request")
+	}
+	if names := channelNames(guild.Channels); containsString(names, secret.Name) {
+		t.Errorf("guild request channels = %v, want no secret", names)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// role creates a custom role in the default server and gives it to members
+func (ts *testServer) role(t *testing.T, name string, position int, perms models.Permission, members ...*models.User) *models.Role {
+	t.Helper()
+	role := models.NewRole(ts.server.ID, name)
+	role.Position = position
+	role.Permissions = perms
+	if err := ts.db.CreateRole(role); err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range members {
+		if err := ts.db.AddMemberRole(user.ID, ts.server.ID, role.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return role
+}
+
+// hasRole reports whether user holds role in the default server
+func (ts *testServer) hasRole(t *testing.T, user *models.User, role *models.Role) bool {
+	t.Helper()
+	roles, err := ts.db.GetMemberRoles(ts.server.ID, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range roles {
+		if r.ID == role.ID {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRoleHierarchy(t *testing.T) {
+	ts := newTestServer(t)
+	owner, admin := ts.addMember(t, "owner"), ts.addMember(t, "admin")
+	mod, peer := ts.addMember(t, "mod"), ts.addMember(t, "peer")
+	helper, plain := ts.addMember(t, "helper"), ts.addMember(t, "plain")
+	if err := ts.db.UpdateServerOwner(ts.server.ID, owner.ID); err != nil {
+		t.Fatal(err)
+	}
+	staff := models.PermissionManageRoles | models.PermissionKickMembers
+	helpers := ts.role(t, "Helpers", 1, 0, helper)
+	mods := ts.role(t, "Mods", 2, staff, mod, peer)
+	admins := ts.role(t, "Admins", 3, staff, admin)
+
+	color := 0x336699
+	edit := func(role *models.Role) func(c *Client) {
+		return func(c *Client) {
+			ts.h.HandleRoleUpdate(c, request(t, protocol.OpRoleUpdate, &protocol.RoleUpdateRequest{
+				ServerID: ts.server.ID, RoleID: role.ID, Color: &color,
+			}))
+		}
+	}
+	assign := func(user *models.User, role *models.Role) func(c *Client) {
+		return func(c *Client) {
+			ts.h.HandleRoleAssign(c, request(t, protocol.OpRoleAssign, &protocol.RoleAssignRequest{
+				ServerID: ts.server.ID, UserID: user.ID, RoleName: role.Name,
+			}))
+		}
+	}
+	kick := func(user *models.User) func(c *Client) {
+		return func(c *Client) {
+			ts.h.HandleKickMember(c, request(t, protocol.OpKickMember, &protocol.KickMemberRequest{
+				ServerID: ts.server.ID, UserID: user.ID,
+			}))
+		}
+	}
+
+	// In order: the kicks that succeed come last
+	tests := []struct {
+		name    string
+		actor   *models.User
+		do      func(c *Client)
+		allowed bool
+	}{
+		{"mod edits a lower role", mod, edit(helpers), true},
+		{"mod edits their own top role", mod, edit(mods), false},
+		{"mod edits a higher role", mod, edit(admins), false},
+		{"mod assigns a lower role", mod, assign(plain, helpers), true},
+		{"mod assigns their own top role", mod, assign(plain, mods), false},
+		{"mod assigns a higher role", mod, assign(plain, admins), false},
+		{"mod assigns to an equal member", mod, assign(peer, helpers), false},
+		{"mod assigns to a higher member", mod, assign(admin, helpers), false},
+		{"mod grants themselves a lower role", mod, assign(mod, helpers), true},
+		{"mod grants themselves their top role again", mod, assign(mod, mods), false},
+		{"mod grants themselves a higher role", mod, assign(mod, admins), false},
+		{"mod kicks an equal member", mod, kick(peer), false},
+		{"mod kicks a higher member", mod, kick(admin), false},
+		{"mod kicks the owner", mod, kick(owner), false},
+		{"admin kicks the owner", admin, kick(owner), false},
+		{"admin assigns a role to the owner", admin, assign(owner, helpers), false},
+		{"owner edits the top role", owner, edit(admins), true},
+		{"owner assigns the top role", owner, assign(plain, admins), true},
+		{"mod kicks a lower member", mod, kick(helper), true},
+		{"owner kicks the top member", owner, kick(admin), true},
+	}
+	for _, tt := range tests {
+		c := ts.connect(tt.actor)
+		tt.do(c)
+		ts.flush()
+		e := lastError(t, c)
+		switch {
+		case tt.allowed && e != nil:
+			t.Errorf("%s: refused: %s", tt.name, e.Message)
+		case !tt.allowed && (e == nil || e.Code != protocol.ErrorCodeRoleHierarchy):
+			t.Errorf("%s: got %+v, want a role hierarchy error", tt.name, e)
+		}
+	}
+
+	// Refusals changed nothing
+	if ts.hasRole(t, mod, admins) || ts.hasRole(t, peer, helpers) || ts.hasRole(t, owner, helpers) {
+		t.Error("a refused role assignment was applied")
+	}
+	if _, err := ts.db.GetServerMember(ts.server.ID, peer.ID); err != nil {
+		t.Errorf("refused kick removed peer: %v", err)
+	}
+	if _, err := ts.db.GetServerMember(ts.server.ID, helper.ID); err == nil {
+		t.Error("allowed kick left helper in the server")
+	}
+}
+
+// post stores a message by author in channel directly
+func (ts *testServer) post(t *testing.T, channel *models.Channel, author *models.User, content string) *models.Message {
+	t.Helper()
+	msg := models.NewMessage(channel.ID, author.ID, content)
+	if err := ts.db.CreateMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestMessageChangesUseChannelPermissions(t *testing.T) {
+	ts := newTestServer(t)
+	alice, bob := ts.addMember(t, "alice"), ts.addMember(t, "bob")
+	mods := ts.role(t, "Mods", 1, models.PermissionManageMessages, bob)
+
+	secret := ts.privateChannel(t, "secret")
+	lounge := models.NewTextChannel(ts.server.ID, "lounge")
+	if err := ts.db.CreateChannel(lounge); err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range []models.PermissionOverwrite{
+		{ID: mods.ID, Type: "role", Deny: int64(models.PermissionManageMessages)},
+		{ID: ts.everyone.ID, Type: "role", Deny: int64(models.PermissionAddReactions)},
+	} {
+		if err := ts.db.SetChannelOverwrite(lounge.ID, o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hidden := ts.post(t, secret, alice, "hidden")
+	denied := ts.post(t, lounge, alice, "denied")
+	visible := ts.post(t, ts.general, alice, "visible")
+
+	del := func(m *models.Message) func(c *Client) {
+		return func(c *Client) {
+			ts.h.HandleDeleteMessage(c, request(t, protocol.OpMessageDelete, &protocol.MessageDeleteRequest{
+				ChannelID: m.ChannelID, MessageID: m.ID,
+			}))
+		}
+	}
+	edit := func(m *models.Message) func(c *Client) {
+		return func(c *Client) {
+			ts.h.HandleEditMessage(c, request(t, protocol.OpMessageEdit, &protocol.MessageEditRequest{
+				ChannelID: m.ChannelID, MessageID: m.ID, Content: "edited",
+			}))
+		}
+	}
+	react := func(m *models.Message) func(c *Client) {
+		return func(c *Client) {
+			ts.h.HandleReaction(c, request(t, protocol.OpReactionAdd, &protocol.ReactionRequest{
+				ChannelID: m.ChannelID, MessageID: m.ID, Emoji: "👍",
+			}), true)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		actor *models.User
+		do    func(c *Client)
+		want  int // Error code, or 0 when allowed
+	}{
+		{"moderator deletes in a hidden channel", bob, del(hidden), protocol.ErrorCodeUnknownChannel},
+		{"moderator edits in a hidden channel", bob, edit(hidden), protocol.ErrorCodeUnknownChannel},
+		{"author edits in a channel they lost", alice, edit(hidden), protocol.ErrorCodeUnknownChannel},
+		{"reaction in a hidden channel", bob, react(hidden), protocol.ErrorCodeUnknownChannel},
+		{"moderator deletes where Manage Messages is denied", bob, del(denied), protocol.ErrorCodeForbidden},
+		{"reaction where Add Reactions is denied", alice, react(denied), protocol.ErrorCodeForbidden},
+		{"reaction in #general", bob, react(visible), 0},
+		{"moderator deletes in #general", bob, del(visible), 0},
+	}
+	for _, tt := range tests {
+		c := ts.connect(tt.actor)
+		tt.do(c)
+		ts.flush()
+		e := lastError(t, c)
+		switch {
+		case tt.want == 0 && e != nil:
+			t.Errorf("%s: refused: %s", tt.name, e.Message)
+		case tt.want != 0 && (e == nil || e.Code != tt.want):
+			t.Errorf("%s: got %+v, want error %d", tt.name, e, tt.want)
+		}
+	}
+
+	for _, m := range []*models.Message{hidden, denied} {
+		stored, err := ts.db.GetMessageByID(m.ID)
+		if err != nil {
+			t.Errorf("refused delete removed %q: %v", m.Content, err)
+			continue
+		}
+		if stored.Content != m.Content || len(stored.Reactions) != 0 {
+			t.Errorf("refused change applied to %q: %+v", m.Content, stored)
+		}
+	}
+	if _, err := ts.db.GetMessageByID(visible.ID); err == nil {
+		t.Error("allowed delete left the message")
+	}
+}
+
+// auditActions returns the actions logged in a server, oldest first
+func (ts *testServer) auditActions(t *testing.T, serverID uuid.UUID) []string {
+	t.Helper()
+	entries, err := ts.db.GetAuditLog(serverID, database.AuditLogFilter{}, 50, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for i := len(entries) - 1; i >= 0; i-- {
+		actions = append(actions, string(entries[i].Action))
+	}
+	return actions
+}
+
+func TestAuditsEditsThreadsAndServers(t *testing.T) {
+	ts := newTestServer(t)
+	alice, bob := ts.addMember(t, "alice"), ts.addMember(t, "bob")
+	ts.role(t, "Mods", 1, models.PermissionManageMessages, bob)
+	msg := ts.post(t, ts.general, alice, "original")
+	edit := func(user *models.User, content string) {
+		c := ts.connect(user)
+		ts.h.HandleEditMessage(c, request(t, protocol.OpMessageEdit, &protocol.MessageEditRequest{
+			ChannelID: msg.ChannelID, MessageID: msg.ID, Content: content,
+		}))
+		if e := lastError(t, c); e != nil {
+			t.Fatalf("edit by %s refused: %s", user.Username, e.Message)
+		}
+	}
+
+	// Only the moderator's edit is logged, with the content before and after
+	edit(alice, "typo")
+	edit(bob, "moderated")
+	entries, err := ts.db.GetAuditLog(ts.server.ID, database.AuditLogFilter{Action: string(models.AuditMessageEdit)}, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ActorID != bob.ID ||
+		!strings.Contains(string(entries[0].Before), "typo") || !strings.Contains(string(entries[0].After), "moderated") {
+		t.Fatalf("message edits logged as %+v", entries)
+	}
+
+	c := ts.connect(alice)
+	ts.h.HandleThreadCreate(c, request(t, protocol.OpThreadCreate, &protocol.ThreadCreateRequest{
+		ChannelID: ts.general.ID, MessageID: msg.ID, Name: "follow-up",
+	}))
+	entries, err = ts.db.GetAuditLog(ts.server.ID, database.AuditLogFilter{Action: "thread"}, 10, nil)
+	if err != nil || len(entries) != 1 || entries[0].TargetName != "#follow-up" {
+		t.Fatalf("thread creation logged as %+v, %v", entries, err)
+	}
+	threadID := uuid.MustParse(entries[0].TargetID)
+	for _, archived := range []bool{true, false} {
+		ts.h.HandleThreadArchive(c, request(t, protocol.OpThreadArchive, &protocol.ThreadArchiveRequest{
+			ThreadID: threadID, Archived: archived,
+		}))
+	}
+	if e := lastError(t, c); e != nil {
+		t.Fatalf("thread change refused: %s", e.Message)
+	}
+	ts.h.HandleServerLeave(c, request(t, protocol.OpServerLeave, &protocol.ServerLeaveRequest{ServerID: ts.server.ID}))
+
+	want := []string{"message_edit", "thread_create", "thread_archive", "thread_unarchive", "member_leave"}
+	if got := ts.auditActions(t, ts.server.ID); !equalStrings(got, want...) {
+		t.Errorf("audit log = %v, want %v", got, want)
+	}
+
+	// A new server's log starts with its creation
+	ts.h.HandleServerCreate(ts.connect(bob), request(t, protocol.OpServerCreate, &protocol.ServerCreateRequest{Name: "Bob's place"}))
+	servers, err := ts.db.GetUserServers(bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := 0
+	for _, s := range servers {
+		if s.ID == ts.server.ID {
+			continue
+		}
+		created++
+		if got := ts.auditActions(t, s.ID); !equalStrings(got, "server_create") {
+			t.Errorf("new server's audit log = %v", got)
+		}
+	}
+	if created != 1 {
+		t.Fatalf("bob is in %d new servers, want 1", created)
+	}
+}
+
+func TestDirectMessages(t *testing.T) {
+	ts := newTestServer(t)
+	alice, bob, carol := ts.addMember(t, "alice"), ts.addMember(t, "bob"), ts.addMember(t, "carol")
+	a := ts.online(t, alice)
+	open := func(c *Client, recipient *models.User) *models.Channel {
+		t.Helper()
+		ts.h.HandleDMOpen(c, request(t, protocol.OpDMOpen, &protocol.DMOpenRequest{RecipientID: recipient.ID}))
+		var payload protocol.DMChannelPayload
+		if !dispatch(t, c, protocol.EventDMChannelOpen, &payload) {
+			t.Fatalf("no %s for a DM with %s", protocol.EventDMChannelOpen, recipient.Username)
+		}
+		return payload.Channel
+	}
+	dm := open(a, bob)
+	if again := open(a, bob); again.ID != dm.ID {
+		t.Fatalf("reopening the DM gave channel %s, want %s", again.ID, dm.ID)
+	}
+
+	// Bob is offline when alice writes
+	ts.h.HandleSendMessage(a, request(t, protocol.OpSendMessage, &protocol.SendMessagePayload{
+		ChannelID: dm.ID, Content: "are you there?",
+	}))
+	ts.flush()
+	if e := lastError(t, a); e != nil {
+		t.Fatalf("DM refused: %s", e.Message)
+	}
+
+	// Only the two of them can post or read
+	stranger := models.NewUser("stranger", "stranger@example.com")
+	if err := ts.db.CreateUser(stranger, ""); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		actor *models.User
+		do    func(c *Client)
+	}{
+		{"member posts in someone else's DM", carol, func(c *Client) {
+			ts.h.HandleSendMessage(c, request(t, protocol.OpSendMessage, &protocol.SendMessagePayload{ChannelID: dm.ID, Content: "hi"}))
+		}},
+		{"member reads someone else's DM", carol, func(c *Client) {
+			ts.h.HandleRequestMessages(c, request(t, protocol.OpRequestMessages, &protocol.MessageHistoryRequest{ChannelID: dm.ID}))
+		}},
+		{"DM with a user who shares no server", stranger, func(c *Client) {
+			ts.h.HandleDMOpen(c, request(t, protocol.OpDMOpen, &protocol.DMOpenRequest{RecipientID: alice.ID}))
+		}},
+	}
+	for _, tt := range tests {
+		c := ts.online(t, tt.actor)
+		tt.do(c)
+		ts.flush()
+		if e := lastError(t, c); e == nil || e.Code != protocol.ErrorCodeForbidden {
+			t.Errorf("%s: got %+v, want forbidden", tt.name, e)
+		}
+	}
+
+	// Bob's next READY carries the channel and the message, once
+	channels, users, undelivered := ts.h.loadPrivateChannels(bob.ID)
+	if len(channels) != 1 || channels[0].ID != dm.ID {
+		t.Fatalf("bob's DM channels = %v", channels)
+	}
+	var names []string
+	for _, u := range users {
+		names = append(names, u.Username)
+	}
+	if !containsString(names, "alice") {
+		t.Errorf("DM recipients = %v, want alice among them", names)
+	}
+	if len(undelivered) != 1 || undelivered[0].Message.Content != "are you there?" || undelivered[0].Author.ID != alice.ID {
+		t.Fatalf("undelivered DMs = %v", undelivered)
+	}
+	if _, _, undelivered := ts.h.loadPrivateChannels(bob.ID); len(undelivered) != 0 {
+		t.Errorf("%d DMs delivered twice", len(undelivered))
+	}
+
+	// History loads like any channel's
+	b := ts.online(t, bob)
+	ts.h.HandleRequestMessages(b, request(t, protocol.OpRequestMessages, &protocol.MessageHistoryRequest{ChannelID: dm.ID}))
+	ts.flush()
+	var history protocol.MessageHistoryPayload
+	if !dispatch(t, b, protocol.EventMessagesHistory, &history) || len(history.Messages) != 1 {
+		t.Errorf("DM history = %+v", history.Messages)
+	}
+}
+
+func TestReactions(t *testing.T) {
+	ts := newTestServer(t)
+	alice, bob := ts.addMember(t, "alice"), ts.addMember(t, "bob")
+	a, b := ts.online(t, alice), ts.online(t, bob)
+	for _, user := range []*models.User{alice, bob} {
+		ts.h.hub.JoinChannel(user.ID, ts.general.ID)
+	}
+	msg := ts.post(t, ts.general, alice, "ship it?")
+	react := func(c *Client, emoji string, add bool) {
+		t.Helper()
+		op := protocol.OpReactionAdd
+		if !add {
+			op = protocol.OpReactionRemove
+		}
+		ts.h.HandleReaction(c, request(t, op, &protocol.ReactionRequest{
+			ChannelID: msg.ChannelID, MessageID: msg.ID, Emoji: emoji,
+		}), add)
+		ts.flush()
+	}
+	// history returns the message's reactions as the channel history reports them
+	history := func() []models.Reaction {
+		t.Helper()
+		ts.h.HandleRequestMessages(a, request(t, protocol.OpRequestMessages, &protocol.MessageHistoryRequest{ChannelID: ts.general.ID}))
+		ts.flush()
+		var payload protocol.MessageHistoryPayload
+		if !dispatch(t, a, protocol.EventMessagesHistory, &payload) || len(payload.Messages) != 1 {
+			t.Fatalf("history = %+v", payload.Messages)
+		}
+		return payload.Messages[0].Message.Reactions
+	}
+
+	react(a, "👍", true)
+	var added protocol.ReactionPayload
+	if !dispatch(t, b, protocol.EventMessageReactionAdd, &added) || added.UserID != alice.ID || added.Emoji != "👍" {
+		t.Fatalf("bob saw %+v, want alice's 👍", added)
+	}
+	react(b, "👍", true)
+	react(a, "👍", true) // Already there, so nothing is sent
+	if dispatch(t, b, protocol.EventMessageReactionAdd, &added) && added.UserID == alice.ID {
+		t.Error("a repeated reaction was broadcast again")
+	}
+	if got := history(); len(got) != 1 || got[0].Count != 2 {
+		t.Fatalf("reactions after two 👍 = %+v", got)
+	}
+
+	react(a, "👍", false)
+	var removed protocol.ReactionPayload
+	if !dispatch(t, b, protocol.EventMessageReactionRemove, &removed) || removed.UserID != alice.ID {
+		t.Fatalf("bob saw %+v, want alice's 👍 removed", removed)
+	}
+	if got := history(); len(got) != 1 || got[0].Count != 1 || got[0].UserIDs[0] != bob.ID {
+		t.Errorf("reactions after alice's removal = %+v", got)
+	}
+
+	react(a, "two words", true)
+	if e := lastError(t, a); e == nil || e.Code != protocol.ErrorCodeInvalidPayload {
+		t.Errorf("reaction with a space: got %+v, want an invalid payload error", e)
+	}
+}
+
+func TestRoleManagement(t *testing.T) {
+	ts := newTestServer(t)
+	alice, mod := ts.addMember(t, "alice"), ts.addMember(t, "mod")
+	mods := ts.role(t, "Mods", 1, models.PermissionManageRoles|models.PermissionKickMembers, mod)
+	watcher := ts.online(t, alice)
+	m := ts.connect(mod)
+	refused := func(name string, c *Client, want int) {
+		t.Helper()
+		ts.flush()
+		if e := lastError(t, c); e == nil || e.Code != want {
+			t.Errorf("%s: got %+v, want error %d", name, e, want)
+		}
+	}
+
+	// A new role goes directly above @everyone, pushing the others up
+	kick := models.PermissionKickMembers
+	ts.h.HandleRoleCreate(m, request(t, protocol.OpRoleCreate, &protocol.RoleCreateRequest{
+		ServerID: ts.server.ID, Name: "Helpers", Color: 0x336699, Permissions: &kick,
+	}))
+	ts.flush()
+	if e := lastError(t, m); e != nil {
+		t.Fatalf("create refused: %s", e.Message)
+	}
+	var created protocol.RolePayload
+	if !dispatch(t, watcher, protocol.EventRoleCreate, &created) || created.Role.Name != "Helpers" {
+		t.Fatalf("members saw %+v, want Helpers created", created.Role)
+	}
+	helpers := created.Role
+	if stored, err := ts.db.GetRoleByID(mods.ID); err != nil || helpers.Position != 1 || stored.Position != 2 {
+		t.Errorf("positions after create: Helpers %d, Mods %+v (%v)", helpers.Position, stored, err)
+	}
+
+	admin := models.PermissionAdministrator
+	ts.h.HandleRoleCreate(m, request(t, protocol.OpRoleCreate, &protocol.RoleCreateRequest{
+		ServerID: ts.server.ID, Name: "Admins", Permissions: &admin,
+	}))
+	refused("create with a permission the creator lacks", m, protocol.ErrorCodeForbidden)
+	a := ts.connect(alice)
+	ts.h.HandleRoleCreate(a, request(t, protocol.OpRoleCreate, &protocol.RoleCreateRequest{
+		ServerID: ts.server.ID, Name: "Mine",
+	}))
+	refused("create without Manage Roles", a, protocol.ErrorCodeForbidden)
+
+	name := "Trusted"
+	ts.h.HandleRoleUpdate(m, request(t, protocol.OpRoleUpdate, &protocol.RoleUpdateRequest{
+		ServerID: ts.server.ID, RoleID: helpers.ID, Name: &name,
+	}))
+	ts.flush()
+	var updated protocol.RolePayload
+	if !dispatch(t, watcher, protocol.EventRoleUpdate, &updated) || updated.Role.ID != helpers.ID || updated.Role.Name != "Trusted" {
+		t.Errorf("members saw %+v, want Helpers renamed", updated.Role)
+	}
+
+	// Deleting a role takes it away from its members
+	if err := ts.db.AddMemberRole(alice.ID, ts.server.ID, helpers.ID); err != nil {
+		t.Fatal(err)
+	}
+	ts.h.HandleRoleDelete(m, request(t, protocol.OpRoleDelete, &protocol.RoleDeleteRequest{ServerID: ts.server.ID, RoleID: helpers.ID}))
+	ts.flush()
+	var deleted protocol.RoleDeletePayload
+	if !dispatch(t, watcher, protocol.EventRoleDelete, &deleted) || deleted.RoleID != helpers.ID {
+		t.Errorf("members saw %+v, want Helpers deleted", deleted)
+	}
+	if ts.hasRole(t, alice, helpers) {
+		t.Error("alice kept a deleted role")
+	}
+	ts.h.HandleRoleDelete(m, request(t, protocol.OpRoleDelete, &protocol.RoleDeleteRequest{ServerID: ts.server.ID, RoleID: ts.everyone.ID}))
+	refused("delete @everyone", m, protocol.ErrorCodeInvalidPayload)
+}
+
+func TestWebSocketAdmission(t *testing.T) {
+	config := DefaultConfig()
+	config.DatabasePath = filepath.Join(t.TempDir(), "concord.db")
+	config.AllowedOrigins = []string{"https://chat.example.com"}
+	config.MaxConnectionsPerIP = 2
+	s, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.db.Close() })
+	s.admission.identifyTimeout = 200 * time.Millisecond
+	go s.hub.Run()
+	srv := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	t.Cleanup(srv.Close)
+
+	dial := func(origin string) (*websocket.Conn, int) {
+		t.Helper()
+		header := http.Header{}
+		if origin != "" {
+			header.Set("Origin", origin)
+		}
+		conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), header)
+		if err != nil {
+			if resp == nil {
+				t.Fatal(err)
+			}
+			return nil, resp.StatusCode
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn, http.StatusSwitchingProtocols
+	}
+
+	if _, status := dial("https://evil.example.com"); status != http.StatusForbidden {
+		t.Errorf("foreign origin: status %d, want %d", status, http.StatusForbidden)
+	}
+	first, _ := dial("https://chat.example.com")
+	second, _ := dial("") // Native clients send no Origin
+	if first == nil || second == nil {
+		t.Fatal("allowed connections were refused")
+	}
+	if _, status := dial(""); status != http.StatusTooManyRequests {
+		t.Errorf("connection over the per-IP cap: status %d, want %d", status, http.StatusTooManyRequests)
+	}
+
+	// Neither identifies, so both are closed and their slots freed
+	for _, conn := range []*websocket.Conn{first, second} {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var err error
+		for err == nil {
+			_, _, err = conn.ReadMessage() // HELLO first
+		}
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != int(protocol.CloseNotAuthenticated) {
+			t.Errorf("idle connection ended with %v, want close code %d", err, protocol.CloseNotAuthenticated)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, _ := dial("")
+		if conn != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("slots of closed connections were not freed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Metrics are only served with the configured token
+	metrics := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/metrics", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		s.handleMetrics(rec, req)
+		return rec
+	}
+	if rec := metrics(""); rec.Code != http.StatusNotFound {
+		t.Errorf("metrics without a configured token: status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	config.MetricsToken = "scrape-secret"
+	for _, token := range []string{"", "wrong", "scrape-secret-longer"} {
+		if rec := metrics(token); rec.Code != http.StatusUnauthorized || strings.Contains(rec.Body.String(), "concord_") {
+			t.Errorf("metrics with token %q: status %d, want %d", token, rec.Code, http.StatusUnauthorized)
+		}
+	}
+	rec := metrics("scrape-secret")
+	for _, line := range []string{
+		`concord_connections_rejected_total{reason="origin"} 1`,
+		`concord_connections_rejected_total{reason="ip_limit"} `, // Retries above may add more
+		`concord_connections_rejected_total{reason="identify_timeout"} 2`,
+	} {
+		if !strings.Contains(rec.Body.String(), line) {
+			t.Errorf("metrics lack %q:\n%s", line, rec.Body.String())
+		}
+	}
+}
+
+func TestReplies(t *testing.T) {
+	ts := newTestServer(t)
+	alice, bob := ts.addMember(t, "alice"), ts.addMember(t, "bob")
+	a, b := ts.online(t, alice), ts.online(t, bob)
+	for _, user := range []*models.User{alice, bob} {
+		ts.h.hub.JoinChannel(user.ID, ts.general.ID)
+	}
+	secret := ts.privateChannel(t, "secret")
+	parent := ts.post(t, ts.general, alice, "lunch?")
+	elsewhere := ts.post(t, secret, alice, "not here")
+	reply := func(to uuid.UUID) {
+		t.Helper()
+		ts.h.HandleSendMessage(b, request(t, protocol.OpSendMessage, &protocol.SendMessagePayload{
+			ChannelID: ts.general.ID, Content: "sure", ReplyToID: &to,
+		}))
+		ts.flush()
+	}
+
+	reply(parent.ID)
+	var created protocol.MessageCreatePayload
+	if !dispatch(t, a, protocol.EventMessageCreate, &created) || created.ReplyToID == nil || *created.ReplyToID != parent.ID {
+		t.Fatalf("alice saw %+v, want a reply to %s", created.Message, parent.ID)
+	}
+	if stored, err := ts.db.GetMessageByID(created.ID); err != nil || !stored.IsReply() {
+		t.Errorf("stored reply = %+v, %v", stored, err)
+	}
+
+	// A reply can't point into another channel
+	reply(elsewhere.ID)
+	if e := lastError(t, b); e == nil || e.Code != protocol.ErrorCodeNotFound {
+		t.Errorf("reply across channels: got %+v, want not found", e)
+	}
+
+	// Parents that aren't loaded are fetched for the preview, only from
+	// the reply's own channel
+	fetch := func(channelID uuid.UUID, ids ...uuid.UUID) {
+		t.Helper()
+		ts.h.HandleFetchMessages(b, request(t, protocol.OpFetchMessages, &protocol.MessageFetchRequest{
+			ChannelID: channelID, MessageIDs: ids,
+		}))
+	}
+	fetch(ts.general.ID, parent.ID, elsewhere.ID)
+	var fetched protocol.MessagesFetchedPayload
+	if !dispatch(t, b, protocol.EventMessagesFetched, &fetched) {
+		t.Fatal("no MESSAGES_FETCHED")
+	}
+	if len(fetched.Messages) != 1 || fetched.Messages[0].Message.Content != "lunch?" || fetched.Messages[0].Author.ID != alice.ID {
+		t.Errorf("fetched %+v, want alice's message", fetched.Messages)
+	}
+	if len(fetched.Missing) != 1 || fetched.Missing[0] != elsewhere.ID {
+		t.Errorf("missing = %v, want the other channel's message", fetched.Missing)
+	}
+	fetch(secret.ID, elsewhere.ID)
+	if e := lastError(t, b); e == nil || e.Code != protocol.ErrorCodeForbidden {
+		t.Errorf("fetch from a hidden channel: got %+v, want forbidden", e)
+	}
+}
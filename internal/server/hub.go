@@ -22,8 +22,12 @@ type Hub struct {
 	// Clients by channel ID for typing indicators and DMs
 	channelClients map[uuid.UUID]map[uuid.UUID]*Client
 
-	// Register requests from clients
-	register chan *Client
+	// Resumable sessions by session ID (attached and recently detached)
+	sessions map[string]*Session
+
+	// Open connections by the login session they authenticated with,
+	// including connections superseded by a newer one
+	authSessions map[uuid.UUID]map[*Client]bool
 
 	// Unregister requests from clients
 	unregister chan *Client
@@ -59,7 +63,8 @@ func NewHub() *Hub {
 		clients:        make(map[uuid.UUID]*Client),
 		serverClients:  make(map[uuid.UUID]map[uuid.UUID]*Client),
 		channelClients: make(map[uuid.UUID]map[uuid.UUID]*Client),
-		register:       make(chan *Client),
+		sessions:       make(map[string]*Session),
+		authSessions:   make(map[uuid.UUID]map[*Client]bool),
 		unregister:     make(chan *Client),
 		broadcast:      make(chan *BroadcastMessage, 256),
 		sequence:       0,
@@ -68,16 +73,19 @@ func NewHub() *Hub {
 
 // Run starts the hub's main loop
 func (h *Hub) Run() {
+	sessionTicker := time.NewTicker(30 * time.Second)
+	defer sessionTicker.Stop()
+
 	for {
 		select {
-		case client := <-h.register:
-			h.registerClient(client)
-
 		case client := <-h.unregister:
 			h.unregisterClient(client)
 
 		case msg := <-h.broadcast:
 			h.broadcastMessage(msg)
+
+		case <-sessionTicker.C:
+			h.expireSessions()
 		}
 	}
 }
@@ -105,7 +113,24 @@ func (h *Hub) registerClient(client *Client) {
 func (h *Hub) unregisterClient(client *Client) {
 	h.mu.Lock()
 
-	if _, ok := h.clients[client.UserID]; !ok {
+	if clients, ok := h.authSessions[client.authSessionID]; ok {
+		delete(clients, client)
+		if len(clients) == 0 {
+			delete(h.authSessions, client.authSessionID)
+		}
+	}
+
+	existing, ok := h.clients[client.UserID]
+	if !ok {
+		h.mu.Unlock()
+		return
+	}
+	if existing != client {
+		// This connection was superseded by a newer one for the same user
+		if session, ok := h.sessions[client.SessionID]; ok {
+			session.detach(client, nil, nil)
+		}
+		close(client.send)
 		h.mu.Unlock()
 		return
 	}
@@ -129,13 +154,22 @@ func (h *Hub) unregisterClient(client *Client) {
 	}
 
 	// Remove from channel client maps
+	var channelIDs []uuid.UUID
 	for channelID, clients := range h.channelClients {
+		if _, ok := clients[client.UserID]; ok {
+			channelIDs = append(channelIDs, channelID)
+		}
 		delete(clients, client.UserID)
 		if len(clients) == 0 {
 			delete(h.channelClients, channelID)
 		}
 	}
 
+	// Keep the session around so the client can RESUME
+	if session, ok := h.sessions[client.SessionID]; ok {
+		session.detach(client, serverIDs, channelIDs)
+	}
+
 	// Close the client's send channel
 	close(client.send)
 
@@ -191,6 +225,10 @@ func (h *Hub) broadcastMessage(msg *BroadcastMessage) {
 			continue
 		}
 
+		if session, ok := h.sessions[client.SessionID]; ok {
+			session.record(msg.Message, msg.ChannelID)
+		}
+
 		select {
 		case client.send <- msg.Message:
 		default:
@@ -198,6 +236,152 @@ func (h *Hub) broadcastMessage(msg *BroadcastMessage) {
 			log.Printf("Client buffer full, dropping message: user=%s", client.UserID)
 		}
 	}
+
+	// Buffer for detached sessions that would have received this message
+	for _, session := range h.sessions {
+		if session.wants(msg) {
+			session.record(msg.Message, msg.ChannelID)
+		}
+	}
+}
+
+// StartSession creates a resumable session for a newly identified client. It
+// runs synchronously so dispatches sent right after IDENTIFY are recorded.
+func (h *Hub) StartSession(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sessions[client.SessionID] = NewSession(client)
+}
+
+// recordDispatch stores a dispatch sent directly to a client in its session buffer
+func (h *Hub) recordDispatch(client *Client, msg *protocol.Message) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if session, ok := h.sessions[client.SessionID]; ok {
+		session.record(msg, nil)
+	}
+}
+
+// ResumeSession re-attaches client to the session named by client.SessionID and
+// sends it every dispatch delivered after lastSeq, except broadcasts to
+// channels that aren't in channelIDs any more. It returns false if the
+// session is unknown, belongs to another user, or has evicted lastSeq; the
+// client must then IDENTIFY again.
+func (h *Hub) ResumeSession(client *Client, lastSeq int64, channelIDs []uuid.UUID) bool {
+	channels := idSet(channelIDs)
+
+	h.mu.Lock()
+	session, ok := h.sessions[client.SessionID]
+	if !ok || session.UserID != client.UserID {
+		h.mu.Unlock()
+		return false
+	}
+
+	// Take over from a connection the server hasn't noticed is dead yet
+	if previous, ok := h.clients[client.UserID]; ok && previous != client {
+		delete(h.clients, client.UserID)
+		for _, clients := range h.serverClients {
+			if clients[client.UserID] == previous {
+				delete(clients, client.UserID)
+			}
+		}
+		for _, clients := range h.channelClients {
+			if clients[client.UserID] == previous {
+				delete(clients, client.UserID)
+			}
+		}
+		previous.conn.Close()
+	}
+
+	// Replay without holding the hub lock. The session keeps buffering for
+	// the client's current subscriptions meanwhile, so catch up until nothing
+	// newer is left, then register while still locked so no broadcast slips
+	// between replay and live delivery.
+	session.resubscribe(client.ServerIDs, channelIDs)
+	replayed := 0
+	for {
+		missed, ok := session.since(lastSeq, channels)
+		if !ok || h.sessions[client.SessionID] != session {
+			if h.sessions[client.SessionID] == session {
+				delete(h.sessions, client.SessionID)
+			}
+			h.mu.Unlock()
+			return false
+		}
+		if len(missed) == 0 {
+			break
+		}
+		h.mu.Unlock()
+		for _, msg := range missed {
+			client.send <- msg
+		}
+		replayed += len(missed)
+		lastSeq = *missed[len(missed)-1].Seq
+		h.mu.Lock()
+	}
+
+	h.clients[client.UserID] = client
+	for _, serverID := range client.ServerIDs {
+		if h.serverClients[serverID] == nil {
+			h.serverClients[serverID] = make(map[uuid.UUID]*Client)
+		}
+		h.serverClients[serverID][client.UserID] = client
+	}
+	for _, channelID := range channelIDs {
+		if h.channelClients[channelID] == nil {
+			h.channelClients[channelID] = make(map[uuid.UUID]*Client)
+		}
+		h.channelClients[channelID][client.UserID] = client
+	}
+	session.attach(client)
+	h.mu.Unlock()
+
+	log.Printf("Session resumed: user=%s, session=%s, replayed=%d", client.UserID, client.SessionID, replayed)
+	return true
+}
+
+// TrackAuthSession records which login session an authenticated client uses
+// so revoking the session can close the connection
+func (h *Hub) TrackAuthSession(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.authSessions[client.authSessionID] == nil {
+		h.authSessions[client.authSessionID] = make(map[*Client]bool)
+	}
+	h.authSessions[client.authSessionID][client] = true
+}
+
+// CloseAuthSessions closes every connection using one of the given login
+// sessions and returns how many were closed
+func (h *Hub) CloseAuthSessions(sessionIDs []uuid.UUID, reason string) int {
+	h.mu.Lock()
+	var clients []*Client
+	for _, id := range sessionIDs {
+		for client := range h.authSessions[id] {
+			clients = append(clients, client)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, client := range clients {
+		client.closeWith(protocol.CloseSessionRevoked, reason)
+		client.conn.Close()
+	}
+	return len(clients)
+}
+
+// expireSessions drops detached sessions that are past the resume window
+func (h *Hub) expireSessions() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for id, session := range h.sessions {
+		if session.expired() {
+			delete(h.sessions, id)
+		}
+	}
 }
 
 // NextSequence returns the next sequence number for dispatch messages
@@ -243,6 +427,14 @@ func (h *Hub) JoinChannel(userID, channelID uuid.UUID) {
 	}
 }
 
+// IsInChannel reports whether a user's connection is subscribed to a channel
+func (h *Hub) IsInChannel(userID, channelID uuid.UUID) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	_, ok := h.channelClients[channelID][userID]
+	return ok
+}
+
 // LeaveChannel removes a client from a channel's client list
 func (h *Hub) LeaveChannel(userID, channelID uuid.UUID) {
 	h.mu.Lock()
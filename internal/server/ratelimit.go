@@ -0,0 +1,197 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/concord-chat/concord/internal/protocol"
+)
+
+// bucketLimit allows burst events at once, then one more every interval
+type bucketLimit struct {
+	burst int
+	every time.Duration
+}
+
+var (
+	// Limit on all frames from one connection
+	connectionLimit = bucketLimit{burst: 60, every: 250 * time.Millisecond}
+
+	// Tighter limits on individual opcodes, on top of connectionLimit
+	opcodeLimits = map[protocol.OpCode]bucketLimit{
+		protocol.OpIdentify:       {burst: 3, every: 10 * time.Second},
+		protocol.OpResume:         {burst: 3, every: 10 * time.Second},
+		protocol.OpSendMessage:    {burst: 5, every: time.Second},
+		protocol.OpMessageEdit:    {burst: 5, every: time.Second},
+		protocol.OpWhisper:        {burst: 5, every: time.Second},
+		protocol.OpTypingStart:    {burst: 3, every: 3 * time.Second},
+		protocol.OpReactionAdd:    {burst: 10, every: 500 * time.Millisecond},
+		protocol.OpReactionRemove: {burst: 10, every: 500 * time.Millisecond},
+		protocol.OpDMOpen:         {burst: 5, every: 5 * time.Second},
+		protocol.OpInviteCreate:   {burst: 3, every: 10 * time.Second},
+		protocol.OpSearch:         {burst: 3, every: 2 * time.Second},
+		protocol.OpAuditLog:       {burst: 3, every: 2 * time.Second},
+		protocol.OpBackup:         {burst: 1, every: time.Minute},
+		protocol.OpSessionList:    {burst: 3, every: 2 * time.Second},
+		protocol.OpSessionRevoke:  {burst: 3, every: 2 * time.Second},
+		protocol.OpServerCreate:   {burst: 2, every: time.Minute},
+		protocol.OpServerDelete:   {burst: 2, every: 10 * time.Second},
+		protocol.OpThreadCreate:   {burst: 3, every: 10 * time.Second},
+		protocol.OpThreadArchive:  {burst: 5, every: 5 * time.Second},
+		protocol.OpFetchMessages:  {burst: 5, every: time.Second},
+	}
+)
+
+const (
+	// A connection that is rate limited this many times within
+	// rateLimitStrikeWindow is disconnected with CloseRateLimited
+	maxRateLimitStrikes   = 10
+	rateLimitStrikeWindow = 10 * time.Second
+
+	// Longest slowmode a channel can have (6 hours)
+	maxSlowmodeSeconds = 21600
+)
+
+// tokenBucket is a single token-bucket rate limit
+type tokenBucket struct {
+	limit  bucketLimit
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit bucketLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{limit: limit, tokens: float64(limit.burst), last: now}
+}
+
+// take refills the bucket for the time elapsed and spends a token if one is available
+func (b *tokenBucket) take(now time.Time) bool {
+	b.tokens += float64(now.Sub(b.last)) / float64(b.limit.every)
+	if burst := float64(b.limit.burst); b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// rateLimiter meters the frames one connection sends. It is only used from
+// the connection's read loop, so it needs no locking.
+type rateLimiter struct {
+	conn    *tokenBucket
+	opcodes map[protocol.OpCode]*tokenBucket
+	strikes []time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		conn:    newTokenBucket(connectionLimit, time.Now()),
+		opcodes: make(map[protocol.OpCode]*tokenBucket),
+	}
+}
+
+// allow reports whether a frame with opcode op may be handled now.
+// Heartbeats are never limited so a busy client isn't timed out.
+func (l *rateLimiter) allow(op protocol.OpCode) bool {
+	if op == protocol.OpHeartbeat {
+		return true
+	}
+	now := time.Now()
+	if !l.conn.take(now) {
+		return false
+	}
+	limit, ok := opcodeLimits[op]
+	if !ok {
+		return true
+	}
+	b := l.opcodes[op]
+	if b == nil {
+		b = newTokenBucket(limit, now)
+		l.opcodes[op] = b
+	}
+	return b.take(now)
+}
+
+// strike records a rejected frame and reports whether the connection has
+// been rate limited often enough to be disconnected
+func (l *rateLimiter) strike() bool {
+	now := time.Now()
+	recent := l.strikes[:0]
+	for _, t := range l.strikes {
+		if now.Sub(t) < rateLimitStrikeWindow {
+			recent = append(recent, t)
+		}
+	}
+	l.strikes = append(recent, now)
+	return len(l.strikes) >= maxRateLimitStrikes
+}
+
+// slowmode tracks when each user may next post in channels with a
+// per-user rate limit
+type slowmode struct {
+	mu   sync.Mutex
+	next map[uuid.UUID]map[uuid.UUID]time.Time // channel -> user -> next allowed send
+}
+
+func newSlowmode() *slowmode {
+	return &slowmode{next: make(map[uuid.UUID]map[uuid.UUID]time.Time)}
+}
+
+// take records a message by userID in a channel with the given slowmode.
+// If the user must still wait, nothing is recorded and the remaining time is
+// returned.
+func (s *slowmode) take(channelID, userID uuid.UUID, seconds int) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	users := s.next[channelID]
+	if users == nil {
+		users = make(map[uuid.UUID]time.Time)
+		s.next[channelID] = users
+	}
+	if wait := users[userID].Sub(now); wait > 0 {
+		return wait
+	}
+	users[userID] = now.Add(time.Duration(seconds) * time.Second)
+	return 0
+}
+
+// refund gives back a slot taken for a message that was then not sent
+func (s *slowmode) refund(channelID, userID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.next[channelID], userID)
+}
+
+// reset forgets a channel's pending waits, e.g. when its slowmode changes
+func (s *slowmode) reset(channelID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.next, channelID)
+}
+
+// expire periodically drops waits that have run out
+func (s *slowmode) expire() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		s.mu.Lock()
+		for channelID, users := range s.next {
+			for userID, next := range users {
+				if now.After(next) {
+					delete(users, userID)
+				}
+			}
+			if len(users) == 0 {
+				delete(s.next, channelID)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/concord-chat/concord/internal/protocol"
+	"github.com/google/uuid"
+)
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Now()
+	b := newTokenBucket(bucketLimit{burst: 3, every: time.Second}, start)
+
+	// The full burst is available at once, then nothing
+	for i := 0; i < 3; i++ {
+		if !b.take(start) {
+			t.Fatalf("take %d of the burst was refused", i+1)
+		}
+	}
+	if b.take(start) {
+		t.Fatal("take past the burst was allowed")
+	}
+
+	// Tokens come back one per interval
+	if b.take(start.Add(999 * time.Millisecond)) {
+		t.Error("token refilled before its interval")
+	}
+	if !b.take(start.Add(time.Second + time.Millisecond)) {
+		t.Error("token not refilled after its interval")
+	}
+
+	// An idle bucket refills only up to the burst
+	later := start.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if !b.take(later) {
+			t.Fatalf("take %d after idling was refused", i+1)
+		}
+	}
+	if b.take(later) {
+		t.Error("idle bucket refilled past its burst")
+	}
+}
+
+func TestRateLimiterOpcodes(t *testing.T) {
+	l := newRateLimiter()
+
+	limit := opcodeLimits[protocol.OpBackup]
+	for i := 0; i < limit.burst; i++ {
+		if !l.allow(protocol.OpBackup) {
+			t.Fatalf("backup %d within the burst was refused", i+1)
+		}
+	}
+	if l.allow(protocol.OpBackup) {
+		t.Error("backup past the burst was allowed")
+	}
+
+	// Each opcode has its own bucket, and heartbeats are never limited
+	if !l.allow(protocol.OpSendMessage) {
+		t.Error("message refused because of the backup limit")
+	}
+	for i := 0; i < 2*connectionLimit.burst; i++ {
+		if !l.allow(protocol.OpHeartbeat) {
+			t.Fatalf("heartbeat %d was refused", i+1)
+		}
+	}
+}
+
+func TestRateLimiterConnectionLimit(t *testing.T) {
+	l := newRateLimiter()
+
+	// Opcodes without their own limit still share the connection's bucket
+	allowed := 0
+	for i := 0; i < 2*connectionLimit.burst; i++ {
+		if l.allow(protocol.OpPresenceUpdate) {
+			allowed++
+		}
+	}
+	if allowed < connectionLimit.burst || allowed > connectionLimit.burst+1 {
+		t.Errorf("allowed %d frames, want about %d", allowed, connectionLimit.burst)
+	}
+}
+
+func TestRateLimiterStrikes(t *testing.T) {
+	l := newRateLimiter()
+	for i := 1; i < maxRateLimitStrikes; i++ {
+		if l.strike() {
+			t.Fatalf("disconnected after %d strikes", i)
+		}
+	}
+	if !l.strike() {
+		t.Errorf("not disconnected after %d strikes", maxRateLimitStrikes)
+	}
+
+	// Strikes outside the window are forgotten
+	l.strikes = []time.Time{time.Now().Add(-2 * rateLimitStrikeWindow)}
+	if l.strike() || len(l.strikes) != 1 {
+		t.Errorf("old strikes were kept: %d", len(l.strikes))
+	}
+}
+
+func TestSlowmode(t *testing.T) {
+	s := newSlowmode()
+	channel, other := uuid.New(), uuid.New()
+	alice, bob := uuid.New(), uuid.New()
+
+	if wait := s.take(channel, alice, 30); wait != 0 {
+		t.Fatalf("first message had to wait %s", wait)
+	}
+	wait := s.take(channel, alice, 30)
+	if wait <= 29*time.Second || wait > 30*time.Second {
+		t.Errorf("second message wait = %s, want just under 30s", wait)
+	}
+
+	// The wait is per user and per channel
+	if wait := s.take(channel, bob, 30); wait != 0 {
+		t.Errorf("another user had to wait %s", wait)
+	}
+	if wait := s.take(other, alice, 30); wait != 0 {
+		t.Errorf("another channel had to wait %s", wait)
+	}
+
+	// A refused message doesn't extend the wait
+	if again := s.take(channel, alice, 30); again > wait {
+		t.Errorf("refused message pushed the wait from %s to %s", wait, again)
+	}
+
+	// A refunded slot can be taken again at once, by that user only
+	s.refund(channel, bob)
+	if wait := s.take(channel, bob, 30); wait != 0 {
+		t.Errorf("refunded slot had to wait %s", wait)
+	}
+	if wait := s.take(channel, alice, 30); wait == 0 {
+		t.Error("refund cleared another user's wait")
+	}
+
+	// Changing the channel's slowmode clears pending waits
+	s.reset(channel)
+	if wait := s.take(channel, alice, 30); wait != 0 {
+		t.Errorf("wait survived reset: %s", wait)
+	}
+}
@@ -2,12 +2,15 @@ package server
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -22,35 +25,68 @@ type Config struct {
 	Host           string `toml:"host"`
 	Port           int    `toml:"port"`
 	DatabasePath   string `toml:"database_path"`
+	DatabaseURL    string `toml:"database_url"` // postgres://... ; overrides DatabasePath when set
 	MaxConnections int    `toml:"max_connections"`
 	Debug          bool   `toml:"debug"`
+	TLSCert        string `toml:"tls_cert"` // PEM certificate; serve wss/https when set with TLSKey
+	TLSKey         string `toml:"tls_key"`
+
+	// WebSocket admission
+	AllowedOrigins      []string `toml:"allowed_origins"`        // Browser origins allowed besides this host; "*" allows any
+	MaxConnectionsPerIP int      `toml:"max_connections_per_ip"` // 0 means unlimited
+	IdentifyTimeout     int      `toml:"identify_timeout"`       // Seconds a new connection has to IDENTIFY; 0 disables
+	MetricsToken        string   `toml:"metrics_token"`          // Bearer token for /api/metrics; empty disables it
+
+	Backup BackupConfig `toml:"backup"`
 }
 
 // DefaultConfig returns the default server configuration
 func DefaultConfig() *Config {
 	return &Config{
-		Host:           "0.0.0.0",
-		Port:           8080,
-		DatabasePath:   "concord.db",
-		MaxConnections: 1000,
-		Debug:          false,
+		Host:                "0.0.0.0",
+		Port:                8080,
+		DatabasePath:        "concord.db",
+		MaxConnections:      1000,
+		Debug:               false,
+		MaxConnectionsPerIP: 20,
+		IdentifyTimeout:     10,
+		Backup: BackupConfig{
+			Dir:  "backups",
+			Keep: 7,
+		},
 	}
 }
 
+// DatabaseSource returns what to pass to database.Open: the PostgreSQL URL
+// when one is configured, otherwise the SQLite file path
+func (c *Config) DatabaseSource() string {
+	if c.DatabaseURL != "" {
+		return c.DatabaseURL
+	}
+	return c.DatabasePath
+}
+
+// TLSEnabled reports whether the server should terminate TLS itself
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCert != "" || c.TLSKey != ""
+}
+
 // Server represents the Concord server
 type Server struct {
-	config   *Config
-	hub      *Hub
-	handlers *Handlers
-	db       *database.DB
-	upgrader websocket.Upgrader
+	config     *Config
+	hub        *Hub
+	handlers   *Handlers
+	db         database.Store
+	backups    *Backups
+	admission  *admission
+	upgrader   websocket.Upgrader
 	httpServer *http.Server
 }
 
 // New creates a new server instance
 func New(config *Config) (*Server, error) {
 	// Open database
-	db, err := database.New(config.DatabasePath)
+	db, err := database.New(config.DatabaseSource())
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -68,20 +104,22 @@ func New(config *Config) (*Server, error) {
 
 	// Create handlers
 	handlers := NewHandlers(db, hub)
+	backups := NewBackups(db, config.Backup)
+	handlers.backups = backups
 
 	// Create server
+	admission := newAdmission(config)
 	s := &Server{
-		config:   config,
-		hub:      hub,
-		handlers: handlers,
-		db:       db,
+		config:    config,
+		hub:       hub,
+		handlers:  handlers,
+		db:        db,
+		backups:   backups,
+		admission: admission,
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
-			CheckOrigin: func(r *http.Request) bool {
-				// In production, you should check the origin
-				return true
-			},
+			CheckOrigin:     admission.checkOrigin,
 		},
 	}
 
@@ -98,7 +136,9 @@ func (s *Server) Run() error {
 	mux.HandleFunc("/ws", s.handleWebSocket)
 	mux.HandleFunc("/api/register", s.handleRegister)
 	mux.HandleFunc("/api/login", s.handleLogin)
+	mux.HandleFunc("/api/invites/", s.handleInvite)
 	mux.HandleFunc("/api/health", s.handleHealth)
+	mux.HandleFunc("/api/metrics", s.handleMetrics)
 
 	// Create HTTP server
 	addr := fmt.Sprintf("%s:%d", s.config.Host, s.config.Port)
@@ -110,14 +150,40 @@ func (s *Server) Run() error {
 		IdleTimeout:  60 * time.Second,
 	}
 
+	scheme, wsScheme := "http", "ws"
+	if s.config.TLSEnabled() {
+		if s.config.TLSCert == "" || s.config.TLSKey == "" {
+			return errors.New("tls_cert and tls_key must both be set")
+		}
+		certs, err := newCertReloader(s.config.TLSCert, s.config.TLSKey)
+		if err != nil {
+			return err
+		}
+		s.httpServer.TLSConfig = certs.tlsConfig()
+		go certs.watchSignals()
+		scheme, wsScheme = "https", "wss"
+	}
+
 	// Handle graceful shutdown
 	go s.handleShutdown()
 
+	if s.config.Backup.IntervalHours > 0 {
+		log.Printf("Backing up every %dh to %s (keeping %d)", s.config.Backup.IntervalHours,
+			s.config.Backup.Dir, s.config.Backup.Keep)
+		go s.backups.schedule()
+	}
+
 	log.Printf("Concord server starting on %s", addr)
-	log.Printf("WebSocket endpoint: ws://%s/ws", addr)
-	log.Printf("API endpoint: http://%s/api", addr)
+	log.Printf("WebSocket endpoint: %s://%s/ws", wsScheme, addr)
+	log.Printf("API endpoint: %s://%s/api", scheme, addr)
 
-	if err := s.httpServer.ListenAndServe(); err != http.ErrServerClosed {
+	var err error
+	if s.httpServer.TLSConfig != nil {
+		err = s.httpServer.ListenAndServeTLS("", "")
+	} else {
+		err = s.httpServer.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
 		return fmt.Errorf("server error: %w", err)
 	}
 
@@ -151,13 +217,25 @@ func (s *Server) handleShutdown() {
 
 // handleWebSocket handles WebSocket upgrade requests
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	ip := remoteIP(r)
+	if reason, ok := s.admission.admit(ip); !ok {
+		status := http.StatusServiceUnavailable
+		if reason == rejectIPLimit {
+			status = http.StatusTooManyRequests
+		}
+		http.Error(w, "Too many connections", status)
+		return
+	}
+
 	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
+		s.admission.release(ip)
 		log.Printf("WebSocket upgrade failed: %v", err)
 		return
 	}
+	s.admission.accept()
 
-	client := NewClient(conn, s.hub, s.handlers)
+	client := NewClient(conn, s.hub, s.handlers, s.admission, ip)
 
 	// Send hello message
 	client.SendHello()
@@ -175,9 +253,10 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Username string `json:"username"`
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Username   string `json:"username"`
+		Email      string `json:"email"`
+		Password   string `json:"password"`
+		InviteCode string `json:"invite_code,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -196,6 +275,15 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Reject a bad invite before creating the account
+	if req.InviteCode != "" {
+		invite, err := s.db.GetInvite(req.InviteCode)
+		if err != nil || !invite.IsUsable() {
+			http.Error(w, "Invalid or expired invite code", http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Hash password
 	passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -226,35 +314,50 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("User retrieval verified: ID=%s, Username=%s", retrievedUser.ID, retrievedUser.Username)
 
-	// Add user to default server
-	defaultServer, everyoneRole, err := s.db.EnsureDefaultServer()
-	if err != nil {
-		log.Printf("Failed to get default server: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+	// Redeem invite, if one was supplied. Invited users join only its server.
+	joined := false
+	if req.InviteCode != "" {
+		if server, err := s.handlers.RedeemInvite(user.ID, req.InviteCode); err != nil {
+			// The invite was validated above, so this only happens if it was used up
+			// meanwhile; fall back to the default server
+			log.Printf("Failed to redeem invite %s for new user: %v", req.InviteCode, err)
+		} else {
+			joined = true
+			log.Printf("User joined server via invite: ServerID=%s, Code=%s", server.ID, req.InviteCode)
+		}
 	}
 
-	// Create server member
-	member := &models.ServerMember{
-		UserID:    user.ID,
-		ServerID:  defaultServer.ID,
-		JoinedAt:  time.Now(),
-		IsMuted:   false,
-		IsDeafened: false,
-	}
-	if err := s.db.AddServerMember(member); err != nil {
-		log.Printf("Failed to add user to default server: %v", err)
-		// Don't fail registration, just log the error
-	} else {
-		log.Printf("User added to default server: ServerID=%s", defaultServer.ID)
-	}
+	// Add user to default server
+	if !joined {
+		defaultServer, everyoneRole, err := s.db.EnsureDefaultServer()
+		if err != nil {
+			log.Printf("Failed to get default server: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
 
-	// Assign @everyone role
-	if err := s.db.AddMemberRole(user.ID, defaultServer.ID, everyoneRole.ID); err != nil {
-		log.Printf("Failed to assign @everyone role: %v", err)
-		// Don't fail registration, just log the error
-	} else {
-		log.Printf("User assigned @everyone role: RoleID=%s", everyoneRole.ID)
+		// Create server member
+		member := &models.ServerMember{
+			UserID:    user.ID,
+			ServerID:  defaultServer.ID,
+			JoinedAt:  time.Now(),
+			IsMuted:   false,
+			IsDeafened: false,
+		}
+		if err := s.db.AddServerMember(member); err != nil {
+			log.Printf("Failed to add user to default server: %v", err)
+			// Don't fail registration, just log the error
+		} else {
+			log.Printf("User added to default server: ServerID=%s", defaultServer.ID)
+		}
+
+		// Assign @everyone role
+		if err := s.db.AddMemberRole(user.ID, defaultServer.ID, everyoneRole.ID); err != nil {
+			log.Printf("Failed to assign @everyone role: %v", err)
+			// Don't fail registration, just log the error
+		} else {
+			log.Printf("User assigned @everyone role: RoleID=%s", everyoneRole.ID)
+		}
 	}
 
 	// Auto-grant admin to the very first real user
@@ -267,7 +370,7 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Generate auth token
-	token, err := s.handlers.CreateAuthToken(user.ID, r.RemoteAddr, r.UserAgent())
+	token, err := s.handlers.CreateAuthToken(user.ID, remoteIP(r), r.UserAgent())
 	if err != nil {
 		log.Printf("Failed to create auth token: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -317,15 +420,17 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Ensure user is a member of the default server
+	// Ensure user belongs to at least one server
 	defaultServer, everyoneRole, err := s.db.EnsureDefaultServer()
 	if err != nil {
 		log.Printf("Failed to get default server: %v", err)
 		// Don't fail login, continue
 	} else {
-		// Check if user is already a member
-		_, err := s.db.GetServerMember(defaultServer.ID, user.ID)
-		if err != nil {
+		// Only users in no server at all are placed in the default one, so
+		// leaving it sticks (banned users are not re-added)
+		servers, err := s.db.GetUserServers(user.ID)
+		banned, _ := s.db.IsBanned(defaultServer.ID, user.ID)
+		if err == nil && len(servers) == 0 && !banned {
 			// User is not a member, add them
 			member := &models.ServerMember{
 				UserID:     user.ID,
@@ -350,7 +455,7 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Generate auth token
-	token, err := s.handlers.CreateAuthToken(user.ID, r.RemoteAddr, r.UserAgent())
+	token, err := s.handlers.CreateAuthToken(user.ID, remoteIP(r), r.UserAgent())
 	if err != nil {
 		log.Printf("Failed to create auth token: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -365,6 +470,90 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleInvite serves /api/invites/{code}.
+// GET returns a preview of the invite; POST redeems it for the user identified
+// by the "Authorization: Bearer <token>" header.
+func (s *Server) handleInvite(w http.ResponseWriter, r *http.Request) {
+	code := strings.TrimPrefix(r.URL.Path, "/api/invites/")
+	if code == "" || strings.Contains(code, "/") {
+		http.Error(w, "Invite not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		invite, err := s.db.GetInvite(code)
+		if err != nil || !invite.IsUsable() {
+			http.Error(w, "Invalid or expired invite code", http.StatusNotFound)
+			return
+		}
+		server, err := s.db.GetServerByID(invite.ServerID)
+		if err != nil {
+			http.Error(w, "Invalid or expired invite code", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"code":        invite.Code,
+			"server_id":   server.ID,
+			"server_name": server.Name,
+			"expires_at":  invite.ExpiresAt,
+			"uses":        invite.Uses,
+			"max_uses":    invite.MaxUses,
+		})
+
+	case http.MethodPost:
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		user, _, _, err := s.handlers.Authenticate(token)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		server, err := s.handlers.RedeemInvite(user.ID, code)
+		switch {
+		case errors.Is(err, ErrInviteInvalid):
+			http.Error(w, "Invalid or expired invite code", http.StatusNotFound)
+			return
+		case errors.Is(err, ErrInviteBanned):
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		case err != nil:
+			log.Printf("Failed to redeem invite %s: %v", code, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("User %s joined server %s via invite %s", user.ID, server.ID, code)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"server": server,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleMetrics reports connection counters in the Prometheus text format to
+// scrapers sending "Authorization: Bearer <metrics_token>". It shares the
+// public listener, so it isn't served at all without a token configured.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if s.config.MetricsToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.config.MetricsToken)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.admission.writeMetrics(w)
+}
+
 // handleHealth returns server health status
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/concord-chat/concord/internal/protocol"
+)
+
+const (
+	// Number of dispatches kept per session for replay on RESUME
+	sessionBufferSize = 128
+
+	// How long a disconnected session can still be resumed
+	sessionResumeWindow = 2 * time.Minute
+)
+
+// Session tracks the dispatches delivered to one authenticated connection so a
+// client that drops off briefly can RESUME and receive what it missed.
+// While detached (no live client), the hub keeps buffering events for the
+// servers and channels the session was subscribed to.
+type Session struct {
+	ID     string
+	UserID uuid.UUID
+
+	// Live connection, nil while detached
+	client *Client
+
+	// Subscriptions captured at detach time, used to buffer events while offline
+	serverIDs  map[uuid.UUID]bool
+	channelIDs map[uuid.UUID]bool
+	detachedAt time.Time
+
+	// Ring buffer of dispatches in delivery order
+	buffer  []sessionEvent
+	start   int
+	count   int
+	evicted bool // true once the buffer has wrapped and dropped old dispatches
+
+	mu sync.Mutex
+}
+
+// sessionEvent is a buffered dispatch and, for channel broadcasts, the
+// channel it went to
+type sessionEvent struct {
+	msg       *protocol.Message
+	channelID *uuid.UUID
+}
+
+// NewSession creates a session attached to client
+func NewSession(client *Client) *Session {
+	return &Session{
+		ID:     client.SessionID,
+		UserID: client.UserID,
+		client: client,
+		buffer: make([]sessionEvent, sessionBufferSize),
+	}
+}
+
+// record appends a dispatch to the ring buffer, evicting the oldest if full.
+// channelID is the channel a broadcast went to, or nil.
+func (s *Session) record(msg *protocol.Message, channelID *uuid.UUID) {
+	if msg.Seq == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event := sessionEvent{msg: msg, channelID: channelID}
+	if s.count < len(s.buffer) {
+		s.buffer[(s.start+s.count)%len(s.buffer)] = event
+		s.count++
+		return
+	}
+	s.buffer[s.start] = event
+	s.start = (s.start + 1) % len(s.buffer)
+	s.evicted = true
+}
+
+// since returns the dispatches delivered after the one with sequence lastSeq,
+// leaving out broadcasts to channels not in channels (nil keeps them all).
+// ok is false if lastSeq is no longer in the buffer, meaning events were lost.
+func (s *Session) since(lastSeq int64, channels map[uuid.UUID]bool) (missed []*protocol.Message, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Nothing has been received yet and nothing was dropped: replay everything
+	if lastSeq == 0 && !s.evicted {
+		ok = true
+	}
+	for i := 0; i < s.count; i++ {
+		event := s.buffer[(s.start+i)%len(s.buffer)]
+		switch {
+		case !ok:
+			ok = *event.msg.Seq == lastSeq
+		case event.channelID == nil || channels == nil || channels[*event.channelID]:
+			missed = append(missed, event.msg)
+		}
+	}
+	return missed, ok
+}
+
+// detach marks the session as disconnected and remembers its subscriptions.
+// It is a no-op if the session has already been resumed on another connection.
+func (s *Session) detach(client *Client, serverIDs, channelIDs []uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client != client {
+		return
+	}
+	s.client = nil
+	s.detachedAt = time.Now()
+	s.serverIDs = idSet(serverIDs)
+	s.channelIDs = idSet(channelIDs)
+}
+
+// resubscribe detaches the session from whatever connection it has and
+// buffers events for the given subscriptions instead, so a resuming client
+// catches up on what it may see now rather than what it saw before
+func (s *Session) resubscribe(serverIDs, channelIDs []uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.client = nil
+	s.detachedAt = time.Now()
+	s.serverIDs = idSet(serverIDs)
+	s.channelIDs = idSet(channelIDs)
+}
+
+// attach binds the session to a new live connection
+func (s *Session) attach(client *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.client = client
+	s.detachedAt = time.Time{}
+	s.serverIDs = nil
+	s.channelIDs = nil
+}
+
+// wants reports whether a detached session should buffer a broadcast
+func (s *Session) wants(msg *BroadcastMessage) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client != nil {
+		return false
+	}
+	if msg.ExcludeUserID != nil && *msg.ExcludeUserID == s.UserID {
+		return false
+	}
+	switch {
+	case msg.UserID != nil:
+		return *msg.UserID == s.UserID
+	case msg.ServerID != nil:
+		return s.serverIDs[*msg.ServerID]
+	case msg.ChannelID != nil:
+		return s.channelIDs[*msg.ChannelID]
+	}
+	return false
+}
+
+// expired reports whether a detached session is past the resume window
+func (s *Session) expired() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.client == nil && time.Since(s.detachedAt) > sessionResumeWindow
+}
+
+// idSet builds a lookup set of IDs
+func idSet(ids []uuid.UUID) map[uuid.UUID]bool {
+	set := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
@@ -0,0 +1,312 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/concord-chat/concord/internal/models"
+	"github.com/concord-chat/concord/internal/protocol"
+	"github.com/google/uuid"
+)
+
+// testEvent is the payload of the dispatches these tests broadcast
+type testEvent struct {
+	Content string `json:"content"`
+}
+
+func seqDispatch(t *testing.T, seq int64) *protocol.Message {
+	t.Helper()
+	msg, err := protocol.NewDispatch(protocol.EventMessageCreate, seq, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func seqs(missed []*protocol.Message) []int64 {
+	out := make([]int64, len(missed))
+	for i, msg := range missed {
+		out[i] = *msg.Seq
+	}
+	return out
+}
+
+func TestSessionRing(t *testing.T) {
+	s := NewSession(&Client{SessionID: "s", UserID: uuid.New()})
+	for seq := int64(1); seq <= sessionBufferSize; seq++ {
+		s.record(seqDispatch(t, seq), nil)
+	}
+	if missed, ok := s.since(0, nil); !ok || len(missed) != sessionBufferSize {
+		t.Fatalf("since(0) before wrapping = %d dispatches, %v", len(missed), ok)
+	}
+
+	// Wrap the ring: 1-32 are evicted, 33-160 kept
+	for seq := int64(sessionBufferSize + 1); seq <= sessionBufferSize+32; seq++ {
+		s.record(seqDispatch(t, seq), nil)
+	}
+	tests := []struct {
+		lastSeq int64
+		ok      bool
+		first   int64 // First replayed sequence
+		count   int
+	}{
+		{0, false, 0, 0},    // Something was dropped, so a fresh client can't catch up
+		{10, false, 0, 0},   // Evicted
+		{32, false, 0, 0},   // The last evicted one
+		{33, true, 34, 127}, // The oldest kept
+		{150, true, 151, 10},
+		{160, true, 0, 0},  // Up to date
+		{999, false, 0, 0}, // Never sent
+	}
+	for _, tt := range tests {
+		missed, ok := s.since(tt.lastSeq, nil)
+		if ok != tt.ok || len(missed) != tt.count {
+			t.Errorf("since(%d) = %d dispatches, %v; want %d, %v", tt.lastSeq, len(missed), ok, tt.count, tt.ok)
+			continue
+		}
+		if tt.count > 0 && *missed[0].Seq != tt.first {
+			t.Errorf("since(%d) starts at %d, want %d", tt.lastSeq, *missed[0].Seq, tt.first)
+		}
+	}
+
+	// Dispatches without a sequence aren't kept
+	s.record(&protocol.Message{Op: protocol.OpHeartbeatAck}, nil)
+	if missed, _ := s.since(160, nil); len(missed) != 0 {
+		t.Errorf("unsequenced message was buffered")
+	}
+}
+
+func TestSessionSinceFiltersChannels(t *testing.T) {
+	s := NewSession(&Client{SessionID: "s", UserID: uuid.New()})
+	kept, lost := uuid.New(), uuid.New()
+	s.record(seqDispatch(t, 1), nil)
+	s.record(seqDispatch(t, 2), &kept)
+	s.record(seqDispatch(t, 3), &lost)
+	s.record(seqDispatch(t, 4), nil)
+
+	if missed, ok := s.since(1, map[uuid.UUID]bool{kept: true}); !ok || !equalSeqs(seqs(missed), 2, 4) {
+		t.Errorf("filtered replay = %v, %v; want [2 4]", seqs(missed), ok)
+	}
+	if missed, ok := s.since(1, nil); !ok || !equalSeqs(seqs(missed), 2, 3, 4) {
+		t.Errorf("unfiltered replay = %v, %v; want [2 3 4]", seqs(missed), ok)
+	}
+	// A filtered dispatch still marks the client's position
+	if missed, ok := s.since(3, map[uuid.UUID]bool{}); !ok || !equalSeqs(seqs(missed), 4) {
+		t.Errorf("replay after a filtered dispatch = %v, %v; want [4]", seqs(missed), ok)
+	}
+}
+
+func equalSeqs(got []int64, want ...int64) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSessionExpiry(t *testing.T) {
+	hub := NewHub()
+	client := &Client{SessionID: "s", UserID: uuid.New()}
+	hub.StartSession(client)
+	s := hub.sessions["s"]
+
+	if s.expired() {
+		t.Fatal("attached session expired")
+	}
+	// A superseded connection doesn't detach the session
+	s.detach(&Client{SessionID: "s", UserID: client.UserID}, nil, nil)
+	s.detachedAt = time.Now().Add(-time.Hour)
+	if s.expired() {
+		t.Fatal("session detached by another connection")
+	}
+
+	s.detach(client, nil, nil)
+	if s.expired() {
+		t.Error("session expired as soon as it was detached")
+	}
+	s.detachedAt = time.Now().Add(-sessionResumeWindow + time.Second)
+	hub.expireSessions()
+	if hub.sessions["s"] == nil {
+		t.Fatal("session dropped inside the resume window")
+	}
+
+	s.detachedAt = time.Now().Add(-sessionResumeWindow - time.Second)
+	hub.expireSessions()
+	if hub.sessions["s"] != nil {
+		t.Fatal("session kept past the resume window")
+	}
+	if hub.ResumeSession(&Client{SessionID: "s", UserID: client.UserID}, 0, nil) {
+		t.Error("expired session was resumed")
+	}
+}
+
+// events returns the contents of the dispatches queued for c, in order
+func events(t *testing.T, c *Client) []string {
+	t.Helper()
+	var out []string
+	for {
+		select {
+		case msg, ok := <-c.send:
+			if !ok {
+				return out
+			}
+			var e testEvent
+			if msg.Op == protocol.OpDispatch && json.Unmarshal(msg.Data, &e) == nil && e.Content != "" {
+				out = append(out, e.Content)
+			}
+		default:
+			return out
+		}
+	}
+}
+
+func TestResumeReplaysVisibleEvents(t *testing.T) {
+	ts := newTestServer(t)
+	hub := ts.h.hub
+	alice := ts.addMember(t, "alice")
+	lounge := models.NewTextChannel(ts.server.ID, "lounge")
+	if err := ts.db.CreateChannel(lounge); err != nil {
+		t.Fatal(err)
+	}
+
+	c := ts.online(t, alice)
+	c.SessionID = "alice-session"
+	hub.StartSession(c)
+	hub.JoinChannel(alice.ID, ts.general.ID)
+	hub.JoinChannel(alice.ID, lounge.ID)
+	hub.BroadcastToChannel(ts.general.ID, protocol.EventMessageCreate, &testEvent{"seen"}, nil)
+	ts.flush()
+	if got := events(t, c); len(got) != 1 {
+		t.Fatalf("live events = %v", got)
+	}
+	lastSeq := hub.sequence
+
+	// Dropped: events keep being buffered for both channels
+	hub.unregisterClient(c)
+	hub.BroadcastToChannel(ts.general.ID, protocol.EventMessageCreate, &testEvent{"general"}, nil)
+	hub.BroadcastToChannel(lounge.ID, protocol.EventMessageCreate, &testEvent{"lounge"}, nil)
+	hub.SendToUser(alice.ID, protocol.EventMessageCreate, &testEvent{"direct"})
+	ts.flush()
+
+	// Meanwhile alice lost access to the lounge, so it isn't resubscribed
+	r := ts.connect(alice)
+	r.SessionID = c.SessionID
+	r.ServerIDs = c.ServerIDs
+	if !hub.ResumeSession(r, lastSeq, []uuid.UUID{ts.general.ID}) {
+		t.Fatal("resume failed")
+	}
+	if got := events(t, r); !equalStrings(got, "general", "direct") {
+		t.Errorf("replayed %v, want [general direct]", got)
+	}
+	if hub.IsInChannel(alice.ID, lounge.ID) || !hub.IsInChannel(alice.ID, ts.general.ID) {
+		t.Error("resume subscribed to the wrong channels")
+	}
+
+	// Live delivery picks up after the replay
+	hub.BroadcastToChannel(lounge.ID, protocol.EventMessageCreate, &testEvent{"lounge again"}, nil)
+	hub.BroadcastToChannel(ts.general.ID, protocol.EventMessageCreate, &testEvent{"live"}, nil)
+	ts.flush()
+	if got := events(t, r); !equalStrings(got, "live") {
+		t.Errorf("live events after resume = %v, want [live]", got)
+	}
+
+	// Another user can't take the session over
+	bob := ts.connect(ts.addMember(t, "bob"))
+	bob.SessionID = c.SessionID
+	if hub.ResumeSession(bob, lastSeq, nil) {
+		t.Error("resumed another user's session")
+	}
+}
+
+func TestResumeFallsBackToIdentify(t *testing.T) {
+	ts := newTestServer(t)
+	hub := ts.h.hub
+	alice := ts.addMember(t, "alice")
+	token := "alice-token"
+	if _, err := ts.db.CreateSession(alice.ID, hashToken(token), "127.0.0.1", "test", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	newClient := func() *Client {
+		return &Client{
+			hub:      hub,
+			send:     make(chan *protocol.Message, sendBufferSize),
+			handlers: ts.h,
+			limiter:  newRateLimiter(),
+		}
+	}
+	identify := func(c *Client) string {
+		t.Helper()
+		c.handleIdentify(request(t, protocol.OpIdentify, &protocol.IdentifyPayload{Token: token}))
+		ts.flush()
+		for {
+			select {
+			case msg := <-c.send:
+				if msg.Op == protocol.OpReady {
+					var ready protocol.ReadyPayload
+					if err := json.Unmarshal(msg.Data, &ready); err != nil {
+						t.Fatal(err)
+					}
+					return ready.SessionID
+				}
+			default:
+				t.Fatal("no READY after IDENTIFY")
+			}
+		}
+	}
+
+	c := newClient()
+	sessionID := identify(c)
+	events(t, c)
+	firstSeq := hub.sequence + 1
+
+	// More dispatches than the session keeps, then the connection drops
+	for i := 0; i < sessionBufferSize+10; i++ {
+		hub.SendToUser(alice.ID, protocol.EventMessageCreate, &testEvent{"filler"})
+		ts.flush()
+		events(t, c)
+	}
+	hub.unregisterClient(c)
+
+	r := newClient()
+	r.handleResume(request(t, protocol.OpResume, &protocol.ResumePayload{
+		Token: token, SessionID: sessionID, Seq: firstSeq,
+	}))
+	var invalid *protocol.InvalidSessionPayload
+	for len(r.send) > 0 {
+		msg := <-r.send
+		if msg.Op == protocol.OpInvalidSession {
+			invalid = &protocol.InvalidSessionPayload{}
+			if err := json.Unmarshal(msg.Data, invalid); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if invalid == nil || invalid.Resumable {
+		t.Fatalf("resume past the buffer: got %+v, want a non-resumable INVALID_SESSION", invalid)
+	}
+	if r.IsAuthenticated() || hub.sessions[sessionID] != nil {
+		t.Error("failed resume left the client or the session behind")
+	}
+
+	// The same socket can IDENTIFY for a full READY
+	if id := identify(r); id == "" || id == sessionID {
+		t.Errorf("READY after a failed resume has session %q", id)
+	}
+}
+
+func equalStrings(got []string, want ...string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
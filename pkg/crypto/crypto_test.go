@@ -0,0 +1,102 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+)
+
+// Cheap argon2id parameters; the cost doesn't change what is being tested
+func testKey(passphrase string, salt []byte) []byte {
+	return DeriveKey(passphrase, salt, 1, 64, 1)
+}
+
+func TestDeriveKey(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	key := testKey("passphrase", salt)
+	if len(key) != 32 {
+		t.Fatalf("key is %d bytes, want 32", len(key))
+	}
+	if !bytes.Equal(key, testKey("passphrase", salt)) {
+		t.Error("same passphrase and salt gave different keys")
+	}
+	if bytes.Equal(key, testKey("Passphrase", salt)) {
+		t.Error("different passphrases gave the same key")
+	}
+	if bytes.Equal(key, testKey("passphrase", []byte("fedcba9876543210"))) {
+		t.Error("different salts gave the same key")
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	key := testKey("passphrase", []byte("0123456789abcdef"))
+	tests := []struct {
+		name      string
+		plaintext []byte
+	}{
+		{"empty", []byte{}},
+		{"token", []byte("a1b2c3d4e5f6")},
+		{"binary", []byte{0, 1, 2, 255, 254}},
+		{"long", bytes.Repeat([]byte("x"), 4096)},
+	}
+	for _, tt := range tests {
+		sealed, err := Seal(key, tt.plaintext)
+		if err != nil {
+			t.Fatalf("%s: seal: %v", tt.name, err)
+		}
+		if len(tt.plaintext) > 0 && bytes.Contains([]byte(sealed), tt.plaintext) {
+			t.Errorf("%s: sealed value contains the plaintext", tt.name)
+		}
+		got, err := Open(key, sealed)
+		if err != nil {
+			t.Errorf("%s: open: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.plaintext) {
+			t.Errorf("%s: opened %q, want %q", tt.name, got, tt.plaintext)
+		}
+	}
+
+	// A fresh nonce each time, so equal secrets don't look equal on disk
+	a, _ := Seal(key, []byte("same"))
+	b, _ := Seal(key, []byte("same"))
+	if a == b {
+		t.Error("sealing twice gave the same value")
+	}
+}
+
+func TestOpenRejects(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	key := testKey("passphrase", salt)
+	sealed, err := Seal(key, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := base64.StdEncoding.DecodeString(sealed)
+	flip := func(i int) string {
+		data := append([]byte(nil), raw...)
+		data[i] ^= 1
+		return base64.StdEncoding.EncodeToString(data)
+	}
+
+	tests := []struct {
+		name   string
+		key    []byte
+		sealed string
+	}{
+		{"wrong passphrase", testKey("passphrase!", salt), sealed},
+		{"wrong salt", testKey("passphrase", []byte("fedcba9876543210")), sealed},
+		{"tampered nonce", key, flip(0)},
+		{"tampered ciphertext", key, flip(len(raw) / 2)},
+		{"tampered tag", key, flip(len(raw) - 1)},
+		{"truncated", key, base64.StdEncoding.EncodeToString(raw[:len(raw)-1])},
+		{"shorter than a nonce", key, base64.StdEncoding.EncodeToString(raw[:4])},
+		{"not base64", key, "not base64!"},
+		{"bad key length", key[:7], sealed},
+	}
+	for _, tt := range tests {
+		if got, err := Open(tt.key, tt.sealed); err == nil {
+			t.Errorf("%s: opened %q", tt.name, got)
+		}
+	}
+}